@@ -0,0 +1,57 @@
+package admintoken
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	set, err := Parse(`[
+		{"name": "team-a", "token": "a-secret", "namespaces": ["team-a", "team-a-*"]},
+		{"name": "team-b", "token": "b-secret", "namespaces": ["team-b"]}
+	]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if set.Len() != 2 {
+		t.Fatalf("expected 2 tokens, got %d", set.Len())
+	}
+
+	tok := set.Lookup("a-secret")
+	if tok == nil || tok.Name != "team-a" {
+		t.Fatalf("expected team-a, got %+v", tok)
+	}
+	if !tok.Allows("team-a") || !tok.Allows("team-a-dev") {
+		t.Error("expected team-a namespaces to be allowed")
+	}
+	if tok.Allows("team-b") {
+		t.Error("expected team-b to be denied for team-a")
+	}
+	if set.Lookup("wrong") != nil || set.Lookup("") != nil {
+		t.Error("expected unknown tokens to be rejected")
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	set, err := Parse("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if set.Len() != 0 || set.Lookup("anything") != nil {
+		t.Error("expected empty set")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	invalid := []string{
+		`not json`,
+		`[{"token": "x", "namespaces": ["a"]}]`,
+		`[{"name": "a", "namespaces": ["a"]}]`,
+		`[{"name": "a", "token": "x"}]`,
+		`[{"name": "a", "token": "x", "namespaces": ["["]}]`,
+		`[{"name": "a", "token": "x", "namespaces": ["a"]}, {"name": "a", "token": "y", "namespaces": ["b"]}]`,
+		`[{"name": "a", "token": "x", "namespaces": ["a"]}, {"name": "b", "token": "x", "namespaces": ["b"]}]`,
+	}
+	for _, spec := range invalid {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error for %s", spec)
+		}
+	}
+}
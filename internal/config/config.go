@@ -5,31 +5,164 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/admintoken"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/httpclient"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/logging"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/routing"
 )
 
 // CommonConfig holds configuration shared between web and worker modes.
 type CommonConfig struct {
-	LogLevel     string
-	ValkeyAddr   string
-	ValkeyChannel string
+	LogLevel string
+	// LogFormat is json, text or logfmt.
+	LogFormat string
+	// LogOutput is stdout, stderr, file or syslog.
+	LogOutput string
+	// LogFile is the path written with the file output.
+	LogFile string
+	// LogFileMaxSize is the size in megabytes from which the log file is
+	// rotated; zero never rotates it.
+	LogFileMaxSize int
+	// LogFileMaxBackups is the number of rotated log files kept.
+	LogFileMaxBackups int
+	// LogSyslogAddr is the syslog server of the syslog output; empty uses
+	// the local syslog daemon.
+	LogSyslogAddr string
+	// HTTPProxyURL is the proxy for outbound HTTP calls. Empty uses the
+	// proxy environment variables.
+	HTTPProxyURL string
+	// NoProxy lists destinations reached without the proxy, in NO_PROXY
+	// syntax. Empty uses NO_PROXY.
+	NoProxy string
+	// PayloadStrictness is how unknown payload fields are handled: strict,
+	// warn or ignore.
+	PayloadStrictness string
+
+	ValkeyAddr     string
+	ValkeyChannel  string
 	ValkeyUsername string
 	ValkeyPassword string
-	ValkeyTLS    bool
+	ValkeyTLS      bool
+	// ValkeyDB is the database index selected on each connection.
+	ValkeyDB int
+	// ValkeyClientName is the name set on each connection, shown by CLIENT
+	// LIST. Empty uses kuberollouttrigger-<mode>/<version>.
+	ValkeyClientName string
 }
 
 // WebConfig holds configuration specific to the web mode.
 type WebConfig struct {
 	CommonConfig
-	ListenAddr        string
+	ListenAddr string
+	// AdminListenAddr serves /healthz, /metrics and /admin apart from
+	// /event. Empty serves every route on ListenAddr.
+	AdminListenAddr    string
 	GithubOIDCAudience string
-	GithubAllowedOrg  string
+	GithubAllowedOrg   string
+	// GithubOIDCIssuer is the issuer of the accepted tokens: github.com's or that of a GitHub Enterprise Server.
+	GithubOIDCIssuer string
+	// GithubOIDCJWKSURL overrides the JWKS URL derived from GithubOIDCIssuer.
+	GithubOIDCJWKSURL string
+	// OIDCIssuersSpec is the inline JSON list of issuers accepted besides GithubOIDCIssuer.
+	OIDCIssuersSpec string
+	// OIDCIssuersFile is the path to a JSON list of additional issuers.
+	OIDCIssuersFile string
+	// OIDCIssuers is the parsed list from OIDCIssuersSpec or OIDCIssuersFile.
+	OIDCIssuers        []oidc.IssuerConfig
 	AllowedImagePrefix string
 	// DevMode disables OIDC signature verification for local development.
 	DevMode bool
+	// OIDCClockSkew is the tolerance for clock differences with GitHub when checking token times.
+	OIDCClockSkew time.Duration
+	// OIDCMaxTokenLifetime is the longest a token may be valid for, from iat to exp. Zero disables the check.
+	OIDCMaxTokenLifetime time.Duration
+	// AuthFailureLogWindow aggregates repeated authentication failure warnings.
+	AuthFailureLogWindow time.Duration
+	// AuditLogOutput is where authentication audit records are written: none, stdout, stderr, file or syslog.
+	AuditLogOutput string
+	// AuditLogFile is the path written with the file audit log output.
+	AuditLogFile string
+	// ProtectedTags are tag patterns that are only accepted with a digest.
+	ProtectedTags []string
+	// AdminToken enables the /admin endpoints, authenticated with this bearer token.
+	AdminToken string
+	// AdminTokensFile is the path to a JSON list of namespace-scoped admin tokens.
+	AdminTokensFile string
+	// AdminTokens is the parsed set of scoped tokens from AdminTokensFile.
+	AdminTokens *admintoken.Set
+	// EventRateLimit is the average number of events per minute accepted per repository. Zero disables it.
+	EventRateLimit int
+	// EventRateBurst is the number of events a repository may send at once.
+	EventRateBurst int
+	// EventRateLimitBackend is where events are counted: "memory" per replica or "valkey" across replicas.
+	EventRateLimitBackend string
+	// IdempotencyKeyTTL is how long the Idempotency-Key of an accepted event is remembered. Zero ignores the header.
+	IdempotencyKeyTTL time.Duration
+	// LoadShedMaxInFlight is the number of event requests processed at once before others are shed. Zero disables it.
+	LoadShedMaxInFlight int
+	// LoadShedMaxHeapMB is the heap size in MiB beyond which event requests are shed. Zero disables it.
+	LoadShedMaxHeapMB int
+	// ReadOnly starts the web mode rejecting events with 503 for planned Valkey maintenance.
+	ReadOnly bool
+	// OPAURL is the Open Policy Agent decision URL that authorizes events. Empty disables it.
+	OPAURL string
+	// OPATimeout bounds each policy decision request.
+	OPATimeout time.Duration
+	// HeartbeatInterval is how often a heartbeat is published for workers. Zero disables it.
+	HeartbeatInterval time.Duration
+	// ValkeyPingInterval is how often the web pings Valkey to detect a lost connection. Zero disables it.
+	ValkeyPingInterval time.Duration
+	// ChannelRoutesSpec is the inline JSON table routing events to Valkey channels.
+	ChannelRoutesSpec string
+	// ChannelRoutesFile is the path to a JSON channel routing table file.
+	ChannelRoutesFile string
+	// ChannelRoutes is the parsed table from ChannelRoutesSpec or ChannelRoutesFile.
+	ChannelRoutes *routing.ChannelTable
+	// GitHubWebhookSecret verifies GitHub deployment webhooks. Empty disables the webhook endpoint.
+	GitHubWebhookSecret string
+	// DeploymentEnvironmentRoutesSpec is the inline JSON table mapping GitHub deployment environments to rollouts.
+	DeploymentEnvironmentRoutesSpec string
+	// DeploymentEnvironmentRoutesFile is the path to a JSON deployment environment table file.
+	DeploymentEnvironmentRoutesFile string
+	// DeploymentEnvironmentRoutes is the parsed table from DeploymentEnvironmentRoutesSpec or DeploymentEnvironmentRoutesFile.
+	DeploymentEnvironmentRoutes *routing.EnvironmentTable
+	// MessageCompression is the encoding of published messages: "none" or "gzip".
+	MessageCompression string
+	// MessageCompressionMinSize is the message size in bytes from which messages are compressed.
+	MessageCompressionMinSize int
+	// FaultValkeyPublishRate is the share of Valkey publishes failed on purpose. Dev mode only.
+	FaultValkeyPublishRate float64
+	// FaultJWKSRate is the share of token validations failed as JWKS outages. Dev mode only.
+	FaultJWKSRate float64
+	// JWKSProxyURL is the proxy for JWKS fetches. Empty uses HTTPProxyURL.
+	JWKSProxyURL string
+	// JWKSCAFile is a PEM bundle of extra CA certificates trusted for JWKS fetches.
+	JWKSCAFile string
+	// JWKSCacheFile persists fetched JWKS keys to validate tokens after a restart during a JWKS outage.
+	JWKSCacheFile string
+	// JWKSCacheMaxAge is the maximum age of keys read back from JWKSCacheFile.
+	JWKSCacheMaxAge time.Duration
+	// PublishRequireReceivers fails requests with 503 when no worker received the published message.
+	PublishRequireReceivers bool
+	// EventSchemaValidation validates event payloads against the event JSON Schema.
+	EventSchemaValidation bool
 }
 
 // WorkerConfig holds configuration specific to the worker mode.
@@ -37,6 +170,177 @@ type WorkerConfig struct {
 	CommonConfig
 	AllowedImagePrefix string
 	Kubeconfig         string
+	// KubeContext selects a kubeconfig context other than the current one.
+	KubeContext string
+	// KubeAPIServer overrides the Kubernetes API server URL.
+	KubeAPIServer string
+	// KubeBearerToken overrides the Kubernetes credentials with a static token.
+	KubeBearerToken string
+	// KubeBearerTokenFile overrides the Kubernetes credentials with a token file.
+	KubeBearerTokenFile string
+	// KubeCAFile overrides the CA bundle used to verify the API server.
+	KubeCAFile string
+	// KubeExecTimeout bounds how long a kubeconfig exec credential plugin may run.
+	KubeExecTimeout time.Duration
+	// KubeUserAgent identifies the worker on Kubernetes API requests. Empty uses kuberollouttrigger-worker/<version>.
+	KubeUserAgent string
+	// KubeAs impersonates this user or service account on Kubernetes API requests.
+	KubeAs string
+	// KubeAsGroups are the groups of the impersonated user.
+	KubeAsGroups []string
+	// KubeTenantImpersonation patches each namespace's workloads as the tenant service account annotated on the namespace.
+	KubeTenantImpersonation bool
+	// KubeTenantServiceAccount is the service account impersonated in namespaces without the annotation.
+	KubeTenantServiceAccount string
+	// KubeNamespaces restricts the worker to these namespaces, each listed separately. Empty watches the whole cluster.
+	KubeNamespaces []string
+	// KubeLabelSelector restricts the Deployments and workloads listed to those it selects.
+	KubeLabelSelector string
+	// KubeListPageSize is the number of objects requested per page when listing. 0 lists in one request.
+	KubeListPageSize int
+	// KubeEvents emits a Kubernetes Event on each restarted Deployment.
+	KubeEvents bool
+	// KubePatchStrategy selects how the restart is applied: "merge" or "apply".
+	KubePatchStrategy string
+	// KubeFieldManager is the field manager used for server-side apply.
+	KubeFieldManager string
+	// KubeApplyForce takes ownership of conflicting fields during server-side apply.
+	KubeApplyForce bool
+	// RestartedAtFormat is the restart annotation value format: rfc3339, unix, or a Go time layout.
+	RestartedAtFormat string
+	// RestartInterval spaces out consecutive restarts triggered by a single event.
+	RestartInterval time.Duration
+	// MessageDedupeWindow drops a message identical to one received on the same channel within it. 0 disables.
+	MessageDedupeWindow time.Duration
+	// MessageTimeout cancels the handling of a message after it. 0 disables.
+	MessageTimeout time.Duration
+	// RestartConcurrency is the number of restarts of a single event in flight at once.
+	RestartConcurrency int
+	// SelfNamespace and SelfDeployment name the worker's own Deployment, which is restarted after the rest of an event.
+	SelfNamespace  string
+	SelfDeployment string
+	// KubePDBCheck defers restarts that would violate a PodDisruptionBudget or hit a degraded Deployment.
+	KubePDBCheck bool
+	// KubePDBRetryInterval is how often deferred restarts are retried.
+	KubePDBRetryInterval time.Duration
+	// KubePDBDeferTimeout is how long a deferred restart is retried before it is abandoned.
+	KubePDBDeferTimeout time.Duration
+	// TagRoutesSpec is the inline JSON routing table mapping tags to namespaces/selectors.
+	TagRoutesSpec string
+	// TagRoutesFile is the path to a JSON routing table file.
+	TagRoutesFile string
+	// TagRoutes is the parsed routing table from TagRoutesSpec or TagRoutesFile.
+	TagRoutes *routing.Table
+	// ValkeyChannels are event channels subscribed besides ValkeyChannel.
+	ValkeyChannels []string
+	// ValkeyChannelPattern is a pattern of event channels subscribed with PSUBSCRIBE. Empty disables it.
+	ValkeyChannelPattern string
+	// ChannelRulesSpec is the inline JSON table restricting the Deployments events of each channel may restart.
+	ChannelRulesSpec string
+	// ChannelRulesFile is the path to a JSON channel rules file.
+	ChannelRulesFile string
+	// ChannelRules is the parsed table from ChannelRulesSpec or ChannelRulesFile.
+	ChannelRules *routing.SubscriptionTable
+	// WorkloadKindsSpec is the inline JSON list of custom workload kinds to match.
+	WorkloadKindsSpec string
+	// WorkloadKindsFile is the path to a JSON file listing custom workload kinds.
+	WorkloadKindsFile string
+	// WorkloadKinds is the parsed list from WorkloadKindsSpec or WorkloadKindsFile.
+	WorkloadKinds []k8s.WorkloadKind
+	// MatchStrategies are the strategies deciding which workloads an image reference matches.
+	MatchStrategies []string
+	// TagRules normalize tags before image references are compared.
+	TagRules imageref.TagRules
+	// SemverChannels are the floating tags matched by the semver match strategy.
+	SemverChannels []string
+	// Matcher combines MatchStrategies.
+	Matcher k8s.Matcher
+	// RegistryUsername and RegistryPassword authenticate to the container registry.
+	RegistryUsername string
+	RegistryPassword string
+	// ExplainMatches logs why each Deployment running the event's image did or did not match.
+	ExplainMatches bool
+	// StartupBackfill restarts Deployments whose tag was pushed while the worker was down.
+	StartupBackfill bool
+	// StartPaused starts the worker paused, holding messages until resumed through the admin API.
+	StartPaused bool
+	// StartupPrefixCheck counts Deployments under AllowedImagePrefix at startup and warns if there are none.
+	StartupPrefixCheck bool
+	// InventoryResyncInterval is how often the Deployment inventory metrics are refreshed. Zero disables it.
+	InventoryResyncInterval time.Duration
+	// RegistryVerify checks that each image:tag exists in the registry before restarting.
+	RegistryVerify bool
+	// RegistryWaitTimeout is how long to keep polling for a missing image:tag before skipping it.
+	RegistryWaitTimeout time.Duration
+	// RegistryPlatformDigests also accepts the per-platform digests listed by a multi-platform image index.
+	RegistryPlatformDigests bool
+	// CosignPublicKeyFile enables cosign signature verification against the PEM keys in the file.
+	CosignPublicKeyFile string
+	// NamespaceDigestPolicy only restarts workloads in namespaces annotated to require a digest for events carrying one.
+	NamespaceDigestPolicy bool
+	// AnnotationGCMaxAge removes trigger annotations from Deployments restarted longer ago. Zero disables cleanup.
+	AnnotationGCMaxAge time.Duration
+	// AnnotationGCInterval is how often the trigger annotation cleanup runs.
+	AnnotationGCInterval time.Duration
+	// HealthListenAddr serves the worker's /healthz and /readyz endpoints. Empty disables them.
+	HealthListenAddr string
+	// HeartbeatTimeout alarms when no web heartbeat arrives for this long. Zero disables it.
+	HeartbeatTimeout time.Duration
+	// SubscriberBufferSize is the number of received messages held while the handler is busy.
+	SubscriberBufferSize int
+	// SubscriberHealthCheckInterval is how often the idle subscription connection is pinged.
+	SubscriberHealthCheckInterval time.Duration
+	// SubscriberOverflow is what happens when the buffer is full: "block" or "drop_oldest".
+	SubscriberOverflow string
+	// NotifyWebhookURL receives restart notifications for namespaces without a webhook of their own.
+	NotifyWebhookURL string
+	// NotifyNamespaceAnnotations routes restart notifications to the webhook annotated on each namespace.
+	NotifyNamespaceAnnotations bool
+	// NotifyAllowedHosts are the hosts a namespace annotated webhook may point to.
+	NotifyAllowedHosts []string
+	// NotifyTimeout bounds each notification webhook request.
+	NotifyTimeout time.Duration
+	// GitHubReport reports rollouts to the triggering repository: "status", "deployment", or empty to disable.
+	GitHubReport string
+	// GitHubAPIURL is the GitHub REST API base URL.
+	GitHubAPIURL string
+	// GitHubAppID identifies the GitHub App reporting rollouts.
+	GitHubAppID int64
+	// GitHubAppInstallationID identifies the installation of the GitHub App.
+	GitHubAppInstallationID int64
+	// GitHubAppPrivateKey is the PEM encoded private key of the GitHub App.
+	GitHubAppPrivateKey string
+	// GitHubStatusContext is the context of reported commit statuses.
+	GitHubStatusContext string
+	// GitHubDeploymentEnvironment is the environment of reported GitHub Deployments.
+	GitHubDeploymentEnvironment string
+	// GitHubTimeout bounds each GitHub API request.
+	GitHubTimeout time.Duration
+	// DevMode allows fault injection for local development.
+	DevMode bool
+	// FaultKubeThrottleRate is the share of Kubernetes API requests answered with 429. Dev mode only.
+	FaultKubeThrottleRate float64
+}
+
+// E2EConfig holds configuration for the hidden e2e subcommand, which checks
+// delivery through running web and worker instances.
+type E2EConfig struct {
+	// WebURL is the base URL of a web instance running with DEV_MODE.
+	WebURL string
+	// Namespace holds the test Deployment.
+	Namespace string
+	// Image is the test Deployment image, without tag, under the allowed prefix.
+	Image string
+	// GithubOIDCAudience and GithubAllowedOrg are the claims of the dev mode tokens.
+	GithubOIDCAudience string
+	GithubAllowedOrg   string
+	// Events is the number of events published.
+	Events int
+	// EventTimeout is how long each event may take to restart the test Deployment.
+	EventTimeout time.Duration
+	Kubeconfig   string
+	KubeContext  string
+	LogLevel     string
 }
 
 func envOrDefault(key, defaultVal string) string {
@@ -46,32 +350,258 @@ func envOrDefault(key, defaultVal string) string {
 	return defaultVal
 }
 
+// envSecret returns the value of the environment variable key, or the
+// contents of the file named by key_FILE, which is how Kubernetes Secret
+// volumes are usually consumed. A single trailing newline is trimmed from the
+// file. Setting both variables, or an unreadable file, is appended to invalid.
+func envSecret(key string, invalid *[]string) string {
+	v := os.Getenv(key)
+	file := os.Getenv(key + "_FILE")
+	if file == "" {
+		return v
+	}
+	if v != "" {
+		*invalid = append(*invalid, fmt.Sprintf("%s and %s_FILE are mutually exclusive", key, key))
+		return v
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		*invalid = append(*invalid, fmt.Sprintf("%s_FILE: %v", key, err))
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+}
+
+// envDuration returns the duration parsed from the environment variable, or
+// defaultVal if it is unset. Unparseable values are appended to invalid so the
+// caller can fail fast with a clear error.
+func envDuration(key string, defaultVal time.Duration, invalid *[]string) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		*invalid = append(*invalid, fmt.Sprintf("%s=%q is not a valid duration", key, v))
+		return defaultVal
+	}
+	return d
+}
+
+// envInt returns the integer parsed from the environment variable, or
+// defaultVal if it is unset. Unparseable values are appended to invalid so the
+// caller can fail fast with a clear error.
+func envInt(key string, defaultVal int, invalid *[]string) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		*invalid = append(*invalid, fmt.Sprintf("%s=%q is not a valid integer", key, v))
+		return defaultVal
+	}
+	return n
+}
+
+// envFloat returns the number parsed from the environment variable, or
+// defaultVal if it is unset. Unparseable values are appended to invalid so the
+// caller can fail fast with a clear error.
+func envFloat(key string, defaultVal float64, invalid *[]string) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		*invalid = append(*invalid, fmt.Sprintf("%s=%q is not a valid number", key, v))
+		return defaultVal
+	}
+	return f
+}
+
+// validateFaultRate appends an error to invalid unless rate is between 0 and
+// 1, and zero outside dev mode.
+func validateFaultRate(name string, rate float64, devMode bool, invalid *[]string) {
+	if rate < 0 || rate > 1 {
+		*invalid = append(*invalid, fmt.Sprintf("%s must be between 0 and 1", name))
+	} else if rate > 0 && !devMode {
+		*invalid = append(*invalid, fmt.Sprintf("%s requires DEV_MODE / --dev-mode", name))
+	}
+}
+
+// splitList splits a comma-separated list, trimming whitespace and dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func envBool(key string) bool {
 	v := os.Getenv(key)
 	return strings.EqualFold(v, "true") || v == "1"
 }
 
+// registerLogFlags registers the log output flags shared by the web and
+// worker modes.
+func registerLogFlags(fs *flag.FlagSet, c *CommonConfig, invalid *[]string) {
+	fs.StringVar(&c.LogFormat, "log-format", envOrDefault("LOG_FORMAT", logging.FormatJSON), "Log format (json, text, logfmt)")
+	fs.StringVar(&c.LogOutput, "log-output", envOrDefault("LOG_OUTPUT", logging.OutputStdout), "Log destination (stdout, stderr, file, syslog)")
+	fs.StringVar(&c.LogFile, "log-file", envOrDefault("LOG_FILE", ""), "Path of the log file written with --log-output=file")
+	fs.IntVar(&c.LogFileMaxSize, "log-file-max-size", envInt("LOG_FILE_MAX_SIZE", 100, invalid), "Size in megabytes from which the log file is rotated (0 never rotates)")
+	fs.IntVar(&c.LogFileMaxBackups, "log-file-max-backups", envInt("LOG_FILE_MAX_BACKUPS", 5, invalid), "Number of rotated log files kept")
+	fs.StringVar(&c.LogSyslogAddr, "log-syslog-addr", envOrDefault("LOG_SYSLOG_ADDR", ""), "Syslog server as udp://host:port or tcp://host:port (empty uses the local daemon)")
+}
+
+// registerProxyFlags registers the outbound proxy flags shared by the web
+// and worker modes.
+func registerProxyFlags(fs *flag.FlagSet, c *CommonConfig) {
+	fs.StringVar(&c.HTTPProxyURL, "http-proxy", envOrDefault("OUTBOUND_HTTP_PROXY", ""), "Proxy URL for outbound HTTP calls (empty uses HTTPS_PROXY and HTTP_PROXY)")
+	fs.StringVar(&c.NoProxy, "no-proxy", envOrDefault("OUTBOUND_NO_PROXY", ""), "Comma-separated hosts, domains and CIDR ranges reached without the proxy (empty uses NO_PROXY)")
+}
+
+// validateValkeyConfig appends a message to invalid for each invalid Valkey
+// connection setting.
+func validateValkeyConfig(c *CommonConfig, invalid *[]string) {
+	if c.ValkeyDB < 0 {
+		*invalid = append(*invalid, "VALKEY_DB / --valkey-db must not be negative")
+	}
+	if c.ValkeyClientName != "" && !clientNamePattern.MatchString(c.ValkeyClientName) {
+		*invalid = append(*invalid, fmt.Sprintf("VALKEY_CLIENT_NAME / --valkey-client-name %q must not contain spaces or special characters", c.ValkeyClientName))
+	}
+}
+
+// clientNamePattern matches the connection names Valkey accepts: printable
+// ASCII without spaces.
+var clientNamePattern = regexp.MustCompile(`^[!-~]+$`)
+
+// validateProxyConfig appends a message to invalid if the outbound proxy
+// URL is invalid.
+func validateProxyConfig(c *CommonConfig, invalid *[]string) {
+	if err := c.HTTPClientOptions(0).Validate(); err != nil {
+		*invalid = append(*invalid, fmt.Sprintf("OUTBOUND_HTTP_PROXY / --http-proxy: %v", err))
+	}
+}
+
+// HTTPClientOptions returns the options for an outbound HTTP client with
+// the given timeout.
+func (c *CommonConfig) HTTPClientOptions(timeout time.Duration) httpclient.Options {
+	return httpclient.Options{
+		Timeout:  timeout,
+		ProxyURL: c.HTTPProxyURL,
+		NoProxy:  c.NoProxy,
+	}
+}
+
+// validateLogConfig appends a message to invalid for each invalid log
+// output setting.
+func validateLogConfig(c *CommonConfig, invalid *[]string) {
+	switch c.LogFormat {
+	case logging.FormatJSON, logging.FormatText, logging.FormatLogfmt:
+	default:
+		*invalid = append(*invalid, fmt.Sprintf("LOG_FORMAT / --log-format must be json, text or logfmt, got %q", c.LogFormat))
+	}
+	switch c.LogOutput {
+	case logging.OutputStdout, logging.OutputStderr, logging.OutputSyslog:
+	case logging.OutputFile:
+		if c.LogFile == "" {
+			*invalid = append(*invalid, "LOG_FILE / --log-file is required with LOG_OUTPUT=file")
+		}
+	default:
+		*invalid = append(*invalid, fmt.Sprintf("LOG_OUTPUT / --log-output must be stdout, stderr, file or syslog, got %q", c.LogOutput))
+	}
+	if c.LogFileMaxSize < 0 {
+		*invalid = append(*invalid, "LOG_FILE_MAX_SIZE / --log-file-max-size must not be negative")
+	}
+	if c.LogFileMaxBackups < 0 {
+		*invalid = append(*invalid, "LOG_FILE_MAX_BACKUPS / --log-file-max-backups must not be negative")
+	}
+	if c.LogSyslogAddr != "" {
+		if u, err := url.Parse(c.LogSyslogAddr); err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			*invalid = append(*invalid, fmt.Sprintf("LOG_SYSLOG_ADDR / --log-syslog-addr %q must be udp://host:port or tcp://host:port", c.LogSyslogAddr))
+		}
+	}
+}
+
 // ParseWebConfig parses web mode configuration from env vars and CLI flags.
 func ParseWebConfig(args []string) (*WebConfig, error) {
+	cfg, _, err := parseWebConfig(args)
+	return cfg, err
+}
+
+// parseWebConfig parses the configuration like ParseWebConfig and also returns the
+// flag set, which is returned even when the configuration is invalid.
+func parseWebConfig(args []string) (*WebConfig, *flag.FlagSet, error) {
 	fs := flag.NewFlagSet("web", flag.ContinueOnError)
 
 	cfg := &WebConfig{}
+	var invalid []string
 	fs.StringVar(&cfg.LogLevel, "log-level", envOrDefault("LOG_LEVEL", "info"), "Log level (debug, info, warn, error)")
 	fs.StringVar(&cfg.ValkeyAddr, "valkey-addr", envOrDefault("VALKEY_ADDR", ""), "Valkey address (host:port)")
 	fs.StringVar(&cfg.ValkeyChannel, "valkey-channel", envOrDefault("VALKEY_CHANNEL", "kuberollouttrigger"), "Valkey PubSub channel")
 	fs.StringVar(&cfg.ValkeyUsername, "valkey-username", envOrDefault("VALKEY_USERNAME", ""), "Valkey username")
-	fs.StringVar(&cfg.ValkeyPassword, "valkey-password", envOrDefault("VALKEY_PASSWORD", ""), "Valkey password")
+	fs.StringVar(&cfg.ValkeyPassword, "valkey-password", envSecret("VALKEY_PASSWORD", &invalid), "Valkey password")
 	fs.BoolVar(&cfg.ValkeyTLS, "valkey-tls", envBool("VALKEY_TLS_ENABLED"), "Enable TLS for Valkey")
+	fs.IntVar(&cfg.ValkeyDB, "valkey-db", envInt("VALKEY_DB", 0, &invalid), "Valkey database index")
+	fs.StringVar(&cfg.ValkeyClientName, "valkey-client-name", envOrDefault("VALKEY_CLIENT_NAME", ""), "Connection name shown by CLIENT LIST (empty uses kuberollouttrigger-<mode>/<version>)")
+	registerLogFlags(fs, &cfg.CommonConfig, &invalid)
+	registerProxyFlags(fs, &cfg.CommonConfig)
+	fs.StringVar(&cfg.PayloadStrictness, "payload-strictness", envOrDefault("PAYLOAD_STRICTNESS", string(payload.StrictnessStrict)), "Handling of unknown payload fields (strict, warn, ignore)")
 
 	fs.StringVar(&cfg.ListenAddr, "listen-addr", envOrDefault("WEB_LISTEN_ADDR", ":8080"), "HTTP listen address")
+	fs.StringVar(&cfg.AdminListenAddr, "admin-listen-addr", envOrDefault("WEB_ADMIN_LISTEN_ADDR", ""), "Separate listen address for /healthz, /metrics and /admin (empty serves them on the listen address)")
 	fs.StringVar(&cfg.GithubOIDCAudience, "github-oidc-audience", envOrDefault("GITHUB_OIDC_AUDIENCE", ""), "Required OIDC audience")
 	fs.StringVar(&cfg.GithubAllowedOrg, "github-allowed-org", envOrDefault("GITHUB_ALLOWED_ORG", ""), "Allowed GitHub organization")
+	fs.StringVar(&cfg.GithubOIDCIssuer, "github-oidc-issuer", envOrDefault("GITHUB_OIDC_ISSUER", oidc.GitHubOIDCIssuer), "OIDC issuer of the accepted tokens, such as https://HOSTNAME/_services/token for GitHub Enterprise Server")
+	fs.StringVar(&cfg.GithubOIDCJWKSURL, "github-oidc-jwks-url", envOrDefault("GITHUB_OIDC_JWKS_URL", ""), "URL of the JWKS verifying tokens (empty uses <issuer>/.well-known/jwks)")
+	fs.StringVar(&cfg.OIDCIssuersSpec, "oidc-issuers", envOrDefault("OIDC_ISSUERS", ""), "JSON list of further accepted OIDC issuers, each with its own audience, allowed org and claim mapping")
+	fs.StringVar(&cfg.OIDCIssuersFile, "oidc-issuers-file", envOrDefault("OIDC_ISSUERS_FILE", ""), "Path to a JSON file with further accepted OIDC issuers")
 	fs.StringVar(&cfg.AllowedImagePrefix, "allowed-image-prefix", envOrDefault("ALLOWED_IMAGE_PREFIX", ""), "Allowed image prefix")
 	fs.BoolVar(&cfg.DevMode, "dev-mode", envBool("DEV_MODE"), "Enable dev mode (disables OIDC signature verification)")
+	fs.DurationVar(&cfg.OIDCClockSkew, "oidc-clock-skew", envDuration("OIDC_CLOCK_SKEW", 30*time.Second, &invalid), "Tolerance for clock differences with GitHub when checking token exp, nbf and iat")
+	fs.DurationVar(&cfg.OIDCMaxTokenLifetime, "oidc-max-token-lifetime", envDuration("OIDC_MAX_TOKEN_LIFETIME", time.Hour, &invalid), "Reject tokens valid for longer than this from iat to exp (0 disables)")
+	fs.DurationVar(&cfg.AuthFailureLogWindow, "auth-failure-log-window", envDuration("AUTH_FAILURE_LOG_WINDOW", time.Minute, &invalid), "Aggregate identical authentication failure warnings per window (0 logs every failure)")
+	fs.StringVar(&cfg.AuditLogOutput, "audit-log-output", envOrDefault("AUDIT_LOG_OUTPUT", logging.OutputStdout), "Destination of authentication audit records (none, stdout, stderr, file, syslog)")
+	fs.StringVar(&cfg.AuditLogFile, "audit-log-file", envOrDefault("AUDIT_LOG_FILE", ""), "Path of the audit log file written with --audit-log-output=file")
+	fs.StringVar(&cfg.AdminToken, "admin-token", envSecret("ADMIN_TOKEN", &invalid), "Bearer token for the /admin endpoints (empty disables them)")
+	fs.StringVar(&cfg.AdminTokensFile, "admin-tokens-file", envOrDefault("ADMIN_TOKENS_FILE", ""), "Path to a JSON file of namespace-scoped admin tokens")
+	fs.IntVar(&cfg.EventRateLimit, "event-rate-limit", envInt("EVENT_RATE_LIMIT", 0, &invalid), "Average events per minute accepted per repository (0 disables)")
+	fs.IntVar(&cfg.EventRateBurst, "event-rate-burst", envInt("EVENT_RATE_BURST", 10, &invalid), "Events a repository may send at once before the rate limit applies")
+	fs.StringVar(&cfg.EventRateLimitBackend, "event-rate-limit-backend", envOrDefault("EVENT_RATE_LIMIT_BACKEND", "memory"), "Where events are counted against the rate limit (memory per replica, valkey across replicas)")
+	fs.DurationVar(&cfg.IdempotencyKeyTTL, "idempotency-key-ttl", envDuration("IDEMPOTENCY_KEY_TTL", 10*time.Minute, &invalid), "How long the Idempotency-Key of an accepted event is remembered (0 ignores the header)")
+	fs.IntVar(&cfg.LoadShedMaxInFlight, "load-shed-max-in-flight", envInt("LOAD_SHED_MAX_IN_FLIGHT", 0, &invalid), "Event requests processed at once before others are rejected with 503 (0 disables)")
+	fs.IntVar(&cfg.LoadShedMaxHeapMB, "load-shed-max-heap-mb", envInt("LOAD_SHED_MAX_HEAP_MB", 0, &invalid), "Heap size in MiB beyond which event requests are rejected with 503 (0 disables)")
+	fs.BoolVar(&cfg.ReadOnly, "read-only", envBool("READ_ONLY"), "Start in read-only mode, rejecting events with 503 until disabled through the admin API")
+	fs.StringVar(&cfg.OPAURL, "opa-url", envOrDefault("OPA_URL", ""), "Open Policy Agent decision URL that authorizes events (empty disables)")
+	fs.DurationVar(&cfg.OPATimeout, "opa-timeout", envDuration("OPA_TIMEOUT", 2*time.Second, &invalid), "Timeout for each Open Policy Agent decision request")
+	fs.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", envDuration("HEARTBEAT_INTERVAL", 30*time.Second, &invalid), "How often to publish a heartbeat for workers (0 disables)")
+	fs.DurationVar(&cfg.ValkeyPingInterval, "valkey-ping-interval", envDuration("VALKEY_PING_INTERVAL", 10*time.Second, &invalid), "How often to ping Valkey to detect a lost connection (0 disables)")
+	fs.StringVar(&cfg.ChannelRoutesSpec, "channel-routes", envOrDefault("CHANNEL_ROUTES", ""), "JSON rules publishing events to other Valkey channels by image prefix or tag")
+	fs.StringVar(&cfg.ChannelRoutesFile, "channel-routes-file", envOrDefault("CHANNEL_ROUTES_FILE", ""), "Path to a JSON file with channel routing rules")
+	fs.StringVar(&cfg.GitHubWebhookSecret, "github-webhook-secret", envSecret("GITHUB_WEBHOOK_SECRET", &invalid), "Secret of the GitHub deployment webhook on /github/deployment (empty disables it)")
+	fs.StringVar(&cfg.DeploymentEnvironmentRoutesSpec, "deployment-environment-routes", envOrDefault("DEPLOYMENT_ENVIRONMENT_ROUTES", ""), "JSON rules mapping GitHub deployment environments to the tag and namespaces they roll out")
+	fs.StringVar(&cfg.DeploymentEnvironmentRoutesFile, "deployment-environment-routes-file", envOrDefault("DEPLOYMENT_ENVIRONMENT_ROUTES_FILE", ""), "Path to a JSON file with deployment environment rules")
+	fs.BoolVar(&cfg.EventSchemaValidation, "event-schema-validation", envBool("EVENT_SCHEMA_VALIDATION"), "Validate event payloads against the JSON Schema served at /schema/event.json")
+	fs.BoolVar(&cfg.PublishRequireReceivers, "publish-require-receivers", envBool("PUBLISH_REQUIRE_RECEIVERS"), "Fail requests with 503 when no worker is subscribed to receive the published message")
+	fs.StringVar(&cfg.MessageCompression, "message-compression", envOrDefault("MESSAGE_COMPRESSION", "none"), "Compression of published messages (none, gzip)")
+	fs.IntVar(&cfg.MessageCompressionMinSize, "message-compression-min-size", envInt("MESSAGE_COMPRESSION_MIN_SIZE", 1024, &invalid), "Message size in bytes from which messages are compressed")
+	var protectedTags string
+	fs.StringVar(&protectedTags, "protected-tags", envOrDefault("PROTECTED_TAGS", ""), "Comma-separated tag patterns that require a digest in the event")
+	fs.Float64Var(&cfg.FaultValkeyPublishRate, "fault-valkey-publish-rate", envFloat("FAULT_VALKEY_PUBLISH_RATE", 0, &invalid), "Share of Valkey publishes to fail on purpose, 0 to 1 (dev mode only)")
+	fs.Float64Var(&cfg.FaultJWKSRate, "fault-jwks-rate", envFloat("FAULT_JWKS_RATE", 0, &invalid), "Share of token validations to fail as JWKS outages, 0 to 1 (dev mode only)")
+	fs.StringVar(&cfg.JWKSProxyURL, "jwks-proxy-url", envOrDefault("JWKS_PROXY_URL", ""), "Proxy URL for fetching the GitHub JWKS (empty uses --http-proxy)")
+	fs.StringVar(&cfg.JWKSCAFile, "jwks-ca-file", envOrDefault("JWKS_CA_FILE", ""), "PEM file of extra CA certificates trusted when fetching the GitHub JWKS")
+	fs.StringVar(&cfg.JWKSCacheFile, "jwks-cache-file", envOrDefault("JWKS_CACHE_FILE", ""), "File persisting fetched JWKS keys, used when the JWKS cannot be fetched after a restart (empty disables)")
+	fs.DurationVar(&cfg.JWKSCacheMaxAge, "jwks-cache-max-age", envDuration("JWKS_CACHE_MAX_AGE", 24*time.Hour, &invalid), "Maximum age of JWKS keys read from --jwks-cache-file")
 
 	if err := fs.Parse(args); err != nil {
-		return nil, err
+		return nil, fs, err
 	}
+	cfg.ProtectedTags = splitList(protectedTags)
 
 	// Validate required fields
 	var missing []string
@@ -88,29 +618,233 @@ func ParseWebConfig(args []string) (*WebConfig, error) {
 		missing = append(missing, "ALLOWED_IMAGE_PREFIX / --allowed-image-prefix")
 	}
 	if len(missing) > 0 {
-		return nil, fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+		return nil, fs, fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+	if cfg.AdminListenAddr != "" && cfg.AdminListenAddr == cfg.ListenAddr {
+		invalid = append(invalid, "WEB_ADMIN_LISTEN_ADDR / --admin-listen-addr must differ from WEB_LISTEN_ADDR / --listen-addr")
+	}
+	if err := oidc.ValidateIssuerURL(cfg.GithubOIDCIssuer); err != nil {
+		invalid = append(invalid, fmt.Sprintf("GITHUB_OIDC_ISSUER / --github-oidc-issuer: %v", err))
+	}
+	if cfg.GithubOIDCJWKSURL != "" {
+		if u, err := url.Parse(cfg.GithubOIDCJWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid = append(invalid, fmt.Sprintf("GITHUB_OIDC_JWKS_URL / --github-oidc-jwks-url %q must be an http or https URL", cfg.GithubOIDCJWKSURL))
+		}
+	}
+	if cfg.OIDCClockSkew < 0 || cfg.OIDCClockSkew > 5*time.Minute {
+		invalid = append(invalid, "OIDC_CLOCK_SKEW / --oidc-clock-skew must be between 0s and 5m")
+	}
+	if cfg.OIDCMaxTokenLifetime < 0 {
+		invalid = append(invalid, "OIDC_MAX_TOKEN_LIFETIME / --oidc-max-token-lifetime must not be negative")
+	}
+	if cfg.AuthFailureLogWindow < 0 {
+		invalid = append(invalid, "AUTH_FAILURE_LOG_WINDOW / --auth-failure-log-window must not be negative")
+	}
+	validateAuditLogConfig(cfg, &invalid)
+	if cfg.EventRateLimit < 0 {
+		invalid = append(invalid, "EVENT_RATE_LIMIT / --event-rate-limit must not be negative")
+	}
+	if cfg.EventRateBurst < 1 {
+		invalid = append(invalid, "EVENT_RATE_BURST / --event-rate-burst must be at least 1")
+	}
+	if cfg.EventRateLimitBackend != "memory" && cfg.EventRateLimitBackend != "valkey" {
+		invalid = append(invalid, fmt.Sprintf("EVENT_RATE_LIMIT_BACKEND / --event-rate-limit-backend must be memory or valkey, got %q", cfg.EventRateLimitBackend))
+	}
+	if cfg.IdempotencyKeyTTL < 0 {
+		invalid = append(invalid, "IDEMPOTENCY_KEY_TTL / --idempotency-key-ttl must not be negative")
+	}
+	if cfg.LoadShedMaxInFlight < 0 {
+		invalid = append(invalid, "LOAD_SHED_MAX_IN_FLIGHT / --load-shed-max-in-flight must not be negative")
+	}
+	if cfg.LoadShedMaxHeapMB < 0 {
+		invalid = append(invalid, "LOAD_SHED_MAX_HEAP_MB / --load-shed-max-heap-mb must not be negative")
+	}
+	if cfg.OPAURL != "" {
+		if u, err := url.Parse(cfg.OPAURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid = append(invalid, fmt.Sprintf("OPA_URL / --opa-url %q must be an http or https URL", cfg.OPAURL))
+		}
+	}
+	if cfg.OPATimeout <= 0 {
+		invalid = append(invalid, "OPA_TIMEOUT / --opa-timeout must be positive")
+	}
+	if cfg.HeartbeatInterval < 0 {
+		invalid = append(invalid, "HEARTBEAT_INTERVAL / --heartbeat-interval must not be negative")
+	}
+	if cfg.ValkeyPingInterval < 0 {
+		invalid = append(invalid, "VALKEY_PING_INTERVAL / --valkey-ping-interval must not be negative")
+	}
+	if cfg.MessageCompression != "none" && cfg.MessageCompression != "gzip" {
+		invalid = append(invalid, fmt.Sprintf("MESSAGE_COMPRESSION / --message-compression must be none or gzip, got %q", cfg.MessageCompression))
+	}
+	if cfg.MessageCompressionMinSize < 1 {
+		invalid = append(invalid, "MESSAGE_COMPRESSION_MIN_SIZE / --message-compression-min-size must be at least 1")
+	}
+	validateFaultRate("FAULT_VALKEY_PUBLISH_RATE / --fault-valkey-publish-rate", cfg.FaultValkeyPublishRate, cfg.DevMode, &invalid)
+	validateFaultRate("FAULT_JWKS_RATE / --fault-jwks-rate", cfg.FaultJWKSRate, cfg.DevMode, &invalid)
+	if err := cfg.JWKSClientOptions().Validate(); err != nil {
+		invalid = append(invalid, fmt.Sprintf("JWKS_PROXY_URL / --jwks-proxy-url or JWKS_CA_FILE / --jwks-ca-file: %v", err))
+	}
+	if cfg.JWKSCacheFile != "" && cfg.JWKSCacheMaxAge <= 0 {
+		invalid = append(invalid, "JWKS_CACHE_MAX_AGE / --jwks-cache-max-age must be positive")
+	}
+	for _, pattern := range cfg.ProtectedTags {
+		if _, err := path.Match(pattern, ""); err != nil {
+			invalid = append(invalid, fmt.Sprintf("PROTECTED_TAGS / --protected-tags pattern %q: %v", pattern, err))
+		}
+	}
+	if cfg.ChannelRoutesSpec != "" && cfg.ChannelRoutesFile != "" {
+		invalid = append(invalid, "CHANNEL_ROUTES / --channel-routes and CHANNEL_ROUTES_FILE / --channel-routes-file are mutually exclusive")
+	}
+	channelsSpec := cfg.ChannelRoutesSpec
+	if cfg.ChannelRoutesFile != "" {
+		data, err := os.ReadFile(cfg.ChannelRoutesFile)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("CHANNEL_ROUTES_FILE / --channel-routes-file: %v", err))
+		}
+		channelsSpec = string(data)
+	}
+	channels, err := routing.ParseChannels(channelsSpec)
+	if err != nil {
+		invalid = append(invalid, err.Error())
+	}
+	cfg.ChannelRoutes = channels
+	validateDeploymentWebhookConfig(cfg, &invalid)
+	validateOIDCIssuersConfig(cfg, &invalid)
+	var tokensSpec string
+	if cfg.AdminTokensFile != "" {
+		data, err := os.ReadFile(cfg.AdminTokensFile)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("ADMIN_TOKENS_FILE / --admin-tokens-file: %v", err))
+		}
+		tokensSpec = string(data)
+	}
+	tokens, err := admintoken.Parse(tokensSpec)
+	if err != nil {
+		invalid = append(invalid, err.Error())
+	}
+	cfg.AdminTokens = tokens
+	validateLogConfig(&cfg.CommonConfig, &invalid)
+	validateProxyConfig(&cfg.CommonConfig, &invalid)
+	validateValkeyConfig(&cfg.CommonConfig, &invalid)
+	if _, err := payload.ParseStrictness(cfg.PayloadStrictness); err != nil {
+		invalid = append(invalid, fmt.Sprintf("PAYLOAD_STRICTNESS / --payload-strictness: %v", err))
+	}
+	if len(invalid) > 0 {
+		return nil, fs, fmt.Errorf("invalid configuration: %s", strings.Join(invalid, ", "))
 	}
 
-	return cfg, nil
+	return cfg, fs, nil
 }
 
 // ParseWorkerConfig parses worker mode configuration from env vars and CLI flags.
 func ParseWorkerConfig(args []string) (*WorkerConfig, error) {
+	cfg, _, err := parseWorkerConfig(args)
+	return cfg, err
+}
+
+// parseWorkerConfig parses the configuration like ParseWorkerConfig and also returns the
+// flag set, which is returned even when the configuration is invalid.
+func parseWorkerConfig(args []string) (*WorkerConfig, *flag.FlagSet, error) {
 	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
 
 	cfg := &WorkerConfig{}
+	var invalid []string
 	fs.StringVar(&cfg.LogLevel, "log-level", envOrDefault("LOG_LEVEL", "info"), "Log level (debug, info, warn, error)")
 	fs.StringVar(&cfg.ValkeyAddr, "valkey-addr", envOrDefault("VALKEY_ADDR", ""), "Valkey address (host:port)")
 	fs.StringVar(&cfg.ValkeyChannel, "valkey-channel", envOrDefault("VALKEY_CHANNEL", "kuberollouttrigger"), "Valkey PubSub channel")
 	fs.StringVar(&cfg.ValkeyUsername, "valkey-username", envOrDefault("VALKEY_USERNAME", ""), "Valkey username")
-	fs.StringVar(&cfg.ValkeyPassword, "valkey-password", envOrDefault("VALKEY_PASSWORD", ""), "Valkey password")
+	fs.StringVar(&cfg.ValkeyPassword, "valkey-password", envSecret("VALKEY_PASSWORD", &invalid), "Valkey password")
 	fs.BoolVar(&cfg.ValkeyTLS, "valkey-tls", envBool("VALKEY_TLS_ENABLED"), "Enable TLS for Valkey")
+	fs.IntVar(&cfg.ValkeyDB, "valkey-db", envInt("VALKEY_DB", 0, &invalid), "Valkey database index")
+	fs.StringVar(&cfg.ValkeyClientName, "valkey-client-name", envOrDefault("VALKEY_CLIENT_NAME", ""), "Connection name shown by CLIENT LIST (empty uses kuberollouttrigger-<mode>/<version>)")
+	registerLogFlags(fs, &cfg.CommonConfig, &invalid)
+	registerProxyFlags(fs, &cfg.CommonConfig)
+	fs.StringVar(&cfg.PayloadStrictness, "payload-strictness", envOrDefault("PAYLOAD_STRICTNESS", string(payload.StrictnessStrict)), "Handling of unknown payload fields (strict, warn, ignore)")
 
 	fs.StringVar(&cfg.AllowedImagePrefix, "allowed-image-prefix", envOrDefault("ALLOWED_IMAGE_PREFIX", ""), "Allowed image prefix")
 	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", envOrDefault("KUBECONFIG", ""), "Path to kubeconfig file (empty for in-cluster)")
+	fs.StringVar(&cfg.KubeContext, "kube-context", envOrDefault("KUBE_CONTEXT", ""), "Kubeconfig context to use (default: current context)")
+	fs.StringVar(&cfg.KubeAPIServer, "kube-api-server", envOrDefault("KUBE_API_SERVER", ""), "Override the Kubernetes API server URL")
+	fs.StringVar(&cfg.KubeBearerToken, "kube-bearer-token", envOrDefault("KUBE_BEARER_TOKEN", ""), "Override Kubernetes credentials with a bearer token")
+	fs.StringVar(&cfg.KubeBearerTokenFile, "kube-bearer-token-file", envOrDefault("KUBE_BEARER_TOKEN_FILE", ""), "Override Kubernetes credentials with a bearer token read from a file")
+	fs.StringVar(&cfg.KubeCAFile, "kube-ca-file", envOrDefault("KUBE_CA_FILE", ""), "Override the CA bundle used to verify the Kubernetes API server")
+	fs.DurationVar(&cfg.KubeExecTimeout, "kube-exec-timeout", envDuration("KUBE_EXEC_TIMEOUT", 0, &invalid), "Timeout for kubeconfig exec credential plugins (0 disables)")
+	fs.StringVar(&cfg.KubeUserAgent, "kube-user-agent", envOrDefault("KUBE_USER_AGENT", ""), "User agent of Kubernetes API requests (default: kuberollouttrigger-worker/<version>)")
+	fs.StringVar(&cfg.KubeAs, "kube-as", envOrDefault("KUBE_AS", ""), "Impersonate this user or service account on Kubernetes API requests, like kubectl --as")
+	var kubeAsGroups string
+	fs.StringVar(&kubeAsGroups, "kube-as-groups", envOrDefault("KUBE_AS_GROUPS", ""), "Comma-separated groups of the impersonated user, like kubectl --as-group")
+	fs.BoolVar(&cfg.KubeTenantImpersonation, "kube-tenant-impersonation", envBool("KUBE_TENANT_IMPERSONATION_ENABLED"), "Patch each namespace's workloads as the service account annotated on the namespace")
+	fs.StringVar(&cfg.KubeTenantServiceAccount, "kube-tenant-service-account", envOrDefault("KUBE_TENANT_SERVICE_ACCOUNT", ""), "Service account impersonated in namespaces without the restart-as annotation (empty patches them as the worker)")
+	var kubeNamespaces string
+	fs.StringVar(&kubeNamespaces, "kube-namespaces", envOrDefault("KUBE_NAMESPACES", ""), "Comma-separated namespaces to watch, each listed separately (empty watches the whole cluster)")
+	fs.StringVar(&cfg.KubeLabelSelector, "kube-label-selector", envOrDefault("KUBE_LABEL_SELECTOR", ""), "Label selector restricting the Deployments and workloads listed, e.g. team=payments (empty lists all)")
+	fs.IntVar(&cfg.KubeListPageSize, "kube-list-page-size", envInt("KUBE_LIST_PAGE_SIZE", 500, &invalid), "Objects requested per page when listing Deployments and workloads (0 lists in one request)")
+	fs.BoolVar(&cfg.KubeEvents, "kube-events", envBool("KUBE_EVENTS_ENABLED"), "Emit a Kubernetes Event on each restarted Deployment")
+	fs.StringVar(&cfg.KubePatchStrategy, "kube-patch-strategy", envOrDefault("KUBE_PATCH_STRATEGY", "merge"), "Restart patch strategy (merge, apply)")
+	fs.StringVar(&cfg.KubeFieldManager, "kube-field-manager", envOrDefault("KUBE_FIELD_MANAGER", "kuberollouttrigger"), "Field manager for server-side apply")
+	fs.BoolVar(&cfg.KubeApplyForce, "kube-apply-force", envBool("KUBE_APPLY_FORCE"), "Force ownership of conflicting fields during server-side apply")
+	fs.StringVar(&cfg.RestartedAtFormat, "restarted-at-format", envOrDefault("RESTARTED_AT_FORMAT", "rfc3339"), "Restart annotation value format (rfc3339, unix, or a Go time layout)")
+	fs.DurationVar(&cfg.MessageDedupeWindow, "message-dedupe-window", envDuration("MESSAGE_DEDUPE_WINDOW", 0, &invalid), "Drop an event identical to one received on the same channel within this window (0 disables)")
+	fs.DurationVar(&cfg.MessageTimeout, "message-timeout", envDuration("MESSAGE_TIMEOUT", 0, &invalid), "Cancel the handling of a message after this long (0 disables)")
+	fs.IntVar(&cfg.RestartConcurrency, "restart-concurrency", envInt("RESTART_CONCURRENCY", 1, &invalid), "Number of restarts of a single event in flight at once")
+	fs.DurationVar(&cfg.RestartInterval, "restart-interval", envDuration("RESTART_INTERVAL", 0, &invalid), "Delay between consecutive restarts triggered by a single event (0 disables)")
+	fs.StringVar(&cfg.SelfNamespace, "self-namespace", envOrDefault("SELF_NAMESPACE", ""), "Namespace of the worker's own Deployment, usually set from the downward API")
+	fs.StringVar(&cfg.SelfDeployment, "self-deployment", envOrDefault("SELF_DEPLOYMENT", ""), "Name of the worker's own Deployment, restarted only after the rest of an event (empty disables)")
+	fs.BoolVar(&cfg.KubePDBCheck, "kube-pdb-check", envBool("KUBE_PDB_CHECK_ENABLED"), "Defer restarts that would violate a PodDisruptionBudget or hit a degraded Deployment")
+	fs.DurationVar(&cfg.KubePDBRetryInterval, "kube-pdb-retry-interval", envDuration("KUBE_PDB_RETRY_INTERVAL", 30*time.Second, &invalid), "How often deferred restarts are retried")
+	fs.DurationVar(&cfg.KubePDBDeferTimeout, "kube-pdb-defer-timeout", envDuration("KUBE_PDB_DEFER_TIMEOUT", 10*time.Minute, &invalid), "How long deferred restarts are retried before being abandoned")
+	fs.StringVar(&cfg.TagRoutesSpec, "tag-routes", envOrDefault("TAG_ROUTES", ""), "JSON tag routing rules restricting which namespaces/labels each tag may restart")
+	fs.StringVar(&cfg.TagRoutesFile, "tag-routes-file", envOrDefault("TAG_ROUTES_FILE", ""), "Path to a JSON file with tag routing rules")
+	var valkeyChannels string
+	fs.StringVar(&valkeyChannels, "valkey-channels", envOrDefault("VALKEY_CHANNELS", ""), "Comma-separated event channels subscribed besides the Valkey channel")
+	fs.StringVar(&cfg.ValkeyChannelPattern, "valkey-channel-pattern", envOrDefault("VALKEY_CHANNEL_PATTERN", ""), "Glob-style pattern of event channels subscribed with PSUBSCRIBE (empty disables)")
+	fs.StringVar(&cfg.ChannelRulesSpec, "channel-rules", envOrDefault("CHANNEL_RULES", ""), "JSON rules restricting which namespaces/labels events of each channel may restart")
+	fs.StringVar(&cfg.ChannelRulesFile, "channel-rules-file", envOrDefault("CHANNEL_RULES_FILE", ""), "Path to a JSON file with channel rules")
+	fs.StringVar(&cfg.WorkloadKindsSpec, "workload-kinds", envOrDefault("WORKLOAD_KINDS", ""), "JSON list of custom workload kinds to match and restart besides Deployments")
+	fs.StringVar(&cfg.WorkloadKindsFile, "workload-kinds-file", envOrDefault("WORKLOAD_KINDS_FILE", ""), "Path to a JSON file listing custom workload kinds")
+	var matchStrategies string
+	fs.StringVar(&matchStrategies, "match-strategies", envOrDefault("MATCH_STRATEGIES", k8s.MatchStrategyImage), "Comma-separated strategies matching workloads to an image: image, annotation, semver")
+	var semverChannels string
+	fs.StringVar(&semverChannels, "semver-channels", envOrDefault("SEMVER_CHANNELS", k8s.SemverChannelMajor+","+k8s.SemverChannelMinor), "Comma-separated floating tags matched by the semver match strategy: major, minor")
+	fs.StringVar(&cfg.TagRules.StripPrefix, "tag-strip-prefix", envOrDefault("TAG_STRIP_PREFIX", ""), "Prefix removed from event and container tags before they are compared, such as v")
+	fs.BoolVar(&cfg.TagRules.Lowercase, "tag-lowercase", envBool("TAG_LOWERCASE_ENABLED"), "Compare event and container tags case-insensitively")
+	fs.StringVar(&cfg.RegistryUsername, "registry-username", envOrDefault("REGISTRY_USERNAME", ""), "Container registry username (empty for anonymous access)")
+	fs.StringVar(&cfg.RegistryPassword, "registry-password", envSecret("REGISTRY_PASSWORD", &invalid), "Container registry password or token")
+	fs.BoolVar(&cfg.ExplainMatches, "explain-matches", envBool("EXPLAIN_MATCHES_ENABLED"), "Log why each Deployment running the event's image did or did not match")
+	fs.BoolVar(&cfg.StartPaused, "start-paused", envBool("START_PAUSED"), "Start paused, holding events until resumed through the admin API")
+	fs.BoolVar(&cfg.StartupBackfill, "startup-backfill", envBool("STARTUP_BACKFILL_ENABLED"), "On startup, restart Deployments whose image tag now points to a newer digest in the registry")
+	fs.BoolVar(&cfg.StartupPrefixCheck, "startup-prefix-check", envBool("STARTUP_PREFIX_CHECK_ENABLED"), "On startup, count Deployments running images under the allowed prefix and warn if there are none")
+	fs.DurationVar(&cfg.InventoryResyncInterval, "inventory-resync-interval", envDuration("INVENTORY_RESYNC_INTERVAL", 0, &invalid), "How often to refresh the Deployment inventory metrics (0 disables)")
+	fs.BoolVar(&cfg.RegistryVerify, "registry-verify", envBool("REGISTRY_VERIFY_ENABLED"), "Check that each image:tag exists in the registry before restarting")
+	fs.BoolVar(&cfg.RegistryPlatformDigests, "registry-platform-digests", envBool("REGISTRY_PLATFORM_DIGESTS_ENABLED"), "Treat the platform manifests of a multi-platform image as the same image when comparing digests")
+	fs.DurationVar(&cfg.RegistryWaitTimeout, "registry-wait-timeout", envDuration("REGISTRY_WAIT_TIMEOUT", 0, &invalid), "How long to retry a missing image:tag before skipping it (0 checks once)")
+	fs.StringVar(&cfg.CosignPublicKeyFile, "cosign-public-key-file", envOrDefault("COSIGN_PUBLIC_KEY_FILE", ""), "Path to PEM cosign public key(s); images must be signed before restarts are triggered")
+	fs.BoolVar(&cfg.NamespaceDigestPolicy, "namespace-digest-policy", envBool("NAMESPACE_DIGEST_POLICY_ENABLED"), "Only restart workloads in namespaces annotated to require a digest for events carrying an image digest")
+	fs.DurationVar(&cfg.AnnotationGCMaxAge, "annotation-gc-max-age", envDuration("ANNOTATION_GC_MAX_AGE", 0, &invalid), "Remove trigger annotations from Deployments restarted longer ago than this (0 disables)")
+	fs.DurationVar(&cfg.AnnotationGCInterval, "annotation-gc-interval", envDuration("ANNOTATION_GC_INTERVAL", time.Hour, &invalid), "How often to run the trigger annotation cleanup")
+	fs.StringVar(&cfg.HealthListenAddr, "health-listen-addr", envOrDefault("WORKER_HEALTH_LISTEN_ADDR", ""), "Listen address for the worker's /healthz and /readyz endpoints (empty disables)")
+	fs.DurationVar(&cfg.HeartbeatTimeout, "heartbeat-timeout", envDuration("HEARTBEAT_TIMEOUT", 0, &invalid), "Warn when no web heartbeat arrives for this long (0 disables)")
+	fs.IntVar(&cfg.SubscriberBufferSize, "subscriber-buffer-size", envInt("SUBSCRIBER_BUFFER_SIZE", 100, &invalid), "Received messages held while an event is being processed")
+	fs.DurationVar(&cfg.SubscriberHealthCheckInterval, "subscriber-health-check-interval", envDuration("SUBSCRIBER_HEALTH_CHECK_INTERVAL", 3*time.Second, &invalid), "How often the idle Valkey subscription connection is pinged")
+	fs.StringVar(&cfg.SubscriberOverflow, "subscriber-overflow", envOrDefault("SUBSCRIBER_OVERFLOW", "block"), "When the subscriber buffer is full: block or drop_oldest")
+	fs.StringVar(&cfg.NotifyWebhookURL, "notify-webhook-url", envSecret("NOTIFY_WEBHOOK_URL", &invalid), "Slack compatible webhook receiving restart notifications (empty disables the default target)")
+	fs.BoolVar(&cfg.NotifyNamespaceAnnotations, "notify-namespace-annotations", envBool("NOTIFY_NAMESPACE_ANNOTATIONS_ENABLED"), "Send restart notifications to the webhook annotated on each namespace")
+	var notifyAllowedHosts string
+	fs.StringVar(&notifyAllowedHosts, "notify-allowed-hosts", envOrDefault("NOTIFY_ALLOWED_HOSTS", "hooks.slack.com"), "Comma-separated hosts a namespace annotated webhook may point to")
+	fs.DurationVar(&cfg.NotifyTimeout, "notify-timeout", envDuration("NOTIFY_TIMEOUT", 5*time.Second, &invalid), "Timeout for each notification webhook request")
+	fs.StringVar(&cfg.GitHubReport, "github-report", envOrDefault("GITHUB_REPORT", ""), "Report rollouts to the triggering commit as a GitHub status or deployment (empty disables)")
+	fs.StringVar(&cfg.GitHubAPIURL, "github-api-url", envOrDefault("GITHUB_API_URL", "https://api.github.com"), "GitHub REST API base URL")
+	fs.Int64Var(&cfg.GitHubAppID, "github-app-id", int64(envInt("GITHUB_APP_ID", 0, &invalid)), "ID of the GitHub App reporting rollouts")
+	fs.Int64Var(&cfg.GitHubAppInstallationID, "github-app-installation-id", int64(envInt("GITHUB_APP_INSTALLATION_ID", 0, &invalid)), "Installation ID of the GitHub App")
+	fs.StringVar(&cfg.GitHubAppPrivateKey, "github-app-private-key", envSecret("GITHUB_APP_PRIVATE_KEY", &invalid), "PEM encoded private key of the GitHub App")
+	fs.StringVar(&cfg.GitHubStatusContext, "github-status-context", envOrDefault("GITHUB_STATUS_CONTEXT", "kuberollouttrigger"), "Context of the reported commit statuses")
+	fs.StringVar(&cfg.GitHubDeploymentEnvironment, "github-deployment-environment", envOrDefault("GITHUB_DEPLOYMENT_ENVIRONMENT", "kubernetes"), "Environment of the reported GitHub Deployments")
+	fs.DurationVar(&cfg.GitHubTimeout, "github-timeout", envDuration("GITHUB_TIMEOUT", 10*time.Second, &invalid), "Timeout for each GitHub API request")
+	fs.BoolVar(&cfg.DevMode, "dev-mode", envBool("DEV_MODE"), "Enable dev mode (allows fault injection)")
+	fs.Float64Var(&cfg.FaultKubeThrottleRate, "fault-kube-throttle-rate", envFloat("FAULT_KUBE_THROTTLE_RATE", 0, &invalid), "Share of Kubernetes API requests to answer with 429, 0 to 1 (dev mode only)")
 
 	if err := fs.Parse(args); err != nil {
-		return nil, err
+		return nil, fs, err
 	}
 
 	// Validate required fields
@@ -121,10 +855,345 @@ func ParseWorkerConfig(args []string) (*WorkerConfig, error) {
 	if cfg.AllowedImagePrefix == "" {
 		missing = append(missing, "ALLOWED_IMAGE_PREFIX / --allowed-image-prefix")
 	}
+	if len(missing) > 0 {
+		return nil, fs, fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+
+	if cfg.KubeBearerToken != "" && cfg.KubeBearerTokenFile != "" {
+		invalid = append(invalid, "KUBE_BEARER_TOKEN / --kube-bearer-token and KUBE_BEARER_TOKEN_FILE / --kube-bearer-token-file are mutually exclusive")
+	}
+	if _, err := labels.Parse(cfg.KubeLabelSelector); err != nil {
+		invalid = append(invalid, fmt.Sprintf("KUBE_LABEL_SELECTOR / --kube-label-selector is not a valid label selector: %v", err))
+	}
+	if cfg.KubeListPageSize < 0 {
+		invalid = append(invalid, "KUBE_LIST_PAGE_SIZE / --kube-list-page-size must not be negative")
+	}
+	if cfg.KubeExecTimeout < 0 {
+		invalid = append(invalid, "KUBE_EXEC_TIMEOUT / --kube-exec-timeout must not be negative")
+	}
+	if cfg.KubePatchStrategy != "merge" && cfg.KubePatchStrategy != "apply" {
+		invalid = append(invalid, fmt.Sprintf("KUBE_PATCH_STRATEGY / --kube-patch-strategy must be merge or apply, got %q", cfg.KubePatchStrategy))
+	}
+	if err := k8s.ValidateTimestampFormat(cfg.RestartedAtFormat); err != nil {
+		invalid = append(invalid, fmt.Sprintf("RESTARTED_AT_FORMAT / --restarted-at-format is invalid: %v", err))
+	}
+	if cfg.MessageDedupeWindow < 0 {
+		invalid = append(invalid, "MESSAGE_DEDUPE_WINDOW / --message-dedupe-window must not be negative")
+	}
+	if cfg.MessageTimeout < 0 {
+		invalid = append(invalid, "MESSAGE_TIMEOUT / --message-timeout must not be negative")
+	}
+	if cfg.RestartConcurrency < 1 {
+		invalid = append(invalid, "RESTART_CONCURRENCY / --restart-concurrency must be at least 1")
+	}
+	if cfg.RestartInterval < 0 {
+		invalid = append(invalid, "RESTART_INTERVAL / --restart-interval must not be negative")
+	}
+	if cfg.SelfDeployment != "" && cfg.SelfNamespace == "" {
+		invalid = append(invalid, "SELF_NAMESPACE / --self-namespace is required with SELF_DEPLOYMENT / --self-deployment")
+	}
+	if cfg.KubePDBRetryInterval <= 0 {
+		invalid = append(invalid, "KUBE_PDB_RETRY_INTERVAL / --kube-pdb-retry-interval must be positive")
+	}
+	if cfg.KubePDBDeferTimeout < 0 {
+		invalid = append(invalid, "KUBE_PDB_DEFER_TIMEOUT / --kube-pdb-defer-timeout must not be negative")
+	}
+	if cfg.AnnotationGCMaxAge < 0 {
+		invalid = append(invalid, "ANNOTATION_GC_MAX_AGE / --annotation-gc-max-age must not be negative")
+	}
+	if cfg.AnnotationGCInterval <= 0 {
+		invalid = append(invalid, "ANNOTATION_GC_INTERVAL / --annotation-gc-interval must be positive")
+	}
+	if cfg.InventoryResyncInterval < 0 {
+		invalid = append(invalid, "INVENTORY_RESYNC_INTERVAL / --inventory-resync-interval must not be negative")
+	}
+	if cfg.HeartbeatTimeout < 0 {
+		invalid = append(invalid, "HEARTBEAT_TIMEOUT / --heartbeat-timeout must not be negative")
+	}
+	if cfg.SubscriberBufferSize < 1 {
+		invalid = append(invalid, "SUBSCRIBER_BUFFER_SIZE / --subscriber-buffer-size must be at least 1")
+	}
+	if cfg.SubscriberHealthCheckInterval <= 0 {
+		invalid = append(invalid, "SUBSCRIBER_HEALTH_CHECK_INTERVAL / --subscriber-health-check-interval must be positive")
+	}
+	if cfg.SubscriberOverflow != "block" && cfg.SubscriberOverflow != "drop_oldest" {
+		invalid = append(invalid, fmt.Sprintf("SUBSCRIBER_OVERFLOW / --subscriber-overflow must be block or drop_oldest, got %q", cfg.SubscriberOverflow))
+	}
+	if cfg.RegistryWaitTimeout < 0 {
+		invalid = append(invalid, "REGISTRY_WAIT_TIMEOUT / --registry-wait-timeout must not be negative")
+	}
+	cfg.NotifyAllowedHosts = splitList(notifyAllowedHosts)
+	cfg.ValkeyChannels = splitList(valkeyChannels)
+	cfg.KubeAsGroups = splitList(kubeAsGroups)
+	if len(cfg.KubeAsGroups) > 0 && cfg.KubeAs == "" {
+		invalid = append(invalid, "KUBE_AS_GROUPS / --kube-as-groups requires KUBE_AS / --kube-as")
+	}
+	if cfg.KubeTenantImpersonation && cfg.KubeAs != "" {
+		invalid = append(invalid, "KUBE_TENANT_IMPERSONATION_ENABLED / --kube-tenant-impersonation and KUBE_AS / --kube-as are mutually exclusive")
+	}
+	if cfg.KubeTenantServiceAccount != "" {
+		if !cfg.KubeTenantImpersonation {
+			invalid = append(invalid, "KUBE_TENANT_SERVICE_ACCOUNT / --kube-tenant-service-account requires KUBE_TENANT_IMPERSONATION_ENABLED / --kube-tenant-impersonation")
+		} else if errs := validation.IsDNS1123Subdomain(cfg.KubeTenantServiceAccount); len(errs) > 0 {
+			invalid = append(invalid, fmt.Sprintf("KUBE_TENANT_SERVICE_ACCOUNT / --kube-tenant-service-account is not a valid service account name: %s", strings.Join(errs, ", ")))
+		}
+	}
+	cfg.KubeNamespaces = splitList(kubeNamespaces)
+	for _, namespace := range cfg.KubeNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			invalid = append(invalid, fmt.Sprintf("KUBE_NAMESPACES / --kube-namespaces has invalid namespace %q: %s", namespace, strings.Join(errs, ", ")))
+		}
+	}
+	if cfg.NotifyWebhookURL != "" {
+		if u, err := url.Parse(cfg.NotifyWebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			invalid = append(invalid, "NOTIFY_WEBHOOK_URL / --notify-webhook-url must be an http(s) URL")
+		}
+	}
+	if cfg.NotifyTimeout <= 0 {
+		invalid = append(invalid, "NOTIFY_TIMEOUT / --notify-timeout must be positive")
+	}
+	validateGitHubReportConfig(cfg, &invalid)
+	validateFaultRate("FAULT_KUBE_THROTTLE_RATE / --fault-kube-throttle-rate", cfg.FaultKubeThrottleRate, cfg.DevMode, &invalid)
+	if cfg.TagRoutesSpec != "" && cfg.TagRoutesFile != "" {
+		invalid = append(invalid, "TAG_ROUTES / --tag-routes and TAG_ROUTES_FILE / --tag-routes-file are mutually exclusive")
+	}
+	routesSpec := cfg.TagRoutesSpec
+	if cfg.TagRoutesFile != "" {
+		data, err := os.ReadFile(cfg.TagRoutesFile)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("TAG_ROUTES_FILE / --tag-routes-file: %v", err))
+		}
+		routesSpec = string(data)
+	}
+	routes, err := routing.Parse(routesSpec)
+	if err != nil {
+		invalid = append(invalid, err.Error())
+	}
+	cfg.TagRoutes = routes
+	validateSubscriptionConfig(cfg, &invalid)
+	if cfg.WorkloadKindsSpec != "" && cfg.WorkloadKindsFile != "" {
+		invalid = append(invalid, "WORKLOAD_KINDS / --workload-kinds and WORKLOAD_KINDS_FILE / --workload-kinds-file are mutually exclusive")
+	}
+	kindsSpec := cfg.WorkloadKindsSpec
+	if cfg.WorkloadKindsFile != "" {
+		data, err := os.ReadFile(cfg.WorkloadKindsFile)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("WORKLOAD_KINDS_FILE / --workload-kinds-file: %v", err))
+		}
+		kindsSpec = string(data)
+	}
+	kinds, err := k8s.ParseWorkloadKinds(kindsSpec)
+	if err != nil {
+		invalid = append(invalid, err.Error())
+	}
+	cfg.WorkloadKinds = kinds
+	cfg.MatchStrategies = splitList(matchStrategies)
+	cfg.SemverChannels = splitList(semverChannels)
+	if len(cfg.MatchStrategies) == 0 {
+		invalid = append(invalid, "MATCH_STRATEGIES / --match-strategies must list at least one strategy")
+	} else if matcher, err := k8s.NewMatcher(cfg.MatchStrategies, k8s.MatcherOptions{Tags: cfg.TagRules, SemverChannels: cfg.SemverChannels}); err != nil {
+		invalid = append(invalid, fmt.Sprintf("MATCH_STRATEGIES / --match-strategies or SEMVER_CHANNELS / --semver-channels: %v", err))
+	} else {
+		cfg.Matcher = matcher
+	}
+	if err := cfg.TagRules.Validate(); err != nil {
+		invalid = append(invalid, fmt.Sprintf("TAG_STRIP_PREFIX / --tag-strip-prefix: %v", err))
+	}
+	validateLogConfig(&cfg.CommonConfig, &invalid)
+	validateProxyConfig(&cfg.CommonConfig, &invalid)
+	validateValkeyConfig(&cfg.CommonConfig, &invalid)
+	if _, err := payload.ParseStrictness(cfg.PayloadStrictness); err != nil {
+		invalid = append(invalid, fmt.Sprintf("PAYLOAD_STRICTNESS / --payload-strictness: %v", err))
+	}
+	if len(invalid) > 0 {
+		return nil, fs, fmt.Errorf("invalid configuration: %s", strings.Join(invalid, ", "))
+	}
+
+	return cfg, fs, nil
+}
+
+// auditLogOutputNone disables the audit log.
+const auditLogOutputNone = "none"
+
+// validateAuditLogConfig appends a message to invalid for each invalid audit
+// log setting.
+func validateAuditLogConfig(c *WebConfig, invalid *[]string) {
+	switch c.AuditLogOutput {
+	case auditLogOutputNone, logging.OutputStdout, logging.OutputStderr, logging.OutputSyslog:
+	case logging.OutputFile:
+		if c.AuditLogFile == "" {
+			*invalid = append(*invalid, "AUDIT_LOG_FILE / --audit-log-file is required with AUDIT_LOG_OUTPUT=file")
+		} else if c.LogOutput == logging.OutputFile && filepath.Clean(c.AuditLogFile) == filepath.Clean(c.LogFile) {
+			// Two writers rotating one file would lose records
+			*invalid = append(*invalid, "AUDIT_LOG_FILE / --audit-log-file must differ from LOG_FILE / --log-file")
+		}
+	default:
+		*invalid = append(*invalid, fmt.Sprintf("AUDIT_LOG_OUTPUT / --audit-log-output must be none, stdout, stderr, file or syslog, got %q", c.AuditLogOutput))
+	}
+}
+
+// validateDeploymentWebhookConfig parses the deployment environment routes
+// and appends a message to invalid for each invalid GitHub deployment webhook
+// setting. The webhook needs both a secret and at least one environment.
+func validateDeploymentWebhookConfig(c *WebConfig, invalid *[]string) {
+	if c.DeploymentEnvironmentRoutesSpec != "" && c.DeploymentEnvironmentRoutesFile != "" {
+		*invalid = append(*invalid, "DEPLOYMENT_ENVIRONMENT_ROUTES / --deployment-environment-routes and DEPLOYMENT_ENVIRONMENT_ROUTES_FILE / --deployment-environment-routes-file are mutually exclusive")
+	}
+	spec := c.DeploymentEnvironmentRoutesSpec
+	if c.DeploymentEnvironmentRoutesFile != "" {
+		data, err := os.ReadFile(c.DeploymentEnvironmentRoutesFile)
+		if err != nil {
+			*invalid = append(*invalid, fmt.Sprintf("DEPLOYMENT_ENVIRONMENT_ROUTES_FILE / --deployment-environment-routes-file: %v", err))
+		}
+		spec = string(data)
+	}
+	environments, err := routing.ParseEnvironments(spec)
+	if err != nil {
+		*invalid = append(*invalid, err.Error())
+	}
+	c.DeploymentEnvironmentRoutes = environments
+
+	if c.GitHubWebhookSecret != "" && err == nil && environments.Len() == 0 {
+		*invalid = append(*invalid, "GITHUB_WEBHOOK_SECRET / --github-webhook-secret requires DEPLOYMENT_ENVIRONMENT_ROUTES / --deployment-environment-routes")
+	}
+	if c.GitHubWebhookSecret == "" && environments.Len() > 0 {
+		*invalid = append(*invalid, "DEPLOYMENT_ENVIRONMENT_ROUTES / --deployment-environment-routes requires GITHUB_WEBHOOK_SECRET / --github-webhook-secret")
+	}
+}
+
+// validateOIDCIssuersConfig parses the additional OIDC issuers and appends a
+// message to invalid for each invalid setting.
+func validateOIDCIssuersConfig(c *WebConfig, invalid *[]string) {
+	if c.OIDCIssuersSpec != "" && c.OIDCIssuersFile != "" {
+		*invalid = append(*invalid, "OIDC_ISSUERS / --oidc-issuers and OIDC_ISSUERS_FILE / --oidc-issuers-file are mutually exclusive")
+	}
+	spec := c.OIDCIssuersSpec
+	if c.OIDCIssuersFile != "" {
+		data, err := os.ReadFile(c.OIDCIssuersFile)
+		if err != nil {
+			*invalid = append(*invalid, fmt.Sprintf("OIDC_ISSUERS_FILE / --oidc-issuers-file: %v", err))
+		}
+		spec = string(data)
+	}
+	issuers, err := oidc.ParseIssuers(spec)
+	if err != nil {
+		*invalid = append(*invalid, err.Error())
+	}
+	for _, issuer := range issuers {
+		if issuer.Issuer == c.GithubOIDCIssuer {
+			*invalid = append(*invalid, fmt.Sprintf("OIDC_ISSUERS / --oidc-issuers lists %q, which is already GITHUB_OIDC_ISSUER / --github-oidc-issuer", issuer.Issuer))
+		}
+	}
+	c.OIDCIssuers = issuers
+}
+
+// validateSubscriptionConfig parses the channel rules and appends a message
+// to invalid for each invalid setting of the subscribed channels.
+func validateSubscriptionConfig(c *WorkerConfig, invalid *[]string) {
+	seen := map[string]bool{c.ValkeyChannel: true}
+	for _, channel := range c.ValkeyChannels {
+		if seen[channel] {
+			*invalid = append(*invalid, fmt.Sprintf("VALKEY_CHANNELS / --valkey-channels lists channel %q twice or with VALKEY_CHANNEL", channel))
+		}
+		seen[channel] = true
+	}
+	if c.ChannelRulesSpec != "" && c.ChannelRulesFile != "" {
+		*invalid = append(*invalid, "CHANNEL_RULES / --channel-rules and CHANNEL_RULES_FILE / --channel-rules-file are mutually exclusive")
+	}
+	spec := c.ChannelRulesSpec
+	if c.ChannelRulesFile != "" {
+		data, err := os.ReadFile(c.ChannelRulesFile)
+		if err != nil {
+			*invalid = append(*invalid, fmt.Sprintf("CHANNEL_RULES_FILE / --channel-rules-file: %v", err))
+		}
+		spec = string(data)
+	}
+	rules, err := routing.ParseSubscriptions(spec)
+	if err != nil {
+		*invalid = append(*invalid, err.Error())
+	}
+	c.ChannelRules = rules
+}
+
+// validateGitHubReportConfig appends a message to invalid for each invalid
+// GitHub rollout report setting. The App settings are only required when
+// reporting is enabled.
+func validateGitHubReportConfig(c *WorkerConfig, invalid *[]string) {
+	switch c.GitHubReport {
+	case "":
+		return
+	case "status", "deployment":
+	default:
+		*invalid = append(*invalid, fmt.Sprintf("GITHUB_REPORT / --github-report must be status or deployment, got %q", c.GitHubReport))
+	}
+	if u, err := url.Parse(c.GitHubAPIURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		*invalid = append(*invalid, "GITHUB_API_URL / --github-api-url must be an http(s) URL")
+	}
+	if c.GitHubAppID <= 0 {
+		*invalid = append(*invalid, "GITHUB_APP_ID / --github-app-id is required with GITHUB_REPORT")
+	}
+	if c.GitHubAppInstallationID <= 0 {
+		*invalid = append(*invalid, "GITHUB_APP_INSTALLATION_ID / --github-app-installation-id is required with GITHUB_REPORT")
+	}
+	if c.GitHubAppPrivateKey == "" {
+		*invalid = append(*invalid, "GITHUB_APP_PRIVATE_KEY / --github-app-private-key is required with GITHUB_REPORT")
+	}
+	if c.GitHubReport == "status" && c.GitHubStatusContext == "" {
+		*invalid = append(*invalid, "GITHUB_STATUS_CONTEXT / --github-status-context must not be empty")
+	}
+	if c.GitHubReport == "deployment" && c.GitHubDeploymentEnvironment == "" {
+		*invalid = append(*invalid, "GITHUB_DEPLOYMENT_ENVIRONMENT / --github-deployment-environment must not be empty")
+	}
+	if c.GitHubTimeout <= 0 {
+		*invalid = append(*invalid, "GITHUB_TIMEOUT / --github-timeout must be positive")
+	}
+}
+
+// ParseE2EConfig parses e2e subcommand configuration from env vars and CLI flags.
+func ParseE2EConfig(args []string) (*E2EConfig, error) {
+	fs := flag.NewFlagSet("e2e", flag.ContinueOnError)
+	cfg := &E2EConfig{}
+	var invalid []string
+
+	fs.StringVar(&cfg.WebURL, "web-url", envOrDefault("E2E_WEB_URL", "http://localhost:8080"), "Base URL of a web instance running with dev mode")
+	fs.StringVar(&cfg.Namespace, "namespace", envOrDefault("E2E_NAMESPACE", "kuberollouttrigger-e2e"), "Namespace for the test Deployment, created if missing")
+	fs.StringVar(&cfg.Image, "image", envOrDefault("E2E_IMAGE", ""), "Test Deployment image, without tag, under the allowed image prefix")
+	fs.StringVar(&cfg.GithubOIDCAudience, "github-oidc-audience", envOrDefault("GITHUB_OIDC_AUDIENCE", ""), "Audience of the dev mode tokens")
+	fs.StringVar(&cfg.GithubAllowedOrg, "github-allowed-org", envOrDefault("GITHUB_ALLOWED_ORG", ""), "Organization of the dev mode tokens")
+	fs.IntVar(&cfg.Events, "events", envInt("E2E_EVENTS", 5, &invalid), "Number of events to publish")
+	fs.DurationVar(&cfg.EventTimeout, "event-timeout", envDuration("E2E_EVENT_TIMEOUT", 30*time.Second, &invalid), "How long each event may take to restart the test Deployment")
+	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", envOrDefault("KUBECONFIG", ""), "Path to kubeconfig file")
+	fs.StringVar(&cfg.KubeContext, "kube-context", envOrDefault("KUBE_CONTEXT", ""), "Kubeconfig context to use (default: current context)")
+	fs.StringVar(&cfg.LogLevel, "log-level", envOrDefault("LOG_LEVEL", "info"), "Log level (debug, info, warn, error)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	if cfg.Image == "" {
+		missing = append(missing, "E2E_IMAGE / --image")
+	}
+	if cfg.GithubOIDCAudience == "" {
+		missing = append(missing, "GITHUB_OIDC_AUDIENCE / --github-oidc-audience")
+	}
+	if cfg.GithubAllowedOrg == "" {
+		missing = append(missing, "GITHUB_ALLOWED_ORG / --github-allowed-org")
+	}
 	if len(missing) > 0 {
 		return nil, fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
 	}
 
+	if cfg.Events < 1 {
+		invalid = append(invalid, "E2E_EVENTS / --events must be at least 1")
+	}
+	if cfg.EventTimeout <= 0 {
+		invalid = append(invalid, "E2E_EVENT_TIMEOUT / --event-timeout must be positive")
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(invalid, ", "))
+	}
+
 	return cfg, nil
 }
 
@@ -142,12 +1211,32 @@ func ParseLogLevel(level string) slog.Level {
 	}
 }
 
-// NewRedisOptions creates redis.Options from the common configuration.
-func (c *CommonConfig) NewRedisOptions() *redis.Options {
+// LogOptions returns the logging options for the configured log output.
+func (c *CommonConfig) LogOptions() logging.Options {
+	return logging.Options{
+		Level:          ParseLogLevel(c.LogLevel),
+		Format:         c.LogFormat,
+		Output:         c.LogOutput,
+		File:           c.LogFile,
+		FileMaxSize:    int64(c.LogFileMaxSize) << 20,
+		FileMaxBackups: c.LogFileMaxBackups,
+		SyslogAddr:     c.LogSyslogAddr,
+		SyslogTag:      "kuberollouttrigger",
+	}
+}
+
+// NewRedisOptions creates redis.Options from the common configuration. The
+// connections are named defaultClientName unless ValkeyClientName is set.
+func (c *CommonConfig) NewRedisOptions(defaultClientName string) *redis.Options {
 	opts := &redis.Options{
-		Addr:     c.ValkeyAddr,
-		Username: c.ValkeyUsername,
-		Password: c.ValkeyPassword,
+		Addr:       c.ValkeyAddr,
+		Username:   c.ValkeyUsername,
+		Password:   c.ValkeyPassword,
+		DB:         c.ValkeyDB,
+		ClientName: c.ValkeyClientName,
+	}
+	if opts.ClientName == "" {
+		opts.ClientName = defaultClientName
 	}
 	if c.ValkeyTLS {
 		opts.TLSConfig = &tls.Config{
@@ -157,33 +1246,198 @@ func (c *CommonConfig) NewRedisOptions() *redis.Options {
 	return opts
 }
 
+// AuditLogOptions returns the logging options of the authentication audit
+// log, and false if it is disabled. Audit records are always logged at info
+// level and share the format, rotation and syslog server of the logs.
+func (c *WebConfig) AuditLogOptions() (logging.Options, bool) {
+	if c.AuditLogOutput == auditLogOutputNone {
+		return logging.Options{}, false
+	}
+	opts := c.LogOptions()
+	opts.Level = slog.LevelInfo
+	opts.Output = c.AuditLogOutput
+	opts.File = c.AuditLogFile
+	opts.SyslogTag = "kuberollouttrigger-audit"
+	return opts, true
+}
+
+// JWKSURL returns the URL the JWKS is fetched from: GithubOIDCJWKSURL, or
+// the JWKS of GithubOIDCIssuer.
+func (c *WebConfig) JWKSURL() string {
+	if c.GithubOIDCJWKSURL != "" {
+		return c.GithubOIDCJWKSURL
+	}
+	return oidc.JWKSURL(c.GithubOIDCIssuer)
+}
+
+// JWKSClientOptions returns the HTTP client options for fetching the JWKS.
+func (c *WebConfig) JWKSClientOptions() httpclient.Options {
+	opts := c.HTTPClientOptions(10 * time.Second)
+	if c.JWKSProxyURL != "" {
+		opts.ProxyURL = c.JWKSProxyURL
+	}
+	opts.CAFile = c.JWKSCAFile
+	return opts
+}
+
+// redactURL returns rawURL with any password replaced, for logging.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[invalid]"
+	}
+	return u.Redacted()
+}
+
 // LogSummary logs the configuration summary, redacting secrets.
 func (c *WebConfig) LogSummary(logger *slog.Logger) {
 	logger.Info("web mode configuration",
 		"listen_addr", c.ListenAddr,
+		"admin_listen_addr", c.AdminListenAddr,
 		"valkey_addr", c.ValkeyAddr,
 		"valkey_channel", c.ValkeyChannel,
 		"valkey_tls", c.ValkeyTLS,
+		"valkey_db", c.ValkeyDB,
+		"valkey_client_name", c.ValkeyClientName,
 		"github_oidc_audience", c.GithubOIDCAudience,
 		"github_allowed_org", c.GithubAllowedOrg,
+		"github_oidc_issuer", c.GithubOIDCIssuer,
+		"github_oidc_jwks_url", c.JWKSURL(),
+		"oidc_issuers", len(c.OIDCIssuers),
 		"allowed_image_prefix", c.AllowedImagePrefix,
 		"dev_mode", c.DevMode,
+		"oidc_clock_skew", c.OIDCClockSkew.String(),
+		"oidc_max_token_lifetime", c.OIDCMaxTokenLifetime.String(),
+		"auth_failure_log_window", c.AuthFailureLogWindow.String(),
+		"audit_log_output", c.AuditLogOutput,
+		"audit_log_file", c.AuditLogFile,
+		"protected_tags", strings.Join(c.ProtectedTags, ","),
+		"admin_api_enabled", c.AdminToken != "" || c.AdminTokens.Len() > 0,
+		"admin_scoped_tokens", c.AdminTokens.Len(),
+		"event_rate_limit", c.EventRateLimit,
+		"event_rate_burst", c.EventRateBurst,
+		"event_rate_limit_backend", c.EventRateLimitBackend,
+		"idempotency_key_ttl", c.IdempotencyKeyTTL.String(),
+		"load_shed_max_in_flight", c.LoadShedMaxInFlight,
+		"load_shed_max_heap_mb", c.LoadShedMaxHeapMB,
+		"read_only", c.ReadOnly,
+		"opa_url", c.OPAURL,
+		"opa_timeout", c.OPATimeout.String(),
+		"heartbeat_interval", c.HeartbeatInterval.String(),
+		"valkey_ping_interval", c.ValkeyPingInterval.String(),
+		"channel_routes", c.ChannelRoutes.Len(),
+		"github_webhook_secret_set", c.GitHubWebhookSecret != "",
+		"deployment_environment_routes", c.DeploymentEnvironmentRoutes.Len(),
+		"publish_require_receivers", c.PublishRequireReceivers,
+		"event_schema_validation", c.EventSchemaValidation,
+		"message_compression", c.MessageCompression,
+		"message_compression_min_size", c.MessageCompressionMinSize,
+		"fault_valkey_publish_rate", c.FaultValkeyPublishRate,
+		"fault_jwks_rate", c.FaultJWKSRate,
+		"http_proxy", redactURL(c.HTTPProxyURL),
+		"no_proxy", c.NoProxy,
+		"payload_strictness", c.PayloadStrictness,
+		"jwks_proxy_url", redactURL(c.JWKSProxyURL),
+		"jwks_ca_file", c.JWKSCAFile,
+		"jwks_cache_file", c.JWKSCacheFile,
+		"jwks_cache_max_age", c.JWKSCacheMaxAge.String(),
 		"log_level", c.LogLevel,
+		"log_format", c.LogFormat,
+		"log_output", c.LogOutput,
+		"log_file", c.LogFile,
 	)
 }
 
 // LogSummary logs the configuration summary, redacting secrets.
 func (c *WorkerConfig) LogSummary(logger *slog.Logger) {
 	kubeconfig := c.Kubeconfig
-	if kubeconfig == "" {
+	if kubeconfig == "" && c.KubeContext == "" {
 		kubeconfig = "(in-cluster)"
 	}
 	logger.Info("worker mode configuration",
 		"valkey_addr", c.ValkeyAddr,
 		"valkey_channel", c.ValkeyChannel,
 		"valkey_tls", c.ValkeyTLS,
+		"valkey_db", c.ValkeyDB,
+		"valkey_client_name", c.ValkeyClientName,
 		"allowed_image_prefix", c.AllowedImagePrefix,
 		"kubeconfig", kubeconfig,
+		"kube_context", c.KubeContext,
+		"kube_api_server", c.KubeAPIServer,
+		"kube_bearer_token_set", c.KubeBearerToken != "",
+		"kube_bearer_token_file", c.KubeBearerTokenFile,
+		"kube_ca_file", c.KubeCAFile,
+		"kube_exec_timeout", c.KubeExecTimeout.String(),
+		"kube_user_agent", c.KubeUserAgent,
+		"kube_as", c.KubeAs,
+		"kube_as_groups", strings.Join(c.KubeAsGroups, ","),
+		"kube_tenant_impersonation", c.KubeTenantImpersonation,
+		"kube_tenant_service_account", c.KubeTenantServiceAccount,
+		"kube_namespaces", strings.Join(c.KubeNamespaces, ","),
+		"kube_label_selector", c.KubeLabelSelector,
+		"kube_list_page_size", c.KubeListPageSize,
+		"kube_events", c.KubeEvents,
+		"kube_patch_strategy", c.KubePatchStrategy,
+		"kube_field_manager", c.KubeFieldManager,
+		"kube_apply_force", c.KubeApplyForce,
+		"restarted_at_format", c.RestartedAtFormat,
+		"restart_interval", c.RestartInterval.String(),
+		"restart_concurrency", c.RestartConcurrency,
+		"message_dedupe_window", c.MessageDedupeWindow.String(),
+		"message_timeout", c.MessageTimeout.String(),
+		"self_namespace", c.SelfNamespace,
+		"self_deployment", c.SelfDeployment,
+		"kube_pdb_check", c.KubePDBCheck,
+		"kube_pdb_retry_interval", c.KubePDBRetryInterval.String(),
+		"kube_pdb_defer_timeout", c.KubePDBDeferTimeout.String(),
+		"tag_routes", c.TagRoutes.Len(),
+		"valkey_channels", strings.Join(c.ValkeyChannels, ","),
+		"valkey_channel_pattern", c.ValkeyChannelPattern,
+		"channel_rules", c.ChannelRules.Len(),
+		"workload_kinds", len(c.WorkloadKinds),
+		"match_strategies", strings.Join(c.MatchStrategies, ","),
+		"tag_strip_prefix", c.TagRules.StripPrefix,
+		"tag_lowercase", c.TagRules.Lowercase,
+		"semver_channels", strings.Join(c.SemverChannels, ","),
+		"registry_username", c.RegistryUsername,
+		"registry_password_set", c.RegistryPassword != "",
+		"explain_matches", c.ExplainMatches,
+		"startup_backfill", c.StartupBackfill,
+		"start_paused", c.StartPaused,
+		"startup_prefix_check", c.StartupPrefixCheck,
+		"inventory_resync_interval", c.InventoryResyncInterval.String(),
+		"registry_verify", c.RegistryVerify,
+		"registry_wait_timeout", c.RegistryWaitTimeout.String(),
+		"registry_platform_digests", c.RegistryPlatformDigests,
+		"cosign_public_key_file", c.CosignPublicKeyFile,
+		"namespace_digest_policy", c.NamespaceDigestPolicy,
+		"annotation_gc_max_age", c.AnnotationGCMaxAge.String(),
+		"annotation_gc_interval", c.AnnotationGCInterval.String(),
+		"health_listen_addr", c.HealthListenAddr,
+		"heartbeat_timeout", c.HeartbeatTimeout.String(),
+		"subscriber_buffer_size", c.SubscriberBufferSize,
+		"subscriber_health_check_interval", c.SubscriberHealthCheckInterval.String(),
+		"subscriber_overflow", c.SubscriberOverflow,
+		"notify_webhook_url_set", c.NotifyWebhookURL != "",
+		"notify_namespace_annotations", c.NotifyNamespaceAnnotations,
+		"notify_allowed_hosts", strings.Join(c.NotifyAllowedHosts, ","),
+		"notify_timeout", c.NotifyTimeout.String(),
+		"github_report", c.GitHubReport,
+		"github_api_url", c.GitHubAPIURL,
+		"github_app_id", c.GitHubAppID,
+		"github_app_installation_id", c.GitHubAppInstallationID,
+		"github_app_private_key_set", c.GitHubAppPrivateKey != "",
+		"github_status_context", c.GitHubStatusContext,
+		"github_deployment_environment", c.GitHubDeploymentEnvironment,
+		"github_timeout", c.GitHubTimeout.String(),
+		"dev_mode", c.DevMode,
+		"fault_kube_throttle_rate", c.FaultKubeThrottleRate,
+		"http_proxy", redactURL(c.HTTPProxyURL),
+		"no_proxy", c.NoProxy,
+		"payload_strictness", c.PayloadStrictness,
 		"log_level", c.LogLevel,
+		"log_format", c.LogFormat,
+		"log_output", c.LogOutput,
+		"log_file", c.LogFile,
 	)
 }
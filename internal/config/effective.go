@@ -0,0 +1,146 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sources of an effective setting, in precedence order.
+const (
+	SourceFlag    = "flag"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceDefault = "default"
+)
+
+// redacted replaces the value of a secret that is set.
+const redacted = "[redacted]"
+
+// flagEnv maps the flags whose environment variable is not the flag name in
+// upper case with underscores.
+var flagEnv = map[string]string{
+	"listen-addr":                  "WEB_LISTEN_ADDR",
+	"admin-listen-addr":            "WEB_ADMIN_LISTEN_ADDR",
+	"health-listen-addr":           "WORKER_HEALTH_LISTEN_ADDR",
+	"valkey-tls":                   "VALKEY_TLS_ENABLED",
+	"http-proxy":                   "OUTBOUND_HTTP_PROXY",
+	"no-proxy":                     "OUTBOUND_NO_PROXY",
+	"kube-events":                  "KUBE_EVENTS_ENABLED",
+	"kube-pdb-check":               "KUBE_PDB_CHECK_ENABLED",
+	"kube-tenant-impersonation":    "KUBE_TENANT_IMPERSONATION_ENABLED",
+	"explain-matches":              "EXPLAIN_MATCHES_ENABLED",
+	"startup-backfill":             "STARTUP_BACKFILL_ENABLED",
+	"startup-prefix-check":         "STARTUP_PREFIX_CHECK_ENABLED",
+	"registry-verify":              "REGISTRY_VERIFY_ENABLED",
+	"registry-platform-digests":    "REGISTRY_PLATFORM_DIGESTS_ENABLED",
+	"notify-namespace-annotations": "NOTIFY_NAMESPACE_ANNOTATIONS_ENABLED",
+	"namespace-digest-policy":      "NAMESPACE_DIGEST_POLICY_ENABLED",
+	"tag-lowercase":                "TAG_LOWERCASE_ENABLED",
+}
+
+// secretFlags are the flags whose values are redacted.
+var secretFlags = map[string]bool{
+	"valkey-password":        true,
+	"admin-token":            true,
+	"github-webhook-secret":  true,
+	"registry-password":      true,
+	"notify-webhook-url":     true,
+	"github-app-private-key": true,
+	"kube-bearer-token":      true,
+}
+
+// fileFlags are the flags whose environment variable has a _FILE variant,
+// read with envSecret.
+var fileFlags = map[string]bool{
+	"valkey-password":        true,
+	"admin-token":            true,
+	"github-webhook-secret":  true,
+	"registry-password":      true,
+	"notify-webhook-url":     true,
+	"github-app-private-key": true,
+}
+
+// urlFlags are the flags whose values are URLs that may embed a password.
+var urlFlags = map[string]bool{
+	"http-proxy":     true,
+	"jwks-proxy-url": true,
+}
+
+// Setting is one setting of the effective configuration.
+type Setting struct {
+	// Flag is the command line flag of the setting.
+	Flag string `json:"flag"`
+	// Value is the resolved value. Secrets that are set are redacted and
+	// durations are formatted like the flags accept them.
+	Value any `json:"value"`
+	// Source is where the value came from: flag, file, env or default.
+	Source string `json:"source"`
+}
+
+// Effective is the effective configuration of a mode.
+type Effective struct {
+	Mode string `json:"mode"`
+	// Settings are keyed by environment variable name.
+	Settings map[string]Setting `json:"settings"`
+}
+
+// EffectiveConfig resolves the configuration of mode ("web" or "worker")
+// from the environment and the flags in args like the mode does at startup,
+// and returns every setting with its value and source. Invalid configuration
+// returns the startup error.
+func EffectiveConfig(mode string, args []string) (*Effective, error) {
+	var fs *flag.FlagSet
+	var err error
+	switch mode {
+	case "web":
+		_, fs, err = parseWebConfig(args)
+	case "worker":
+		_, fs, err = parseWorkerConfig(args)
+	default:
+		return nil, fmt.Errorf("unknown mode %q, expected web or worker", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	effective := &Effective{Mode: mode, Settings: make(map[string]Setting)}
+	fs.VisitAll(func(f *flag.Flag) {
+		env := flagEnvName(f.Name)
+		setting := Setting{Flag: "--" + f.Name, Value: f.Value.(flag.Getter).Get(), Source: SourceDefault}
+		switch {
+		case set[f.Name]:
+			setting.Source = SourceFlag
+		case fileFlags[f.Name] && os.Getenv(env+"_FILE") != "":
+			setting.Source = SourceFile
+		case os.Getenv(env) != "":
+			setting.Source = SourceEnv
+		}
+
+		if d, ok := setting.Value.(time.Duration); ok {
+			setting.Value = d.String()
+		}
+		if v, ok := setting.Value.(string); ok && v != "" {
+			if secretFlags[f.Name] {
+				setting.Value = redacted
+			} else if urlFlags[f.Name] {
+				setting.Value = redactURL(v)
+			}
+		}
+		effective.Settings[env] = setting
+	})
+	return effective, nil
+}
+
+// flagEnvName returns the environment variable of the flag name.
+func flagEnvName(name string) string {
+	if env, ok := flagEnv[name]; ok {
+		return env
+	}
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"net"
+	"strings"
+)
+
+// Warning is a configuration that is valid but probably not what was intended.
+// Warnings are logged at startup and never prevent the process from starting.
+type Warning struct {
+	// Setting names the environment variable and flag the warning refers to.
+	Setting string
+	// Message explains the risk.
+	Message string
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// hostOf returns the host of a host:port address, or addr itself if it has no port.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func (c *CommonConfig) warnings() []Warning {
+	var warnings []Warning
+	if !c.ValkeyTLS && c.ValkeyAddr != "" && !isLoopbackHost(hostOf(c.ValkeyAddr)) {
+		warnings = append(warnings, Warning{
+			Setting: "VALKEY_TLS_ENABLED / --valkey-tls",
+			Message: "TLS is disabled for a non-local Valkey address; events and credentials are sent in plain text",
+		})
+	}
+	return warnings
+}
+
+func prefixWarnings(prefix string) []Warning {
+	// A prefix without any slash names a whole registry host, which is
+	// matched up to the host boundary
+	if strings.Contains(prefix, "/") && !strings.HasSuffix(prefix, "/") {
+		return []Warning{{
+			Setting: "ALLOWED_IMAGE_PREFIX / --allowed-image-prefix",
+			Message: "prefix does not end with a slash, so it also allows images in other repositories or organizations that share the same leading characters",
+		}}
+	}
+	return nil
+}
+
+// Warnings returns semantic warnings about the web mode configuration.
+func (c *WebConfig) Warnings() []Warning {
+	warnings := c.CommonConfig.warnings()
+	warnings = append(warnings, prefixWarnings(c.AllowedImagePrefix)...)
+	if c.DevMode && !isLoopbackHost(hostOf(c.ListenAddr)) {
+		warnings = append(warnings, Warning{
+			Setting: "DEV_MODE / --dev-mode",
+			Message: "dev mode disables OIDC signature verification but the listen address is not loopback-only; anyone who can reach it can trigger restarts",
+		})
+	}
+	return warnings
+}
+
+// Warnings returns semantic warnings about the worker mode configuration.
+func (c *WorkerConfig) Warnings() []Warning {
+	warnings := c.CommonConfig.warnings()
+	return append(warnings, prefixWarnings(c.AllowedImagePrefix)...)
+}
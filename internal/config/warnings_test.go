@@ -0,0 +1,102 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func warningSettings(warnings []Warning) string {
+	settings := make([]string, len(warnings))
+	for i, w := range warnings {
+		settings[i] = w.Setting
+	}
+	return strings.Join(settings, "|")
+}
+
+func TestWebConfig_Warnings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  WebConfig
+		want string
+	}{
+		{
+			name: "clean",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "localhost:6379"},
+				ListenAddr:         ":8080",
+				AllowedImagePrefix: "ghcr.io/myorg/",
+			},
+			want: "",
+		},
+		{
+			name: "prefix without slash",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "127.0.0.1:6379"},
+				AllowedImagePrefix: "ghcr.io/myorg",
+			},
+			want: "ALLOWED_IMAGE_PREFIX / --allowed-image-prefix",
+		},
+		{
+			name: "registry host prefix",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "localhost:6379"},
+				ListenAddr:         ":8080",
+				AllowedImagePrefix: "registry.internal:5000",
+			},
+			want: "",
+		},
+		{
+			name: "dev mode on all interfaces",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "localhost:6379"},
+				ListenAddr:         ":8080",
+				AllowedImagePrefix: "ghcr.io/myorg/",
+				DevMode:            true,
+			},
+			want: "DEV_MODE / --dev-mode",
+		},
+		{
+			name: "dev mode on loopback",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "localhost:6379"},
+				ListenAddr:         "127.0.0.1:8080",
+				AllowedImagePrefix: "ghcr.io/myorg/",
+				DevMode:            true,
+			},
+			want: "",
+		},
+		{
+			name: "remote valkey without TLS",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "valkey.example.com:6379"},
+				AllowedImagePrefix: "ghcr.io/myorg/",
+			},
+			want: "VALKEY_TLS_ENABLED / --valkey-tls",
+		},
+		{
+			name: "remote valkey with TLS",
+			cfg: WebConfig{
+				CommonConfig:       CommonConfig{ValkeyAddr: "valkey.example.com:6379", ValkeyTLS: true},
+				AllowedImagePrefix: "ghcr.io/myorg/",
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := warningSettings(tt.cfg.Warnings()); got != tt.want {
+				t.Errorf("expected warnings %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWorkerConfig_Warnings(t *testing.T) {
+	cfg := WorkerConfig{
+		CommonConfig:       CommonConfig{ValkeyAddr: "[::1]:6379"},
+		AllowedImagePrefix: "ghcr.io/myorg",
+	}
+	if got := warningSettings(cfg.Warnings()); got != "ALLOWED_IMAGE_PREFIX / --allowed-image-prefix" {
+		t.Errorf("unexpected warnings %q", got)
+	}
+}
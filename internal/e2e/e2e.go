@@ -0,0 +1,272 @@
+// Package e2e drives the web → Valkey → worker → restart path end to end
+// against running web and worker instances, so delivery semantics can be
+// checked for a real broker and cluster rather than assumed.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+// Tag is the image tag the harness publishes events for.
+const Tag = "e2e"
+
+// pollInterval is how often the test Deployment is checked for a restart.
+const pollInterval = 200 * time.Millisecond
+
+// Options configures a Harness.
+type Options struct {
+	// WebURL is the base URL of a web instance running with DEV_MODE, such as
+	// http://localhost:8080.
+	WebURL string
+	// Namespace holds the test Deployment. It is created and deleted by the
+	// run if it does not exist.
+	Namespace string
+	// Image is the image, without tag, run by the test Deployment. It must be
+	// under the ALLOWED_IMAGE_PREFIX of both the web and the worker.
+	Image string
+	// Org and Audience are the claims of the unsigned dev mode tokens, matching
+	// the web's GITHUB_ALLOWED_ORG and GITHUB_OIDC_AUDIENCE.
+	Org      string
+	Audience string
+	// Events is the number of events published, one after the other.
+	Events int
+	// Timeout is how long each event may take to restart the Deployment
+	// before it is counted as lost.
+	Timeout time.Duration
+}
+
+// Result summarizes a run.
+type Result struct {
+	// Delivered counts events whose restart was observed within the timeout.
+	Delivered int
+	// Lost counts events that were accepted but never restarted the Deployment.
+	Lost int
+	// Latencies are the times from publishing to the observed restart of each
+	// delivered event.
+	Latencies []time.Duration
+}
+
+// MaxLatency returns the slowest observed delivery.
+func (r *Result) MaxLatency() time.Duration {
+	var max time.Duration
+	for _, l := range r.Latencies {
+		if l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+// Harness publishes events and observes the resulting restarts.
+type Harness struct {
+	opts      Options
+	clientset kubernetes.Interface
+	client    *http.Client
+	logger    *slog.Logger
+}
+
+// New creates a Harness that manages the test Deployment through clientset.
+func New(opts Options, clientset kubernetes.Interface, logger *slog.Logger) *Harness {
+	return &Harness{
+		opts:      opts,
+		clientset: clientset,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		logger:    logger,
+	}
+}
+
+// Run creates a test Deployment, publishes the configured number of events
+// for its image and waits for each to restart it. The Deployment, and the
+// namespace if the run created it, are deleted afterwards. An error is
+// returned when the run could not be carried out; lost events are reported
+// in the Result.
+func (h *Harness) Run(ctx context.Context) (*Result, error) {
+	// Cleanup uses its own context so an interrupted run still removes its objects
+	cleanupCtx := context.WithoutCancel(ctx)
+
+	created, err := h.ensureNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		defer h.deleteNamespace(cleanupCtx)
+	}
+
+	name := "kuberollouttrigger-e2e-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := h.createDeployment(ctx, name); err != nil {
+		return nil, err
+	}
+	defer h.deleteDeployment(cleanupCtx, name)
+	h.logger.Info("created test deployment", "namespace", h.opts.Namespace, "deployment", name, "image", h.opts.Image+":"+Tag)
+
+	result := &Result{}
+	for i := 0; i < h.opts.Events; i++ {
+		// A unique run ID identifies the restart caused by this event in the
+		// trigger annotation, which timestamps of one second resolution cannot
+		runID := fmt.Sprintf("%s-%d", name, i)
+		start := time.Now()
+		if err := h.publish(ctx, runID); err != nil {
+			return result, fmt.Errorf("event %d: %w", i, err)
+		}
+		if err := h.waitForRestart(ctx, name, runID); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			result.Lost++
+			h.logger.Warn("event was not delivered", "event", i, "run_id", runID, "error", err)
+			continue
+		}
+		latency := time.Since(start)
+		result.Delivered++
+		result.Latencies = append(result.Latencies, latency)
+		h.logger.Info("event delivered", "event", i, "run_id", runID, "latency", latency.String())
+	}
+	return result, nil
+}
+
+// ensureNamespace creates the namespace if needed, reporting whether it did.
+func (h *Harness) ensureNamespace(ctx context.Context) (bool, error) {
+	_, err := h.clientset.CoreV1().Namespaces().Get(ctx, h.opts.Namespace, metav1.GetOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get namespace %s: %w", h.opts.Namespace, err)
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: h.opts.Namespace}}
+	if _, err := h.clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to create namespace %s: %w", h.opts.Namespace, err)
+	}
+	return true, nil
+}
+
+func (h *Harness) deleteNamespace(ctx context.Context) {
+	if err := h.clientset.CoreV1().Namespaces().Delete(ctx, h.opts.Namespace, metav1.DeleteOptions{}); err != nil {
+		h.logger.Warn("failed to delete test namespace", "namespace", h.opts.Namespace, "error", err)
+	}
+}
+
+// createDeployment creates a Deployment scaled to zero, so restarts can be
+// observed without pulling the image or scheduling pods.
+func (h *Harness) createDeployment(ctx context.Context, name string) error {
+	replicas := int32(0)
+	labels := map[string]string{"app.kubernetes.io/name": name}
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: h.opts.Namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: h.opts.Image + ":" + Tag}},
+				},
+			},
+		},
+	}
+	if _, err := h.clientset.AppsV1().Deployments(h.opts.Namespace).Create(ctx, d, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create test deployment: %w", err)
+	}
+	return nil
+}
+
+func (h *Harness) deleteDeployment(ctx context.Context, name string) {
+	if err := h.clientset.AppsV1().Deployments(h.opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		h.logger.Warn("failed to delete test deployment", "namespace", h.opts.Namespace, "deployment", name, "error", err)
+	}
+}
+
+// publish sends an event for the test image with an unsigned token carrying runID.
+func (h *Harness) publish(ctx context.Context, runID string) error {
+	token, err := DevToken(h.opts.Org, h.opts.Audience, runID)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"image": h.opts.Image, "tags": []string{Tag}})
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(h.opts.WebURL, "/")+"/event", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create event request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("event request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("event rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// waitForRestart polls the Deployment until its trigger annotation names runID.
+func (h *Harness) waitForRestart(ctx context.Context, name, runID string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		d, err := h.clientset.AppsV1().Deployments(h.opts.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			var cause k8s.RestartCause
+			if raw := d.Annotations[k8s.TriggerAnnotation]; raw != "" && json.Unmarshal([]byte(raw), &cause) == nil && cause.RunID == runID {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no restart within %s", h.opts.Timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// DevToken returns an unsigned token with the claims a web instance running
+// with DEV_MODE accepts. It is rejected by any instance verifying signatures.
+func DevToken(org, audience, runID string) (string, error) {
+	now := time.Now()
+	claims := oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		RepositoryOwner: org,
+		Repository:      org + "/kuberollouttrigger-e2e",
+		Actor:           "kuberollouttrigger-e2e",
+		RunID:           runID,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		return "", fmt.Errorf("failed to create dev token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,114 @@
+package e2e
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// pipeline stands in for the web and worker: it validates the dev token like
+// a DEV_MODE web instance and restarts every Deployment of the test namespace
+// asynchronously, unless drop reports the event should be lost.
+func pipeline(t *testing.T, clientset *fake.Clientset, drop func(n int64) bool) *httptest.Server {
+	validator := oidc.NewValidator("kuberollouttrigger", "test-org", true, testLogger())
+	restarter := k8s.NewRestarterWithClient(clientset, testLogger())
+	var received atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.ValidateToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if err != nil {
+			t.Errorf("dev token rejected: %v", err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if drop(received.Add(1)) {
+			return
+		}
+		go func() {
+			list, err := clientset.AppsV1().Deployments("e2e").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Errorf("failed to list deployments: %v", err)
+				return
+			}
+			for _, d := range list.Items {
+				restarter.RestartDeployment(context.Background(), d.Namespace, d.Name, &k8s.RestartCause{RunID: claims.RunID})
+			}
+		}()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testOptions(webURL string) Options {
+	return Options{
+		WebURL:    webURL,
+		Namespace: "e2e",
+		Image:     "ghcr.io/test/e2e",
+		Org:       "test-org",
+		Audience:  "kuberollouttrigger",
+		Events:    3,
+		Timeout:   2 * time.Second,
+	}
+}
+
+func TestHarness_Run(t *testing.T) {
+	clientset := fake.NewClientset()
+	srv := pipeline(t, clientset, func(int64) bool { return false })
+
+	result, err := New(testOptions(srv.URL), clientset, testLogger()).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Delivered != 3 || result.Lost != 0 || len(result.Latencies) != 3 {
+		t.Errorf("expected 3 delivered events, got %+v", result)
+	}
+
+	// The namespace and Deployment created by the run are removed
+	if _, err := clientset.CoreV1().Namespaces().Get(context.Background(), "e2e", metav1.GetOptions{}); err == nil {
+		t.Error("expected the test namespace to be deleted")
+	}
+}
+
+func TestHarness_RunReportsLostEvents(t *testing.T) {
+	clientset := fake.NewClientset()
+	srv := pipeline(t, clientset, func(n int64) bool { return n == 2 })
+
+	opts := testOptions(srv.URL)
+	opts.Timeout = 500 * time.Millisecond
+	result, err := New(opts, clientset, testLogger()).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Delivered != 2 || result.Lost != 1 {
+		t.Errorf("expected 2 delivered and 1 lost event, got %+v", result)
+	}
+}
+
+func TestHarness_RunRejectedEvent(t *testing.T) {
+	clientset := fake.NewClientset()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	if _, err := New(testOptions(srv.URL), clientset, testLogger()).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the rejected event to fail the run, got %v", err)
+	}
+}
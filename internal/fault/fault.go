@@ -0,0 +1,81 @@
+// Package fault injects simulated failures at fixed points, so operators can
+// rehearse failure modes and check that alerts fire. It is only enabled in
+// dev mode.
+package fault
+
+import (
+	"errors"
+	"math/rand/v2"
+)
+
+// Point is a place where a failure can be injected.
+type Point string
+
+const (
+	// ValkeyPublish fails publishing a message to Valkey.
+	ValkeyPublish Point = "valkey_publish"
+	// JWKS fails token validation as if the JWKS could not be fetched.
+	JWKS Point = "jwks"
+	// KubeThrottle answers Kubernetes API requests with 429 Too Many Requests.
+	KubeThrottle Point = "kube_throttle"
+)
+
+// ErrInjected is wrapped by every injected failure.
+var ErrInjected = errors.New("injected fault")
+
+// Injector decides whether an injected failure occurs at each point. A nil
+// *Injector never injects anything, so callers need not check for it.
+type Injector struct {
+	rates   map[Point]float64
+	observe func(Point)
+	random  func() float64
+}
+
+// New creates an Injector failing each point with the given probability,
+// between 0 (never) and 1 (always), calling observe, if non-nil, for each
+// injected failure. It returns nil if no rate is positive.
+func New(rates map[Point]float64, observe func(Point)) *Injector {
+	i := &Injector{
+		rates:   make(map[Point]float64),
+		observe: observe,
+		random:  rand.Float64,
+	}
+	for p, rate := range rates {
+		if rate > 0 {
+			i.rates[p] = rate
+		}
+	}
+	if len(i.rates) == 0 {
+		return nil
+	}
+	return i
+}
+
+// Fail reports whether a failure should be injected at p now.
+func (i *Injector) Fail(p Point) bool {
+	if i == nil {
+		return false
+	}
+	rate, ok := i.rates[p]
+	if !ok || i.random() >= rate {
+		return false
+	}
+	if i.observe != nil {
+		i.observe(p)
+	}
+	return true
+}
+
+// Points returns the points with a positive failure rate.
+func (i *Injector) Points() []Point {
+	if i == nil {
+		return nil
+	}
+	var points []Point
+	for _, p := range []Point{ValkeyPublish, JWKS, KubeThrottle} {
+		if _, ok := i.rates[p]; ok {
+			points = append(points, p)
+		}
+	}
+	return points
+}
@@ -0,0 +1,38 @@
+package fault
+
+import "testing"
+
+func TestInjector_Fail(t *testing.T) {
+	var nilInjector *Injector
+	if nilInjector.Fail(ValkeyPublish) || nilInjector.Points() != nil {
+		t.Error("expected a nil injector to inject nothing")
+	}
+	if New(map[Point]float64{ValkeyPublish: 0}, nil) != nil {
+		t.Error("expected no injector without a positive rate")
+	}
+
+	var observed []Point
+	i := New(map[Point]float64{ValkeyPublish: 1, JWKS: 0.5}, func(p Point) { observed = append(observed, p) })
+	if !i.Fail(ValkeyPublish) {
+		t.Error("expected a rate of 1 to always fail")
+	}
+	if i.Fail(KubeThrottle) {
+		t.Error("expected a point without a rate never to fail")
+	}
+
+	i.random = func() float64 { return 0.7 }
+	if i.Fail(JWKS) {
+		t.Error("expected no failure above the rate")
+	}
+	i.random = func() float64 { return 0.2 }
+	if !i.Fail(JWKS) {
+		t.Error("expected a failure below the rate")
+	}
+
+	if len(observed) != 2 || observed[0] != ValkeyPublish || observed[1] != JWKS {
+		t.Errorf("unexpected observed failures %v", observed)
+	}
+	if points := i.Points(); len(points) != 2 || points[0] != ValkeyPublish || points[1] != JWKS {
+		t.Errorf("unexpected points %v", points)
+	}
+}
@@ -0,0 +1,335 @@
+// Package github reports rollout results back to the repository whose
+// workflow triggered them, as a commit status or a GitHub Deployment, using
+// the installation token of a GitHub App.
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Report modes.
+const (
+	// ModeStatus sets a commit status on the triggering commit.
+	ModeStatus = "status"
+	// ModeDeployment creates a GitHub Deployment for the triggering commit
+	// and sets its status.
+	ModeDeployment = "deployment"
+)
+
+// DefaultAPIURL is the REST API of github.com.
+const DefaultAPIURL = "https://api.github.com"
+
+// maxDescription is the longest status description GitHub accepts.
+const maxDescription = 140
+
+// tokenRefreshMargin renews an installation token this long before it
+// expires, so a request never starts with a token about to expire.
+const tokenRefreshMargin = 5 * time.Minute
+
+// Options configures a Reporter.
+type Options struct {
+	// Mode is ModeStatus or ModeDeployment.
+	Mode string
+	// APIURL is the REST API base URL, https://<host>/api/v3 for GitHub
+	// Enterprise Server. Empty uses DefaultAPIURL.
+	APIURL string
+	// AppID identifies the GitHub App.
+	AppID int64
+	// InstallationID identifies the installation of the App whose token is
+	// used. It must have access to the triggering repositories.
+	InstallationID int64
+	// PrivateKey is the PEM encoded private key of the App.
+	PrivateKey string
+	// Context is the commit status context, which tells apart the statuses
+	// of several clusters.
+	Context string
+	// Environment is the deployment environment in ModeDeployment.
+	Environment string
+	// Timeout bounds each API request.
+	Timeout time.Duration
+	// Transport sends the API requests, for example through a proxy. Nil
+	// uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Report is the result of one rollout to report.
+type Report struct {
+	// Repository is the triggering repository as owner/name.
+	Repository string
+	// SHA is the triggering commit.
+	SHA string
+	// RunID is the triggering workflow run, linked from the status. Empty
+	// links nothing.
+	RunID string
+	// Restarted lists the restarted workloads, such as Deployment dev/api.
+	Restarted []string
+	// Deferred, Failed and Skipped count the workloads that were not
+	// restarted. Any failed or skipped workload fails the report.
+	Deferred, Failed, Skipped int
+}
+
+// Reporter reports rollout results to GitHub.
+type Reporter struct {
+	opts   Options
+	key    *rsa.PrivateKey
+	client *http.Client
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+// New creates a Reporter. It returns an error if the private key is invalid.
+func New(opts Options, logger *slog.Logger) (*Reporter, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(opts.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = DefaultAPIURL
+	}
+	opts.APIURL = strings.TrimSuffix(opts.APIURL, "/")
+	return &Reporter{
+		opts:   opts,
+		key:    key,
+		client: &http.Client{Timeout: opts.Timeout, Transport: opts.Transport},
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+// Sent returns the number of reports delivered.
+func (r *Reporter) Sent() int64 {
+	return r.sent.Load()
+}
+
+// Failed returns the number of reports that could not be delivered.
+func (r *Reporter) Failed() int64 {
+	return r.failed.Load()
+}
+
+// Report reports the result of a rollout. Delivery failures are logged and
+// never returned, so reports cannot affect restarts.
+func (r *Reporter) Report(ctx context.Context, report Report) {
+	if report.Repository == "" || report.SHA == "" {
+		r.logger.Debug("not reporting rollout to GitHub, the trigger has no repository or commit")
+		return
+	}
+	var err error
+	if r.opts.Mode == ModeDeployment {
+		err = r.reportDeployment(ctx, report)
+	} else {
+		err = r.reportStatus(ctx, report)
+	}
+	if err != nil {
+		r.failed.Add(1)
+		r.logger.Warn("failed to report rollout to GitHub", "repository", report.Repository, "sha", report.SHA, "error", err)
+		return
+	}
+	r.sent.Add(1)
+	r.logger.Debug("reported rollout to GitHub", "repository", report.Repository, "sha", report.SHA, "mode", r.opts.Mode)
+}
+
+// reportStatus sets a commit status on the triggering commit.
+func (r *Reporter) reportStatus(ctx context.Context, report Report) error {
+	body := map[string]string{
+		"state":       state(report),
+		"context":     r.opts.Context,
+		"description": description(report),
+	}
+	if runURL := r.runURL(report); runURL != "" {
+		body["target_url"] = runURL
+	}
+	return r.post(ctx, "/repos/"+report.Repository+"/statuses/"+report.SHA, body, nil)
+}
+
+// reportDeployment creates a deployment of the triggering commit and sets its
+// status.
+func (r *Reporter) reportDeployment(ctx context.Context, report Report) error {
+	var deployment struct {
+		ID int64 `json:"id"`
+	}
+	err := r.post(ctx, "/repos/"+report.Repository+"/deployments", map[string]any{
+		"ref":         report.SHA,
+		"environment": r.opts.Environment,
+		"description": "Rollout restart by kuberollouttrigger",
+		"auto_merge":  false,
+		// The image is already built, so no commit status has to pass first
+		"required_contexts": []string{},
+	}, &deployment)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	body := map[string]string{
+		"state":       state(report),
+		"environment": r.opts.Environment,
+		"description": description(report),
+	}
+	if runURL := r.runURL(report); runURL != "" {
+		body["log_url"] = runURL
+	}
+	path := "/repos/" + report.Repository + "/deployments/" + strconv.FormatInt(deployment.ID, 10) + "/statuses"
+	if err := r.post(ctx, path, body, nil); err != nil {
+		return fmt.Errorf("failed to set status of deployment %d: %w", deployment.ID, err)
+	}
+	return nil
+}
+
+// post sends body as JSON to the API path with the installation token and
+// decodes the response into out unless it is nil.
+func (r *Reporter) post(ctx context.Context, path string, body, out any) error {
+	token, err := r.installationToken(ctx)
+	if err != nil {
+		return err
+	}
+	return r.do(ctx, path, "token "+token, body, out)
+}
+
+func (r *Reporter) do(ctx context.Context, path, authorization string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.opts.APIURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("request to %s returned status %d: %s", path, resp.StatusCode, apiMessage(resp.Body))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// installationToken returns a cached installation token, requesting a new
+// one with an App JWT when it is missing or about to expire.
+func (r *Reporter) installationToken(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token != "" && r.now().Before(r.tokenExpiry.Add(-tokenRefreshMargin)) {
+		return r.token, nil
+	}
+
+	now := r.now()
+	appJWT, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer: strconv.FormatInt(r.opts.AppID, 10),
+		// Backdated to allow for clock drift, as GitHub recommends
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	}).SignedString(r.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/app/installations/" + strconv.FormatInt(r.opts.InstallationID, 10) + "/access_tokens"
+	if err := r.do(ctx, path, "Bearer "+appJWT, map[string]any{}, &token); err != nil {
+		return "", fmt.Errorf("failed to get installation token: %w", err)
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("failed to get installation token: empty token in response")
+	}
+	r.token, r.tokenExpiry = token.Token, token.ExpiresAt
+	return r.token, nil
+}
+
+// runURL returns the web URL of the triggering workflow run, or an empty
+// string if it is unknown.
+func (r *Reporter) runURL(report Report) string {
+	if report.RunID == "" {
+		return ""
+	}
+	return webURL(r.opts.APIURL) + "/" + report.Repository + "/actions/runs/" + url.PathEscape(report.RunID)
+}
+
+// webURL returns the web URL of the GitHub instance serving apiURL.
+func webURL(apiURL string) string {
+	if apiURL == DefaultAPIURL {
+		return "https://github.com"
+	}
+	return strings.TrimSuffix(apiURL, "/api/v3")
+}
+
+// state returns the status state of a report, which commit and deployment
+// statuses share.
+func state(report Report) string {
+	if report.Failed+report.Skipped > 0 {
+		return "failure"
+	}
+	return "success"
+}
+
+// description summarizes a report within the length GitHub accepts.
+func description(report Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Restarted %d", len(report.Restarted))
+	for _, n := range []struct {
+		count int
+		what  string
+	}{{report.Deferred, "deferred"}, {report.Failed, "failed"}, {report.Skipped, "skipped"}} {
+		if n.count > 0 {
+			fmt.Fprintf(&b, ", %d %s", n.count, n.what)
+		}
+	}
+	if len(report.Restarted) > 0 {
+		b.WriteString(": " + strings.Join(report.Restarted, ", "))
+	}
+	text := b.String()
+	if utf8.RuneCountInString(text) <= maxDescription {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:maxDescription-1]) + "…"
+}
+
+// apiMessage returns the message of a GitHub API error response.
+func apiMessage(body io.Reader) string {
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(body, 4096))
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+		return apiErr.Message
+	}
+	return strings.TrimSpace(string(data))
+}
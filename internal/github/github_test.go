@@ -0,0 +1,230 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeGitHub serves the installation token, commit status and deployment
+// endpoints and records the requests.
+type fakeGitHub struct {
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	mu       sync.Mutex
+	tokens   int
+	requests map[string][]map[string]any
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *httptest.Server) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	gh := &fakeGitHub{t: t, key: key, requests: make(map[string][]map[string]any)}
+	srv := httptest.NewServer(gh)
+	t.Cleanup(srv.Close)
+	return gh, srv
+}
+
+func (gh *fakeGitHub) privateKeyPEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(gh.key)}))
+}
+
+func (gh *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+
+	auth := r.Header.Get("Authorization")
+	if r.URL.Path == "/app/installations/7/access_tokens" {
+		claims := &jwt.RegisteredClaims{}
+		_, err := jwt.ParseWithClaims(strings.TrimPrefix(auth, "Bearer "), claims, func(*jwt.Token) (any, error) {
+			return &gh.key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}))
+		if err != nil || claims.Issuer != "42" {
+			gh.t.Errorf("invalid App JWT: %v, issuer %q", err, claims.Issuer)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		gh.tokens++
+		json.NewEncoder(w).Encode(map[string]any{
+			"token":      "ghs_test",
+			"expires_at": time.Now().Add(time.Hour),
+		})
+		return
+	}
+	if auth != "token ghs_test" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"Bad credentials"}`))
+		return
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		gh.t.Errorf("failed to decode request to %s: %v", r.URL.Path, err)
+	}
+	gh.requests[r.URL.Path] = append(gh.requests[r.URL.Path], body)
+	switch r.URL.Path {
+	case "/repos/test-org/app/deployments":
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":99}`))
+	case "/repos/test-org/missing/statuses/abc123":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Not Found"}`))
+	default:
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}
+}
+
+func (gh *fakeGitHub) received(path string) []map[string]any {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	return gh.requests[path]
+}
+
+func newTestReporter(t *testing.T, gh *fakeGitHub, srv *httptest.Server, mode string) *Reporter {
+	t.Helper()
+	r, err := New(Options{
+		Mode:           mode,
+		APIURL:         srv.URL + "/",
+		AppID:          42,
+		InstallationID: 7,
+		PrivateKey:     gh.privateKeyPEM(),
+		Context:        "kuberollouttrigger/prod",
+		Environment:    "prod",
+		Timeout:        5 * time.Second,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+func TestReporter_Status(t *testing.T) {
+	gh, srv := newFakeGitHub(t)
+	r := newTestReporter(t, gh, srv, ModeStatus)
+
+	r.Report(context.Background(), Report{
+		Repository: "test-org/app",
+		SHA:        "abc123",
+		RunID:      "1001",
+		Restarted:  []string{"Deployment dev/api", "Deployment dev/web"},
+	})
+	r.Report(context.Background(), Report{
+		Repository: "test-org/app",
+		SHA:        "def456",
+		Restarted:  []string{"Deployment dev/api"},
+		Failed:     1,
+	})
+
+	statuses := gh.received("/repos/test-org/app/statuses/abc123")
+	if len(statuses) != 1 {
+		t.Fatalf("expected one status, got %d", len(statuses))
+	}
+	want := map[string]any{
+		"state":       "success",
+		"context":     "kuberollouttrigger/prod",
+		"description": "Restarted 2: Deployment dev/api, Deployment dev/web",
+		"target_url":  srv.URL + "/test-org/app/actions/runs/1001",
+	}
+	for k, v := range want {
+		if statuses[0][k] != v {
+			t.Errorf("expected %s %q, got %q", k, v, statuses[0][k])
+		}
+	}
+	failed := gh.received("/repos/test-org/app/statuses/def456")
+	if len(failed) != 1 || failed[0]["state"] != "failure" || failed[0]["description"] != "Restarted 1, 1 failed: Deployment dev/api" {
+		t.Errorf("unexpected failure status %v", failed)
+	}
+	if gh.tokens != 1 {
+		t.Errorf("expected the installation token to be reused, got %d token requests", gh.tokens)
+	}
+	if r.Sent() != 2 || r.Failed() != 0 {
+		t.Errorf("expected 2 sent and 0 failed, got %d and %d", r.Sent(), r.Failed())
+	}
+}
+
+func TestReporter_Deployment(t *testing.T) {
+	gh, srv := newFakeGitHub(t)
+	r := newTestReporter(t, gh, srv, ModeDeployment)
+
+	r.Report(context.Background(), Report{
+		Repository: "test-org/app",
+		SHA:        "abc123",
+		Restarted:  []string{"Deployment prod/api"},
+		Deferred:   1,
+	})
+
+	deployments := gh.received("/repos/test-org/app/deployments")
+	if len(deployments) != 1 || deployments[0]["ref"] != "abc123" || deployments[0]["environment"] != "prod" {
+		t.Fatalf("unexpected deployments %v", deployments)
+	}
+	statuses := gh.received("/repos/test-org/app/deployments/99/statuses")
+	if len(statuses) != 1 || statuses[0]["state"] != "success" || statuses[0]["description"] != "Restarted 1, 1 deferred: Deployment prod/api" {
+		t.Errorf("unexpected deployment statuses %v", statuses)
+	}
+	if _, ok := statuses[0]["log_url"]; ok {
+		t.Errorf("expected no log URL without a run ID, got %v", statuses[0]["log_url"])
+	}
+}
+
+func TestReporter_Failures(t *testing.T) {
+	gh, srv := newFakeGitHub(t)
+	r := newTestReporter(t, gh, srv, ModeStatus)
+
+	r.Report(context.Background(), Report{Repository: "test-org/missing", SHA: "abc123"})
+	if r.Failed() != 1 || r.Sent() != 0 {
+		t.Errorf("expected 1 failed report, got %d failed and %d sent", r.Failed(), r.Sent())
+	}
+
+	// Triggers from older web instances carry no commit
+	r.Report(context.Background(), Report{Repository: "test-org/app"})
+	if r.Failed() != 1 || r.Sent() != 0 || gh.tokens != 1 {
+		t.Errorf("expected a report without a commit to be skipped")
+	}
+
+	if _, err := New(Options{PrivateKey: "not a key"}, testLogger()); err == nil {
+		t.Error("expected an invalid private key to be rejected")
+	}
+}
+
+func TestDescription_Truncated(t *testing.T) {
+	var restarted []string
+	for i := 0; i < 20; i++ {
+		restarted = append(restarted, "Deployment production/service")
+	}
+	got := description(Report{Restarted: restarted})
+	if n := len([]rune(got)); n != maxDescription || !strings.HasSuffix(got, "…") {
+		t.Errorf("expected a truncated description of %d characters, got %d: %q", maxDescription, n, got)
+	}
+}
+
+func TestWebURL(t *testing.T) {
+	for apiURL, want := range map[string]string{
+		DefaultAPIURL:                       "https://github.com",
+		"https://github.example.com/api/v3": "https://github.example.com",
+	} {
+		if got := webURL(apiURL); got != want {
+			t.Errorf("webURL(%q) = %q, want %q", apiURL, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package httpclient creates the HTTP clients used for outbound calls, with
+// connection pooling, proxy and CA bundle settings that plain http.Client
+// values do not expose.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Options configures an HTTP client.
+type Options struct {
+	// Timeout bounds each request, including reading the response body.
+	Timeout time.Duration
+	// ProxyURL is the proxy used for every request, as http://, https:// or
+	// socks5:// URL. Empty uses HTTPS_PROXY and HTTP_PROXY from the
+	// environment.
+	ProxyURL string
+	// NoProxy lists destinations reached directly, in NO_PROXY syntax: host
+	// names, domain suffixes such as .internal, IP addresses and CIDR ranges,
+	// each optionally with a port. Empty uses NO_PROXY from the environment.
+	// Loopback destinations are never proxied.
+	NoProxy string
+	// CAFile is a PEM bundle of CA certificates trusted in addition to the
+	// system roots, such as the CA of a TLS intercepting proxy.
+	CAFile string
+}
+
+// Validate checks the proxy URL and loads the CA bundle, so configuration
+// errors are reported before the first request.
+func (o Options) Validate() error {
+	if _, err := o.proxy(); err != nil {
+		return err
+	}
+	if _, err := o.rootCAs(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// New creates an HTTP client for opts.
+func New(opts Options) (*http.Client, error) {
+	transport, err := NewTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: opts.Timeout, Transport: transport}, nil
+}
+
+// NewTransport creates the transport of an HTTP client for opts, for clients
+// that set their own timeout. Timeout is ignored.
+func NewTransport(opts Options) (*http.Transport, error) {
+	proxy, err := opts.proxy()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := opts.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Cloning keeps the dial and TLS handshake timeouts and HTTP/2 of the
+	// default transport
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.MaxIdleConns = 16
+	transport.MaxIdleConnsPerHost = 4
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.ForceAttemptHTTP2 = true
+	if roots != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return transport, nil
+}
+
+// proxy returns the proxy function for ProxyURL and NoProxy, falling back to
+// the environment for the one that is not set.
+func (o Options) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if o.ProxyURL == "" && o.NoProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	cfg := httpproxy.FromEnvironment()
+	if o.ProxyURL != "" {
+		u, err := url.Parse(o.ProxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("proxy URL %q must be an absolute URL", o.ProxyURL)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy URL %q must use http, https or socks5", o.ProxyURL)
+		}
+		cfg.HTTPProxy, cfg.HTTPSProxy = o.ProxyURL, o.ProxyURL
+	}
+	if o.NoProxy != "" {
+		cfg.NoProxy = o.NoProxy
+	}
+	proxyFunc := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+// rootCAs returns the system roots plus the certificates of CAFile, or nil
+// to use the system roots alone.
+func (o Options) rootCAs() (*x509.CertPool, error) {
+	if o.CAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(o.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA file %s contains no PEM certificates", o.CAFile)
+	}
+	return pool, nil
+}
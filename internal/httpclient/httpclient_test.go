@@ -0,0 +1,116 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNew_ProxyURL(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the destination
+		proxied <- r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	client, err := New(Options{Timeout: 5 * time.Second, ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get("http://jwks.example.invalid/keys")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got := <-proxied; got != "http://jwks.example.invalid/keys" {
+		t.Errorf("expected the request to go through the proxy, got %q", got)
+	}
+}
+
+func TestOptions_NoProxy(t *testing.T) {
+	proxy, err := Options{ProxyURL: "http://proxy.internal:3128", NoProxy: ".svc.cluster.local,10.0.0.0/8"}.proxy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for target, want := range map[string]string{
+		"https://ghcr.io/v2/":                             "http://proxy.internal:3128",
+		"http://token.actions.githubusercontent.com/keys": "http://proxy.internal:3128",
+		"http://hooks.notify.svc.cluster.local/rollout":   "",
+		"https://10.1.2.3/v2/":                            "",
+		"http://127.0.0.1:8080/":                          "",
+	} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := proxy(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", target, err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != want {
+			t.Errorf("%s: expected proxy %q, got %q", target, want, got)
+		}
+	}
+}
+
+func TestNew_CAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// The test server's certificate is not trusted by the system roots
+	plain, err := New(Options{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := plain.Get(srv.URL); err == nil {
+		t.Fatal("expected an untrusted certificate to be rejected")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(Options{Timeout: 5 * time.Second, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the CA file to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestOptions_Validate(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, opts := range map[string]Options{
+		"relative proxy":    {ProxyURL: "proxy:3128"},
+		"unsupported proxy": {ProxyURL: "ftp://proxy:21"},
+		"missing CA file":   {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"CA file not PEM":   {CAFile: notPEM},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := (Options{ProxyURL: "http://proxy.internal:3128"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package imageref compares and validates container image references the way
+// registries and the container runtime interpret them, so that references with
+// registry ports or differently cased hosts still match.
+package imageref
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// namePattern matches an image name without tag or digest: an optional
+	// registry host with port followed by lowercase path components, as
+	// defined by the OCI distribution reference grammar.
+	namePattern = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?/)?` +
+		`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+	// tagPattern matches an image tag.
+	tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+)
+
+// splitHost splits ref into the registry host (with port) and the rest. The
+// first path component is a host if it contains a dot or colon, is
+// localhost, or has uppercase letters, following the Docker convention.
+// References without a host return an empty host.
+func splitHost(ref string) (host, rest string) {
+	i := strings.IndexByte(ref, '/')
+	if i < 0 {
+		return "", ref
+	}
+	first := ref[:i]
+	if strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first {
+		return first, ref[i:]
+	}
+	return "", ref
+}
+
+// Normalize returns ref with its registry host lowercased. Hosts are case
+// insensitive, while repository paths and tags are not. A ref whose host is
+// already lowercase is returned as is, without allocating.
+func Normalize(ref string) string {
+	host, rest := splitHost(ref)
+	lower := strings.ToLower(host)
+	if lower == host {
+		return ref
+	}
+	return lower + rest
+}
+
+// Equal reports whether two image references name the same image.
+func Equal(a, b string) bool {
+	return Normalize(a) == Normalize(b)
+}
+
+// HasPrefix reports whether image starts with prefix, ignoring the case of
+// the registry host. A prefix without a slash names a registry host and
+// must match the whole host and port, so registry.internal:5000 does not
+// match registry.internal:50001/app. An empty prefix matches every image.
+func HasPrefix(image, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	image = Normalize(image)
+	if !strings.Contains(prefix, "/") {
+		prefix = strings.ToLower(prefix)
+		rest, ok := strings.CutPrefix(image, prefix)
+		return ok && strings.HasPrefix(rest, "/")
+	}
+	return strings.HasPrefix(image, Normalize(prefix))
+}
+
+// ValidateName returns an error if name is not an image name without tag or
+// digest, such as ghcr.io/org/app or registry.internal:5000/team/app.
+func ValidateName(name string) error {
+	if strings.Contains(name, "@") {
+		return fmt.Errorf("image %q must not include a digest", name)
+	}
+	if _, rest := splitHost(name); strings.Contains(rest, ":") {
+		return fmt.Errorf("image %q must not include a tag", name)
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("image %q is not a valid container image reference", name)
+	}
+	return nil
+}
+
+// ValidateTag returns an error if tag is not a valid image tag.
+func ValidateTag(tag string) error {
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("tag %q is not a valid image tag", tag)
+	}
+	return nil
+}
+
+// TagRules normalize image tags before they are compared, for registries
+// and deployments that spell the same version differently, such as v1.2.3
+// and 1.2.3. The zero TagRules compares tags as they are.
+type TagRules struct {
+	// Lowercase compares tags case-insensitively.
+	Lowercase bool
+	// StripPrefix is removed from the start of tags, so that with "v" the
+	// tags v1.2.3 and 1.2.3 are equal.
+	StripPrefix string
+}
+
+// Validate returns an error if the prefix could never start a valid tag.
+func (r TagRules) Validate() error {
+	if r.StripPrefix != "" && !tagPattern.MatchString(r.StripPrefix) {
+		return fmt.Errorf("tag prefix %q is not a valid image tag prefix", r.StripPrefix)
+	}
+	return nil
+}
+
+// Tag returns tag normalized by the rules. A tag consisting of the prefix
+// alone is kept, since stripping it would leave no tag.
+func (r TagRules) Tag(tag string) string {
+	prefix := r.StripPrefix
+	if r.Lowercase {
+		tag, prefix = strings.ToLower(tag), strings.ToLower(prefix)
+	}
+	if rest, ok := strings.CutPrefix(tag, prefix); ok && rest != "" {
+		return rest
+	}
+	return tag
+}
+
+// Ref returns ref with its tag normalized by the rules. References without
+// a tag, or pinned by digest, are returned as is.
+func (r TagRules) Ref(ref string) string {
+	if r == (TagRules{}) || strings.Contains(ref, "@") {
+		return ref
+	}
+	_, rest := splitHost(ref)
+	i := strings.LastIndexByte(rest, ':')
+	if i < 0 {
+		return ref
+	}
+	i += len(ref) - len(rest)
+	return ref[:i+1] + r.Tag(ref[i+1:])
+}
@@ -0,0 +1,155 @@
+package imageref
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"ghcr.io/org/app:dev", "ghcr.io/org/app:dev", true},
+		{"GHCR.io/org/app:dev", "ghcr.io/org/app:dev", true},
+		{"Registry.Internal:5000/team/app:v1", "registry.internal:5000/team/app:v1", true},
+		{"registry.internal:5000/team/app:v1", "registry.internal:5001/team/app:v1", false},
+		{"registry.internal:5000/team/app:v1", "registry.internal/team/app:v1", false},
+		{"localhost:5000/app:dev", "LOCALHOST:5000/app:dev", true},
+		{"10.0.0.1:5000/team/app:dev", "10.0.0.1:5000/team/app:dev", true},
+		{"ghcr.io/org/app:Dev", "ghcr.io/org/app:dev", false},
+		{"ghcr.io/Org/app:dev", "ghcr.io/org/app:dev", false},
+		{"ghcr.io/org/app:dev@sha256:abc", "ghcr.io/org/app:dev", false},
+	}
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equal(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for ref, want := range map[string]string{
+		"GHCR.io/Org/App:Dev": "ghcr.io/Org/App:Dev",
+		"ghcr.io/org/app:dev": "ghcr.io/org/app:dev",
+		"Registry:5000/app":   "registry:5000/app",
+		"library/nginx":       "library/nginx",
+		"nginx":               "nginx",
+	} {
+		if got := Normalize(ref); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", ref, got, want)
+		}
+	}
+
+	// Matching runs for every container in the cluster, so the common case
+	// of an already lowercase host must not allocate
+	if allocs := testing.AllocsPerRun(100, func() { Normalize("ghcr.io/org/app:dev") }); allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	tests := []struct {
+		image, prefix string
+		want          bool
+	}{
+		{"ghcr.io/org/app", "ghcr.io/org/", true},
+		{"GHCR.IO/org/app", "ghcr.io/org/", true},
+		{"ghcr.io/org/app", "GHCR.io/org/", true},
+		{"ghcr.io/other/app", "ghcr.io/org/", false},
+		{"ghcr.io/Org/app", "ghcr.io/org/", false},
+		{"registry.internal:5000/team/app", "registry.internal:5000/team/", true},
+		{"Registry.Internal:5000/team/app", "registry.internal:5000/", true},
+		{"registry.internal:5000/team/app", "registry.internal:5000", true},
+		{"registry.internal:50001/team/app", "registry.internal:5000", false},
+		{"registry.internal:5000/team/app", "registry.internal", false},
+		{"registry.internal/team/app", "registry.internal", true},
+		{"registry.internal.evil.com/team/app", "registry.internal", false},
+		{"localhost:5000/app", "localhost:5000/", true},
+		{"anything.example/app", "", true},
+	}
+	for _, tt := range tests {
+		if got := HasPrefix(tt.image, tt.prefix); got != tt.want {
+			t.Errorf("HasPrefix(%q, %q) = %v, want %v", tt.image, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	valid := []string{
+		"ghcr.io/org/app",
+		"ghcr.io/org/team/app",
+		"registry.internal:5000/team/app",
+		"Registry.Internal:5000/team/app",
+		"localhost:5000/app",
+		"10.0.0.1:5000/team/app",
+		"registry-1.example.com/org/my_app",
+		"ghcr.io/org/app__v2",
+		"ghcr.io/org/app--beta",
+	}
+	for _, name := range valid {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) unexpected error: %v", name, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"ghcr.io/org/app:dev",
+		"registry.internal:5000/team/app:v1",
+		"ghcr.io/org/app@sha256:abc",
+		"ghcr.io/Org/app",
+		"ghcr.io/org//app",
+		"ghcr.io/org/app/",
+		"ghcr.io/org/-app",
+		"registry.internal:port/team/app",
+		"ghcr.io/org/app name",
+	}
+	for _, name := range invalid {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) expected error", name)
+		}
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	for _, tag := range []string{"dev", "v1.2.3", "release-1.2", "sha_abc", "_internal", "V1"} {
+		if err := ValidateTag(tag); err != nil {
+			t.Errorf("ValidateTag(%q) unexpected error: %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"", "-dev", ".dev", "dev:1", "dev/1", "dev@1", string(make([]byte, 129))} {
+		if err := ValidateTag(tag); err == nil {
+			t.Errorf("ValidateTag(%q) expected error", tag)
+		}
+	}
+}
+
+func TestTagRules(t *testing.T) {
+	rules := TagRules{Lowercase: true, StripPrefix: "V"}
+	for ref, want := range map[string]string{
+		"ghcr.io/org/app:v1.2.3":             "ghcr.io/org/app:1.2.3",
+		"ghcr.io/org/app:1.2.3":              "ghcr.io/org/app:1.2.3",
+		"ghcr.io/org/app:Release-A":          "ghcr.io/org/app:release-a",
+		"ghcr.io/org/app:v":                  "ghcr.io/org/app:v",
+		"registry.internal:5000/team/app:V2": "registry.internal:5000/team/app:2",
+		"registry.internal:5000/team/app":    "registry.internal:5000/team/app",
+		"ghcr.io/org/app:v1@sha256:abc":      "ghcr.io/org/app:v1@sha256:abc",
+		"localhost:5000/app:Dev":             "localhost:5000/app:dev",
+	} {
+		if got := rules.Ref(ref); got != want {
+			t.Errorf("Ref(%q) = %q, want %q", ref, got, want)
+		}
+	}
+
+	if got := (TagRules{}).Ref("ghcr.io/org/app:V1"); got != "ghcr.io/org/app:V1" {
+		t.Errorf("expected the zero rules to keep the tag, got %q", got)
+	}
+	if got := (TagRules{StripPrefix: "release-"}).Tag("release-42"); got != "42" {
+		t.Errorf("expected the prefix to be stripped, got %q", got)
+	}
+
+	if err := (TagRules{StripPrefix: "v"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (TagRules{StripPrefix: "v/"}).Validate(); err == nil {
+		t.Error("expected an error for a prefix that is not part of a tag")
+	}
+}
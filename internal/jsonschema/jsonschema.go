@@ -0,0 +1,454 @@
+// Package jsonschema validates JSON documents against the subset of JSON
+// Schema (draft 2020-12) used by the schemas kuberollouttrigger publishes.
+// Keywords outside that subset are rejected when compiling, so a schema never
+// silently checks less than it states.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// annotations are keywords that do not affect validation.
+var annotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"$defs":       true,
+	"title":       true,
+	"description": true,
+	"examples":    true,
+	"default":     true,
+}
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	root *node
+	defs map[string]*node
+}
+
+// node is one compiled schema or subschema.
+type node struct {
+	// always is set for the boolean schemas true and false.
+	always *bool
+	title  string
+
+	ref                  string
+	types                []string
+	enum                 []any
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	items                *node
+	minItems, maxItems   int
+	uniqueItems          bool
+	minLength, maxLength int
+	pattern              *regexp.Regexp
+	oneOf                []*node
+	not                  *node
+}
+
+// ValidationError reports where a document does not match its schema.
+type ValidationError struct {
+	// Path is the JSON Pointer of the invalid value, empty for the document.
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Compile parses a JSON Schema document.
+func Compile(data []byte) (*Schema, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	s := &Schema{defs: make(map[string]*node)}
+	if obj, ok := doc.(map[string]any); ok {
+		if defs, ok := obj["$defs"]; ok {
+			defsObj, ok := defs.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("$defs must be an object")
+			}
+			for name, def := range defsObj {
+				n, err := compileNode(def, "/$defs/"+name)
+				if err != nil {
+					return nil, err
+				}
+				s.defs[name] = n
+			}
+		}
+	}
+	root, err := compileNode(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	s.root = root
+	if err := s.checkRefs(root); err != nil {
+		return nil, err
+	}
+	for _, def := range s.defs {
+		if err := s.checkRefs(def); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// MustCompile is like Compile but panics if the schema is invalid. It is
+// meant for schemas embedded in the binary.
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic("jsonschema: " + err.Error())
+	}
+	return s
+}
+
+func compileNode(v any, at string) (*node, error) {
+	if b, ok := v.(bool); ok {
+		return &node{always: &b}, nil
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", location(at))
+	}
+	n := &node{minItems: -1, maxItems: -1, minLength: -1, maxLength: -1}
+	for key, value := range obj {
+		var err error
+		switch key {
+		case "title":
+			n.title, _ = value.(string)
+		case "$ref":
+			ref, _ := value.(string)
+			if !strings.HasPrefix(ref, "#/$defs/") {
+				err = fmt.Errorf("only local #/$defs/ references are supported, got %v", value)
+			}
+			n.ref = strings.TrimPrefix(ref, "#/$defs/")
+		case "type":
+			n.types, err = stringList(value)
+		case "enum":
+			n.enum, ok = value.([]any)
+			if !ok || len(n.enum) == 0 {
+				err = fmt.Errorf("enum must be a non-empty array")
+			}
+		case "properties":
+			props, ok := value.(map[string]any)
+			if !ok {
+				err = fmt.Errorf("properties must be an object")
+				break
+			}
+			n.properties = make(map[string]*node, len(props))
+			for name, prop := range props {
+				if n.properties[name], err = compileNode(prop, at+"/properties/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			n.required, err = stringList(value)
+		case "additionalProperties":
+			if n.additionalProperties, err = compileNode(value, at+"/additionalProperties"); err != nil {
+				return nil, err
+			}
+		case "items":
+			if n.items, err = compileNode(value, at+"/items"); err != nil {
+				return nil, err
+			}
+		case "minItems":
+			n.minItems, err = count(value)
+		case "maxItems":
+			n.maxItems, err = count(value)
+		case "uniqueItems":
+			n.uniqueItems, _ = value.(bool)
+		case "minLength":
+			n.minLength, err = count(value)
+		case "maxLength":
+			n.maxLength, err = count(value)
+		case "pattern":
+			pattern, _ := value.(string)
+			n.pattern, err = regexp.Compile(pattern)
+		case "oneOf":
+			alternatives, ok := value.([]any)
+			if !ok || len(alternatives) == 0 {
+				err = fmt.Errorf("oneOf must be a non-empty array")
+				break
+			}
+			for i, alt := range alternatives {
+				compiled, err := compileNode(alt, at+"/oneOf/"+strconv.Itoa(i))
+				if err != nil {
+					return nil, err
+				}
+				n.oneOf = append(n.oneOf, compiled)
+			}
+		case "not":
+			if n.not, err = compileNode(value, at+"/not"); err != nil {
+				return nil, err
+			}
+		default:
+			if !annotations[key] {
+				err = fmt.Errorf("unsupported keyword")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", location(at), key, err)
+		}
+	}
+	return n, nil
+}
+
+// checkRefs returns an error if n or a subschema refers to a missing
+// definition.
+func (s *Schema) checkRefs(n *node) error {
+	if n == nil {
+		return nil
+	}
+	if n.ref != "" {
+		if _, ok := s.defs[n.ref]; !ok {
+			return fmt.Errorf("reference to undefined #/$defs/%s", n.ref)
+		}
+	}
+	children := append([]*node{n.additionalProperties, n.items, n.not}, n.oneOf...)
+	for _, prop := range n.properties {
+		children = append(children, prop)
+	}
+	for _, child := range children {
+		if err := s.checkRefs(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func location(at string) string {
+	if at == "" {
+		return "(root)"
+	}
+	return at
+}
+
+func stringList(v any) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return []string{s}, nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+	list := make([]string, len(items))
+	for i, item := range items {
+		if list[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("must be a string or an array of strings")
+		}
+	}
+	return list, nil
+}
+
+func count(v any) (int, error) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("must be a non-negative integer")
+	}
+	return int(f), nil
+}
+
+// Validate decodes the JSON document data and validates it. It returns a
+// *ValidationError for the first mismatch found.
+func (s *Schema) Validate(data []byte) error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return &ValidationError{Message: "invalid JSON: " + err.Error()}
+	}
+	return s.ValidateValue(doc)
+}
+
+// ValidateValue validates a document decoded by encoding/json into an any.
+func (s *Schema) ValidateValue(doc any) error {
+	if err := s.validate(s.root, doc, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Schema) validate(n *node, v any, at string) *ValidationError {
+	fail := func(format string, args ...any) *ValidationError {
+		return &ValidationError{Path: at, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if n.always != nil {
+		if !*n.always {
+			return fail("is not allowed")
+		}
+		return nil
+	}
+	if n.ref != "" {
+		if err := s.validate(s.defs[n.ref], v, at); err != nil {
+			return err
+		}
+	}
+	if len(n.types) > 0 && !hasType(v, n.types) {
+		return fail("must be of type %s", strings.Join(n.types, " or "))
+	}
+	if n.enum != nil && !contains(n.enum, v) {
+		return fail("must be one of %s", formatEnum(n.enum))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				return fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := n.properties[name]
+			if !ok {
+				prop = n.additionalProperties
+			}
+			if prop == nil {
+				continue
+			}
+			if prop.always != nil && !*prop.always {
+				return fail("property %q is not allowed", name)
+			}
+			if err := s.validate(prop, v[name], at+"/"+escapePointer(name)); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if n.minItems >= 0 && len(v) < n.minItems {
+			return fail("must have at least %d items", n.minItems)
+		}
+		if n.maxItems >= 0 && len(v) > n.maxItems {
+			return fail("must have at most %d items", n.maxItems)
+		}
+		if n.uniqueItems {
+			for i := range v {
+				if contains(v[:i], v[i]) {
+					return fail("item %d is a duplicate", i)
+				}
+			}
+		}
+		if n.items != nil {
+			for i, item := range v {
+				if err := s.validate(n.items, item, at+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength >= 0 && length < n.minLength {
+			return fail("must be at least %d characters", n.minLength)
+		}
+		if n.maxLength >= 0 && length > n.maxLength {
+			return fail("must be at most %d characters", n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			return fail("%q does not match pattern %s", v, n.pattern)
+		}
+	}
+
+	if n.oneOf != nil {
+		matched := 0
+		for _, alt := range n.oneOf {
+			if s.validate(alt, v, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fail("must be exactly one of: %s", alternatives(n.oneOf))
+		}
+	}
+	if n.not != nil && s.validate(n.not, v, at) == nil {
+		return fail("matches a schema it must not match")
+	}
+	return nil
+}
+
+// alternatives describes the oneOf alternatives by title.
+func alternatives(nodes []*node) string {
+	titles := make([]string, len(nodes))
+	for i, n := range nodes {
+		titles[i] = n.title
+		if titles[i] == "" {
+			titles[i] = "alternative " + strconv.Itoa(i+1)
+		}
+	}
+	return strings.Join(titles, "; ")
+}
+
+func hasType(v any, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "object":
+			if _, ok := v.(map[string]any); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]any); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []any, v any) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		data, _ := json.Marshal(v)
+		parts[i] = string(data)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escapePointer escapes a property name as a JSON Pointer reference token.
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
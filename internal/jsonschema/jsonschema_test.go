@@ -0,0 +1,87 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "name": {"type": "string", "minLength": 1, "maxLength": 5, "pattern": "^[a-z]+$"},
+    "count": {"type": "integer"},
+    "list": {"type": "array", "minItems": 1, "maxItems": 2, "uniqueItems": true, "items": {"$ref": "#/$defs/item"}},
+    "kind": {"enum": ["a", "b"]},
+    "a/b": {"type": "boolean"}
+  },
+  "required": ["name"],
+  "additionalProperties": false,
+  "oneOf": [
+    {"title": "with count", "required": ["count"]},
+    {"title": "with list", "required": ["list"], "properties": {"count": false}}
+  ],
+  "not": {"required": ["kind", "a/b"]},
+  "$defs": {
+    "item": {"type": ["string", "null"]}
+  }
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := Compile([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, doc := range []string{
+		`{"name":"abc","count":3}`,
+		`{"name":"abc","list":["x",null],"kind":"a"}`,
+		`{"name":"abc","count":1,"a/b":true}`,
+	} {
+		if err := s.Validate([]byte(doc)); err != nil {
+			t.Errorf("%s: unexpected error: %v", doc, err)
+		}
+	}
+
+	for doc, want := range map[string]string{
+		`[]`:                                             "must be of type object",
+		`{"count":3}`:                                    `missing required property "name"`,
+		`{"name":"","count":3}`:                          "/name: must be at least 1 characters",
+		`{"name":"abcdef","count":3}`:                    "/name: must be at most 5 characters",
+		`{"name":"ABC","count":3}`:                       `/name: "ABC" does not match pattern`,
+		`{"name":"abc","count":1.5}`:                     "/count: must be of type integer",
+		`{"name":"abc","list":[]}`:                       "/list: must have at least 1 items",
+		`{"name":"abc","list":["x","y","z"]}`:            "/list: must have at most 2 items",
+		`{"name":"abc","list":["x","x"]}`:                "/list: item 1 is a duplicate",
+		`{"name":"abc","list":[1]}`:                      "/list/0: must be of type string or null",
+		`{"name":"abc","count":1,"kind":"c"}`:            `/kind: must be one of "a", "b"`,
+		`{"name":"abc","count":1,"other":1}`:             `property "other" is not allowed`,
+		`{"name":"abc"}`:                                 "must be exactly one of: with count; with list",
+		`{"name":"abc","count":1,"a/b":1}`:               "/a~1b: must be of type boolean",
+		`{"name":"abc","count":1,"kind":"a","a/b":true}`: "must not match",
+		`{"name":`: "invalid JSON",
+	} {
+		err := s.Validate([]byte(doc))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", doc, want, err)
+		}
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	for name, schema := range map[string]string{
+		"not JSON":            `{`,
+		"not a schema":        `"string"`,
+		"unsupported keyword": `{"type":"string","format":"email"}`,
+		"remote reference":    `{"$ref":"https://example.com/schema.json"}`,
+		"undefined reference": `{"properties":{"a":{"$ref":"#/$defs/missing"}}}`,
+		"invalid pattern":     `{"pattern":"("}`,
+		"negative minItems":   `{"minItems":-1}`,
+		"empty enum":          `{"enum":[]}`,
+		"nested unsupported":  `{"items":{"minimum":1}}`,
+	} {
+		if _, err := Compile([]byte(schema)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+// ResolveFunc resolves image:tag to the digests the registry currently serves
+// for it: the digest of the tagged manifest, optionally followed by the
+// digests of the platform manifests it lists. A pod running any of them is up
+// to date.
+type ResolveFunc func(ctx context.Context, image, tag string) ([]string, error)
+
+// StaleDeployment is a Deployment running a digest other than the one its
+// image tag currently points to.
+type StaleDeployment struct {
+	MatchingDeployment
+	Image  string
+	Tag    string
+	Digest string
+}
+
+// splitImageRef splits a container image reference into image and tag. Image
+// references pinned by digest or without a tag return ok=false.
+func splitImageRef(ref string) (image, tag string, ok bool) {
+	if strings.Contains(ref, "@") {
+		return "", "", false
+	}
+	i := strings.LastIndexByte(ref, ':')
+	if i < 0 || strings.Contains(ref[i:], "/") {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+// FindStaleDeployments lists Deployments with containers whose image starts
+// with imagePrefix and compares the digest their pods are running against the
+// digest resolve returns for the image tag. Deployments with at least one pod
+// running an outdated digest are returned, once per Deployment, so that pushes
+// missed while the worker was down can be rolled out.
+func (r *Restarter) FindStaleDeployments(ctx context.Context, imagePrefix string, resolve ResolveFunc) ([]StaleDeployment, error) {
+	deployments, err := r.listDeployments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	// Resolve each image:tag once even if many Deployments use it
+	resolved := make(map[string][]string)
+	var stale []StaleDeployment
+	for _, d := range deployments {
+		selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+
+		var pods []podDigests
+		for _, c := range d.Spec.Template.Spec.Containers {
+			if !imageref.HasPrefix(c.Image, imagePrefix) {
+				continue
+			}
+			image, tag, ok := splitImageRef(c.Image)
+			if !ok {
+				continue
+			}
+
+			digests, found := resolved[c.Image]
+			if !found {
+				digests, err = resolve(ctx, image, tag)
+				if err != nil {
+					r.logger.Warn("failed to resolve image for backfill", "image_ref", c.Image, "error", err)
+				}
+				resolved[c.Image] = digests
+			}
+			if len(digests) == 0 {
+				continue
+			}
+
+			if pods == nil {
+				pods, err = r.listPodDigests(ctx, d.Namespace, selector.String())
+				if err != nil {
+					return nil, err
+				}
+			}
+			if runningOutdated(pods, c.Name, digests) {
+				stale = append(stale, StaleDeployment{
+					MatchingDeployment: MatchingDeployment{
+						Namespace:      d.Namespace,
+						Name:           d.Name,
+						ContainerNames: []string{c.Name},
+						Containers:     []ContainerMatch{{Name: c.Name, Image: c.Image, ImageRef: c.Image}},
+						Labels:         d.Labels,
+					},
+					Image:  image,
+					Tag:    tag,
+					Digest: digests[0],
+				})
+				break
+			}
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].Namespace != stale[j].Namespace {
+			return stale[i].Namespace < stale[j].Namespace
+		}
+		return stale[i].Name < stale[j].Name
+	})
+	return stale, nil
+}
+
+// podDigests maps container names to the image IDs reported for one pod.
+type podDigests map[string]string
+
+func (r *Restarter) listPodDigests(ctx context.Context, namespace, selector string) ([]podDigests, error) {
+	pods, err := r.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+	}
+	result := make([]podDigests, 0, len(pods.Items))
+	for _, p := range pods.Items {
+		digests := make(podDigests)
+		for _, cs := range p.Status.ContainerStatuses {
+			digests[cs.Name] = cs.ImageID
+		}
+		result = append(result, digests)
+	}
+	return result, nil
+}
+
+// runningOutdated reports whether any pod runs container with an image ID that
+// does not end in one of digests. Containers that have not reported an image
+// ID yet are ignored.
+func runningOutdated(pods []podDigests, container string, digests []string) bool {
+	for _, p := range pods {
+		imageID := p[container]
+		if imageID != "" && !slices.ContainsFunc(digests, func(digest string) bool {
+			return strings.HasSuffix(imageID, "@"+digest)
+		}) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	oldDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	newDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func createTestPod(namespace, app, image, digest string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app + "-pod-" + digest[7:11],
+			Namespace: namespace,
+			Labels:    map[string]string{"app": app},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:    "container-0",
+				Image:   image,
+				ImageID: image[:len(image)-4] + "@" + digest,
+			}},
+		},
+	}
+}
+
+func createSelectedDeployment(namespace, name, image string) *appsv1.Deployment {
+	d := createTestDeployment(namespace, name, image)
+	d.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}
+	d.Spec.Template.Labels = map[string]string{"app": name}
+	return d
+}
+
+func TestSplitImageRef(t *testing.T) {
+	tests := []struct {
+		ref, image, tag string
+		ok              bool
+	}{
+		{"ghcr.io/test/svc:dev", "ghcr.io/test/svc", "dev", true},
+		{"localhost:5000/svc:dev", "localhost:5000/svc", "dev", true},
+		{"localhost:5000/svc", "", "", false},
+		{"ghcr.io/test/svc@sha256:abc", "", "", false},
+	}
+	for _, tt := range tests {
+		image, tag, ok := splitImageRef(tt.ref)
+		if image != tt.image || tag != tt.tag || ok != tt.ok {
+			t.Errorf("splitImageRef(%q) = %q, %q, %v", tt.ref, image, tag, ok)
+		}
+	}
+}
+
+func TestFindStaleDeployments(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		createSelectedDeployment("default", "stale", "ghcr.io/test/svc:dev"),
+		createTestPod("default", "stale", "ghcr.io/test/svc:dev", oldDigest),
+		createSelectedDeployment("default", "current", "ghcr.io/test/svc:dev"),
+		createTestPod("default", "current", "ghcr.io/test/svc:dev", newDigest),
+		createSelectedDeployment("default", "other", "docker.io/library/nginx:1"),
+		createTestPod("default", "other", "docker.io/library/nginx:1", oldDigest),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+
+	var resolves int
+	resolve := func(_ context.Context, image, tag string) ([]string, error) {
+		resolves++
+		if image != "ghcr.io/test/svc" || tag != "dev" {
+			return nil, errors.New("unexpected image")
+		}
+		return []string{newDigest}, nil
+	}
+
+	stale, err := restarter.FindStaleDeployments(context.Background(), "ghcr.io/test/", resolve)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stale) != 1 || stale[0].Name != "stale" {
+		t.Fatalf("expected only the stale deployment, got %+v", stale)
+	}
+	if stale[0].Tag != "dev" || stale[0].Digest != newDigest {
+		t.Errorf("unexpected stale deployment %+v", stale[0])
+	}
+	if resolves != 1 {
+		t.Errorf("expected image:tag to be resolved once, got %d", resolves)
+	}
+}
+
+func TestFindStaleDeployments_PlatformDigests(t *testing.T) {
+	platformDigest := "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	client := fake.NewSimpleClientset(
+		createSelectedDeployment("default", "arm", "ghcr.io/test/svc:dev"),
+		createTestPod("default", "arm", "ghcr.io/test/svc:dev", platformDigest),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+
+	// The pod reports the digest of its platform manifest, which the index lists
+	resolve := func(_ context.Context, image, tag string) ([]string, error) {
+		return []string{newDigest, platformDigest}, nil
+	}
+	stale, err := restarter.FindStaleDeployments(context.Background(), "ghcr.io/test/", resolve)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("expected a pod on a platform digest to be up to date, got %+v", stale)
+	}
+}
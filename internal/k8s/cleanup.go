@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// parseTimestamp parses a restart annotation value written in format. Values
+// written by kubectl rollout restart are RFC 3339 and are accepted for any
+// format.
+func parseTimestamp(value, format string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	switch format {
+	case "", TimestampFormatRFC3339:
+		return time.Time{}, fmt.Errorf("invalid RFC 3339 timestamp %q", value)
+	case TimestampFormatUnix:
+		secs, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid Unix timestamp %q", value)
+		}
+		return time.Unix(secs, 0), nil
+	default:
+		return time.Parse(format, value)
+	}
+}
+
+// CleanupTriggerAnnotations removes the TriggerAnnotation from Deployments
+// last restarted more than maxAge ago, so the audit record of old restarts
+// does not linger in manifests and GitOps diffs. The age is taken from the
+// RestartedAtAnnotation on the pod template, which is left in place because
+// changing the pod template would roll out the Deployment again. Deployments
+// whose restart time cannot be determined are skipped. It returns the number
+// of Deployments cleaned up.
+func (r *Restarter) CleanupTriggerAnnotations(ctx context.Context, maxAge time.Duration) (int, error) {
+	deployments, err := r.listDeployments(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{TriggerAnnotation: nil},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode patch: %w", err)
+	}
+
+	cutoff := r.now().Add(-maxAge)
+	var cleaned int
+	for _, d := range deployments {
+		if _, ok := d.Annotations[TriggerAnnotation]; !ok {
+			continue
+		}
+		restartedAt, err := parseTimestamp(d.Spec.Template.Annotations[RestartedAtAnnotation], r.opts.TimestampFormat)
+		if err != nil {
+			r.logger.Debug("skipping annotation cleanup, restart time unknown",
+				"namespace", d.Namespace,
+				"deployment", d.Name,
+				"error", err,
+			)
+			continue
+		}
+		if restartedAt.After(cutoff) {
+			continue
+		}
+
+		if _, err := r.clientset.AppsV1().Deployments(d.Namespace).Patch(ctx, d.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			r.logger.Warn("failed to remove trigger annotation",
+				"namespace", d.Namespace,
+				"deployment", d.Name,
+				"error", err,
+			)
+			continue
+		}
+		r.logger.Info("removed stale trigger annotation",
+			"namespace", d.Namespace,
+			"deployment", d.Name,
+			"restarted_at", restartedAt.UTC().Format(time.RFC3339),
+		)
+		cleaned++
+	}
+	return cleaned, nil
+}
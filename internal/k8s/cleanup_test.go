@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value  string
+		format string
+	}{
+		{"2024-01-02T15:04:05Z", ""},
+		{"2024-01-02T15:04:05Z", TimestampFormatUnix},
+		{"1704207845", TimestampFormatUnix},
+		{"20240102150405", "20060102150405"},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.value, tt.format)
+		if err != nil {
+			t.Errorf("parseTimestamp(%q, %q): %v", tt.value, tt.format, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseTimestamp(%q, %q) = %v, want %v", tt.value, tt.format, got, want)
+		}
+	}
+
+	if _, err := parseTimestamp("garbage", ""); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+}
+
+func TestCleanupTriggerAnnotations(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	old := createTestDeployment("default", "old", "ghcr.io/test/app:dev")
+	old.Annotations = map[string]string{TriggerAnnotation: `{"image":"ghcr.io/test/app"}`, "keep": "me"}
+	old.Spec.Template.Annotations = map[string]string{RestartedAtAnnotation: "2024-01-01T00:00:00Z"}
+
+	recent := createTestDeployment("default", "recent", "ghcr.io/test/app:dev")
+	recent.Annotations = map[string]string{TriggerAnnotation: `{"image":"ghcr.io/test/app"}`}
+	recent.Spec.Template.Annotations = map[string]string{RestartedAtAnnotation: "2024-02-28T00:00:00Z"}
+
+	unknown := createTestDeployment("default", "unknown", "ghcr.io/test/app:dev")
+	unknown.Annotations = map[string]string{TriggerAnnotation: `{"image":"ghcr.io/test/app"}`}
+
+	clientset := fake.NewClientset(old, recent, unknown)
+	restarter := NewRestarterWithClient(clientset, testLogger())
+	restarter.opts.Clock = func() time.Time { return now }
+
+	cleaned, err := restarter.CleanupTriggerAnnotations(context.Background(), 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cleaned != 1 {
+		t.Errorf("expected 1 deployment cleaned, got %d", cleaned)
+	}
+
+	for name, wantTrigger := range map[string]bool{"old": false, "recent": true, "unknown": true} {
+		d, err := clientset.AppsV1().Deployments("default").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := d.Annotations[TriggerAnnotation]; ok != wantTrigger {
+			t.Errorf("%s: expected trigger annotation present=%v", name, wantTrigger)
+		}
+		if name == "old" {
+			if d.Annotations["keep"] != "me" {
+				t.Error("expected unrelated annotations to be kept")
+			}
+			if d.Spec.Template.Annotations[RestartedAtAnnotation] == "" {
+				t.Error("expected restart annotation on pod template to be kept")
+			}
+		}
+	}
+}
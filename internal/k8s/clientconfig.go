@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildRestConfig resolves the Kubernetes client configuration from opts.
+//
+// When neither a kubeconfig path nor a context is given, in-cluster
+// configuration is used, or a bare configuration for APIServer if one is set.
+// Otherwise the kubeconfig is loaded and the context, API server, bearer token,
+// and CA overrides are applied on top of it. The user agent and impersonation
+// settings apply either way.
+func buildRestConfig(opts Options) (*rest.Config, error) {
+	if opts.Kubeconfig == "" && opts.Context == "" {
+		var config *rest.Config
+		if opts.APIServer != "" {
+			config = &rest.Config{Host: opts.APIServer}
+		} else {
+			inCluster, err := rest.InClusterConfig()
+			if err != nil {
+				return nil, err
+			}
+			config = inCluster
+		}
+		applyRestOverrides(config, opts)
+		applyClientIdentity(config, opts)
+		return config, nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if opts.Kubeconfig != "" {
+		loadingRules.ExplicitPath = opts.Kubeconfig
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+	}
+	overrides.ClusterInfo.Server = opts.APIServer
+	overrides.ClusterInfo.CertificateAuthority = opts.CAFile
+	overrides.AuthInfo.Token = opts.BearerToken
+	overrides.AuthInfo.TokenFile = opts.BearerTokenFile
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	applyClientIdentity(config, opts)
+	return config, nil
+}
+
+// applyClientIdentity sets the user agent and impersonation of opts, so API
+// server audit logs attribute requests to this tool and, when impersonating,
+// to the impersonated identity. Impersonation replaces any configured in the
+// kubeconfig.
+func applyClientIdentity(config *rest.Config, opts Options) {
+	if opts.UserAgent != "" {
+		config.UserAgent = opts.UserAgent
+	}
+	if opts.ImpersonateUser != "" {
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: opts.ImpersonateUser,
+			Groups:   opts.ImpersonateGroups,
+		}
+	}
+}
+
+// applyRestOverrides applies the API server, bearer token, and CA overrides to
+// a configuration that was not loaded from a kubeconfig.
+func applyRestOverrides(config *rest.Config, opts Options) {
+	if opts.APIServer != "" {
+		config.Host = opts.APIServer
+	}
+	if opts.CAFile != "" {
+		config.TLSClientConfig.CAFile = opts.CAFile
+		config.TLSClientConfig.CAData = nil
+	}
+	if opts.BearerToken != "" {
+		config.BearerToken = opts.BearerToken
+		config.BearerTokenFile = ""
+	} else if opts.BearerTokenFile != "" {
+		config.BearerToken = ""
+		config.BearerTokenFile = opts.BearerTokenFile
+	}
+}
+
+// NewClientset creates a Kubernetes clientset from the connection settings in
+// opts, for tools that need direct API access rather than a Restarter.
+func NewClientset(opts Options) (kubernetes.Interface, error) {
+	config, err := buildRestConfig(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes config: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return clientset, nil
+}
@@ -0,0 +1,140 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+users:
+- name: dev-user
+  user:
+    token: dev-token
+- name: prod-user
+  user:
+    token: prod-token
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev-user
+- name: prod
+  context:
+    cluster: prod
+    user: prod-user
+`
+
+func writeTestKubeconfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestBuildRestConfig_CurrentContext(t *testing.T) {
+	config, err := buildRestConfig(Options{Kubeconfig: writeTestKubeconfig(t)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://dev.example.com" {
+		t.Errorf("expected dev host, got %s", config.Host)
+	}
+	if config.BearerToken != "dev-token" {
+		t.Errorf("expected dev token, got %s", config.BearerToken)
+	}
+}
+
+func TestBuildRestConfig_ContextOverride(t *testing.T) {
+	config, err := buildRestConfig(Options{Kubeconfig: writeTestKubeconfig(t), Context: "prod"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://prod.example.com" {
+		t.Errorf("expected prod host, got %s", config.Host)
+	}
+	if config.BearerToken != "prod-token" {
+		t.Errorf("expected prod token, got %s", config.BearerToken)
+	}
+}
+
+func TestBuildRestConfig_UnknownContext(t *testing.T) {
+	if _, err := buildRestConfig(Options{Kubeconfig: writeTestKubeconfig(t), Context: "missing"}); err == nil {
+		t.Fatal("expected error for unknown context")
+	}
+}
+
+func TestBuildRestConfig_ServerAndTokenOverrides(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("not-validated-at-load"), 0o600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	config, err := buildRestConfig(Options{
+		Kubeconfig:  writeTestKubeconfig(t),
+		APIServer:   "https://override.example.com:6443",
+		BearerToken: "override-token",
+		CAFile:      caFile,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://override.example.com:6443" {
+		t.Errorf("expected override host, got %s", config.Host)
+	}
+	if config.BearerToken != "override-token" {
+		t.Errorf("expected override token, got %s", config.BearerToken)
+	}
+	if config.TLSClientConfig.CAFile != caFile {
+		t.Errorf("expected CA file override, got %s", config.TLSClientConfig.CAFile)
+	}
+}
+
+func TestBuildRestConfig_APIServerWithoutKubeconfig(t *testing.T) {
+	config, err := buildRestConfig(Options{
+		APIServer:       "https://external.example.com",
+		BearerTokenFile: "/var/run/secrets/token",
+		CAFile:          "/etc/ca.crt",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://external.example.com" {
+		t.Errorf("expected external host, got %s", config.Host)
+	}
+	if config.BearerTokenFile != "/var/run/secrets/token" {
+		t.Errorf("expected token file, got %s", config.BearerTokenFile)
+	}
+}
+
+func TestBuildRestConfig_ClientIdentity(t *testing.T) {
+	for _, opts := range []Options{
+		{Kubeconfig: writeTestKubeconfig(t)},
+		{APIServer: "https://external.example.com"},
+	} {
+		opts.UserAgent = "kuberollouttrigger-worker/v1.2.3"
+		opts.ImpersonateUser = "system:serviceaccount:ci:restarter"
+		opts.ImpersonateGroups = []string{"system:serviceaccounts"}
+		config, err := buildRestConfig(opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.UserAgent != "kuberollouttrigger-worker/v1.2.3" {
+			t.Errorf("expected the user agent to be set, got %q", config.UserAgent)
+		}
+		if config.Impersonate.UserName != "system:serviceaccount:ci:restarter" || len(config.Impersonate.Groups) != 1 {
+			t.Errorf("expected impersonation to be set, got %+v", config.Impersonate)
+		}
+	}
+}
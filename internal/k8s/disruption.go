@@ -0,0 +1,207 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DeferredError is returned by RestartDeployment when the disruption check is
+// enabled and restarting the Deployment now would be unsafe.
+type DeferredError struct {
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("restart of deployment %s/%s deferred: %s", e.Namespace, e.Name, e.Reason)
+}
+
+// CheckDisruption reports whether the Deployment can be restarted without
+// making things worse. It returns a *DeferredError if the Deployment is already
+// degraded or a PodDisruptionBudget selecting its pods allows no disruptions.
+func (r *Restarter) CheckDisruption(ctx context.Context, namespace, name string) error {
+	d, err := r.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %w", namespace, name, classify(err))
+	}
+
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	if d.Status.AvailableReplicas < desired {
+		return &DeferredError{
+			Namespace: namespace,
+			Name:      name,
+			Reason:    fmt.Sprintf("deployment is degraded with %d of %d replicas available", d.Status.AvailableReplicas, desired),
+		}
+	}
+
+	pdbs, err := r.clientset.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pod disruption budgets in %s: %w", namespace, classify(err))
+	}
+	podLabels := labels.Set(d.Spec.Template.Labels)
+	for _, pdb := range pdbs.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(podLabels) {
+			continue
+		}
+		if pdb.Status.DisruptionsAllowed < 1 {
+			return &DeferredError{
+				Namespace: namespace,
+				Name:      name,
+				Reason:    fmt.Sprintf("PodDisruptionBudget %s allows no disruptions (%d of %d pods healthy)", pdb.Name, pdb.Status.CurrentHealthy, pdb.Status.DesiredHealthy),
+			}
+		}
+	}
+	return nil
+}
+
+// DeploymentRestarter restarts a single Deployment. *Restarter implements it.
+type DeploymentRestarter interface {
+	RestartDeployment(ctx context.Context, namespace, name string, cause *RestartCause) error
+}
+
+// DeferredQueue retries restarts that were deferred by the disruption check,
+// or that failed with a transient error, until they succeed or the timeout
+// elapses.
+type DeferredQueue struct {
+	restarter DeploymentRestarter
+	interval  time.Duration
+	timeout   time.Duration
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]*RestartCause
+
+	// paused suspends retries without letting them time out.
+	paused atomic.Bool
+}
+
+// NewDeferredQueue creates a queue that retries deferred restarts every
+// interval, giving up after timeout.
+func NewDeferredQueue(restarter DeploymentRestarter, interval, timeout time.Duration, logger *slog.Logger) *DeferredQueue {
+	return &DeferredQueue{
+		restarter: restarter,
+		interval:  interval,
+		timeout:   timeout,
+		logger:    logger,
+		pending:   make(map[string]*RestartCause),
+	}
+}
+
+// Add queues a deferred restart. If the Deployment is already queued, only
+// the cause is updated so the retry records the most recent trigger. If a
+// retry is in flight, the Deployment is restarted again for the new cause.
+func (q *DeferredQueue) Add(ctx context.Context, namespace, name string, cause *RestartCause) {
+	key := namespace + "/" + name
+	q.mu.Lock()
+	_, exists := q.pending[key]
+	q.pending[key] = cause
+	q.mu.Unlock()
+	if !exists {
+		go q.retry(ctx, namespace, name)
+	}
+}
+
+// Pause suspends retries until Resume is called. Queued restarts do not time
+// out while paused.
+func (q *DeferredQueue) Pause() {
+	q.paused.Store(true)
+}
+
+// Resume continues retries suspended by Pause.
+func (q *DeferredQueue) Resume() {
+	q.paused.Store(false)
+}
+
+// Len returns the number of queued restarts.
+func (q *DeferredQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// finish removes key from the queue if cause, which the last attempt was
+// made with, is still its most recent, and reports whether it did. Otherwise
+// a newer cause was added during the attempt, which the caller retries, as
+// Add did not start a retry of its own.
+func (q *DeferredQueue) finish(key string, cause *RestartCause) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[key] != cause {
+		return false
+	}
+	delete(q.pending, key)
+	return true
+}
+
+func (q *DeferredQueue) retry(ctx context.Context, namespace, name string) {
+	key := namespace + "/" + name
+	deadline := time.Now().Add(q.timeout)
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			delete(q.pending, key)
+			q.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+		if q.paused.Load() {
+			deadline = deadline.Add(q.interval)
+			continue
+		}
+
+		q.mu.Lock()
+		cause := q.pending[key]
+		q.mu.Unlock()
+
+		err := q.restarter.RestartDeployment(ctx, namespace, name, cause)
+		if err == nil {
+			if q.finish(key, cause) {
+				q.logger.Info("deferred restart completed", "namespace", namespace, "deployment", name)
+				return
+			}
+			q.logger.Info("deployment deferred again during its restart, restarting for the newer cause", "namespace", namespace, "deployment", name)
+			continue
+		}
+		var deferredErr *DeferredError
+		var reason string
+		switch {
+		case errors.As(err, &deferredErr):
+			reason = deferredErr.Reason
+		case IsTransient(err):
+			// Throttling and conflicts are retried like an unsafe restart
+			reason = err.Error()
+		default:
+			if q.finish(key, cause) {
+				q.logger.Error("deferred restart failed", "namespace", namespace, "deployment", name, "error", err, "error_class", ErrorClass(err))
+				return
+			}
+			continue
+		}
+		if time.Now().After(deadline) && q.finish(key, cause) {
+			q.logger.Error("deferred restart abandoned",
+				"namespace", namespace,
+				"deployment", name,
+				"timeout", q.timeout.String(),
+				"reason", reason,
+			)
+			return
+		}
+		q.logger.Debug("restart still deferred", "namespace", namespace, "deployment", name, "reason", reason)
+	}
+}
@@ -0,0 +1,180 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func createHealthyDeployment(namespace, name string) *appsv1.Deployment {
+	d := createTestDeployment(namespace, name, "ghcr.io/test/myservice:dev")
+	replicas := int32(2)
+	d.Spec.Replicas = &replicas
+	d.Spec.Template.Labels = map[string]string{"app": name}
+	d.Status.AvailableReplicas = 2
+	return d
+}
+
+func createTestPDB(namespace, app string, disruptionsAllowed int32) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: app + "-pdb", Namespace: namespace},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+		},
+		Status: policyv1.PodDisruptionBudgetStatus{
+			DisruptionsAllowed: disruptionsAllowed,
+			CurrentHealthy:     2,
+			DesiredHealthy:     2,
+		},
+	}
+}
+
+func TestCheckDisruption(t *testing.T) {
+	degraded := createHealthyDeployment("default", "degraded")
+	degraded.Status.AvailableReplicas = 1
+
+	client := fake.NewSimpleClientset(
+		createHealthyDeployment("default", "healthy"),
+		createHealthyDeployment("default", "blocked"),
+		degraded,
+		createTestPDB("default", "healthy", 1),
+		createTestPDB("default", "blocked", 0),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+
+	tests := []struct {
+		name   string
+		reason string
+	}{
+		{"healthy", ""},
+		{"blocked", "PodDisruptionBudget blocked-pdb allows no disruptions"},
+		{"degraded", "1 of 2 replicas available"},
+	}
+	for _, tt := range tests {
+		err := restarter.CheckDisruption(context.Background(), "default", tt.name)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		var deferred *DeferredError
+		if !errors.As(err, &deferred) || !strings.Contains(deferred.Reason, tt.reason) {
+			t.Errorf("%s: expected deferral containing %q, got %v", tt.name, tt.reason, err)
+		}
+	}
+}
+
+func TestRestartDeployment_Deferred(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		createHealthyDeployment("default", "blocked"),
+		createTestPDB("default", "blocked", 0),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+	restarter.opts.CheckDisruption = true
+
+	err := restarter.RestartDeployment(context.Background(), "default", "blocked", nil)
+	var deferred *DeferredError
+	if !errors.As(err, &deferred) {
+		t.Fatalf("expected DeferredError, got %v", err)
+	}
+
+	updated, _ := client.AppsV1().Deployments("default").Get(context.Background(), "blocked", metav1.GetOptions{})
+	if _, ok := updated.Spec.Template.Annotations[RestartedAtAnnotation]; ok {
+		t.Error("expected deferred deployment not to be restarted")
+	}
+}
+
+func TestDeferredQueue(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		createHealthyDeployment("default", "blocked"),
+		createTestPDB("default", "blocked", 0),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+	restarter.opts.CheckDisruption = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue := NewDeferredQueue(restarter, 10*time.Millisecond, time.Minute, testLogger())
+	queue.Add(ctx, "default", "blocked", &RestartCause{Actor: "first"})
+	queue.Add(ctx, "default", "blocked", &RestartCause{Actor: "second"})
+	if queue.Len() != 1 {
+		t.Fatalf("expected 1 queued restart, got %d", queue.Len())
+	}
+
+	// Once the budget allows a disruption the queued restart goes through,
+	// but not while the queue is paused
+	queue.Pause()
+	pdb := createTestPDB("default", "blocked", 1)
+	if _, err := client.PolicyV1().PodDisruptionBudgets("default").UpdateStatus(ctx, pdb, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update pdb: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if queue.Len() != 1 {
+		t.Fatal("expected the restart to stay queued while paused")
+	}
+	queue.Resume()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for queue.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if queue.Len() != 0 {
+		t.Fatal("expected deferred restart to complete")
+	}
+
+	updated, _ := client.AppsV1().Deployments("default").Get(ctx, "blocked", metav1.GetOptions{})
+	if updated.Spec.Template.Annotations[RestartedAtAnnotation] == "" {
+		t.Error("expected deployment to be restarted")
+	}
+	if !strings.Contains(updated.Annotations[TriggerAnnotation], "second") {
+		t.Errorf("expected latest cause to be recorded, got %q", updated.Annotations[TriggerAnnotation])
+	}
+}
+
+// restarterFunc adapts a function to the DeploymentRestarter interface.
+type restarterFunc func(ctx context.Context, namespace, name string, cause *RestartCause) error
+
+func (f restarterFunc) RestartDeployment(ctx context.Context, namespace, name string, cause *RestartCause) error {
+	return f(ctx, namespace, name, cause)
+}
+
+func TestDeferredQueue_CauseAddedDuringRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var queue *DeferredQueue
+	var mu sync.Mutex
+	var actors []string
+	queue = NewDeferredQueue(restarterFunc(func(ctx context.Context, namespace, name string, cause *RestartCause) error {
+		mu.Lock()
+		actors = append(actors, cause.Actor)
+		first := len(actors) == 1
+		mu.Unlock()
+		// A newer event defers the Deployment while its restart is in flight
+		if first {
+			queue.Add(ctx, namespace, name, &RestartCause{Actor: "second"})
+		}
+		return nil
+	}), 10*time.Millisecond, time.Minute, testLogger())
+	queue.Add(ctx, "default", "api", &RestartCause{Actor: "first"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for queue.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if queue.Len() != 0 || !slices.Equal(actors, []string{"first", "second"}) {
+		t.Errorf("expected the Deployment to be restarted again for the newer cause, got %v with %d queued", actors, queue.Len())
+	}
+}
@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Classes of Kubernetes API errors returned by the Restarter, matched with
+// errors.Is. The API error stays in the chain, so apierrors functions still
+// recognize it.
+var (
+	// ErrNotFound is returned when the object no longer exists.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnauthorized is returned when the API server rejects the worker's
+	// credentials, for example an expired or revoked token.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned when the worker's RBAC does not allow the
+	// request.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrConflict is returned when the object was modified concurrently or
+	// server-side apply found a field owned by another manager.
+	ErrConflict = errors.New("conflict")
+
+	// ErrThrottled is returned when the API server rate limited the request
+	// or was too busy to answer it.
+	ErrThrottled = errors.New("throttled")
+)
+
+// classError is an API error together with its class.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string   { return e.err.Error() }
+func (e *classError) Unwrap() []error { return []error{e.class, e.err} }
+
+// classify returns err with the class of the API error it is, or err itself
+// if it has no class.
+func classify(err error) error {
+	var class error
+	switch {
+	case apierrors.IsNotFound(err):
+		class = ErrNotFound
+	case apierrors.IsUnauthorized(err):
+		class = ErrUnauthorized
+	case apierrors.IsForbidden(err):
+		class = ErrForbidden
+	case apierrors.IsConflict(err):
+		class = ErrConflict
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err):
+		class = ErrThrottled
+	default:
+		return err
+	}
+	return &classError{class: class, err: err}
+}
+
+// ErrorClass names the class of err for logs and metrics: not_found,
+// unauthorized, forbidden, conflict, throttled or other.
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrThrottled):
+		return "throttled"
+	default:
+		return "other"
+	}
+}
+
+// IsTransient reports whether err is likely to go away when the request is
+// retried later.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrConflict) || errors.Is(err, ErrThrottled)
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClassify(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		err       error
+		class     string
+		transient bool
+	}{
+		{apierrors.NewNotFound(deployments, "api"), "not_found", false},
+		{apierrors.NewUnauthorized("token expired"), "unauthorized", false},
+		{apierrors.NewForbidden(deployments, "api", errors.New("no RBAC")), "forbidden", false},
+		{apierrors.NewConflict(deployments, "api", errors.New("modified")), "conflict", true},
+		{apierrors.NewTooManyRequests("slow down", 1), "throttled", true},
+		{apierrors.NewServerTimeout(deployments, "patch", 1), "throttled", true},
+		{errors.New("connection refused"), "other", false},
+	}
+	for _, tt := range tests {
+		err := classify(tt.err)
+		if got := ErrorClass(err); got != tt.class || IsTransient(err) != tt.transient {
+			t.Errorf("%v: expected class %s (transient %v), got %s (transient %v)", tt.err, tt.class, tt.transient, got, IsTransient(err))
+		}
+		if !errors.Is(err, tt.err) || err.Error() != tt.err.Error() {
+			t.Errorf("%v: expected the API error to stay in the chain, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestRestartDeployment_ErrorClasses(t *testing.T) {
+	clientset := fake.NewClientset(createTestDeployment("dev", "api", "ghcr.io/test/api:dev"))
+	restarter := NewRestarterWithClient(clientset, testLogger())
+
+	err := restarter.RestartDeployment(context.Background(), "dev", "gone", nil)
+	if !errors.Is(err, ErrNotFound) || !apierrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	clientset.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewTooManyRequests("slow down", 1)
+	})
+	if err := restarter.RestartDeployment(context.Background(), "dev", "api", nil); !errors.Is(err, ErrThrottled) {
+		t.Errorf("expected a throttled error, got %v", err)
+	}
+
+	clientset.PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "", errors.New("no RBAC"))
+	})
+	if _, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/api:dev"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected a forbidden error, got %v", err)
+	}
+}
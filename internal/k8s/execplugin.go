@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExecPluginSubcommand is the hidden subcommand used to run a kubeconfig exec
+// credential plugin (aws eks get-token, gke-gcloud-auth-plugin, kubelogin, ...)
+// under a timeout. client-go has no timeout for exec plugins, so a hung plugin
+// would otherwise block every Kubernetes API call indefinitely.
+const ExecPluginSubcommand = "kube-exec-plugin"
+
+// configureExecProvider prepares an exec credential provider for a
+// non-interactive daemon: plugins never receive stdin, and if timeout is
+// positive the plugin is invoked through self (the current executable) running
+// ExecPluginSubcommand. The plugin's environment, including
+// KUBERNETES_EXEC_INFO, is inherited unchanged.
+func configureExecProvider(config *rest.Config, timeout time.Duration, self string) {
+	execConfig := config.ExecProvider
+	if execConfig == nil {
+		return
+	}
+	execConfig.InteractiveMode = clientcmdapi.NeverExecInteractiveMode
+
+	if timeout <= 0 || self == "" {
+		return
+	}
+	args := []string{ExecPluginSubcommand, "--timeout", timeout.String(), "--", execConfig.Command}
+	execConfig.Args = append(args, execConfig.Args...)
+	execConfig.Command = self
+}
+
+// RunExecPlugin implements ExecPluginSubcommand. args are the arguments after
+// the subcommand: "--timeout <duration> -- <command> [args...]". It returns the
+// process exit code.
+func RunExecPlugin(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(ExecPluginSubcommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	timeout := fs.Duration("timeout", 30*time.Second, "Maximum time the credential plugin may run")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	command := fs.Args()
+	if len(command) == 0 {
+		fmt.Fprintf(stderr, "%s: missing credential plugin command\n", ExecPluginSubcommand)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(stderr, "%s: credential plugin %q timed out after %s\n", ExecPluginSubcommand, command[0], *timeout)
+		return 1
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(stderr, "%s: failed to run credential plugin %q: %v\n", ExecPluginSubcommand, command[0], err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package k8s
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testExecKubeconfig = `apiVersion: v1
+kind: Config
+current-context: eks
+clusters:
+- name: eks
+  cluster:
+    server: https://eks.example.com
+users:
+- name: eks-user
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: aws
+      args: ["eks", "get-token", "--cluster-name", "dev"]
+contexts:
+- name: eks
+  context:
+    cluster: eks
+    user: eks-user
+`
+
+func TestConfigureExecProvider_WrapsPlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(testExecKubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	config, err := buildRestConfig(Options{Kubeconfig: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.ExecProvider == nil {
+		t.Fatal("expected exec provider from kubeconfig")
+	}
+
+	configureExecProvider(config, 15*time.Second, "/server")
+
+	if config.ExecProvider.Command != "/server" {
+		t.Errorf("expected command to be wrapped by /server, got %s", config.ExecProvider.Command)
+	}
+	expected := "kube-exec-plugin --timeout 15s -- aws eks get-token --cluster-name dev"
+	if got := strings.Join(config.ExecProvider.Args, " "); got != expected {
+		t.Errorf("expected args %q, got %q", expected, got)
+	}
+	if config.ExecProvider.InteractiveMode != clientcmdapi.NeverExecInteractiveMode {
+		t.Errorf("expected interactive mode Never, got %s", config.ExecProvider.InteractiveMode)
+	}
+}
+
+func TestConfigureExecProvider_NoTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(testExecKubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	config, err := buildRestConfig(Options{Kubeconfig: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configureExecProvider(config, 0, "/server")
+
+	if config.ExecProvider.Command != "aws" {
+		t.Errorf("expected command to be unchanged, got %s", config.ExecProvider.Command)
+	}
+}
+
+func TestRunExecPlugin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := RunExecPlugin([]string{"--timeout", "5s", "--", "sh", "-c", "echo token"}, strings.NewReader(""), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if strings.TrimSpace(stdout.String()) != "token" {
+		t.Errorf("expected plugin output to be passed through, got %q", stdout.String())
+	}
+}
+
+func TestRunExecPlugin_ExitCode(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := RunExecPlugin([]string{"--", "sh", "-c", "exit 3"}, strings.NewReader(""), &stdout, &stderr); code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+}
+
+func TestRunExecPlugin_Timeout(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	code := RunExecPlugin([]string{"--timeout", "100ms", "--", "sleep", "5"}, strings.NewReader(""), &stdout, &stderr)
+	if code == 0 {
+		t.Fatal("expected non-zero exit code on timeout")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("expected plugin to be killed promptly, took %s", time.Since(start))
+	}
+	if !strings.Contains(stderr.String(), "timed out") {
+		t.Errorf("expected timeout message, got %q", stderr.String())
+	}
+}
+
+func TestRunExecPlugin_MissingCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := RunExecPlugin([]string{"--timeout", "1s"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2, got %d", code)
+	}
+}
@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+// MatchDecision explains why a Deployment did or did not match an image reference.
+type MatchDecision struct {
+	Namespace string
+	Name      string
+	Matched   bool
+	Reason    string
+	Labels    map[string]string
+}
+
+// ExplainMatches examines every Deployment for imageRef and returns a decision
+// for each one that matched or that runs the same image repository under a
+// different tag or digest (a near miss). Deployments running unrelated images
+// are only counted, in examined, to keep the explanation readable.
+func (r *Restarter) ExplainMatches(ctx context.Context, imageRef string) (decisions []MatchDecision, examined int, err error) {
+	deployments, err := r.listDeployments(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	want := imageref.Normalize(imageRef)
+	repo, _, _ := splitImageRef(want)
+	matcher := r.matcher()
+	for i := range deployments {
+		d := &deployments[i]
+		examined++
+		matched := matcher.Match(ctx, want, deploymentCandidate(d))
+		var nearMisses []string
+		for _, c := range d.Spec.Template.Spec.Containers {
+			image := imageref.Normalize(c.Image)
+			if image != want && repo != "" && (strings.HasPrefix(image, repo+":") || strings.HasPrefix(image, repo+"@")) {
+				nearMisses = append(nearMisses, fmt.Sprintf("container %s runs %s", c.Name, c.Image))
+			}
+		}
+
+		switch {
+		case len(matched) > 0:
+			decisions = append(decisions, MatchDecision{
+				Namespace: d.Namespace,
+				Name:      d.Name,
+				Matched:   true,
+				Reason:    "image matches containers " + strings.Join(matched, ","),
+				Labels:    d.Labels,
+			})
+		case len(nearMisses) > 0:
+			decisions = append(decisions, MatchDecision{
+				Namespace: d.Namespace,
+				Name:      d.Name,
+				Reason:    "image mismatch: " + strings.Join(nearMisses, "; "),
+				Labels:    d.Labels,
+			})
+		}
+	}
+	return decisions, examined, nil
+}
@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExplainMatches(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		createTestDeployment("default", "match", "ghcr.io/test/myservice:dev"),
+		createTestDeployment("default", "other-tag", "ghcr.io/test/myservice:prod"),
+		createTestDeployment("default", "pinned", "ghcr.io/test/myservice@sha256:abc"),
+		createTestDeployment("default", "unrelated", "ghcr.io/test/myservice-extended:dev"),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+
+	decisions, examined, err := restarter.ExplainMatches(context.Background(), "ghcr.io/test/myservice:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if examined != 4 {
+		t.Errorf("expected 4 deployments examined, got %d", examined)
+	}
+
+	byName := make(map[string]MatchDecision)
+	for _, d := range decisions {
+		byName[d.Name] = d
+	}
+	if len(byName) != 3 {
+		t.Fatalf("expected 3 decisions, got %+v", decisions)
+	}
+	if !byName["match"].Matched {
+		t.Errorf("expected match to be matched: %+v", byName["match"])
+	}
+	if d := byName["other-tag"]; d.Matched || !strings.Contains(d.Reason, "ghcr.io/test/myservice:prod") {
+		t.Errorf("unexpected decision for other-tag: %+v", d)
+	}
+	if d := byName["pinned"]; d.Matched || !strings.Contains(d.Reason, "@sha256:abc") {
+		t.Errorf("unexpected decision for pinned: %+v", d)
+	}
+}
@@ -0,0 +1,43 @@
+package k8s
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
+)
+
+// throttledBody is the Status object the API server returns with a 429.
+const throttledBody = `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"injected fault: too many requests","reason":"TooManyRequests","code":429}`
+
+// throttleTransport answers requests with 429 Too Many Requests at the rate
+// configured for fault.KubeThrottle, without sending them to the API server.
+// client-go retries them after the Retry-After delay like real throttling.
+type throttleTransport struct {
+	next   http.RoundTripper
+	faults *fault.Injector
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.faults.Fail(fault.KubeThrottle) {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:     "429 Too Many Requests",
+		StatusCode: http.StatusTooManyRequests,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+			"Retry-After":  []string{"1"},
+		},
+		Body:          io.NopCloser(strings.NewReader(throttledBody)),
+		ContentLength: int64(len(throttledBody)),
+		Request:       req,
+	}, nil
+}
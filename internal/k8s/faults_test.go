@@ -0,0 +1,40 @@
+package k8s
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestThrottleTransport(t *testing.T) {
+	forwarded := 0
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		forwarded++
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	throttled := &throttleTransport{next: next, faults: fault.New(map[fault.Point]float64{fault.KubeThrottle: 1}, nil)}
+	req, _ := http.NewRequest(http.MethodGet, "https://kubernetes.default/apis/apps/v1/deployments", nil)
+	resp, err := throttled.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" || string(body) != throttledBody {
+		t.Errorf("unexpected throttled response %d %v %s", resp.StatusCode, resp.Header, body)
+	}
+	if forwarded != 0 {
+		t.Errorf("expected the throttled request not to be forwarded")
+	}
+
+	passthrough := &throttleTransport{next: next, faults: fault.New(map[fault.Point]float64{fault.ValkeyPublish: 1}, nil)}
+	if resp, err := passthrough.RoundTrip(req); err != nil || resp.StatusCode != http.StatusOK || forwarded != 1 {
+		t.Errorf("expected the request to be forwarded, got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+// Inventory describes the Deployments running images under an image prefix.
+type Inventory struct {
+	// Examined is the number of Deployments listed.
+	Examined int
+	// Namespaces counts the matching Deployments in each namespace.
+	Namespaces map[string]int
+	// Images counts the matching Deployments running each image reference.
+	Images map[string]int
+}
+
+// Deployments returns the number of Deployments with at least one container
+// image under the prefix.
+func (i Inventory) Deployments() int {
+	var n int
+	for _, count := range i.Namespaces {
+		n += count
+	}
+	return n
+}
+
+// Inventory lists every Deployment and collects those with a container image
+// starting with imagePrefix. No matching Deployments usually means the prefix
+// or the worker's RBAC scope is misconfigured.
+func (r *Restarter) Inventory(ctx context.Context, imagePrefix string) (Inventory, error) {
+	deployments, err := r.listDeployments(ctx)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	inv := Inventory{
+		Examined:   len(deployments),
+		Namespaces: make(map[string]int),
+		Images:     make(map[string]int),
+	}
+	for _, d := range deployments {
+		images := make(map[string]bool)
+		for _, c := range d.Spec.Template.Spec.Containers {
+			if imageref.HasPrefix(c.Image, imagePrefix) {
+				images[c.Image] = true
+			}
+		}
+		if len(images) == 0 {
+			continue
+		}
+		inv.Namespaces[d.Namespace]++
+		for image := range images {
+			inv.Images[image]++
+		}
+	}
+	return inv, nil
+}
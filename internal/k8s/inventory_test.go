@@ -0,0 +1,41 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInventory(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		createTestDeployment("default", "app", "ghcr.io/test/myservice:dev"),
+		createTestDeployment("default", "app-copy", "ghcr.io/test/myservice:dev"),
+		createTestDeployment("other", "app", "ghcr.io/test/other@sha256:abc"),
+		createTestDeployment("default", "unrelated", "docker.io/library/nginx:latest"),
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+
+	inv, err := restarter.Inventory(context.Background(), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inv.Examined != 4 || inv.Deployments() != 3 {
+		t.Errorf("expected 3 of 4 deployments to match, got %d of %d", inv.Deployments(), inv.Examined)
+	}
+	if !reflect.DeepEqual(inv.Namespaces, map[string]int{"default": 2, "other": 1}) {
+		t.Errorf("unexpected namespaces %v", inv.Namespaces)
+	}
+	if !reflect.DeepEqual(inv.Images, map[string]int{"ghcr.io/test/myservice:dev": 2, "ghcr.io/test/other@sha256:abc": 1}) {
+		t.Errorf("unexpected images %v", inv.Images)
+	}
+
+	inv, err = restarter.Inventory(context.Background(), "ghcr.io/typo/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inv.Deployments() != 0 {
+		t.Errorf("expected no matches for a wrong prefix, got %v", inv.Namespaces)
+	}
+}
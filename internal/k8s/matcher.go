@@ -0,0 +1,246 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+// ImagesAnnotation on a Deployment or custom workload lists, comma-separated,
+// image references that restart it with the annotation match strategy, even
+// though none of its containers runs them.
+const ImagesAnnotation = "kuberollouttrigger.unitvectorylabs.com/images"
+
+// Match strategies selectable with NewMatcher.
+const (
+	// MatchStrategyImage matches containers running the image reference.
+	MatchStrategyImage = "image"
+
+	// MatchStrategyAnnotation matches workloads listing the image reference
+	// in their ImagesAnnotation.
+	MatchStrategyAnnotation = "annotation"
+
+	// MatchStrategySemver matches containers running a floating tag, such
+	// as 1.4 or 1, of the semantic version tag of the image reference.
+	MatchStrategySemver = "semver"
+)
+
+// Semver channels, the floating tags matched by the semver strategy.
+const (
+	// SemverChannelMajor matches the major version tag, 1 for 1.4.7.
+	SemverChannelMajor = "major"
+	// SemverChannelMinor matches the minor version tag, 1.4 for 1.4.7.
+	SemverChannelMinor = "minor"
+)
+
+// MatcherOptions configure the matchers created by NewMatcher.
+type MatcherOptions struct {
+	// Tags normalizes tags before image references are compared.
+	Tags imageref.TagRules
+	// SemverChannels are the floating tags matched by the semver strategy.
+	// Empty matches both SemverChannelMajor and SemverChannelMinor.
+	SemverChannels []string
+}
+
+// Container is a container of a Candidate.
+type Container struct {
+	Name  string
+	Image string
+}
+
+// Candidate is a Deployment or custom workload examined by a Matcher.
+type Candidate struct {
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	Containers  []Container
+}
+
+// Matcher decides which workloads an image reference of an event restarts.
+type Matcher interface {
+	// Match returns the names of the containers of candidate that make it
+	// match imageRef, or none if it does not match. imageRef is normalized
+	// with imageref.Normalize, once for all candidates.
+	Match(ctx context.Context, imageRef string, candidate *Candidate) []string
+}
+
+// ImageMatcher matches the containers whose image is imageRef once
+// normalized. It is the default Matcher.
+type ImageMatcher struct {
+	// Tags normalizes the tags of both images before they are compared.
+	Tags imageref.TagRules
+}
+
+// Match implements Matcher.
+func (m ImageMatcher) Match(ctx context.Context, imageRef string, candidate *Candidate) []string {
+	imageRef = m.Tags.Ref(imageRef)
+	var names []string
+	for _, c := range candidate.Containers {
+		if m.Tags.Ref(imageref.Normalize(c.Image)) == imageRef {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// AnnotationMatcher matches workloads whose ImagesAnnotation lists imageRef,
+// for workloads that follow an image they do not run directly, such as one
+// pulled by an init step or pinned by digest. A match names every container,
+// since the annotation does not say which one uses the image.
+type AnnotationMatcher struct {
+	// Tags normalizes the tags of both images before they are compared.
+	Tags imageref.TagRules
+}
+
+// Match implements Matcher.
+func (m AnnotationMatcher) Match(ctx context.Context, imageRef string, candidate *Candidate) []string {
+	imageRef = m.Tags.Ref(imageRef)
+	for _, ref := range strings.Split(candidate.Annotations[ImagesAnnotation], ",") {
+		if ref = strings.TrimSpace(ref); ref != "" && m.Tags.Ref(imageref.Normalize(ref)) == imageRef {
+			names := make([]string, len(candidate.Containers))
+			for i, c := range candidate.Containers {
+				names[i] = c.Name
+			}
+			return names
+		}
+	}
+	return nil
+}
+
+// semverTagPattern matches a release version tag, MAJOR.MINOR.PATCH without
+// pre-release or build metadata.
+var semverTagPattern = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)$`)
+
+// SemverMatcher matches the containers running a floating tag of the
+// version tag of imageRef in the same repository, so that consumers of 1.4
+// or 1 are restarted when 1.4.7 is pushed. Pre-release versions and tags
+// that are not versions match nothing.
+type SemverMatcher struct {
+	// Tags normalizes the tags of both images before they are compared.
+	Tags imageref.TagRules
+	// Channels are the floating tags matched, SemverChannelMajor and
+	// SemverChannelMinor.
+	Channels []string
+}
+
+// Match implements Matcher.
+func (m SemverMatcher) Match(ctx context.Context, imageRef string, candidate *Candidate) []string {
+	repo, tag, ok := splitImageRef(m.Tags.Ref(imageRef))
+	if !ok {
+		return nil
+	}
+	floating := m.floatingTags(tag)
+	if len(floating) == 0 {
+		return nil
+	}
+	var names []string
+	for _, c := range candidate.Containers {
+		image, running, ok := splitImageRef(m.Tags.Ref(imageref.Normalize(c.Image)))
+		if ok && image == repo && slices.Contains(floating, running) {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// floatingTags returns the floating tags of the channels of version tag, or
+// none if tag is not a release version.
+func (m SemverMatcher) floatingTags(tag string) []string {
+	version := semverTagPattern.FindStringSubmatch(tag)
+	if version == nil {
+		return nil
+	}
+	var tags []string
+	for _, channel := range m.Channels {
+		switch channel {
+		case SemverChannelMajor:
+			tags = append(tags, version[1])
+		case SemverChannelMinor:
+			tags = append(tags, version[1]+"."+version[2])
+		}
+	}
+	return tags
+}
+
+// Matchers matches a workload if any of its matchers does, naming the
+// containers each one matched once, in order.
+type Matchers []Matcher
+
+// Match implements Matcher.
+func (m Matchers) Match(ctx context.Context, imageRef string, candidate *Candidate) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, matcher := range m {
+		for _, name := range matcher.Match(ctx, imageRef, candidate) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// NewMatcher returns the Matcher combining the named strategies, configured
+// by opts. No strategies returns an ImageMatcher.
+func NewMatcher(strategies []string, opts MatcherOptions) (Matcher, error) {
+	if len(strategies) == 0 {
+		return ImageMatcher{Tags: opts.Tags}, nil
+	}
+
+	var matchers Matchers
+	seen := make(map[string]bool)
+	for _, s := range strategies {
+		if seen[s] {
+			return nil, fmt.Errorf("match strategy %q is listed twice", s)
+		}
+		seen[s] = true
+		switch s {
+		case MatchStrategyImage:
+			matchers = append(matchers, ImageMatcher{Tags: opts.Tags})
+		case MatchStrategyAnnotation:
+			matchers = append(matchers, AnnotationMatcher{Tags: opts.Tags})
+		case MatchStrategySemver:
+			channels, err := semverChannels(opts.SemverChannels)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, SemverMatcher{Tags: opts.Tags, Channels: channels})
+		default:
+			return nil, fmt.Errorf("unknown match strategy %q, expected %s, %s or %s", s, MatchStrategyImage, MatchStrategyAnnotation, MatchStrategySemver)
+		}
+	}
+	if len(matchers) == 1 {
+		return matchers[0], nil
+	}
+	return matchers, nil
+}
+
+// semverChannels validates channels, defaulting to both channels.
+func semverChannels(channels []string) ([]string, error) {
+	if len(channels) == 0 {
+		return []string{SemverChannelMajor, SemverChannelMinor}, nil
+	}
+	for i, channel := range channels {
+		if channel != SemverChannelMajor && channel != SemverChannelMinor {
+			return nil, fmt.Errorf("unknown semver channel %q, expected %s or %s", channel, SemverChannelMajor, SemverChannelMinor)
+		}
+		if slices.Contains(channels[:i], channel) {
+			return nil, fmt.Errorf("semver channel %q is listed twice", channel)
+		}
+	}
+	return channels, nil
+}
+
+// matcher returns the configured Matcher, or the default ImageMatcher.
+func (r *Restarter) matcher() Matcher {
+	if r.opts.Matcher != nil {
+		return r.opts.Matcher
+	}
+	return ImageMatcher{}
+}
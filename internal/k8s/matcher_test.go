@@ -0,0 +1,149 @@
+package k8s
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+func TestNewMatcher(t *testing.T) {
+	for _, tt := range []struct {
+		strategies []string
+		want       Matcher
+	}{
+		{nil, ImageMatcher{}},
+		{[]string{"image"}, ImageMatcher{}},
+		{[]string{"annotation"}, AnnotationMatcher{}},
+		{[]string{"image", "annotation"}, Matchers{ImageMatcher{}, AnnotationMatcher{}}},
+	} {
+		matcher, err := NewMatcher(tt.strategies, MatcherOptions{})
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", tt.strategies, err)
+			continue
+		}
+		if m, ok := matcher.(Matchers); ok {
+			if !slices.Equal(m, tt.want.(Matchers)) {
+				t.Errorf("expected %v for %v, got %v", tt.want, tt.strategies, matcher)
+			}
+		} else if matcher != tt.want {
+			t.Errorf("expected %T for %v, got %T", tt.want, tt.strategies, matcher)
+		}
+	}
+
+	matcher, err := NewMatcher([]string{"semver"}, MatcherOptions{})
+	if err != nil || !slices.Equal(matcher.(SemverMatcher).Channels, []string{"major", "minor"}) {
+		t.Errorf("expected both semver channels by default, got %+v %v", matcher, err)
+	}
+	for _, channels := range [][]string{{"patch"}, {"minor", "minor"}} {
+		if _, err := NewMatcher([]string{"semver"}, MatcherOptions{SemverChannels: channels}); err == nil {
+			t.Errorf("expected an error for semver channels %v", channels)
+		}
+	}
+
+	for _, strategies := range [][]string{{"regex"}, {"image", "image"}} {
+		if _, err := NewMatcher(strategies, MatcherOptions{}); err == nil {
+			t.Errorf("expected an error for %v", strategies)
+		}
+	}
+}
+
+func TestFindMatchingDeployments_Matchers(t *testing.T) {
+	follower := createTestDeployment("default", "follower", "ghcr.io/test/runner:v1", "ghcr.io/test/sidecar:v1")
+	follower.Annotations = map[string]string{ImagesAnnotation: "ghcr.io/test/other:dev, ghcr.io/test/myservice:dev"}
+	client := fake.NewSimpleClientset(
+		createTestDeployment("default", "runner", "ghcr.io/test/myservice:dev"),
+		follower,
+	)
+	restarter := NewRestarterWithClient(client, testLogger())
+
+	names := func() []string {
+		t.Helper()
+		matches, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/myservice:dev")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, m := range matches {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+
+	// The default image matcher ignores the annotation
+	if got := names(); !slices.Equal(got, []string{"runner"}) {
+		t.Errorf("expected only runner to match by image, got %v", got)
+	}
+
+	restarter.opts.Matcher = AnnotationMatcher{}
+	if got := names(); !slices.Equal(got, []string{"follower"}) {
+		t.Errorf("expected only follower to match by annotation, got %v", got)
+	}
+
+	restarter.opts.Matcher = Matchers{ImageMatcher{}, AnnotationMatcher{}}
+	matches, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/myservice:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected both deployments to match, got %+v", matches)
+	}
+	for _, m := range matches {
+		if m.Name == "follower" && !slices.Equal(m.ContainerNames, []string{"container-0", "container-1"}) {
+			t.Errorf("expected an annotation match to name every container, got %v", m.ContainerNames)
+		}
+	}
+}
+
+func TestMatchers_TagRules(t *testing.T) {
+	candidate := &Candidate{
+		Annotations: map[string]string{ImagesAnnotation: "ghcr.io/test/other:V2.0.0"},
+		Containers: []Container{
+			{Name: "app", Image: "GHCR.io/test/myservice:v1.2.3"},
+			{Name: "pinned", Image: "ghcr.io/test/myservice@sha256:abc"},
+		},
+	}
+	rules := imageref.TagRules{Lowercase: true, StripPrefix: "v"}
+
+	if got := (ImageMatcher{}).Match(context.Background(), "ghcr.io/test/myservice:1.2.3", candidate); got != nil {
+		t.Errorf("expected no match without tag rules, got %v", got)
+	}
+	if got := (ImageMatcher{Tags: rules}).Match(context.Background(), "ghcr.io/test/myservice:1.2.3", candidate); !slices.Equal(got, []string{"app"}) {
+		t.Errorf("expected the app container to match with the prefix stripped, got %v", got)
+	}
+	if got := (AnnotationMatcher{Tags: rules}).Match(context.Background(), "ghcr.io/test/other:2.0.0", candidate); len(got) != 2 {
+		t.Errorf("expected the annotation to match with tag rules, got %v", got)
+	}
+}
+
+func TestSemverMatcher(t *testing.T) {
+	candidate := &Candidate{Containers: []Container{
+		{Name: "major", Image: "ghcr.io/test/myservice:1"},
+		{Name: "minor", Image: "ghcr.io/test/myservice:v1.4"},
+		{Name: "exact", Image: "ghcr.io/test/myservice:1.4.7"},
+		{Name: "other-minor", Image: "ghcr.io/test/myservice:1.3"},
+		{Name: "other-image", Image: "ghcr.io/test/other:1.4"},
+	}}
+	match := func(m SemverMatcher, imageRef string) []string {
+		return m.Match(context.Background(), imageRef, candidate)
+	}
+	both := []string{SemverChannelMajor, SemverChannelMinor}
+
+	if got := match(SemverMatcher{Channels: both}, "ghcr.io/test/myservice:1.4.7"); !slices.Equal(got, []string{"major"}) {
+		t.Errorf("expected only the major tag to match without tag rules, got %v", got)
+	}
+	if got := match(SemverMatcher{Channels: both, Tags: imageref.TagRules{StripPrefix: "v"}}, "ghcr.io/test/myservice:v1.4.7"); !slices.Equal(got, []string{"major", "minor"}) {
+		t.Errorf("expected the major and minor tags to match, got %v", got)
+	}
+	if got := match(SemverMatcher{Channels: []string{SemverChannelMajor}}, "ghcr.io/test/myservice:1.3.0"); !slices.Equal(got, []string{"major"}) {
+		t.Errorf("expected only the major channel, got %v", got)
+	}
+	for _, imageRef := range []string{"ghcr.io/test/myservice:1.4.7-rc.1", "ghcr.io/test/myservice:dev", "ghcr.io/test/myservice:1.4"} {
+		if got := match(SemverMatcher{Channels: both}, imageRef); got != nil {
+			t.Errorf("expected %s to match nothing, got %v", imageRef, got)
+		}
+	}
+}
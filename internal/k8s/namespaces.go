@@ -0,0 +1,22 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RequireDigestAnnotation on a namespace set to "true" makes the worker only
+// restart workloads in it for events that carry an image digest, when
+// NAMESPACE_DIGEST_POLICY_ENABLED is set.
+const RequireDigestAnnotation = "kuberollouttrigger.unitvectorylabs.com/require-digest"
+
+// NamespaceAnnotations returns the annotations of a namespace.
+func (r *Restarter) NamespaceAnnotations(ctx context.Context, namespace string) (map[string]string, error) {
+	ns, err := r.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+	return ns.Annotations, nil
+}
@@ -2,45 +2,224 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+const (
+	// RestartedAtAnnotation is the pod template annotation used by kubectl rollout restart.
+	RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	// TriggerAnnotation is the Deployment annotation recording who triggered the last restart.
+	TriggerAnnotation = "kuberollouttrigger.unitvectorylabs.com/trigger"
+
+	// eventComponent is the source component reported on Kubernetes Events.
+	eventComponent = "kuberollouttrigger"
+
+	// DefaultFieldManager is the field manager used for server-side apply.
+	DefaultFieldManager = "kuberollouttrigger"
+)
+
+// Patch strategies for restarting Deployments.
+const (
+	// PatchStrategyMerge uses a strategic merge patch, identical to kubectl rollout restart.
+	PatchStrategyMerge = "merge"
+
+	// PatchStrategyApply uses server-side apply with a dedicated field manager so
+	// ownership of the restart annotation is tracked in managedFields.
+	PatchStrategyApply = "apply"
 )
 
+// Restart annotation timestamp formats.
+const (
+	// TimestampFormatRFC3339 matches kubectl rollout restart, e.g. 2024-01-02T15:04:05Z.
+	TimestampFormatRFC3339 = "rfc3339"
+
+	// TimestampFormatUnix writes Unix seconds, e.g. 1704207845.
+	TimestampFormatUnix = "unix"
+)
+
+// Options configures how the Restarter connects to and interacts with Kubernetes.
+type Options struct {
+	// Kubeconfig is the path to a kubeconfig file. If empty and Context is
+	// empty, in-cluster config is used.
+	Kubeconfig string
+
+	// Context selects a kubeconfig context other than the current one.
+	Context string
+
+	// APIServer overrides the API server URL.
+	APIServer string
+
+	// BearerToken overrides the credentials with a static bearer token.
+	BearerToken string
+
+	// BearerTokenFile overrides the credentials with a token read from a file,
+	// which is re-read periodically so rotated tokens are picked up.
+	BearerTokenFile string
+
+	// CAFile overrides the certificate authority used to verify the API server.
+	CAFile string
+
+	// ExecTimeout bounds how long a kubeconfig exec credential plugin may run.
+	// Zero runs plugins directly without a timeout.
+	ExecTimeout time.Duration
+
+	// UserAgent identifies the client on every API request. Empty keeps the
+	// client-go default.
+	UserAgent string
+
+	// ImpersonateUser makes every API request as this user or service
+	// account, like kubectl --as. Empty disables impersonation.
+	ImpersonateUser string
+
+	// ImpersonateGroups are the groups of the impersonated user, like kubectl
+	// --as-group. They require ImpersonateUser.
+	ImpersonateGroups []string
+
+	// RecordEvents emits a Kubernetes Event on each restarted Deployment.
+	RecordEvents bool
+
+	// PatchStrategy is PatchStrategyMerge (default) or PatchStrategyApply.
+	PatchStrategy string
+
+	// FieldManager is the server-side apply field manager. Defaults to DefaultFieldManager.
+	FieldManager string
+
+	// ApplyForce takes ownership of conflicting fields during server-side apply
+	// instead of failing the restart.
+	ApplyForce bool
+
+	// CheckDisruption defers restarts of degraded Deployments and of Deployments
+	// whose PodDisruptionBudget allows no disruptions.
+	CheckDisruption bool
+
+	// TimestampFormat is the format of the restart annotation value:
+	// TimestampFormatRFC3339 (default), TimestampFormatUnix, or a Go time layout.
+	TimestampFormat string
+
+	// Clock returns the current time for restart annotations and Events.
+	// Defaults to time.Now.
+	Clock func() time.Time
+
+	// WorkloadKinds are custom workload resources matched and restarted in
+	// addition to Deployments, using the dynamic client.
+	WorkloadKinds []WorkloadKind
+
+	// Matcher decides which Deployments and workloads an image reference
+	// matches. Defaults to ImageMatcher.
+	Matcher Matcher
+
+	// TenantImpersonation patches the objects of each namespace as the
+	// service account named by the namespace's RestartAsAnnotation, or
+	// TenantServiceAccount, so audit logs attribute restarts to tenants.
+	TenantImpersonation bool
+
+	// TenantServiceAccount is the service account impersonated in namespaces
+	// without a RestartAsAnnotation. Empty patches them as the worker itself.
+	TenantServiceAccount string
+
+	// Namespaces restricts the worker to these namespaces, each listed on its
+	// own so a namespace it cannot list does not hide the others. Empty
+	// lists across the cluster.
+	Namespaces []string
+
+	// LabelSelector restricts every listing to the objects it selects, so
+	// the worker never enumerates Deployments and workloads it does not
+	// manage. Empty lists every object.
+	LabelSelector string
+
+	// ListPageSize is the number of objects requested per page when listing,
+	// so a cluster with many Deployments is never loaded in one response.
+	// Zero lists each scope in one request.
+	ListPageSize int64
+
+	// Faults injects simulated API throttling in dev mode.
+	Faults *fault.Injector
+}
+
 // Restarter handles Kubernetes Deployment rollout restarts.
 type Restarter struct {
 	clientset kubernetes.Interface
-	logger    *slog.Logger
+	dynamic   dynamic.Interface
+	// tenants holds the impersonating clients with TenantImpersonation
+	tenants *tenantClients
+	opts    Options
+	logger  *slog.Logger
 }
 
-// NewRestarter creates a new Restarter using the given kubeconfig path.
-// If kubeconfigPath is empty, in-cluster config is used.
-func NewRestarter(kubeconfigPath string, logger *slog.Logger) (*Restarter, error) {
-	var config *rest.Config
-	var err error
-
-	if kubeconfigPath != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	} else {
-		config, err = rest.InClusterConfig()
+// NewRestarter creates a new Restarter from the given options.
+// If opts.Kubeconfig and opts.Context are empty, in-cluster config is used.
+func NewRestarter(opts Options, logger *slog.Logger) (*Restarter, error) {
+	if err := ValidateTimestampFormat(opts.TimestampFormat); err != nil {
+		return nil, err
 	}
+
+	config, err := buildRestConfig(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes config: %w", err)
 	}
 
+	if opts.Faults != nil {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &throttleTransport{next: rt, faults: opts.Faults}
+		})
+	}
+
+	if config.ExecProvider != nil {
+		self, err := os.Executable()
+		if err != nil && opts.ExecTimeout > 0 {
+			return nil, fmt.Errorf("failed to resolve executable for exec credential plugin timeout: %w", err)
+		}
+		configureExecProvider(config, opts.ExecTimeout, self)
+		logger.Info("using exec credential plugin",
+			"command", config.ExecProvider.Command,
+			"timeout", opts.ExecTimeout.String(),
+		)
+	}
+
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
+	var dynamicClient dynamic.Interface
+	if len(opts.WorkloadKinds) > 0 {
+		dynamicClient, err = dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+		}
+	}
+
+	var tenants *tenantClients
+	if opts.TenantImpersonation {
+		tenants = newTenantClients(config, dynamicClient != nil)
+	}
+
 	return &Restarter{
 		clientset: clientset,
+		dynamic:   dynamicClient,
+		tenants:   tenants,
+		opts:      opts,
 		logger:    logger,
 	}, nil
 }
@@ -53,63 +232,351 @@ func NewRestarterWithClient(clientset kubernetes.Interface, logger *slog.Logger)
 	}
 }
 
+// CheckCredentials makes one authenticated request to the API server, so
+// that credentials it rejects fail at startup rather than with the first
+// restart. API errors are classified like those of a restart.
+func (r *Restarter) CheckCredentials() error {
+	if _, err := r.clientset.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("failed to reach the Kubernetes API server: %w", classify(err))
+	}
+	return nil
+}
+
+// now returns the current time from the configured clock.
+func (r *Restarter) now() time.Time {
+	if r.opts.Clock != nil {
+		return r.opts.Clock()
+	}
+	return time.Now()
+}
+
+// formatTimestamp renders t in UTC for the restart annotation.
+func formatTimestamp(t time.Time, format string) string {
+	t = t.UTC()
+	switch format {
+	case "", TimestampFormatRFC3339:
+		return t.Format(time.RFC3339)
+	case TimestampFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	default:
+		return t.Format(format)
+	}
+}
+
+// ValidateTimestampFormat checks that format is a known format or a Go time
+// layout with at least second precision. A layout that renders the same value
+// for different seconds would leave the annotation unchanged, so a restart
+// would silently not roll out.
+func ValidateTimestampFormat(format string) error {
+	base := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	if formatTimestamp(base, format) == formatTimestamp(base.Add(time.Second), format) {
+		return fmt.Errorf("timestamp format %q does not change every second", format)
+	}
+	return nil
+}
+
 // MatchingDeployment describes a Deployment that matches an image reference.
 type MatchingDeployment struct {
 	Namespace      string
 	Name           string
 	ContainerNames []string
+	// Containers records, for each matched container, the image it runs and
+	// the image reference it matched.
+	Containers []ContainerMatch
+	Labels     map[string]string
+}
+
+// ContainerMatch records which container of a restarted object matched which
+// image reference of an event. It is recorded in the RestartCause.
+type ContainerMatch struct {
+	Name string `json:"name"`
+	// Image is the image the container ran when it matched.
+	Image string `json:"image,omitempty"`
+	// ImageRef is the event image reference that matched.
+	ImageRef string `json:"image_ref"`
+}
+
+// containerMatches returns the ContainerMatch of each of the names containers
+// of candidate, which matched imageRef.
+func containerMatches(candidate *Candidate, names []string, imageRef string) []ContainerMatch {
+	matches := make([]ContainerMatch, 0, len(names))
+	for _, name := range names {
+		m := ContainerMatch{Name: name, ImageRef: imageRef}
+		for _, c := range candidate.Containers {
+			if c.Name == name {
+				m.Image = c.Image
+				break
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
 }
 
-// FindMatchingDeployments lists all Deployments across accessible namespaces
-// and returns those with containers matching the given image reference.
+// deploymentCandidate returns the Candidate a Matcher examines for d.
+func deploymentCandidate(d *appsv1.Deployment) *Candidate {
+	containers := make([]Container, len(d.Spec.Template.Spec.Containers))
+	for i, c := range d.Spec.Template.Spec.Containers {
+		containers[i] = Container{Name: c.Name, Image: c.Image}
+	}
+	return &Candidate{
+		Namespace:   d.Namespace,
+		Name:        d.Name,
+		Labels:      d.Labels,
+		Annotations: d.Annotations,
+		Containers:  containers,
+	}
+}
+
+// FindMatchingDeployments lists all Deployments in scope, page by page with
+// ListPageSize, and returns those the Matcher matches with the given image
+// reference.
+// Listing errors are classified like those of RestartDeployment.
 func (r *Restarter) FindMatchingDeployments(ctx context.Context, imageRef string) ([]MatchingDeployment, error) {
-	deployments, err := r.clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	// Normalize once rather than for every container of every Deployment
+	want := imageref.Normalize(imageRef)
+	matcher := r.matcher()
+	// Match page by page so only the matches are kept in memory
+	matches, err := listScoped(ctx, r, "deployments", r.deploymentPage, func(d *appsv1.Deployment) (MatchingDeployment, bool) {
+		candidate := deploymentCandidate(d)
+		containerNames := matcher.Match(ctx, want, candidate)
+		if len(containerNames) == 0 {
+			return MatchingDeployment{}, false
+		}
+		return MatchingDeployment{
+			Namespace:      d.Namespace,
+			Name:           d.Name,
+			ContainerNames: containerNames,
+			Containers:     containerMatches(candidate, containerNames, imageRef),
+			Labels:         d.Labels,
+		}, true
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list deployments: %w", err)
 	}
+	return matches, nil
+}
 
-	var matches []MatchingDeployment
-	for _, d := range deployments.Items {
-		var containerNames []string
-		for _, c := range d.Spec.Template.Spec.Containers {
-			if c.Image == imageRef {
-				containerNames = append(containerNames, c.Name)
-			}
-		}
-		if len(containerNames) > 0 {
-			matches = append(matches, MatchingDeployment{
-				Namespace:      d.Namespace,
-				Name:           d.Name,
-				ContainerNames: containerNames,
-			})
-		}
+// RestartCause describes the event and identity behind a restart. It is recorded
+// in the TriggerAnnotation and in the Kubernetes Event for the restart.
+type RestartCause struct {
+	Image string `json:"image,omitempty"`
+	// Images lists the images of a multi-image event when several of them
+	// matched the restarted object; Image is then empty.
+	Images          []string `json:"images,omitempty"`
+	Repository      string   `json:"repository,omitempty"`
+	RepositoryOwner string   `json:"repository_owner,omitempty"`
+	Actor           string   `json:"actor,omitempty"`
+	RunID           string   `json:"run_id,omitempty"`
+	// Containers lists the containers that matched and the image reference
+	// each matched, so a rollback investigation can tell which container's
+	// image caused the rollout.
+	Containers []ContainerMatch `json:"containers,omitempty"`
+	// Reason is the operator supplied note for manual restarts.
+	Reason string `json:"reason,omitempty"`
+}
+
+// String returns a short human readable description of the cause.
+func (c *RestartCause) String() string {
+	desc := "image " + c.Image
+	if len(c.Images) > 0 {
+		desc = "images " + strings.Join(c.Images, ", ")
+	} else if c.Image == "" {
+		desc = "manual request"
+	}
+	if c.Repository != "" {
+		desc += " from " + c.Repository
+	}
+	if c.RunID != "" {
+		desc += " run " + c.RunID
+	}
+	if c.Actor != "" {
+		desc += " by " + c.Actor
+	}
+	if c.Reason != "" {
+		desc += ": " + c.Reason
 	}
+	return desc
+}
 
-	return matches, nil
+// containersString describes the matched containers as name=image_ref pairs,
+// or returns an empty string if none were recorded.
+func (c *RestartCause) containersString() string {
+	pairs := make([]string, len(c.Containers))
+	for i, m := range c.Containers {
+		pairs[i] = m.Name + "=" + m.ImageRef
+	}
+	return strings.Join(pairs, ", ")
 }
 
 // RestartDeployment triggers a rollout restart for the specified Deployment
 // by patching the pod template annotation with the current timestamp.
-func (r *Restarter) RestartDeployment(ctx context.Context, namespace, name string) error {
-	patch := fmt.Sprintf(
-		`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`,
-		time.Now().UTC().Format(time.RFC3339),
-	)
+// If cause is non-nil it is recorded on the Deployment metadata (not the pod
+// template) and, when enabled, in a Kubernetes Event. With CheckDisruption
+// enabled, a *DeferredError is returned instead of restarting when it would
+// be unsafe. Kubernetes API errors match ErrNotFound, ErrForbidden,
+// ErrConflict or ErrThrottled with errors.Is.
+func (r *Restarter) RestartDeployment(ctx context.Context, namespace, name string, cause *RestartCause) error {
+	if r.opts.CheckDisruption {
+		if err := r.CheckDisruption(ctx, namespace, name); err != nil {
+			return err
+		}
+	}
+
+	templateAnnotations := map[string]string{
+		RestartedAtAnnotation: formatTimestamp(r.now(), r.opts.TimestampFormat),
+	}
+	var deploymentAnnotations map[string]string
+	if cause != nil {
+		causeJSON, err := json.Marshal(cause)
+		if err != nil {
+			return fmt.Errorf("failed to encode restart cause: %w", err)
+		}
+		deploymentAnnotations = map[string]string{
+			TriggerAnnotation: string(causeJSON),
+		}
+	}
+
+	client, err := r.writeClient(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	var deployment *appsv1.Deployment
+	if r.opts.PatchStrategy == PatchStrategyApply {
+		deployment, err = r.applyRestart(ctx, client.clientset, namespace, name, templateAnnotations, deploymentAnnotations)
+	} else {
+		deployment, err = r.mergeRestart(ctx, client.clientset, namespace, name, templateAnnotations, deploymentAnnotations)
+	}
+	if err != nil {
+		return err
+	}
+
+	logArgs := []any{"namespace", namespace, "deployment", name}
+	if client.user != "" {
+		logArgs = append(logArgs, "impersonated_user", client.user)
+	}
+	r.logger.Info("triggered rollout restart", logArgs...)
+
+	if r.opts.RecordEvents && cause != nil {
+		r.recordRestartEvent(ctx, deployment, cause)
+	}
+	return nil
+}
+
+// mergeRestart sets the annotations with a strategic merge patch.
+func (r *Restarter) mergeRestart(ctx context.Context, clientset kubernetes.Interface, namespace, name string, templateAnnotations, deploymentAnnotations map[string]string) (*appsv1.Deployment, error) {
+	patch := map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": templateAnnotations,
+				},
+			},
+		},
+	}
+	if len(deploymentAnnotations) > 0 {
+		patch["metadata"] = map[string]any{
+			"annotations": deploymentAnnotations,
+		}
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode patch: %w", err)
+	}
 
-	_, err := r.clientset.AppsV1().Deployments(namespace).Patch(
+	deployment, err := clientset.AppsV1().Deployments(namespace).Patch(
 		ctx,
 		name,
 		types.StrategicMergePatchType,
-		[]byte(patch),
+		patchBytes,
 		metav1.PatchOptions{},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to patch deployment %s/%s: %w", namespace, name, err)
+		return nil, fmt.Errorf("failed to patch deployment %s/%s: %w", namespace, name, classify(err))
 	}
+	return deployment, nil
+}
 
-	r.logger.Info("triggered rollout restart",
-		"namespace", namespace,
-		"deployment", name,
-	)
-	return nil
+// applyRestart sets the annotations with server-side apply. The Deployment is
+// fetched first and its UID applied as a precondition, so that apply never
+// creates a Deployment that does not exist, even one deleted in between.
+// Conflicts with other field managers are returned as errors unless ApplyForce is set.
+func (r *Restarter) applyRestart(ctx context.Context, clientset kubernetes.Interface, namespace, name string, templateAnnotations, deploymentAnnotations map[string]string) (*appsv1.Deployment, error) {
+	existing, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s/%s: %w", namespace, name, classify(err))
+	}
+
+	// Apply removes the fields of the field manager it leaves out, so a
+	// restart without a cause keeps applying the current trigger annotation
+	if _, ok := deploymentAnnotations[TriggerAnnotation]; !ok {
+		if current, ok := existing.Annotations[TriggerAnnotation]; ok {
+			deploymentAnnotations = map[string]string{TriggerAnnotation: current}
+		}
+	}
+
+	fieldManager := r.opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+
+	applyConfig := appsv1ac.Deployment(name, namespace).
+		WithUID(existing.UID).
+		WithSpec(appsv1ac.DeploymentSpec().
+			WithTemplate(corev1ac.PodTemplateSpec().
+				WithAnnotations(templateAnnotations)))
+	if len(deploymentAnnotations) > 0 {
+		applyConfig.WithAnnotations(deploymentAnnotations)
+	}
+
+	deployment, err := clientset.AppsV1().Deployments(namespace).Apply(ctx, applyConfig, metav1.ApplyOptions{
+		FieldManager: fieldManager,
+		Force:        r.opts.ApplyForce,
+	})
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, fmt.Errorf("server-side apply conflict on deployment %s/%s (field manager %q; set apply force to take ownership): %w", namespace, name, fieldManager, classify(err))
+		}
+		return nil, fmt.Errorf("failed to apply deployment %s/%s: %w", namespace, name, classify(err))
+	}
+	return deployment, nil
+}
+
+// recordRestartEvent creates a Kubernetes Event on the Deployment describing the
+// restart. Failures are logged but never fail the restart itself.
+func (r *Restarter) recordRestartEvent(ctx context.Context, d *appsv1.Deployment, cause *RestartCause) {
+	now := metav1.NewTime(r.now())
+	message := "Rollout restart triggered for " + cause.String()
+	if containers := cause.containersString(); containers != "" {
+		message += " (containers " + containers + ")"
+	}
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: d.Name + ".",
+			Namespace:    d.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "apps/v1",
+			Kind:            "Deployment",
+			Namespace:       d.Namespace,
+			Name:            d.Name,
+			UID:             d.UID,
+			ResourceVersion: d.ResourceVersion,
+		},
+		Reason:         "RolloutRestartTriggered",
+		Message:        message,
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := r.clientset.CoreV1().Events(d.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		r.logger.Warn("failed to record Kubernetes event",
+			"namespace", d.Namespace,
+			"deployment", d.Name,
+			"error", err,
+		)
+	}
 }
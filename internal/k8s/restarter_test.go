@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func testLogger() *slog.Logger {
@@ -81,6 +86,24 @@ func TestFindMatchingDeployments_MultipleMatches(t *testing.T) {
 	}
 }
 
+func TestFindMatchingDeployments_RegistryPort(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		createTestDeployment("ns1", "app1", "Registry.Internal:5000/team/app:dev"),
+		createTestDeployment("ns2", "app2", "registry.internal:5001/team/app:dev"),
+		createTestDeployment("ns3", "app3", "registry.internal/team/app:dev"),
+	)
+
+	restarter := NewRestarterWithClient(client, testLogger())
+	matches, err := restarter.FindMatchingDeployments(context.Background(), "registry.internal:5000/team/app:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(matches) != 1 || matches[0].Name != "app1" {
+		t.Fatalf("expected only app1 to match regardless of host case, got %+v", matches)
+	}
+}
+
 func TestFindMatchingDeployments_NoMatch(t *testing.T) {
 	client := fake.NewSimpleClientset(
 		createTestDeployment("default", "my-app", "ghcr.io/test/myservice:prod"),
@@ -118,6 +141,10 @@ func TestFindMatchingDeployments_MultipleContainers(t *testing.T) {
 	if len(matches[0].ContainerNames) != 1 {
 		t.Errorf("expected 1 container match, got %d", len(matches[0].ContainerNames))
 	}
+	want := []ContainerMatch{{Name: matches[0].ContainerNames[0], Image: "ghcr.io/test/myservice:dev", ImageRef: "ghcr.io/test/myservice:dev"}}
+	if !slices.Equal(matches[0].Containers, want) {
+		t.Errorf("expected the matched container and image reference to be recorded, got %+v", matches[0].Containers)
+	}
 
 	// Match second container
 	matches, err = restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/sidecar:dev")
@@ -155,7 +182,7 @@ func TestRestartDeployment(t *testing.T) {
 	client := fake.NewSimpleClientset(deploy)
 
 	restarter := NewRestarterWithClient(client, testLogger())
-	err := restarter.RestartDeployment(context.Background(), "default", "my-app")
+	err := restarter.RestartDeployment(context.Background(), "default", "my-app", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -179,8 +206,219 @@ func TestRestartDeployment_NotFound(t *testing.T) {
 	client := fake.NewSimpleClientset()
 
 	restarter := NewRestarterWithClient(client, testLogger())
-	err := restarter.RestartDeployment(context.Background(), "default", "nonexistent")
+	err := restarter.RestartDeployment(context.Background(), "default", "nonexistent", nil)
 	if err == nil {
 		t.Fatal("expected error for nonexistent deployment")
 	}
 }
+
+func TestRestartDeployment_WithCause(t *testing.T) {
+	deploy := createTestDeployment("default", "my-app", "ghcr.io/test/myservice:dev")
+	client := fake.NewSimpleClientset(deploy)
+
+	restarter := NewRestarterWithClient(client, testLogger())
+	restarter.opts.RecordEvents = true
+
+	cause := &RestartCause{
+		Image:           "ghcr.io/test/myservice:dev",
+		Repository:      "test-org/myservice",
+		RepositoryOwner: "test-org",
+		Actor:           "octocat",
+		RunID:           "42",
+		Containers:      []ContainerMatch{{Name: "container-0", Image: "ghcr.io/test/myservice:dev", ImageRef: "ghcr.io/test/myservice:dev"}},
+	}
+	if err := restarter.RestartDeployment(context.Background(), "default", "my-app", cause); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updated, err := client.AppsV1().Deployments("default").Get(context.Background(), "my-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	trigger := updated.Annotations[TriggerAnnotation]
+	if !strings.Contains(trigger, `"actor":"octocat"`) || !strings.Contains(trigger, `"run_id":"42"`) {
+		t.Errorf("expected trigger annotation to record actor and run id, got %q", trigger)
+	}
+	if !strings.Contains(trigger, `"containers":[{"name":"container-0","image":"ghcr.io/test/myservice:dev","image_ref":"ghcr.io/test/myservice:dev"}]`) {
+		t.Errorf("expected trigger annotation to record the matched containers, got %q", trigger)
+	}
+	if _, ok := updated.Spec.Template.Annotations[TriggerAnnotation]; ok {
+		t.Error("expected trigger annotation to be set on the deployment, not the pod template")
+	}
+
+	events, err := client.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list events: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events.Items))
+	}
+	if events.Items[0].InvolvedObject.Name != "my-app" || !strings.Contains(events.Items[0].Message, "octocat") ||
+		!strings.Contains(events.Items[0].Message, "(containers container-0=ghcr.io/test/myservice:dev)") {
+		t.Errorf("unexpected event: %+v", events.Items[0])
+	}
+}
+
+func TestRestartDeployment_ServerSideApply(t *testing.T) {
+	deploy := createTestDeployment("default", "my-app", "ghcr.io/test/myservice:dev")
+	deploy.UID = "5c4a5d1e-0000-4000-8000-000000000001"
+	client := fake.NewClientset(deploy)
+	var patches []string
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches = append(patches, string(action.(k8stesting.PatchAction).GetPatch()))
+		return false, nil, nil
+	})
+
+	restarter := NewRestarterWithClient(client, testLogger())
+	restarter.opts.PatchStrategy = PatchStrategyApply
+
+	cause := &RestartCause{Image: "ghcr.io/test/myservice:dev", Actor: "octocat"}
+	if err := restarter.RestartDeployment(context.Background(), "default", "my-app", cause); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updated, err := client.AppsV1().Deployments("default").Get(context.Background(), "my-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if updated.Spec.Template.Annotations[RestartedAtAnnotation] == "" {
+		t.Error("expected restartedAt annotation to be set")
+	}
+	if !strings.Contains(updated.Annotations[TriggerAnnotation], "octocat") {
+		t.Errorf("expected trigger annotation, got %q", updated.Annotations[TriggerAnnotation])
+	}
+	if len(updated.Spec.Template.Spec.Containers) != 1 || updated.Spec.Template.Spec.Containers[0].Image != "ghcr.io/test/myservice:dev" {
+		t.Errorf("expected containers to be preserved, got %+v", updated.Spec.Template.Spec.Containers)
+	}
+
+	var found bool
+	for _, mf := range updated.ManagedFields {
+		if mf.Manager == DefaultFieldManager && mf.Operation == metav1.ManagedFieldsOperationApply {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected managedFields entry for %q, got %+v", DefaultFieldManager, updated.ManagedFields)
+	}
+
+	// A restart without a cause keeps the annotation the field manager owns
+	if err := restarter.RestartDeployment(context.Background(), "default", "my-app", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err = client.AppsV1().Deployments("default").Get(context.Background(), "my-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get deployment: %v", err)
+	}
+	if !strings.Contains(updated.Annotations[TriggerAnnotation], "octocat") {
+		t.Errorf("expected the trigger annotation to be kept, got %q", updated.Annotations[TriggerAnnotation])
+	}
+
+	// The UID of the fetched Deployment makes the API server reject an apply
+	// that would recreate it after a deletion
+	for _, patch := range patches {
+		if !strings.Contains(patch, `"uid":"5c4a5d1e-0000-4000-8000-000000000001"`) {
+			t.Errorf("expected the apply to carry the UID precondition, got %s", patch)
+		}
+	}
+	if len(patches) != 2 {
+		t.Errorf("expected 2 applies, got %d", len(patches))
+	}
+}
+
+func TestRestartDeployment_ServerSideApplyNotFound(t *testing.T) {
+	client := fake.NewClientset()
+
+	restarter := NewRestarterWithClient(client, testLogger())
+	restarter.opts.PatchStrategy = PatchStrategyApply
+
+	if err := restarter.RestartDeployment(context.Background(), "default", "nonexistent", nil); err == nil {
+		t.Fatal("expected error for nonexistent deployment")
+	}
+	if _, err := client.AppsV1().Deployments("default").Get(context.Background(), "nonexistent", metav1.GetOptions{}); err == nil {
+		t.Fatal("expected apply not to create the deployment")
+	}
+}
+
+func TestRestartDeployment_TimestampFormat(t *testing.T) {
+	fixed := time.Date(2024, 1, 2, 15, 4, 5, 0, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "2024-01-02T20:04:05Z"},
+		{TimestampFormatRFC3339, "2024-01-02T20:04:05Z"},
+		{TimestampFormatUnix, "1704225845"},
+		{"2006-01-02 15:04:05", "2024-01-02 20:04:05"},
+	}
+	for _, tt := range tests {
+		client := fake.NewSimpleClientset(createTestDeployment("default", "my-app", "ghcr.io/test/myservice:dev"))
+		restarter := NewRestarterWithClient(client, testLogger())
+		restarter.opts.TimestampFormat = tt.format
+		restarter.opts.Clock = func() time.Time { return fixed }
+
+		if err := restarter.RestartDeployment(context.Background(), "default", "my-app", nil); err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.format, err)
+		}
+		updated, _ := client.AppsV1().Deployments("default").Get(context.Background(), "my-app", metav1.GetOptions{})
+		if got := updated.Spec.Template.Annotations[RestartedAtAnnotation]; got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.format, tt.want, got)
+		}
+	}
+}
+
+func TestValidateTimestampFormat(t *testing.T) {
+	for _, format := range []string{"", TimestampFormatRFC3339, TimestampFormatUnix, time.RFC1123} {
+		if err := ValidateTimestampFormat(format); err != nil {
+			t.Errorf("%q: unexpected error: %v", format, err)
+		}
+	}
+	for _, format := range []string{"2006-01-02", "static"} {
+		if err := ValidateTimestampFormat(format); err == nil {
+			t.Errorf("%q: expected error for format without second precision", format)
+		}
+	}
+}
+
+func TestRestartCause_String(t *testing.T) {
+	tests := []struct {
+		cause *RestartCause
+		want  string
+	}{
+		{&RestartCause{Image: "ghcr.io/test/svc", Repository: "test/svc", RunID: "42", Actor: "octocat"}, "image ghcr.io/test/svc from test/svc run 42 by octocat"},
+		{&RestartCause{Actor: "admin", Reason: "config change"}, "manual request by admin: config change"},
+		{&RestartCause{Images: []string{"ghcr.io/test/svc", "ghcr.io/test/sidecar"}, RunID: "42"}, "images ghcr.io/test/svc, ghcr.io/test/sidecar run 42"},
+	}
+	for _, tt := range tests {
+		if got := tt.cause.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func BenchmarkFindMatchingDeployments(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("deployments=%d", n), func(b *testing.B) {
+			objects := make([]runtime.Object, n)
+			for i := range objects {
+				// One in a hundred runs the pushed image, next to a sidecar
+				image := fmt.Sprintf("ghcr.io/test/service-%d:dev", i)
+				if i%100 == 0 {
+					image = "ghcr.io/test/myservice:dev"
+				}
+				objects[i] = createTestDeployment(fmt.Sprintf("ns-%d", i%50), fmt.Sprintf("app-%d", i), image, "registry.internal:5000/proxy:v1")
+			}
+			r := NewRestarterWithClient(fake.NewSimpleClientset(objects...), testLogger())
+
+			b.ReportAllocs()
+			for b.Loop() {
+				matches, err := r.FindMatchingDeployments(context.Background(), "ghcr.io/test/myservice:dev")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(matches) != n/100 {
+					b.Fatalf("expected %d matches, got %d", n/100, len(matches))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// A throttled page is retried pageRetries times, waiting pageRetryDelay and
+// then twice as long each time, before the listing fails.
+const pageRetries = 3
+
+var pageRetryDelay = time.Second
+
+// listPage lists one page of a resource in namespace with opts, returning
+// its items and the continue token of the next page, empty on the last one.
+type listPage[T any] func(ctx context.Context, namespace string, opts metav1.ListOptions) ([]T, string, error)
+
+// listScoped lists a resource page by page, once for the whole cluster, or,
+// with Options.Namespaces, once for each namespace concurrently. Only the
+// objects matching Options.LabelSelector are listed. keep is
+// called with each item as its page arrives and returns what to collect, so
+// that only the kept items, not every object of the cluster, are held in
+// memory; keep calls are serialized. A namespace whose listing fails, for
+// example because the worker has no Role in it, is logged and skipped so
+// that the others are still served; an error is only returned if every
+// namespace failed.
+func listScoped[T, R any](ctx context.Context, r *Restarter, resource string, list listPage[T], keep func(*T) (R, bool)) ([]R, error) {
+	var mu sync.Mutex
+	keepLocked := func(item *T) (R, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return keep(item)
+	}
+
+	namespaces := r.opts.Namespaces
+	if len(namespaces) == 0 {
+		return listPaged(ctx, r, metav1.NamespaceAll, list, keep)
+	}
+
+	results := make([][]R, len(namespaces))
+	errs := make([]error, len(namespaces))
+	var wg sync.WaitGroup
+	for i, namespace := range namespaces {
+		wg.Go(func() {
+			results[i], errs[i] = listPaged(ctx, r, namespace, list, keepLocked)
+		})
+	}
+	wg.Wait()
+
+	var items []R
+	var failed []string
+	for i, namespace := range namespaces {
+		if errs[i] != nil {
+			failed = append(failed, namespace)
+			r.logger.Warn("failed to list "+resource+" in namespace, skipping it", "namespace", namespace, "error", errs[i])
+			continue
+		}
+		items = append(items, results[i]...)
+	}
+	if len(failed) == len(namespaces) {
+		return nil, fmt.Errorf("failed in all %d namespaces: %w", len(namespaces), errs[0])
+	}
+	return items, nil
+}
+
+// listPaged lists namespace with pages of Options.ListPageSize objects,
+// following continue tokens. A throttled page is retried after a backoff
+// without starting over. If a continue token expires before the listing
+// completes, the namespace is listed again in one request, like the
+// client-go pager does, rather than mixing two snapshots.
+func listPaged[T, R any](ctx context.Context, r *Restarter, namespace string, list listPage[T], keep func(*T) (R, bool)) ([]R, error) {
+	var kept []R
+	opts := metav1.ListOptions{LabelSelector: r.opts.LabelSelector, Limit: r.opts.ListPageSize}
+	retries := 0
+	for {
+		items, next, err := list(ctx, namespace, opts)
+		switch {
+		case err != nil && apierrors.IsResourceExpired(err) && opts.Continue != "":
+			r.logger.Warn("list continue token expired, listing again in one request", "namespace", namespace)
+			kept, opts.Continue, opts.Limit = nil, "", 0
+			continue
+		case err != nil && errors.Is(classify(err), ErrThrottled) && retries < pageRetries:
+			delay := pageRetryDelay << retries
+			retries++
+			r.logger.Warn("list page throttled, retrying", "namespace", namespace, "retry_in", delay.String(), "error", err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		case err != nil:
+			return nil, classify(err)
+		}
+		retries = 0
+		for i := range items {
+			if item, ok := keep(&items[i]); ok {
+				kept = append(kept, item)
+			}
+		}
+		if next == "" {
+			return kept, nil
+		}
+		opts.Continue = next
+	}
+}
+
+// keepAll keeps every item of a listing.
+func keepAll[T any](item *T) (T, bool) {
+	return *item, true
+}
+
+// deploymentPage lists a page of Deployments.
+func (r *Restarter) deploymentPage(ctx context.Context, namespace string, opts metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+	list, err := r.clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return list.Items, list.Continue, nil
+}
+
+// listDeployments lists the Deployments in scope.
+func (r *Restarter) listDeployments(ctx context.Context) ([]appsv1.Deployment, error) {
+	return listScoped(ctx, r, "deployments", r.deploymentPage, keepAll)
+}
+
+// listWorkloads lists the objects of a custom workload kind in scope.
+func (r *Restarter) listWorkloads(ctx context.Context, kind WorkloadKind) ([]unstructured.Unstructured, error) {
+	return listScoped(ctx, r, kind.String(), func(ctx context.Context, namespace string, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+		list, err := r.dynamic.Resource(kind.GVR()).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.GetContinue(), nil
+	}, keepAll)
+}
@@ -0,0 +1,143 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestFindMatchingDeployments_Namespaces(t *testing.T) {
+	clientset := fake.NewClientset(
+		createTestDeployment("dev", "api", "ghcr.io/test/api:dev"),
+		createTestDeployment("staging", "api", "ghcr.io/test/api:dev"),
+		createTestDeployment("prod", "api", "ghcr.io/test/api:dev"),
+		createTestDeployment("locked", "api", "ghcr.io/test/api:dev"),
+	)
+	// The worker has no Role in the locked namespace
+	clientset.PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "locked" {
+			return true, nil, errors.New(`deployments.apps is forbidden in namespace "locked"`)
+		}
+		return false, nil, nil
+	})
+	restarter := NewRestarterWithClient(clientset, testLogger())
+
+	restarter.opts.Namespaces = []string{"dev", "locked", "staging"}
+	matches, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/api:dev")
+	if err != nil {
+		t.Fatalf("expected the locked namespace to be skipped, got %v", err)
+	}
+	if len(matches) != 2 || matches[0].Namespace != "dev" || matches[1].Namespace != "staging" {
+		t.Errorf("expected the matches of dev and staging in order, got %+v", matches)
+	}
+
+	restarter.opts.Namespaces = []string{"locked"}
+	if _, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/api:dev"); err == nil {
+		t.Error("expected an error when every namespace fails")
+	}
+}
+
+func TestFindMatchingDeployments_Pagination(t *testing.T) {
+	clientset := fake.NewClientset()
+	pages := map[string]*appsv1.DeploymentList{
+		"": {ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: []appsv1.Deployment{
+			*createTestDeployment("dev", "api", "ghcr.io/test/api:dev"),
+			*createTestDeployment("dev", "web", "ghcr.io/test/web:dev"),
+		}},
+		"page-2": {ListMeta: metav1.ListMeta{Continue: "page-3"}, Items: []appsv1.Deployment{
+			*createTestDeployment("prod", "api", "ghcr.io/test/api:dev"),
+		}},
+		"page-3": {Items: []appsv1.Deployment{
+			*createTestDeployment("prod", "worker", "ghcr.io/test/api:dev"),
+		}},
+	}
+	var requests []metav1.ListOptions
+	throttled := false
+	clientset.PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		opts := action.(k8stesting.ListActionImpl).ListOptions
+		requests = append(requests, opts)
+		// The API server throttles the third page once
+		if opts.Continue == "page-3" && !throttled {
+			throttled = true
+			return true, nil, apierrors.NewTooManyRequests("slow down", 0)
+		}
+		return true, pages[opts.Continue], nil
+	})
+	restarter := NewRestarterWithClient(clientset, testLogger())
+	restarter.opts.ListPageSize = 2
+	defer func(delay time.Duration) { pageRetryDelay = delay }(pageRetryDelay)
+	pageRetryDelay = time.Millisecond
+
+	matches, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/api:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, m := range matches {
+		names = append(names, m.Namespace+"/"+m.Name)
+	}
+	if !slices.Equal(names, []string{"dev/api", "prod/api", "prod/worker"}) {
+		t.Errorf("expected the matches of every page, got %v", names)
+	}
+	if len(requests) != 4 || requests[0].Limit != 2 || requests[3].Continue != "page-3" {
+		t.Errorf("expected three pages of 2 with one retry, got %+v", requests)
+	}
+
+	// An expired continue token lists again in one request
+	all := append(append(slices.Clone(pages[""].Items), pages["page-2"].Items...), pages["page-3"].Items...)
+	requests = nil
+	clientset = fake.NewClientset()
+	clientset.PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		opts := action.(k8stesting.ListActionImpl).ListOptions
+		requests = append(requests, opts)
+		switch {
+		case opts.Limit == 0:
+			return true, &appsv1.DeploymentList{Items: all}, nil
+		case opts.Continue == "page-2":
+			return true, nil, apierrors.NewResourceExpired("continue token expired")
+		default:
+			return true, pages[opts.Continue], nil
+		}
+	})
+	restarter.clientset = clientset
+	matches, err = restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/api:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 3 || len(requests) != 3 || requests[2].Limit != 0 {
+		t.Errorf("expected the matches of one full listing, got %d matches after %+v", len(matches), requests)
+	}
+}
+
+func TestFindMatchingDeployments_LabelSelector(t *testing.T) {
+	managed := createTestDeployment("dev", "api", "ghcr.io/test/api:dev")
+	managed.Labels = map[string]string{"team": "payments"}
+	clientset := fake.NewClientset(managed, createTestDeployment("dev", "other", "ghcr.io/test/api:dev"))
+	var selectors []string
+	clientset.PrependReactor("list", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selectors = append(selectors, action.(k8stesting.ListActionImpl).ListOptions.LabelSelector)
+		return false, nil, nil
+	})
+	restarter := NewRestarterWithClient(clientset, testLogger())
+	restarter.opts.LabelSelector = "team=payments"
+
+	matches, err := restarter.FindMatchingDeployments(context.Background(), "ghcr.io/test/api:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Name != "api" {
+		t.Errorf("expected only the selected Deployment to match, got %+v", matches)
+	}
+	if !slices.Equal(selectors, []string{"team=payments"}) {
+		t.Errorf("expected the selector to be sent to the API server, got %v", selectors)
+	}
+}
@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Restart strategies of custom workload kinds.
+const (
+	// StrategyAnnotation sets the RestartedAtAnnotation in the annotations map
+	// at the kind's AnnotationsPath, like kubectl rollout restart. The default.
+	StrategyAnnotation = "annotation"
+
+	// StrategyRolloutRestart sets spec.restartAt, the native restart of Argo
+	// Rollouts, which restarts the pods without creating a new revision.
+	StrategyRolloutRestart = "rollout_restart"
+
+	// StrategyFluxReconcile sets the FluxReconcileAnnotation, asking Flux to
+	// reconcile the object, such as a HelmRelease or Kustomization, now.
+	StrategyFluxReconcile = "flux_reconcile"
+)
+
+// FluxReconcileAnnotation requests an immediate reconciliation from Flux.
+const FluxReconcileAnnotation = "reconcile.fluxcd.io/requestedAt"
+
+// DeploymentKind is the kind of Deployment targets. Deployments are always
+// matched and are restarted with RestartDeployment.
+var DeploymentKind = WorkloadKind{Group: "apps", Version: "v1", Resource: "deployments"}
+
+// Target is a Deployment or custom workload matched by an event.
+type Target struct {
+	MatchingDeployment
+	// Kind is DeploymentKind or a configured custom workload kind.
+	Kind WorkloadKind
+}
+
+// DeploymentTarget returns the Target of a matching Deployment.
+func DeploymentTarget(m MatchingDeployment) Target {
+	return Target{MatchingDeployment: m, Kind: DeploymentKind}
+}
+
+// WorkloadTarget returns the Target of a matching custom workload.
+func WorkloadTarget(w MatchingWorkload) Target {
+	return Target{MatchingDeployment: w.MatchingDeployment, Kind: w.Kind}
+}
+
+// IsDeployment reports whether t is a Deployment.
+func (t Target) IsDeployment() bool {
+	return t.Kind == DeploymentKind
+}
+
+// KindName names the kind of t in logs and notifications: Deployment, or the
+// resource.group of a custom workload kind.
+func (t Target) KindName() string {
+	if t.IsDeployment() {
+		return "Deployment"
+	}
+	return t.Kind.String()
+}
+
+// Key identifies t: namespace/name for a Deployment, kind/namespace/name for
+// a custom workload.
+func (t Target) Key() string {
+	if t.IsDeployment() {
+		return t.Namespace + "/" + t.Name
+	}
+	return t.Kind.String() + "/" + t.Namespace + "/" + t.Name
+}
+
+// RestartStrategy triggers the rollout of a Target.
+type RestartStrategy interface {
+	Restart(ctx context.Context, t Target, cause *RestartCause) error
+}
+
+// RestartStrategyFunc adapts a function to a RestartStrategy.
+type RestartStrategyFunc func(ctx context.Context, t Target, cause *RestartCause) error
+
+// Restart implements RestartStrategy.
+func (f RestartStrategyFunc) Restart(ctx context.Context, t Target, cause *RestartCause) error {
+	return f(ctx, t, cause)
+}
+
+// Restart triggers the rollout of t with the strategy of its kind. Restarts
+// of Deployments may return a *DeferredError. Kubernetes API errors are
+// classified like those of RestartDeployment.
+func (r *Restarter) Restart(ctx context.Context, t Target, cause *RestartCause) error {
+	return r.strategy(t.Kind).Restart(ctx, t, cause)
+}
+
+// strategy returns the RestartStrategy of kind.
+func (r *Restarter) strategy(kind WorkloadKind) RestartStrategy {
+	if kind == DeploymentKind {
+		return RestartStrategyFunc(func(ctx context.Context, t Target, cause *RestartCause) error {
+			return r.RestartDeployment(ctx, t.Namespace, t.Name, cause)
+		})
+	}
+	switch kind.RestartStrategy {
+	case StrategyRolloutRestart:
+		return RestartStrategyFunc(r.restartRollout)
+	case StrategyFluxReconcile:
+		return RestartStrategyFunc(r.requestReconcile)
+	default:
+		return RestartStrategyFunc(func(ctx context.Context, t Target, cause *RestartCause) error {
+			return r.RestartWorkload(ctx, MatchingWorkload{MatchingDeployment: t.MatchingDeployment, Kind: t.Kind}, cause)
+		})
+	}
+}
+
+// restartRollout sets spec.restartAt of an Argo Rollout. The field is a
+// Kubernetes timestamp, so RESTARTED_AT_FORMAT does not apply.
+func (r *Restarter) restartRollout(ctx context.Context, t Target, cause *RestartCause) error {
+	patch := map[string]any{
+		"spec": map[string]any{"restartAt": r.now().UTC().Format(time.RFC3339)},
+	}
+	return r.patchWorkload(ctx, t, patch, cause)
+}
+
+// requestReconcile sets the FluxReconcileAnnotation on the object metadata.
+func (r *Restarter) requestReconcile(ctx context.Context, t Target, cause *RestartCause) error {
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{
+				FluxReconcileAnnotation: formatTimestamp(r.now(), r.opts.TimestampFormat),
+			},
+		},
+	}
+	return r.patchWorkload(ctx, t, patch, cause)
+}
+
+// patchWorkload applies patch to the custom workload t with a JSON merge
+// patch, since custom resources do not support strategic merge patches. If
+// cause is non-nil it is recorded in the TriggerAnnotation on the object
+// metadata.
+func (r *Restarter) patchWorkload(ctx context.Context, t Target, patch map[string]any, cause *RestartCause) error {
+	if cause != nil {
+		causeJSON, err := json.Marshal(cause)
+		if err != nil {
+			return fmt.Errorf("failed to encode restart cause: %w", err)
+		}
+		metadata, _ := patch["metadata"].(map[string]any)
+		if metadata == nil {
+			metadata = map[string]any{}
+			patch["metadata"] = metadata
+		}
+		annotations, _ := metadata["annotations"].(map[string]any)
+		if annotations == nil {
+			annotations = map[string]any{}
+			metadata["annotations"] = annotations
+		}
+		annotations[TriggerAnnotation] = string(causeJSON)
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode patch: %w", err)
+	}
+
+	client, err := r.writeClient(ctx, t.Namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := client.dynamic.Resource(t.Kind.GVR()).Namespace(t.Namespace).Patch(ctx, t.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch %s %s/%s: %w", t.Kind, t.Namespace, t.Name, classify(err))
+	}
+
+	logArgs := []any{"namespace", t.Namespace, "kind", t.Kind.String(), "name", t.Name, "strategy", t.Kind.strategyName()}
+	if client.user != "" {
+		logArgs = append(logArgs, "impersonated_user", client.user)
+	}
+	r.logger.Info("triggered rollout restart", logArgs...)
+	return nil
+}
@@ -0,0 +1,133 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var (
+	argoRollouts = WorkloadKind{
+		Group:           "argoproj.io",
+		Version:         "v1alpha1",
+		Resource:        "rollouts",
+		ContainersPath:  "spec.template.spec.containers",
+		RestartStrategy: StrategyRolloutRestart,
+	}
+	fluxHelmReleases = WorkloadKind{
+		Group:           "helm.toolkit.fluxcd.io",
+		Version:         "v2",
+		Resource:        "helmreleases",
+		ContainersPath:  "spec.values.containers",
+		RestartStrategy: StrategyFluxReconcile,
+	}
+)
+
+func TestTarget(t *testing.T) {
+	deployment := DeploymentTarget(MatchingDeployment{Namespace: "dev", Name: "api"})
+	if !deployment.IsDeployment() || deployment.KindName() != "Deployment" || deployment.Key() != "dev/api" {
+		t.Errorf("unexpected deployment target %+v: %s %s", deployment, deployment.KindName(), deployment.Key())
+	}
+	workload := WorkloadTarget(MatchingWorkload{MatchingDeployment: MatchingDeployment{Namespace: "dev", Name: "api"}, Kind: argoRollouts})
+	if workload.IsDeployment() || workload.KindName() != "rollouts.argoproj.io" || workload.Key() != "rollouts.argoproj.io/dev/api" {
+		t.Errorf("unexpected workload target %+v: %s %s", workload, workload.KindName(), workload.Key())
+	}
+}
+
+func TestParseWorkloadKinds_RestartStrategy(t *testing.T) {
+	kinds, err := ParseWorkloadKinds(`[
+		{"group":"argoproj.io","version":"v1alpha1","resource":"rollouts","containers_path":"spec.template.spec.containers","restart_strategy":"rollout_restart"},
+		{"group":"helm.toolkit.fluxcd.io","version":"v2","resource":"helmreleases","containers_path":"spec.values.containers","restart_strategy":"flux_reconcile"}
+	]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kinds) != 2 || kinds[0].RestartStrategy != StrategyRolloutRestart {
+		t.Errorf("unexpected kinds %+v", kinds)
+	}
+
+	for _, spec := range []string{
+		`[{"version":"v1","resource":"services","containers_path":"spec.containers","restart_strategy":"recreate"}]`,
+		`[{"version":"v1","resource":"services","containers_path":"spec.containers","restart_strategy":"annotation"}]`,
+	} {
+		if _, err := ParseWorkloadKinds(spec); err == nil {
+			t.Errorf("expected an error for %s", spec)
+		}
+	}
+}
+
+func TestRestart_Strategies(t *testing.T) {
+	newObject := func(kind WorkloadKind, apiKind string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": kind.Group + "/" + kind.Version,
+			"kind":       apiKind,
+			"metadata":   map[string]any{"name": "api", "namespace": "dev"},
+			"spec":       map[string]any{"replicas": int64(2)},
+		}}
+	}
+	restarter := NewRestarterWithClient(fake.NewClientset(createTestDeployment("dev", "api", "ghcr.io/test/api:dev")), testLogger())
+	restarter.opts.Clock = func() time.Time { return time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC) }
+	restarter.opts.TimestampFormat = TimestampFormatUnix
+	restarter.dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		argoRollouts.GVR():     "RolloutList",
+		fluxHelmReleases.GVR(): "HelmReleaseList",
+	}, newObject(argoRollouts, "Rollout"), newObject(fluxHelmReleases, "HelmRelease"))
+
+	cause := &RestartCause{Image: "ghcr.io/test/api"}
+	get := func(kind WorkloadKind) *unstructured.Unstructured {
+		t.Helper()
+		obj, err := restarter.dynamic.Resource(kind.GVR()).Namespace("dev").Get(context.Background(), "api", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+	target := func(kind WorkloadKind) Target {
+		return WorkloadTarget(MatchingWorkload{MatchingDeployment: MatchingDeployment{Namespace: "dev", Name: "api"}, Kind: kind})
+	}
+
+	if err := restarter.Restart(context.Background(), target(argoRollouts), cause); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rollout := get(argoRollouts)
+	// spec.restartAt is a Kubernetes timestamp whatever the annotation format
+	if restartAt, _, _ := unstructured.NestedString(rollout.Object, "spec", "restartAt"); restartAt != "2024-01-02T15:04:05Z" {
+		t.Errorf("expected spec.restartAt to be set, got %q", restartAt)
+	}
+	if replicas, _, _ := unstructured.NestedInt64(rollout.Object, "spec", "replicas"); replicas != 2 {
+		t.Errorf("expected the rest of the spec to be preserved, got replicas %d", replicas)
+	}
+	if trigger := rollout.GetAnnotations()[TriggerAnnotation]; !strings.Contains(trigger, "ghcr.io/test/api") {
+		t.Errorf("expected trigger annotation on the rollout, got %q", trigger)
+	}
+
+	if err := restarter.Restart(context.Background(), target(fluxHelmReleases), cause); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release := get(fluxHelmReleases)
+	if requestedAt := release.GetAnnotations()[FluxReconcileAnnotation]; requestedAt != "1704207845" {
+		t.Errorf("expected reconcile request annotation, got %q", requestedAt)
+	}
+	if _, ok := release.GetAnnotations()[TriggerAnnotation]; !ok {
+		t.Error("expected trigger annotation on the helm release")
+	}
+
+	if err := restarter.Restart(context.Background(), DeploymentTarget(MatchingDeployment{Namespace: "dev", Name: "api"}), cause); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, err := restarter.clientset.AppsV1().Deployments("dev").Get(context.Background(), "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Spec.Template.Annotations[RestartedAtAnnotation] != "1704207845" {
+		t.Errorf("expected the deployment to be restarted, got %v", d.Spec.Template.Annotations)
+	}
+}
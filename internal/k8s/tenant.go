@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// RestartAsAnnotation on a namespace names the service account of that
+// namespace the worker impersonates when restarting workloads in it, with
+// TenantImpersonation enabled.
+const RestartAsAnnotation = "kuberollouttrigger.unitvectorylabs.com/restart-as"
+
+// tenantClient is the clients that patch the objects of one namespace.
+type tenantClient struct {
+	// user is the impersonated user, empty for the worker's own identity.
+	user      string
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+}
+
+// tenantClients creates clients impersonating tenant service accounts and
+// caches them by user, so each restart does not build new clients.
+type tenantClients struct {
+	build func(user string) (tenantClient, error)
+
+	mu      sync.Mutex
+	clients map[string]tenantClient
+}
+
+// newTenantClients returns tenantClients deriving the clients of each user
+// from config.
+func newTenantClients(config *rest.Config, withDynamic bool) *tenantClients {
+	return &tenantClients{build: func(user string) (tenantClient, error) {
+		impersonated := rest.CopyConfig(config)
+		// The API server adds the service account groups itself
+		impersonated.Impersonate = rest.ImpersonationConfig{UserName: user}
+		clientset, err := kubernetes.NewForConfig(impersonated)
+		if err != nil {
+			return tenantClient{}, fmt.Errorf("failed to create Kubernetes client for %s: %w", user, err)
+		}
+		client := tenantClient{user: user, clientset: clientset}
+		if withDynamic {
+			if client.dynamic, err = dynamic.NewForConfig(impersonated); err != nil {
+				return tenantClient{}, fmt.Errorf("failed to create Kubernetes dynamic client for %s: %w", user, err)
+			}
+		}
+		return client, nil
+	}}
+}
+
+// get returns the clients of user, building them on first use.
+func (t *tenantClients) get(user string) (tenantClient, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if client, found := t.clients[user]; found {
+		return client, nil
+	}
+	client, err := t.build(user)
+	if err != nil {
+		return tenantClient{}, err
+	}
+	if t.clients == nil {
+		t.clients = make(map[string]tenantClient)
+	}
+	t.clients[user] = client
+	return client, nil
+}
+
+// writeClient returns the clients that patch objects in namespace. With
+// TenantImpersonation they impersonate the service account named by the
+// namespace's RestartAsAnnotation, or TenantServiceAccount if it has none,
+// so audit logs attribute the restart to the tenant. Otherwise, or when
+// neither names a service account, they are the worker's own.
+func (r *Restarter) writeClient(ctx context.Context, namespace string) (tenantClient, error) {
+	own := tenantClient{clientset: r.clientset, dynamic: r.dynamic}
+	if !r.opts.TenantImpersonation {
+		return own, nil
+	}
+
+	annotations, err := r.NamespaceAnnotations(ctx, namespace)
+	if err != nil {
+		return tenantClient{}, fmt.Errorf("failed to resolve the service account to impersonate: %w", classify(err))
+	}
+	serviceAccount := strings.TrimSpace(annotations[RestartAsAnnotation])
+	if serviceAccount == "" {
+		serviceAccount = r.opts.TenantServiceAccount
+	}
+	if serviceAccount == "" {
+		return own, nil
+	}
+	if errs := validation.IsDNS1123Subdomain(serviceAccount); len(errs) > 0 {
+		return tenantClient{}, fmt.Errorf("invalid service account %q in namespace %s: %s", serviceAccount, namespace, strings.Join(errs, ", "))
+	}
+	return r.tenants.get("system:serviceaccount:" + namespace + ":" + serviceAccount)
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRestartDeployment_TenantImpersonation(t *testing.T) {
+	namespace := func(name, restartAs string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if restartAs != "" {
+			ns.Annotations = map[string]string{RestartAsAnnotation: restartAs}
+		}
+		return ns
+	}
+	client := fake.NewClientset(
+		namespace("team-a", "deployer"),
+		namespace("team-b", ""),
+		namespace("team-c", "Not_Valid"),
+		createTestDeployment("team-a", "api", "ghcr.io/test/api:dev"),
+		createTestDeployment("team-a", "web", "ghcr.io/test/web:dev"),
+		createTestDeployment("team-b", "api", "ghcr.io/test/api:dev"),
+		createTestDeployment("team-c", "api", "ghcr.io/test/api:dev"),
+	)
+
+	var built []string
+	restarter := NewRestarterWithClient(client, testLogger())
+	restarter.opts.TenantImpersonation = true
+	restarter.tenants = &tenantClients{build: func(user string) (tenantClient, error) {
+		built = append(built, user)
+		return tenantClient{user: user, clientset: client}, nil
+	}}
+	restart := func(namespace, name string) error {
+		return restarter.RestartDeployment(context.Background(), namespace, name, nil)
+	}
+
+	// Without a default service account, namespaces without the annotation are patched as the worker
+	for _, target := range [][2]string{{"team-a", "api"}, {"team-a", "web"}, {"team-b", "api"}} {
+		if err := restart(target[0], target[1]); err != nil {
+			t.Fatalf("unexpected error restarting %s: %v", target, err)
+		}
+	}
+	if want := []string{"system:serviceaccount:team-a:deployer"}; !slices.Equal(built, want) {
+		t.Errorf("expected one cached client for the annotated service account, got %v", built)
+	}
+
+	restarter.opts.TenantServiceAccount = "restarter"
+	if err := restart("team-b", "api"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if built[len(built)-1] != "system:serviceaccount:team-b:restarter" {
+		t.Errorf("expected the default service account to be impersonated, got %v", built)
+	}
+
+	if err := restart("team-c", "api"); err == nil {
+		t.Error("expected an invalid service account annotation to fail the restart")
+	}
+}
@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+// WorkloadKind describes a custom workload resource, such as a Knative Service
+// or an Argo Rollout, that is matched and restarted through the dynamic client.
+type WorkloadKind struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+
+	// ContainersPath is the dot-separated field path to the list of containers,
+	// each with a name and image, e.g. spec.template.spec.containers.
+	ContainersPath string `json:"containers_path"`
+
+	// AnnotationsPath is the dot-separated field path to the annotations map
+	// whose change triggers a rollout, e.g. spec.template.metadata.annotations.
+	// Only used, and then required, by StrategyAnnotation.
+	AnnotationsPath string `json:"annotations_path"`
+
+	// RestartStrategy is how objects of the kind are restarted:
+	// StrategyAnnotation (default), StrategyRolloutRestart or
+	// StrategyFluxReconcile.
+	RestartStrategy string `json:"restart_strategy,omitempty"`
+}
+
+// strategyName returns the restart strategy of the kind, defaulting to
+// StrategyAnnotation.
+func (k WorkloadKind) strategyName() string {
+	if k.RestartStrategy == "" {
+		return StrategyAnnotation
+	}
+	return k.RestartStrategy
+}
+
+// GVR returns the GroupVersionResource of the kind.
+func (k WorkloadKind) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: k.Group, Version: k.Version, Resource: k.Resource}
+}
+
+// String returns the kind as resource.group, like kubectl.
+func (k WorkloadKind) String() string {
+	if k.Group == "" {
+		return k.Resource
+	}
+	return k.Resource + "." + k.Group
+}
+
+// fieldPath splits a dot-separated field path, tolerating a leading dot as
+// written in kubectl JSONPath expressions.
+func fieldPath(p string) []string {
+	return strings.Split(strings.TrimPrefix(p, "."), ".")
+}
+
+// ParseWorkloadKinds parses a JSON array of workload kinds. An empty spec
+// returns no kinds.
+func ParseWorkloadKinds(spec string) ([]WorkloadKind, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var kinds []WorkloadKind
+	if err := json.Unmarshal([]byte(spec), &kinds); err != nil {
+		return nil, fmt.Errorf("invalid workload kinds: %w", err)
+	}
+	for i, k := range kinds {
+		if k.Version == "" || k.Resource == "" {
+			return nil, fmt.Errorf("invalid workload kinds: kind %d requires version and resource", i)
+		}
+		if k.Group == "apps" && k.Resource == "deployments" {
+			return nil, fmt.Errorf("invalid workload kinds: deployments are always matched and must not be listed")
+		}
+		paths := map[string]string{"containers_path": k.ContainersPath}
+		switch k.strategyName() {
+		case StrategyAnnotation:
+			paths["annotations_path"] = k.AnnotationsPath
+		case StrategyRolloutRestart, StrategyFluxReconcile:
+			// Restarted through fixed fields of the object
+		default:
+			return nil, fmt.Errorf("invalid workload kinds: %s has unknown restart_strategy %q, expected %s, %s or %s", k, k.RestartStrategy, StrategyAnnotation, StrategyRolloutRestart, StrategyFluxReconcile)
+		}
+		for name, p := range paths {
+			if p == "" {
+				return nil, fmt.Errorf("invalid workload kinds: %s requires %s", k, name)
+			}
+			for _, field := range fieldPath(p) {
+				if field == "" {
+					return nil, fmt.Errorf("invalid workload kinds: %s %s %q has an empty field", k, name, p)
+				}
+			}
+		}
+	}
+	return kinds, nil
+}
+
+// MatchingWorkload describes a custom workload that matches an image reference.
+type MatchingWorkload struct {
+	MatchingDeployment
+	Kind WorkloadKind
+}
+
+// FindMatchingWorkloads lists every configured workload kind in scope and
+// returns the objects the Matcher matches with imageRef.
+func (r *Restarter) FindMatchingWorkloads(ctx context.Context, imageRef string) ([]MatchingWorkload, error) {
+	want := imageref.Normalize(imageRef)
+	matcher := r.matcher()
+	var matches []MatchingWorkload
+	for _, kind := range r.opts.WorkloadKinds {
+		items, err := r.listWorkloads(ctx, kind)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", kind, err)
+		}
+		for _, item := range items {
+			containers, found, err := unstructured.NestedSlice(item.Object, fieldPath(kind.ContainersPath)...)
+			if err != nil || !found {
+				continue
+			}
+			candidate := &Candidate{
+				Namespace:   item.GetNamespace(),
+				Name:        item.GetName(),
+				Labels:      item.GetLabels(),
+				Annotations: item.GetAnnotations(),
+			}
+			for _, c := range containers {
+				container, ok := c.(map[string]any)
+				if !ok {
+					continue
+				}
+				name, _ := container["name"].(string)
+				image, _ := container["image"].(string)
+				candidate.Containers = append(candidate.Containers, Container{Name: name, Image: image})
+			}
+			if containerNames := matcher.Match(ctx, want, candidate); len(containerNames) > 0 {
+				matches = append(matches, MatchingWorkload{
+					MatchingDeployment: MatchingDeployment{
+						Namespace:      item.GetNamespace(),
+						Name:           item.GetName(),
+						ContainerNames: containerNames,
+						Containers:     containerMatches(candidate, containerNames, imageRef),
+						Labels:         item.GetLabels(),
+					},
+					Kind: kind,
+				})
+			}
+		}
+	}
+	return matches, nil
+}
+
+// RestartWorkload triggers a rollout of a custom workload with
+// StrategyAnnotation, setting the RestartedAtAnnotation in the annotations
+// map at the kind's AnnotationsPath. If cause is non-nil it is recorded in the
+// TriggerAnnotation on the object metadata.
+func (r *Restarter) RestartWorkload(ctx context.Context, w MatchingWorkload, cause *RestartCause) error {
+	patch := map[string]any{
+		RestartedAtAnnotation: formatTimestamp(r.now(), r.opts.TimestampFormat),
+	}
+	path := fieldPath(w.Kind.AnnotationsPath)
+	for i := len(path) - 1; i >= 0; i-- {
+		patch = map[string]any{path[i]: patch}
+	}
+	return r.patchWorkload(ctx, WorkloadTarget(w), patch, cause)
+}
@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var knativeServices = WorkloadKind{
+	Group:           "serving.knative.dev",
+	Version:         "v1",
+	Resource:        "services",
+	ContainersPath:  "spec.template.spec.containers",
+	AnnotationsPath: ".spec.template.metadata.annotations",
+}
+
+func createTestKnativeService(namespace, name, image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "serving.knative.dev/v1",
+		"kind":       "Service",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]any{"team": "a"},
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{
+						map[string]any{"name": "user-container", "image": image},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func newWorkloadTestRestarter(objects ...runtime.Object) *Restarter {
+	restarter := NewRestarterWithClient(fake.NewClientset(), testLogger())
+	restarter.dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		knativeServices.GVR(): "ServiceList",
+	}, objects...)
+	restarter.opts.WorkloadKinds = []WorkloadKind{knativeServices}
+	return restarter
+}
+
+func TestParseWorkloadKinds(t *testing.T) {
+	kinds, err := ParseWorkloadKinds(`[{"group":"serving.knative.dev","version":"v1","resource":"services","containers_path":"spec.template.spec.containers","annotations_path":"spec.template.metadata.annotations"}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kinds) != 1 || kinds[0].String() != "services.serving.knative.dev" {
+		t.Errorf("unexpected kinds %+v", kinds)
+	}
+
+	if kinds, err := ParseWorkloadKinds(""); err != nil || kinds != nil {
+		t.Errorf("expected no kinds for empty spec, got %v, %v", kinds, err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`[{"group":"x","resource":"things","containers_path":"a","annotations_path":"b"}]`,
+		`[{"group":"x","version":"v1","resource":"things","annotations_path":"b"}]`,
+		`[{"group":"x","version":"v1","resource":"things","containers_path":"a..b","annotations_path":"b"}]`,
+		`[{"group":"apps","version":"v1","resource":"deployments","containers_path":"a","annotations_path":"b"}]`,
+	}
+	for _, spec := range invalid {
+		if _, err := ParseWorkloadKinds(spec); err == nil {
+			t.Errorf("expected error for %s", spec)
+		}
+	}
+}
+
+func TestFindMatchingWorkloads(t *testing.T) {
+	restarter := newWorkloadTestRestarter(
+		createTestKnativeService("dev", "api", "ghcr.io/test/api:dev"),
+		createTestKnativeService("prod", "api", "ghcr.io/test/api:prod"),
+	)
+
+	matches, err := restarter.FindMatchingWorkloads(context.Background(), "ghcr.io/test/api:dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	m := matches[0]
+	if m.Namespace != "dev" || m.Name != "api" || m.Kind.Resource != "services" {
+		t.Errorf("unexpected match %+v", m)
+	}
+	if len(m.ContainerNames) != 1 || m.ContainerNames[0] != "user-container" {
+		t.Errorf("unexpected containers %v", m.ContainerNames)
+	}
+	if m.Labels["team"] != "a" {
+		t.Errorf("expected labels to be copied, got %v", m.Labels)
+	}
+}
+
+func TestRestartWorkload(t *testing.T) {
+	restarter := newWorkloadTestRestarter(createTestKnativeService("dev", "api", "ghcr.io/test/api:dev"))
+	restarter.opts.Clock = func() time.Time { return time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC) }
+
+	matches, err := restarter.FindMatchingWorkloads(context.Background(), "ghcr.io/test/api:dev")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d (%v)", len(matches), err)
+	}
+	if err := restarter.RestartWorkload(context.Background(), matches[0], &RestartCause{Image: "ghcr.io/test/api"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	obj, err := restarter.dynamic.Resource(knativeServices.GVR()).Namespace("dev").Get(context.Background(), "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restartedAt, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "metadata", "annotations", RestartedAtAnnotation)
+	if restartedAt != "2024-01-02T15:04:05Z" {
+		t.Errorf("expected restart annotation on template, got %q", restartedAt)
+	}
+	if trigger := obj.GetAnnotations()[TriggerAnnotation]; !strings.Contains(trigger, "ghcr.io/test/api") {
+		t.Errorf("expected trigger annotation on metadata, got %q", trigger)
+	}
+	// The containers must survive the merge patch
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 1 {
+		t.Errorf("expected containers to be preserved, got %v", containers)
+	}
+}
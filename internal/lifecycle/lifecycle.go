@@ -0,0 +1,92 @@
+// Package lifecycle stops the web and worker modes, either on the platform's
+// shutdown signals or programmatically through Stop, so they can run embedded
+// in another process and be stopped in tests without sending real signals.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ErrStopped is the cause of a shutdown requested through Stop.
+var ErrStopped = errors.New("stop requested")
+
+// SignalError is the cause of a shutdown requested by a signal.
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return fmt.Sprintf("received signal %s", e.Signal)
+}
+
+// Lifecycle is a context cancelled when shutdown is requested.
+type Lifecycle struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	signals chan os.Signal
+	once    sync.Once
+}
+
+// New creates a Lifecycle derived from parent that shuts down on any of
+// signals, typically ShutdownSignals(). Without signals, it only shuts down
+// through Stop or parent, leaving signal handling to the embedding process.
+// Close must be called to release the signal handler.
+func New(parent context.Context, signals ...os.Signal) *Lifecycle {
+	ctx, cancel := context.WithCancelCause(parent)
+	l := &Lifecycle{ctx: ctx, cancel: cancel}
+	if len(signals) > 0 {
+		l.signals = make(chan os.Signal, 1)
+		signal.Notify(l.signals, signals...)
+		go l.watch()
+	}
+	return l
+}
+
+func (l *Lifecycle) watch() {
+	select {
+	case sig := <-l.signals:
+		l.cancel(&SignalError{Signal: sig})
+	case <-l.ctx.Done():
+	}
+}
+
+// Context returns the context cancelled on shutdown.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Done returns a channel closed on shutdown.
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Stop requests a shutdown. It is safe to call more than once and from any
+// goroutine; only the first request is recorded as the Reason.
+func (l *Lifecycle) Stop() {
+	l.cancel(ErrStopped)
+}
+
+// Reason returns why shutdown was requested, such as ErrStopped or a
+// *SignalError, or nil while running.
+func (l *Lifecycle) Reason() error {
+	if l.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(l.ctx)
+}
+
+// Close stops listening for signals and cancels the context if it is still
+// running. Signals received afterwards get their default behaviour again.
+func (l *Lifecycle) Close() {
+	l.once.Do(func() {
+		if l.signals != nil {
+			signal.Stop(l.signals)
+		}
+		l.cancel(ErrStopped)
+	})
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitDone(t *testing.T, l *Lifecycle) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected shutdown")
+	}
+}
+
+func TestLifecycle_Stop(t *testing.T) {
+	l := New(context.Background())
+	defer l.Close()
+
+	if l.Reason() != nil {
+		t.Fatalf("expected no reason while running, got %v", l.Reason())
+	}
+	l.Stop()
+	l.Stop()
+	waitDone(t, l)
+	if !errors.Is(l.Reason(), ErrStopped) {
+		t.Errorf("expected ErrStopped, got %v", l.Reason())
+	}
+	if l.Context().Err() == nil {
+		t.Error("expected the context to be cancelled")
+	}
+}
+
+func TestLifecycle_Signal(t *testing.T) {
+	l := New(context.Background(), ShutdownSignals()...)
+	defer l.Close()
+
+	// Deliver the signal as signal.Notify would
+	l.signals <- syscall.SIGTERM
+	waitDone(t, l)
+
+	var sigErr *SignalError
+	if !errors.As(l.Reason(), &sigErr) || sigErr.Signal != syscall.SIGTERM {
+		t.Errorf("expected a SIGTERM SignalError, got %v", l.Reason())
+	}
+
+	// Later requests do not replace the reason
+	l.Stop()
+	if !errors.As(l.Reason(), &sigErr) {
+		t.Errorf("expected the signal to remain the reason, got %v", l.Reason())
+	}
+}
+
+func TestLifecycle_Parent(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	l := New(parent, os.Interrupt)
+	defer l.Close()
+
+	cancel()
+	waitDone(t, l)
+	if !errors.Is(l.Reason(), context.Canceled) {
+		t.Errorf("expected the parent's cancellation, got %v", l.Reason())
+	}
+}
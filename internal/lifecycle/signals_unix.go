@@ -0,0 +1,14 @@
+//go:build !windows
+
+package lifecycle
+
+import (
+	"os"
+	"syscall"
+)
+
+// ShutdownSignals returns the signals requesting a graceful shutdown: SIGINT
+// from a terminal and SIGTERM from Kubernetes, systemd or docker stop.
+func ShutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package lifecycle
+
+import (
+	"os"
+	"syscall"
+)
+
+// ShutdownSignals returns the signals requesting a graceful shutdown. Go
+// delivers Ctrl+C and Ctrl+Break as os.Interrupt, and closing the console,
+// logging off or shutting down Windows as syscall.SIGTERM.
+func ShutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// Level names accepted by ParseLevel.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// ParseLevel converts a level name to slog.Level. Unlike the LOG_LEVEL
+// setting, which falls back to info, it rejects unknown names.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case LevelDebug:
+		return slog.LevelDebug, nil
+	case LevelInfo:
+		return slog.LevelInfo, nil
+	case LevelWarn:
+		return slog.LevelWarn, nil
+	case LevelError:
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("log level must be one of %s, %s, %s or %s, got %q", LevelDebug, LevelInfo, LevelWarn, LevelError, name)
+	}
+}
+
+// ToggleDebugOnSignal switches level between debug and the level it had when
+// called each time the process receives the level toggle signal (SIGUSR1),
+// until ctx is done. It does nothing on platforms without that signal.
+func ToggleDebugOnSignal(ctx context.Context, level *slog.LevelVar, logger *slog.Logger) {
+	if len(toggleSignals) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, toggleSignals...)
+	defer signal.Stop(signals)
+
+	base := level.Level()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			toggleDebug(level, base)
+			logger.Warn("log level changed by signal", "level", level.Level().String())
+		}
+	}
+}
+
+// toggleDebug sets level to debug, or back to base if it already is debug.
+// A base of debug or lower is left unchanged.
+func toggleDebug(level *slog.LevelVar, base slog.Level) {
+	if level.Level() == slog.LevelDebug && base > slog.LevelDebug {
+		level.Set(base)
+		return
+	}
+	level.Set(slog.LevelDebug)
+}
@@ -0,0 +1,98 @@
+// Package logging creates the slog logger from the log configuration,
+// writing JSON or logfmt records to stdout, stderr, a rotated file or syslog.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Output formats.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+	// FormatLogfmt is an alias of FormatText, whose key=value records are logfmt.
+	FormatLogfmt = "logfmt"
+)
+
+// Output destinations.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// Options configures a logger.
+type Options struct {
+	// Level is the minimum level logged.
+	Level slog.Leveler
+	// Format is FormatJSON, FormatText or FormatLogfmt.
+	Format string
+	// Output is OutputStdout, OutputStderr, OutputFile or OutputSyslog.
+	Output string
+	// File is the path written with OutputFile.
+	File string
+	// FileMaxSize is the size in bytes from which the file is rotated. Zero
+	// never rotates it.
+	FileMaxSize int64
+	// FileMaxBackups is the number of rotated files kept, named File.1 (the
+	// newest) to File.N.
+	FileMaxBackups int
+	// SyslogAddr is the syslog server written with OutputSyslog, as
+	// udp://host:port or tcp://host:port. Empty uses the local syslog daemon.
+	SyslogAddr string
+	// SyslogTag identifies the process in syslog messages.
+	SyslogTag string
+}
+
+// New creates a logger for opts. The returned Closer releases the output and
+// must be called once the logger is no longer used.
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	var w io.Writer
+	var closer io.Closer = nopCloser{}
+	var sw *syslogWriter
+	switch opts.Output {
+	case OutputStdout, "":
+		w = os.Stdout
+	case OutputStderr:
+		w = os.Stderr
+	case OutputFile:
+		f, err := newRotatingFile(opts.File, opts.FileMaxSize, opts.FileMaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+	case OutputSyslog:
+		s, err := dialSyslog(opts.SyslogAddr, opts.SyslogTag)
+		if err != nil {
+			return nil, nil, err
+		}
+		sw = &syslogWriter{w: s}
+		w, closer = sw, s
+	default:
+		return nil, nil, fmt.Errorf("unknown log output %q", opts.Output)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	var handler slog.Handler
+	switch opts.Format {
+	case FormatJSON, "":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	case FormatText, FormatLogfmt:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	if sw != nil {
+		handler = &syslogHandler{Handler: handler, w: sw}
+	}
+	return slog.New(handler), closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
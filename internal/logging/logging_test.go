@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew_FileFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{FormatJSON, `"msg":"hello"`},
+		{FormatText, "msg=hello"},
+		{FormatLogfmt, "msg=hello"},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			logger, closer, err := New(Options{Level: slog.LevelInfo, Format: tc.format, Output: OutputFile, File: path})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			logger.Debug("hidden")
+			logger.Info("hello", "key", "value")
+			closer.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read log file: %v", err)
+			}
+			if !strings.Contains(string(data), tc.want) || strings.Contains(string(data), "hidden") {
+				t.Errorf("unexpected log output %q", data)
+			}
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, _, err := New(Options{Format: "xml"}); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+	if _, _, err := New(Options{Output: "kafka"}); err == nil {
+		t.Error("expected an unknown output to fail")
+	}
+	if _, _, err := New(Options{Output: OutputFile, File: filepath.Join(t.TempDir(), "missing", "app.log")}); err == nil {
+		t.Error("expected a file in a missing directory to fail")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected write error: %v", err)
+		}
+	}
+
+	// Each line exceeds the remaining room, so each starts a new file and
+	// only the two newest backups are kept
+	for name, want := range map[string]string{
+		path:        "dddddd\n",
+		path + ".1": "cccccc\n",
+		path + ".2": "bbbbbb\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("expected %s to hold %q, got %q (%v)", name, want, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third backup, got %v", err)
+	}
+}
+
+// recordingSyslog records messages by severity.
+type recordingSyslog struct {
+	messages map[string][]string
+}
+
+func (r *recordingSyslog) record(sev, m string) error {
+	r.messages[sev] = append(r.messages[sev], m)
+	return nil
+}
+
+func (r *recordingSyslog) Debug(m string) error   { return r.record("debug", m) }
+func (r *recordingSyslog) Info(m string) error    { return r.record("info", m) }
+func (r *recordingSyslog) Warning(m string) error { return r.record("warning", m) }
+func (r *recordingSyslog) Err(m string) error     { return r.record("err", m) }
+
+func TestSyslogHandler_Severity(t *testing.T) {
+	rec := &recordingSyslog{messages: make(map[string][]string)}
+	sw := &syslogWriter{w: rec}
+	logger := slog.New(&syslogHandler{
+		Handler: slog.NewJSONHandler(sw, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		w:       sw,
+	}).With("mode", "worker")
+
+	logger.Debug("d")
+	logger.Info("i")
+	logger.Warn("w")
+	logger.Error("e")
+
+	for sev, msg := range map[string]string{"debug": `"msg":"d"`, "info": `"msg":"i"`, "warning": `"msg":"w"`, "err": `"msg":"e"`} {
+		if len(rec.messages[sev]) != 1 || !strings.Contains(rec.messages[sev][0], msg) || !strings.Contains(rec.messages[sev][0], `"mode":"worker"`) {
+			t.Errorf("unexpected %s messages %q", sev, rec.messages[sev])
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		got, err := ParseLevel(name)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %s, %v; want %s", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
+func TestToggleDebug(t *testing.T) {
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+
+	toggleDebug(level, slog.LevelWarn)
+	if level.Level() != slog.LevelDebug {
+		t.Fatalf("expected debug after the first toggle, got %s", level.Level())
+	}
+	toggleDebug(level, slog.LevelWarn)
+	if level.Level() != slog.LevelWarn {
+		t.Errorf("expected the base level after the second toggle, got %s", level.Level())
+	}
+
+	// A level changed since startup goes to debug first
+	level.Set(slog.LevelError)
+	toggleDebug(level, slog.LevelWarn)
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("expected debug, got %s", level.Level())
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9
+
+package logging
+
+import "os"
+
+// toggleSignals is empty: there is no SIGUSR1 on this platform.
+var toggleSignals []os.Signal
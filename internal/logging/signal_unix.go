@@ -0,0 +1,11 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"os"
+	"syscall"
+)
+
+// toggleSignals switch the log level between debug and the configured level.
+var toggleSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// levelWriter writes one formatted record at a syslog severity. The syslog
+// writer of the standard library implements it.
+type levelWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+}
+
+// syslogWriter sends each record at the severity of its slog level, set by
+// syslogHandler before the record is formatted and written.
+type syslogWriter struct {
+	mu    sync.Mutex
+	w     levelWriter
+	level slog.Level
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	m := string(p)
+	var err error
+	switch {
+	case s.level >= slog.LevelError:
+		err = s.w.Err(m)
+	case s.level >= slog.LevelWarn:
+		err = s.w.Warning(m)
+	case s.level >= slog.LevelInfo:
+		err = s.w.Info(m)
+	default:
+		err = s.w.Debug(m)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogHandler records the level of each record on the syslogWriter its
+// handler writes to.
+type syslogHandler struct {
+	slog.Handler
+	w *syslogWriter
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
@@ -0,0 +1,18 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+// syslogConn is a syslog connection that can be closed.
+type syslogConn interface {
+	levelWriter
+	io.Closer
+}
+
+func dialSyslog(addr, tag string) (syslogConn, error) {
+	return nil, errors.New("syslog output is not supported on this platform")
+}
@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+)
+
+// syslogConn is a syslog connection that can be closed.
+type syslogConn interface {
+	levelWriter
+	io.Closer
+}
+
+// dialSyslog connects to the syslog server at addr, or to the local syslog
+// daemon if addr is empty.
+func dialSyslog(addr, tag string) (syslogConn, error) {
+	var network, raddr string
+	if addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("syslog address %q must be udp://host:port or tcp://host:port", addr)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return w, nil
+}
@@ -0,0 +1,441 @@
+// Package metrics provides a minimal, dependency-free metrics registry that
+// renders counters and gauges in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// collector is implemented by every metric type that can be rendered.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds a set of uniquely named metrics, rendered together with
+// those of the registries included in it.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+	included   []*Registry
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.collectors[c.name()]; exists {
+		panic(fmt.Sprintf("metrics: duplicate registration of %q", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// Include renders the metrics of child with those of r until the returned
+// function is called, so that a component started several times can
+// register its metrics afresh in a new child each time. A metric of r, or of
+// a child included earlier, hides a metric of the same name.
+func (r *Registry) Include(child *Registry) (remove func()) {
+	r.mu.Lock()
+	r.included = append(r.included, child)
+	r.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.included = slices.DeleteFunc(r.included, func(c *Registry) bool { return c == child })
+		})
+	}
+}
+
+// gather adds the metrics of r and of the registries included in it to
+// byName, unless one of the same name is already there.
+func (r *Registry) gather(byName map[string]collector) {
+	r.mu.Lock()
+	for name, c := range r.collectors {
+		if _, exists := byName[name]; !exists {
+			byName[name] = c
+		}
+	}
+	included := slices.Clone(r.included)
+	r.mu.Unlock()
+
+	for _, child := range included {
+		child.gather(byName)
+	}
+}
+
+// Write renders all registered metrics, sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	byName := make(map[string]collector)
+	r.gather(byName)
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		byName[name].write(w)
+	}
+}
+
+// Handler returns an HTTP handler serving the registry in text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// value is a float64 updated atomically.
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if v.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	v.bits.Store(math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(v.bits.Load())
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v value
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add increments the counter by delta, which must not be negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta)
+}
+
+// Value returns the current counter value.
+func (c *Counter) Value() float64 { return c.v.get() }
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	v value
+}
+
+// Set sets the gauge to f.
+func (g *Gauge) Set(f float64) { g.v.set(f) }
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc() { g.v.add(1) }
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec() { g.v.add(-1) }
+
+// Add adds delta to the gauge.
+func (g *Gauge) Add(delta float64) { g.v.add(delta) }
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() float64 { return g.v.get() }
+
+// family is a named metric with zero or more labeled children.
+type family[T any] struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+
+	mu       sync.RWMutex
+	children map[string]*T
+	labels   map[string][]string
+	read     func(*T) float64
+}
+
+func newFamily[T any](name, help, kind string, labelNames []string, read func(*T) float64) *family[T] {
+	return &family[T]{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		children:   make(map[string]*T),
+		labels:     make(map[string][]string),
+		read:       read,
+	}
+}
+
+func (f *family[T]) name() string { return f.metricName }
+
+func (f *family[T]) with(values ...string) *T {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	child, ok := f.children[key]
+	f.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if child, ok := f.children[key]; ok {
+		return child
+	}
+	child = new(T)
+	f.children[key] = child
+	f.labels[key] = append([]string(nil), values...)
+	return child
+}
+
+// set replaces the child for the given label values. Children are read under
+// the lock, so this does not race with write.
+func (f *family[T]) set(child T, values ...string) {
+	ptr := f.with(values...)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*ptr = child
+}
+
+func (f *family[T]) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.children = make(map[string]*T)
+	f.labels = make(map[string][]string)
+}
+
+func (f *family[T]) write(w io.Writer) {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.children))
+	for key := range f.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	type sample struct {
+		labels []string
+		value  float64
+	}
+	samples := make([]sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, sample{labels: f.labels[key], value: f.read(f.children[key])})
+	}
+	f.mu.RUnlock()
+
+	writeHeader(w, f.metricName, f.help, f.kind)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", f.metricName, formatLabels(f.labelNames, s.labels), formatValue(s.value))
+	}
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	*family[Counter]
+}
+
+// WithLabelValues returns the counter for the given label values, creating it if needed.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values...)
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	*family[Gauge]
+}
+
+// WithLabelValues returns the gauge for the given label values, creating it if needed.
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.with(values...)
+}
+
+// Reset removes all children, for gauges describing a snapshot that is rebuilt periodically.
+func (v *GaugeVec) Reset() {
+	v.reset()
+}
+
+// CounterFuncVec is a computed counter partitioned by label values.
+type CounterFuncVec struct {
+	*family[func() float64]
+}
+
+// Set reads the counter for the given label values from fn on every scrape,
+// replacing any previous function. fn must never decrease.
+func (v *CounterFuncVec) Set(fn func() float64, values ...string) {
+	v.set(fn, values...)
+}
+
+// GaugeFuncVec is a computed gauge partitioned by label values.
+type GaugeFuncVec struct {
+	*family[func() float64]
+}
+
+// Set computes the gauge for the given label values with fn on every scrape,
+// replacing any previous function.
+func (v *GaugeFuncVec) Set(fn func() float64, values ...string) {
+	v.set(fn, values...)
+}
+
+func readFunc(fn *func() float64) float64 { return (*fn)() }
+
+// valueFunc reports a gauge or counter value computed at scrape time.
+type valueFunc struct {
+	metricName string
+	help       string
+	kind       string
+	fn         func() float64
+}
+
+func (f *valueFunc) name() string { return f.metricName }
+
+func (f *valueFunc) write(w io.Writer) {
+	writeHeader(w, f.metricName, f.help, f.kind)
+	fmt.Fprintf(w, "%s %s\n", f.metricName, formatValue(f.fn()))
+}
+
+// NewCounter registers and returns a counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).WithLabelValues()
+}
+
+// NewCounterVec registers and returns a labeled counter.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{newFamily(name, help, "counter", labelNames, (*Counter).Value)}
+	r.register(v)
+	return v
+}
+
+// NewGauge registers and returns a gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).WithLabelValues()
+}
+
+// NewGaugeVec registers and returns a labeled gauge.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	v := &GaugeVec{newFamily(name, help, "gauge", labelNames, (*Gauge).Value)}
+	r.register(v)
+	return v
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{metricName: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on every
+// scrape, for counts kept by another component. fn must never decrease.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{metricName: name, help: help, kind: "counter", fn: fn})
+}
+
+// NewCounterFuncVec registers and returns a labeled computed counter.
+func (r *Registry) NewCounterFuncVec(name, help string, labelNames ...string) *CounterFuncVec {
+	v := &CounterFuncVec{newFamily(name, help, "counter", labelNames, readFunc)}
+	r.register(v)
+	return v
+}
+
+// NewGaugeFuncVec registers and returns a labeled computed gauge.
+func (r *Registry) NewGaugeFuncVec(name, help string, labelNames ...string) *GaugeFuncVec {
+	v := &GaugeFuncVec{newFamily(name, help, "gauge", labelNames, readFunc)}
+	r.register(v)
+	return v
+}
+
+// NewCounter registers a counter on the Default registry.
+func NewCounter(name, help string) *Counter { return Default.NewCounter(name, help) }
+
+// NewCounterVec registers a labeled counter on the Default registry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labelNames...)
+}
+
+// NewGauge registers a gauge on the Default registry.
+func NewGauge(name, help string) *Gauge { return Default.NewGauge(name, help) }
+
+// NewGaugeVec registers a labeled gauge on the Default registry.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labelNames...)
+}
+
+// NewGaugeFunc registers a computed gauge on the Default registry.
+func NewGaugeFunc(name, help string, fn func() float64) { Default.NewGaugeFunc(name, help, fn) }
+
+// NewCounterFunc registers a computed counter on the Default registry.
+func NewCounterFunc(name, help string, fn func() float64) { Default.NewCounterFunc(name, help, fn) }
+
+// NewCounterFuncVec registers a labeled computed counter on the Default
+// registry.
+func NewCounterFuncVec(name, help string, labelNames ...string) *CounterFuncVec {
+	return Default.NewCounterFuncVec(name, help, labelNames...)
+}
+
+// NewGaugeFuncVec registers a labeled computed gauge on the Default registry.
+func NewGaugeFuncVec(name, help string, labelNames ...string) *GaugeFuncVec {
+	return Default.NewGaugeFuncVec(name, help, labelNames...)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
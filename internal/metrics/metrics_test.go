@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_requests_total", "Total requests.")
+	vec := r.NewCounterVec("test_failures_total", "Failures by reason.", "reason")
+	g := r.NewGauge("test_in_flight", "In-flight requests.")
+	r.NewGaugeFunc("test_computed", "Computed value.", func() float64 { return 1.5 })
+	r.NewCounterFunc("test_external_total", "Externally kept count.", func() float64 { return 7 })
+
+	c.Inc()
+	c.Add(2)
+	vec.WithLabelValues("expired").Inc()
+	vec.WithLabelValues(`bad "quote"`).Add(3)
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE test_requests_total counter",
+		"test_requests_total 3",
+		`test_failures_total{reason="expired"} 1`,
+		`test_failures_total{reason="bad \"quote\""} 3`,
+		"# TYPE test_in_flight gauge",
+		"test_in_flight 1",
+		"test_computed 1.5",
+		"# TYPE test_external_total counter",
+		"test_external_total 7",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %q, got:\n%s", e, out)
+		}
+	}
+
+	// Metrics are rendered sorted by name
+	if strings.Index(out, "test_computed") > strings.Index(out, "test_requests_total") {
+		t.Errorf("expected metrics sorted by name, got:\n%s", out)
+	}
+}
+
+func TestRegistry_DuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup_total", "help")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate registration")
+		}
+	}()
+	r.NewCounter("dup_total", "help")
+}
+
+func TestRegistry_Include(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("shared_total", "help").Add(1)
+
+	child := NewRegistry()
+	child.NewCounter("shared_total", "help").Add(2)
+	child.NewGauge("child_gauge", "help").Set(3)
+	remove := r.Include(child)
+
+	var b strings.Builder
+	r.Write(&b)
+	out := b.String()
+	if !strings.Contains(out, "shared_total 1\n") || strings.Contains(out, "shared_total 2") || !strings.Contains(out, "child_gauge 3\n") {
+		t.Errorf("expected the child's metrics under those of the registry, got:\n%s", out)
+	}
+
+	remove()
+	remove()
+	b.Reset()
+	r.Write(&b)
+	if strings.Contains(b.String(), "child_gauge") {
+		t.Errorf("expected a removed child not to be rendered, got:\n%s", b.String())
+	}
+}
+
+func TestCounter_IgnoresNegative(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("neg_total", "help")
+	c.Add(-1)
+	if c.Value() != 0 {
+		t.Errorf("expected 0, got %v", c.Value())
+	}
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	r := NewRegistry()
+	vec := r.NewCounterVec("concurrent_total", "help", "label")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				vec.WithLabelValues("a").Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := vec.WithLabelValues("a").Value(); got != 5000 {
+		t.Errorf("expected 5000, got %v", got)
+	}
+}
+
+func TestGaugeVec_Reset(t *testing.T) {
+	r := NewRegistry()
+	vec := r.NewGaugeVec("reset_gauge", "help", "namespace")
+	vec.WithLabelValues("dev").Set(3)
+	vec.Reset()
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	if strings.Contains(buf.String(), `namespace="dev"`) {
+		t.Errorf("expected reset to remove children, got:\n%s", buf.String())
+	}
+}
+
+func TestFuncVec(t *testing.T) {
+	r := NewRegistry()
+	hits := r.NewCounterFuncVec("pool_hits_total", "help", "client")
+	conns := r.NewGaugeFuncVec("pool_connections", "help", "client")
+	hits.Set(func() float64 { return 7 }, "publisher")
+	hits.Set(func() float64 { return 9 }, "publisher")
+	conns.Set(func() float64 { return 2 }, "subscriber")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	for _, want := range []string{
+		"# TYPE pool_hits_total counter",
+		`pool_hits_total{client="publisher"} 9`,
+		"# TYPE pool_connections gauge",
+		`pool_connections{client="subscriber"} 2`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("handler_total", "help").Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "handler_total 1") {
+		t.Errorf("unexpected body:\n%s", w.Body.String())
+	}
+}
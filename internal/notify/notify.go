@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookAnnotation on a namespace names the webhook that restart
+// notifications for its workloads are sent to instead of the default webhook.
+const WebhookAnnotation = "kuberollouttrigger.unitvectorylabs.com/notify-webhook"
+
+// namespaceCacheTTL bounds how long a namespace's webhook is cached, so
+// annotation changes are picked up without reading the namespace on every
+// restart.
+const namespaceCacheTTL = time.Minute
+
+// NamespaceLookup returns the annotations of a namespace.
+type NamespaceLookup func(ctx context.Context, namespace string) (map[string]string, error)
+
+// Options configures a Notifier.
+type Options struct {
+	// DefaultURL receives notifications for namespaces without a webhook of
+	// their own. Empty sends nothing for those namespaces.
+	DefaultURL string
+	// NamespaceAnnotations reads the WebhookAnnotation of each namespace.
+	NamespaceAnnotations bool
+	// AllowedHosts are the hosts an annotated webhook may point to. Annotated
+	// webhooks on other hosts are ignored in favour of DefaultURL.
+	AllowedHosts []string
+	// Timeout bounds each webhook request.
+	Timeout time.Duration
+	// Transport sends the webhook requests, for example through a proxy.
+	// Nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Restart identifies one restarted object.
+type Restart struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+type cachedTarget struct {
+	url     string
+	fetched time.Time
+}
+
+// Notifier posts restart notifications to Slack compatible incoming webhooks,
+// routing each restart to the webhook of its namespace.
+type Notifier struct {
+	opts   Options
+	lookup NamespaceLookup
+	client *http.Client
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedTarget
+
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+// New creates a Notifier. lookup is only called when NamespaceAnnotations is set.
+func New(opts Options, lookup NamespaceLookup, logger *slog.Logger) *Notifier {
+	return &Notifier{
+		opts:   opts,
+		lookup: lookup,
+		client: &http.Client{Timeout: opts.Timeout, Transport: opts.Transport},
+		logger: logger,
+		now:    time.Now,
+		cache:  make(map[string]cachedTarget),
+	}
+}
+
+// Sent returns the number of notifications delivered.
+func (n *Notifier) Sent() int64 {
+	return n.sent.Load()
+}
+
+// Failed returns the number of notifications that could not be delivered.
+func (n *Notifier) Failed() int64 {
+	return n.failed.Load()
+}
+
+// Notify sends one notification per webhook listing the restarts routed to it.
+// Delivery failures are logged and never returned, so notifications cannot
+// affect restarts.
+func (n *Notifier) Notify(ctx context.Context, restarts []Restart, cause string) {
+	byTarget := make(map[string][]Restart)
+	for _, r := range restarts {
+		target := n.target(ctx, r.Namespace)
+		if target == "" {
+			continue
+		}
+		byTarget[target] = append(byTarget[target], r)
+	}
+
+	targets := make([]string, 0, len(byTarget))
+	for target := range byTarget {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		if err := n.post(ctx, target, message(byTarget[target], cause)); err != nil {
+			n.failed.Add(1)
+			// The webhook URL is a credential, so only its host is logged
+			n.logger.Warn("failed to send restart notification", "webhook_host", host(target), "error", err)
+			continue
+		}
+		n.sent.Add(1)
+	}
+}
+
+// target returns the webhook for namespace, or an empty string if its
+// restarts are not notified.
+func (n *Notifier) target(ctx context.Context, namespace string) string {
+	if !n.opts.NamespaceAnnotations {
+		return n.opts.DefaultURL
+	}
+
+	n.mu.Lock()
+	cached, ok := n.cache[namespace]
+	n.mu.Unlock()
+	if ok && n.now().Sub(cached.fetched) < namespaceCacheTTL {
+		return cached.url
+	}
+
+	target := n.opts.DefaultURL
+	annotations, err := n.lookup(ctx, namespace)
+	if err != nil {
+		n.logger.Warn("failed to read namespace notification webhook, using default", "namespace", namespace, "error", err)
+		return target
+	}
+	if annotated := annotations[WebhookAnnotation]; annotated != "" {
+		if err := n.allowed(annotated); err != nil {
+			n.logger.Warn("ignoring namespace notification webhook", "namespace", namespace, "error", err)
+		} else {
+			target = annotated
+		}
+	}
+
+	n.mu.Lock()
+	n.cache[namespace] = cachedTarget{url: target, fetched: n.now()}
+	n.mu.Unlock()
+	return target
+}
+
+// allowed returns an error unless rawURL is an http(s) URL on an allowed host.
+func (n *Notifier) allowed(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("webhook is not an http(s) URL")
+	}
+	if !slices.Contains(n.opts.AllowedHosts, u.Hostname()) {
+		return fmt.Errorf("webhook host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+func (n *Notifier) post(ctx context.Context, target, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The error includes the URL, which is a credential
+		return fmt.Errorf("notification request failed: %w", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification request returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// message formats the notification text for restarts.
+func message(restarts []Restart, cause string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Rollout restart triggered for %s:", cause)
+	for _, r := range restarts {
+		fmt.Fprintf(&b, "\n• %s %s/%s", r.Kind, r.Namespace, r.Name)
+	}
+	return b.String()
+}
+
+func host(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
+
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
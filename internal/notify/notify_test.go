@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a webhook that records the text of each notification by path.
+type recorder struct {
+	mu       sync.Mutex
+	received map[string][]string
+}
+
+func newRecorder(t *testing.T) (*recorder, *httptest.Server) {
+	rec := &recorder{received: make(map[string][]string)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		rec.mu.Lock()
+		rec.received[r.URL.Path] = append(rec.received[r.URL.Path], body.Text)
+		rec.mu.Unlock()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestNotifier_RoutesByNamespace(t *testing.T) {
+	rec, srv := newRecorder(t)
+	annotations := map[string]map[string]string{
+		"team-a": {WebhookAnnotation: srv.URL + "/team-a"},
+		"team-b": {WebhookAnnotation: "https://attacker.example.com/hook"},
+	}
+	lookups := 0
+	lookup := func(ctx context.Context, namespace string) (map[string]string, error) {
+		lookups++
+		if namespace == "missing" {
+			return nil, errors.New("not found")
+		}
+		return annotations[namespace], nil
+	}
+
+	n := New(Options{
+		DefaultURL:           srv.URL + "/default",
+		NamespaceAnnotations: true,
+		AllowedHosts:         []string{"127.0.0.1"},
+		Timeout:              time.Second,
+	}, lookup, testLogger())
+
+	n.Notify(context.Background(), []Restart{
+		{Kind: "Deployment", Namespace: "team-a", Name: "api"},
+		{Kind: "Deployment", Namespace: "team-a", Name: "worker"},
+		{Kind: "Deployment", Namespace: "team-b", Name: "web"},
+		{Kind: "Deployment", Namespace: "missing", Name: "svc"},
+		{Kind: "Deployment", Namespace: "plain", Name: "svc"},
+	}, "image ghcr.io/test/svc")
+
+	teamA := rec.received["/team-a"]
+	if len(teamA) != 1 || !strings.Contains(teamA[0], "team-a/api") || !strings.Contains(teamA[0], "team-a/worker") {
+		t.Errorf("unexpected team-a notifications %q", teamA)
+	}
+	def := rec.received["/default"]
+	if len(def) != 1 || !strings.Contains(def[0], "team-b/web") || !strings.Contains(def[0], "missing/svc") || strings.Contains(def[0], "team-a") {
+		t.Errorf("unexpected default notifications %q", def)
+	}
+	if !strings.HasPrefix(def[0], "Rollout restart triggered for image ghcr.io/test/svc:") {
+		t.Errorf("unexpected notification text %q", def[0])
+	}
+	if n.Sent() != 2 || n.Failed() != 0 {
+		t.Errorf("expected 2 sent and 0 failed, got %d and %d", n.Sent(), n.Failed())
+	}
+
+	// Namespaces are cached, except when the lookup failed
+	before := lookups
+	n.Notify(context.Background(), []Restart{{Kind: "Deployment", Namespace: "team-a", Name: "api"}}, "image ghcr.io/test/svc")
+	if lookups != before {
+		t.Errorf("expected the team-a webhook to be cached, got %d lookups", lookups-before)
+	}
+}
+
+func TestNotifier_DefaultOnly(t *testing.T) {
+	rec, srv := newRecorder(t)
+	lookup := func(ctx context.Context, namespace string) (map[string]string, error) {
+		t.Error("namespace lookup without namespace annotations")
+		return nil, nil
+	}
+
+	n := New(Options{DefaultURL: srv.URL + "/broken", Timeout: time.Second}, lookup, testLogger())
+	n.Notify(context.Background(), []Restart{{Kind: "Deployment", Namespace: "dev", Name: "svc"}}, "manual request")
+	if len(rec.received["/broken"]) != 1 || n.Failed() != 1 || n.Sent() != 0 {
+		t.Errorf("expected one failed notification, got %d sent and %d failed", n.Sent(), n.Failed())
+	}
+
+	// Without a default, only annotated namespaces are notified
+	n = New(Options{NamespaceAnnotations: true, Timeout: time.Second}, func(ctx context.Context, namespace string) (map[string]string, error) {
+		return nil, nil
+	}, testLogger())
+	n.Notify(context.Background(), []Restart{{Kind: "Deployment", Namespace: "dev", Name: "svc"}}, "manual request")
+	if n.Sent() != 0 || n.Failed() != 0 {
+		t.Errorf("expected nothing to be sent, got %d sent and %d failed", n.Sent(), n.Failed())
+	}
+}
@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// validationCacheSize bounds the number of validated tokens remembered.
+const validationCacheSize = 1024
+
+// validationCache is an LRU cache of successfully validated tokens, keyed by
+// the SHA-256 of the raw token, so the token itself is never held. Entries
+// expire with the token.
+type validationCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+}
+
+type validationCacheEntry struct {
+	key       [sha256.Size]byte
+	claims    Claims
+	expiresAt time.Time
+}
+
+func newValidationCache(size int) *validationCache {
+	return &validationCache{
+		size:    size,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns a copy of the cached claims for token if it was validated and
+// has not expired at now.
+func (c *validationCache) Get(token string, now time.Time) (*Claims, bool) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*validationCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	claims := entry.claims
+	return &claims, true
+}
+
+// Add caches claims for token until expiresAt, evicting the least recently
+// used entry if the cache is full.
+func (c *validationCache) Add(token string, claims *Claims, expiresAt time.Time) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*validationCacheEntry).key)
+	}
+	c.entries[key] = c.order.PushFront(&validationCacheEntry{
+		key:       key,
+		claims:    *claims,
+		expiresAt: expiresAt,
+	})
+}
+
+// Len returns the number of cached entries.
+func (c *validationCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
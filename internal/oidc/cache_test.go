@@ -0,0 +1,40 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidationCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newValidationCache(2)
+
+	c.Add("token-a", &Claims{Repository: "org/a"}, now.Add(time.Minute))
+	c.Add("token-b", &Claims{Repository: "org/b"}, now.Add(time.Minute))
+
+	claims, ok := c.Get("token-a", now)
+	if !ok || claims.Repository != "org/a" {
+		t.Fatalf("expected cached claims for token-a, got %+v, %v", claims, ok)
+	}
+	// Mutating the returned claims must not affect the cache
+	claims.Repository = "changed"
+	if claims, _ := c.Get("token-a", now); claims.Repository != "org/a" {
+		t.Errorf("expected cached claims to be copied, got %q", claims.Repository)
+	}
+
+	// token-b is now least recently used and is evicted
+	c.Add("token-c", &Claims{Repository: "org/c"}, now.Add(time.Minute))
+	if _, ok := c.Get("token-b", now); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+
+	if _, ok := c.Get("token-a", now.Add(time.Minute)); ok {
+		t.Error("expected entry to expire with the token")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected expired entry to be removed, got %d entries", c.Len())
+	}
+}
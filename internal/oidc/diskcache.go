@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// jwksCacheFile is the document persisted by SetJWKSCacheFile.
+type jwksCacheFile struct {
+	// URL is the JWKS URL the keys were fetched from. A file written for
+	// another URL is ignored.
+	URL       string          `json:"url"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	JWKS      json.RawMessage `json:"jwks"`
+}
+
+// SetJWKSCacheFile persists every fetched JWKS to path, so that a validator
+// started while the JWKS cannot be fetched still validates tokens signed by
+// keys fetched at most maxAge ago. An empty path disables the file.
+func (v *Validator) SetJWKSCacheFile(path string, maxAge time.Duration) {
+	v.cacheFile = path
+	v.cacheFileMaxAge = maxAge
+	for i, issuer := range v.issuers {
+		issuer.SetJWKSCacheFile(v.issuerCacheFile(i), maxAge)
+	}
+}
+
+// writeJWKSCache writes body, fetched at fetchedAt, to the cache file. The
+// file is replaced atomically so a crash never leaves a truncated file.
+func (v *Validator) writeJWKSCache(body []byte, fetchedAt time.Time) error {
+	data, err := json.Marshal(jwksCacheFile{URL: v.jwksURL, FetchedAt: fetchedAt.UTC(), JWKS: body})
+	if err != nil {
+		return fmt.Errorf("failed to encode JWKS cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(v.cacheFile), filepath.Base(v.cacheFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write JWKS cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write JWKS cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), v.cacheFile); err != nil {
+		return fmt.Errorf("failed to replace JWKS cache file: %w", err)
+	}
+	return nil
+}
+
+// errJWKSCacheStale is returned for a cache file older than its maximum age.
+var errJWKSCacheStale = errors.New("JWKS cache file is too old")
+
+// readJWKSCache returns the keys of the cache file and when they were
+// fetched. A file for another JWKS URL or older than the maximum age is not
+// used.
+func (v *Validator) readJWKSCache(now time.Time) (map[string]crypto.PublicKey, time.Time, error) {
+	data, err := os.ReadFile(v.cacheFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read JWKS cache file: %w", err)
+	}
+	var cached jwksCacheFile
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse JWKS cache file: %w", err)
+	}
+	if cached.URL != v.jwksURL {
+		return nil, time.Time{}, fmt.Errorf("JWKS cache file holds keys of %s, not %s", cached.URL, v.jwksURL)
+	}
+	if age := now.Sub(cached.FetchedAt); age > v.cacheFileMaxAge {
+		return nil, time.Time{}, fmt.Errorf("%w: fetched %s ago", errJWKSCacheStale, age.Round(time.Second))
+	}
+	keys, err := parseJWKS(cached.JWKS, v.logger)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return keys, cached.FetchedAt, nil
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJWKSCacheFile(t *testing.T) {
+	key := generateTestKey(t)
+	healthy := serveJWKS(t, key, "test-kid")
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	file := filepath.Join(t.TempDir(), "jwks.json")
+
+	v := NewValidator("test-audience", "test-org", false, testLogger())
+	v.jwksURL = healthy.URL
+	v.SetJWKSCacheFile(file, time.Hour)
+	if _, err := v.getKeys(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("expected the JWKS to be persisted: %v", err)
+	}
+
+	// A restarted validator falls back to the file while the JWKS is down
+	restarted := func(maxAge time.Duration) *Validator {
+		v := NewValidator("test-audience", "test-org", false, testLogger())
+		v.jwksURL = broken.URL
+		v.SetJWKSCacheFile(file, maxAge)
+		return v
+	}
+	if err := os.WriteFile(file, rewriteCacheURL(t, file, broken.URL), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v = restarted(time.Hour)
+	keys, err := v.getKeys()
+	if err != nil {
+		t.Fatalf("expected keys from the cache file, got %v", err)
+	}
+	if _, ok := keys["test-kid"]; !ok {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	status := v.JWKSStatus()
+	if !status.FromDisk || status.LastError == "" || status.FetchedAt.IsZero() {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if time.Until(status.CachedUntil) > jwksMinRefreshInterval {
+		t.Errorf("expected keys from disk to be trusted only until the next retry, got %v", status.CachedUntil)
+	}
+
+	// A file older than the maximum age is not used
+	v = restarted(time.Nanosecond)
+	if _, err := v.getKeys(); err == nil {
+		t.Error("expected a stale cache file to be ignored")
+	}
+	if v.JWKSStatus().FromDisk {
+		t.Error("expected no keys from a stale cache file")
+	}
+
+	// A file written for another JWKS URL is not used
+	v = restarted(time.Hour)
+	v.jwksURL = broken.URL + "/other"
+	if _, err := v.getKeys(); err == nil {
+		t.Error("expected a cache file of another JWKS URL to be ignored")
+	}
+}
+
+func TestJWKSCacheFile_FetchClearsFromDisk(t *testing.T) {
+	key := generateTestKey(t)
+	healthy := serveJWKS(t, key, "test-kid")
+	file := filepath.Join(t.TempDir(), "jwks.json")
+
+	v := NewValidator("test-audience", "test-org", false, testLogger())
+	v.jwksURL = healthy.URL
+	v.SetJWKSCacheFile(file, time.Hour)
+	v.fromDisk = true
+	if _, err := v.loadKeys(true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.JWKSStatus().FromDisk {
+		t.Error("expected fetched keys not to be reported as from disk")
+	}
+}
+
+// rewriteCacheURL returns the cache file with its JWKS URL replaced by url.
+func rewriteCacheURL(t *testing.T, file, url string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached jwksCacheFile
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatal(err)
+	}
+	cached.URL = url
+	data, err = json.Marshal(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IssuerConfig is an issuer accepted by a Validator besides its own, such as
+// a GitHub Enterprise Server or GitLab, with the rules its tokens are
+// validated by.
+type IssuerConfig struct {
+	// Issuer must match the iss claim of the tokens exactly.
+	Issuer string `json:"issuer"`
+	// JWKSURL is where the signing keys are fetched from. Empty uses the
+	// JWKS below Issuer.
+	JWKSURL string `json:"jwks_url,omitempty"`
+	// Audience must be one of the aud claims of the tokens.
+	Audience string `json:"audience"`
+	// AllowedOrg must match the claim mapped to Claims.RepositoryOwner.
+	AllowedOrg string `json:"allowed_org"`
+	// Claims names the claims the Claims fields are read from. Fields left
+	// empty use the GitHub claim names.
+	Claims ClaimMapping `json:"claims,omitzero"`
+}
+
+// ClaimMapping names the token claims each field of Claims is read from, so
+// that tokens of issuers other than GitHub, which name them differently,
+// can be validated and attributed.
+type ClaimMapping struct {
+	RepositoryOwner string `json:"repository_owner,omitempty"`
+	Repository      string `json:"repository,omitempty"`
+	Actor           string `json:"actor,omitempty"`
+	RunID           string `json:"run_id,omitempty"`
+	SHA             string `json:"sha,omitempty"`
+}
+
+// GitHubClaims is the ClaimMapping of GitHub Actions tokens.
+var GitHubClaims = ClaimMapping{
+	RepositoryOwner: "repository_owner",
+	Repository:      "repository",
+	Actor:           "actor",
+	RunID:           "run_id",
+	SHA:             "sha",
+}
+
+// withDefaults returns m with the GitHub claim name of each empty field.
+func (m ClaimMapping) withDefaults() ClaimMapping {
+	set := func(name *string, github string) {
+		if *name == "" {
+			*name = github
+		}
+	}
+	set(&m.RepositoryOwner, GitHubClaims.RepositoryOwner)
+	set(&m.Repository, GitHubClaims.Repository)
+	set(&m.Actor, GitHubClaims.Actor)
+	set(&m.RunID, GitHubClaims.RunID)
+	set(&m.SHA, GitHubClaims.SHA)
+	return m
+}
+
+// ParseIssuers parses a JSON array of issuer configurations. An empty spec
+// returns no issuers.
+func ParseIssuers(spec string) ([]IssuerConfig, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var issuers []IssuerConfig
+	if err := json.Unmarshal([]byte(spec), &issuers); err != nil {
+		return nil, fmt.Errorf("invalid OIDC issuers: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, issuer := range issuers {
+		if err := ValidateIssuerURL(issuer.Issuer); err != nil {
+			return nil, fmt.Errorf("invalid OIDC issuers: issuer %d: %w", i, err)
+		}
+		if seen[issuer.Issuer] {
+			return nil, fmt.Errorf("invalid OIDC issuers: issuer %q is listed twice", issuer.Issuer)
+		}
+		seen[issuer.Issuer] = true
+		if issuer.JWKSURL != "" {
+			if u, err := url.Parse(issuer.JWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid OIDC issuers: issuer %q jwks_url %q must be an http or https URL", issuer.Issuer, issuer.JWKSURL)
+			}
+		}
+		if issuer.Audience == "" {
+			return nil, fmt.Errorf("invalid OIDC issuers: issuer %q has no audience", issuer.Issuer)
+		}
+		if issuer.AllowedOrg == "" {
+			return nil, fmt.Errorf("invalid OIDC issuers: issuer %q has no allowed_org", issuer.Issuer)
+		}
+	}
+	return issuers, nil
+}
+
+// ValidateIssuerURL checks that issuer is an https URL without a trailing
+// slash, query or fragment, which could never match an iss claim.
+func ValidateIssuerURL(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(issuer, "/") {
+		return fmt.Errorf("issuer %q must be an https URL without a trailing slash, query or fragment", issuer)
+	}
+	return nil
+}
+
+// AddIssuer makes v also accept the tokens of cfg.Issuer, validated against
+// its own audience, organization, claim mapping and JWKS. The HTTP client,
+// token limits, JWKS cache file and faults of v apply to it as well, whether
+// they are set before or after.
+func (v *Validator) AddIssuer(cfg IssuerConfig) {
+	issuer := NewValidator(cfg.Audience, cfg.AllowedOrg, v.devMode, v.logger.With("issuer", cfg.Issuer))
+	issuer.SetIssuer(cfg.Issuer)
+	if cfg.JWKSURL != "" {
+		issuer.SetJWKSURL(cfg.JWKSURL)
+	}
+	issuer.claims = cfg.Claims.withDefaults()
+	issuer.httpClient = v.httpClient
+	issuer.faults = v.faults
+	issuer.SetTokenLimits(v.limits)
+	v.issuers = append(v.issuers, issuer)
+	issuer.SetJWKSCacheFile(v.issuerCacheFile(len(v.issuers)-1), v.cacheFileMaxAge)
+}
+
+// issuerCacheFile returns the JWKS cache file of the additional issuer at
+// index i, next to the file of v, or empty if v has none.
+func (v *Validator) issuerCacheFile(i int) string {
+	if v.cacheFile == "" {
+		return ""
+	}
+	return v.cacheFile + "." + strconv.Itoa(i+1)
+}
+
+// Issuers returns the validators of the issuers added with AddIssuer, in the
+// order they were added, for diagnostics.
+func (v *Validator) Issuers() []*Validator {
+	return v.issuers
+}
+
+// ForToken returns the validator of the issuer of tokenString: one added
+// with AddIssuer whose issuer matches its unverified iss claim, or v itself,
+// which rejects the tokens of unknown issuers. Its Issuer, Audience and
+// AllowedOrg are what the token is expected to carry.
+func (v *Validator) ForToken(tokenString string) *Validator {
+	if len(v.issuers) == 0 {
+		return v
+	}
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return v
+	}
+	for _, issuer := range v.issuers {
+		if claims.Issuer == issuer.issuer {
+			return issuer
+		}
+	}
+	return v
+}
+
+// mappedClaims decodes the payload of a token into Claims, reading each of
+// its fields from the claim named by mapping.
+type mappedClaims struct {
+	*Claims
+	mapping ClaimMapping
+}
+
+func (c mappedClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.RegisteredClaims); err != nil {
+		return err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	c.RepositoryOwner = claimString(raw[c.mapping.RepositoryOwner])
+	c.Repository = claimString(raw[c.mapping.Repository])
+	c.Actor = claimString(raw[c.mapping.Actor])
+	c.RunID = claimString(raw[c.mapping.RunID])
+	c.SHA = claimString(raw[c.mapping.SHA])
+	return nil
+}
+
+// claimString returns a string or numeric claim as a string, such as the
+// numeric pipeline_id of GitLab, and other claims as empty.
+func claimString(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number:
+		return value.String()
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,129 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// gitlabClaims are the claims of a GitLab CI token relevant to the Validator.
+type gitlabClaims struct {
+	jwt.RegisteredClaims
+	NamespacePath string `json:"namespace_path"`
+	ProjectPath   string `json:"project_path"`
+	UserLogin     string `json:"user_login"`
+	PipelineID    int64  `json:"pipeline_id"`
+}
+
+func TestValidateToken_MultipleIssuers(t *testing.T) {
+	githubKey, gitlabKey := generateTestKey(t), generateTestKey(t)
+	githubJWKS := serveJWKS(t, githubKey, "github-kid")
+	gitlabJWKS := serveJWKS(t, gitlabKey, "gitlab-kid")
+
+	v := NewValidator("github-audience", "github-org", false, testLogger())
+	v.SetJWKSURL(githubJWKS.URL)
+	v.AddIssuer(IssuerConfig{
+		Issuer:     "https://gitlab.example.com",
+		JWKSURL:    gitlabJWKS.URL,
+		Audience:   "gitlab-audience",
+		AllowedOrg: "gitlab-group",
+		Claims: ClaimMapping{
+			RepositoryOwner: "namespace_path",
+			Repository:      "project_path",
+			Actor:           "user_login",
+			RunID:           "pipeline_id",
+		},
+	})
+
+	registered := func(issuer, audience string) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		}
+	}
+	gitlabToken := func(claims gitlabClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "gitlab-kid"
+		signed, err := token.SignedString(gitlabKey)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	github := createSignedToken(t, githubKey, "github-kid", Claims{
+		RegisteredClaims: registered(GitHubOIDCIssuer, "github-audience"),
+		RepositoryOwner:  "github-org",
+		Repository:       "github-org/app",
+	})
+	if claims, err := v.ValidateToken(github); err != nil || claims.Repository != "github-org/app" {
+		t.Fatalf("expected the GitHub token to be valid, got %+v, %v", claims, err)
+	}
+
+	gitlab := gitlabToken(gitlabClaims{
+		RegisteredClaims: registered("https://gitlab.example.com", "gitlab-audience"),
+		NamespacePath:    "gitlab-group",
+		ProjectPath:      "gitlab-group/app",
+		UserLogin:        "alice",
+		PipelineID:       4242,
+	})
+	claims, err := v.ValidateToken(gitlab)
+	if err != nil {
+		t.Fatalf("expected the GitLab token to be valid, got %v", err)
+	}
+	if claims.RepositoryOwner != "gitlab-group" || claims.Repository != "gitlab-group/app" || claims.Actor != "alice" || claims.RunID != "4242" {
+		t.Errorf("expected the claims mapped from the GitLab token, got %+v", claims)
+	}
+	if inspection := v.InspectToken(gitlab); inspection.Repository != "gitlab-group/app" {
+		t.Errorf("expected the inspection to map the claims, got %+v", inspection)
+	}
+
+	// Each issuer is held to its own audience, organization and keys
+	for name, token := range map[string]string{
+		"github audience": gitlabToken(gitlabClaims{RegisteredClaims: registered("https://gitlab.example.com", "github-audience"), NamespacePath: "gitlab-group"}),
+		"github org":      gitlabToken(gitlabClaims{RegisteredClaims: registered("https://gitlab.example.com", "gitlab-audience"), NamespacePath: "github-org"}),
+		"github key": createSignedToken(t, githubKey, "github-kid", Claims{
+			RegisteredClaims: registered("https://gitlab.example.com", "gitlab-audience"),
+			RepositoryOwner:  "gitlab-group",
+		}),
+		"unknown issuer": gitlabToken(gitlabClaims{RegisteredClaims: registered("https://other.example.com", "gitlab-audience"), NamespacePath: "gitlab-group"}),
+	} {
+		if _, err := v.ValidateToken(token); err == nil {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+}
+
+func TestParseIssuers(t *testing.T) {
+	issuers, err := ParseIssuers(`[
+		{"issuer": "https://github.example.com/_services/token", "audience": "aud", "allowed_org": "org"},
+		{"issuer": "https://gitlab.example.com", "audience": "aud", "allowed_org": "group", "claims": {"repository_owner": "namespace_path"}}
+	]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issuers) != 2 || issuers[1].Claims.RepositoryOwner != "namespace_path" {
+		t.Errorf("unexpected issuers %+v", issuers)
+	}
+
+	if issuers, err := ParseIssuers(""); err != nil || len(issuers) != 0 {
+		t.Errorf("expected no issuers for an empty spec, got %v, %v", issuers, err)
+	}
+
+	for _, invalid := range []string{
+		`{"issuer": "https://gitlab.example.com"}`,
+		`[{"issuer": "http://gitlab.example.com", "audience": "aud", "allowed_org": "group"}]`,
+		`[{"issuer": "https://gitlab.example.com/", "audience": "aud", "allowed_org": "group"}]`,
+		`[{"issuer": "https://gitlab.example.com", "allowed_org": "group"}]`,
+		`[{"issuer": "https://gitlab.example.com", "audience": "aud"}]`,
+		`[{"issuer": "https://gitlab.example.com", "audience": "aud", "allowed_org": "group", "jwks_url": "keys"}]`,
+		`[{"issuer": "https://gitlab.example.com", "audience": "aud", "allowed_org": "group"}, {"issuer": "https://gitlab.example.com", "audience": "aud", "allowed_org": "group"}]`,
+	} {
+		if _, err := ParseIssuers(invalid); err == nil {
+			t.Errorf("expected error for %s", invalid)
+		}
+	}
+}
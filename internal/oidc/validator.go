@@ -3,67 +3,237 @@ package oidc
 import (
 	"crypto"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math/big"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
 )
 
 const (
 	// GitHubOIDCIssuer is the OIDC issuer URL for GitHub Actions.
 	GitHubOIDCIssuer = "https://token.actions.githubusercontent.com"
 
+	// jwksPath is the path of the JWKS below the issuer URL, on github.com
+	// and GitHub Enterprise Server alike.
+	jwksPath = "/.well-known/jwks"
+
 	// jwksCacheTTL is how long JWKS keys are cached.
 	jwksCacheTTL = 1 * time.Hour
+
+	// jwksMinRefreshInterval is the minimum time between a fetch and a forced
+	// refresh for an unknown key id, so tokens with made-up key ids cannot
+	// make every request fetch the JWKS.
+	jwksMinRefreshInterval = 10 * time.Second
+)
+
+// Failure reasons returned by FailureReason. They are stable identifiers
+// suitable for metric labels.
+const (
+	ReasonParseError      = "parse_error"
+	ReasonBadSignature    = "bad_signature"
+	ReasonUnknownKey      = "unknown_key"
+	ReasonJWKSUnavailable = "jwks_unavailable"
+	ReasonExpired         = "expired"
+	ReasonNotYetValid     = "not_yet_valid"
+	ReasonWrongAudience   = "wrong_audience"
+	ReasonWrongIssuer     = "wrong_issuer"
+	ReasonMissingClaim    = "missing_claim"
+	ReasonWrongOrg        = "wrong_org"
+	ReasonLifetime        = "lifetime_too_long"
+	ReasonInvalid         = "invalid"
+)
+
+var (
+	// ErrWrongOrg is returned when the token's repository_owner does not match the allowed org.
+	ErrWrongOrg = errors.New("token organization not allowed")
+
+	// ErrUnknownKey is returned when the token's kid is not present in the JWKS.
+	ErrUnknownKey = errors.New("signing key not found in JWKS")
+
+	// ErrJWKSUnavailable is returned when the JWKS could not be fetched.
+	ErrJWKSUnavailable = errors.New("JWKS unavailable")
+
+	// ErrLifetimeTooLong is returned when a token is valid for longer than
+	// the configured maximum lifetime.
+	ErrLifetimeTooLong = errors.New("token lifetime too long")
 )
 
-// Validator validates GitHub Actions OIDC tokens.
+// FailureReason classifies an error returned by ValidateToken into one of the
+// Reason* constants.
+func FailureReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrWrongOrg):
+		return ReasonWrongOrg
+	case errors.Is(err, ErrJWKSUnavailable):
+		return ReasonJWKSUnavailable
+	case errors.Is(err, ErrUnknownKey):
+		return ReasonUnknownKey
+	case errors.Is(err, ErrLifetimeTooLong):
+		return ReasonLifetime
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ReasonParseError
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ReasonBadSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ReasonNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ReasonWrongAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ReasonWrongIssuer
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ReasonMissingClaim
+	default:
+		return ReasonInvalid
+	}
+}
+
+// Validator validates GitHub Actions OIDC tokens, and those of the issuers
+// added with AddIssuer.
 type Validator struct {
+	issuer     string
 	audience   string
 	allowedOrg string
 	devMode    bool
 	logger     *slog.Logger
 
+	// claims names the claims the Claims fields are read from.
+	claims ClaimMapping
+
+	// issuers validate the tokens of the issuers added with AddIssuer.
+	issuers []*Validator
+
+	// parser checks the registered claims. It holds no per-token state, so
+	// it is built once and shared.
+	parser *jwt.Parser
+
+	// limits constrain the validity window of tokens.
+	limits TokenLimits
+
 	// httpClient is the HTTP client for fetching JWKS.
 	httpClient *http.Client
 
 	// jwksURL is the URL to fetch JWKS keys from.
 	jwksURL string
 
+	// cacheFile persists fetched JWKS for a restart during an outage, and
+	// cacheFileMaxAge bounds the age of the keys read back from it.
+	cacheFile       string
+	cacheFileMaxAge time.Duration
+
 	mu          sync.RWMutex
 	cachedKeys  map[string]crypto.PublicKey
 	cachedUntil time.Time
+	fetchedAt   time.Time
+	// fromDisk reports that the cached keys were read from cacheFile
+	// because the JWKS could not be fetched.
+	fromDisk bool
+	// lastErr and lastErrAt record the most recent failed JWKS fetch.
+	lastErr   error
+	lastErrAt time.Time
+	// inflight is the JWKS fetch in progress, shared by all callers that
+	// need keys while it runs.
+	inflight *jwksFetch
+
+	// cache remembers successfully validated tokens until they expire.
+	cache *validationCache
+
+	// faults injects simulated JWKS outages in dev mode.
+	faults *fault.Injector
+}
+
+// jwksFetch is a single JWKS fetch whose result is shared by every waiter.
+type jwksFetch struct {
+	done chan struct{}
+	keys map[string]crypto.PublicKey
+	// body is the fetched JWKS document, persisted to the cache file.
+	body []byte
+	err  error
+}
+
+// TokenLimits constrain the validity window of tokens beyond their exp and
+// nbf claims.
+type TokenLimits struct {
+	// ClockSkew is the tolerance for the difference between this host's clock
+	// and GitHub's, applied to the exp, nbf and iat claims.
+	ClockSkew time.Duration
+
+	// MaxLifetime is the longest a token may be valid for, from its iat to
+	// its exp claim. Zero allows any lifetime.
+	MaxLifetime time.Duration
 }
 
 // NewValidator creates a new OIDC token validator.
 func NewValidator(audience, allowedOrg string, devMode bool, logger *slog.Logger) *Validator {
 	return &Validator{
+		issuer:     GitHubOIDCIssuer,
 		audience:   audience,
 		allowedOrg: allowedOrg,
 		devMode:    devMode,
 		logger:     logger,
+		claims:     GitHubClaims,
+		parser:     newParser(GitHubOIDCIssuer, audience, devMode, 0),
 		httpClient: &http.Client{Timeout: 10 * time.Second},
-		jwksURL:    GitHubOIDCIssuer + "/.well-known/jwks",
+		jwksURL:    JWKSURL(GitHubOIDCIssuer),
+		cache:      newValidationCache(validationCacheSize),
+	}
+}
+
+// JWKSURL returns the URL of the JWKS of issuer.
+func JWKSURL(issuer string) string {
+	return issuer + jwksPath
+}
+
+// newParser returns the parser checking the registered claims of tokens for
+// issuer and audience, tolerating leeway of clock skew.
+func newParser(issuer, audience string, devMode bool, leeway time.Duration) *jwt.Parser {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithAudience(audience),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+		// Rejects tokens issued in the future, which GitHub never does
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	}
+	if devMode {
+		parserOpts = append(parserOpts, jwt.WithoutClaimsValidation())
 	}
+	return jwt.NewParser(parserOpts...)
 }
 
-// Claims represents the relevant claims from a GitHub Actions OIDC token.
+// Claims represents the relevant claims from a GitHub Actions OIDC token, or
+// from the claims of another issuer's token named by its ClaimMapping.
 type Claims struct {
 	jwt.RegisteredClaims
 	RepositoryOwner string `json:"repository_owner"`
 	Repository      string `json:"repository"`
+	Actor           string `json:"actor"`
+	RunID           string `json:"run_id"`
+	SHA             string `json:"sha"`
 }
 
 // TokenInspection contains unverified, safe-to-log token metadata.
 type TokenInspection struct {
+	// TokenHash is a short fingerprint of the raw token for correlating log
+	// entries. It is set even when the token cannot be parsed.
+	TokenHash       string
 	HeaderAlg       string
 	HeaderKID       string
 	Issuer          string
@@ -73,11 +243,54 @@ type TokenInspection struct {
 	ParseError      string
 }
 
-// SetJWKSURL overrides the JWKS URL (for testing).
+// InjectFaults makes validation of tokens that are not cached fail at the
+// rate configured for fault.JWKS, as if the JWKS could not be fetched.
+func (v *Validator) InjectFaults(faults *fault.Injector) {
+	v.faults = faults
+	for _, issuer := range v.issuers {
+		issuer.faults = faults
+	}
+}
+
+// SetHTTPClient replaces the client used to fetch the JWKS, for example one
+// going through a proxy.
+func (v *Validator) SetHTTPClient(client *http.Client) {
+	v.httpClient = client
+	for _, issuer := range v.issuers {
+		issuer.httpClient = client
+	}
+}
+
+// SetTokenLimits constrains the validity window of the tokens accepted.
+// Limits are not enforced in dev mode.
+func (v *Validator) SetTokenLimits(limits TokenLimits) {
+	v.limits = limits
+	v.parser = newParser(v.issuer, v.audience, v.devMode, limits.ClockSkew)
+	for _, issuer := range v.issuers {
+		issuer.SetTokenLimits(limits)
+	}
+}
+
+// SetIssuer replaces the issuer that tokens must carry in their iss claim,
+// GitHubOIDCIssuer by default, for example with the issuer of a GitHub
+// Enterprise Server, and fetches the keys from the JWKS of that issuer.
+func (v *Validator) SetIssuer(issuer string) {
+	v.issuer = issuer
+	v.jwksURL = JWKSURL(issuer)
+	v.parser = newParser(issuer, v.audience, v.devMode, v.limits.ClockSkew)
+}
+
+// SetJWKSURL overrides the URL the JWKS is fetched from, by default the one
+// of the issuer. Call it after SetIssuer.
 func (v *Validator) SetJWKSURL(url string) {
 	v.jwksURL = url
 }
 
+// Issuer returns the expected issuer value.
+func (v *Validator) Issuer() string {
+	return v.issuer
+}
+
 // Audience returns the expected audience value.
 func (v *Validator) Audience() string {
 	return v.audience
@@ -88,19 +301,105 @@ func (v *Validator) AllowedOrg() string {
 	return v.allowedOrg
 }
 
+// JWKSStatus describes the state of the JWKS cache for diagnostics.
+type JWKSStatus struct {
+	URL string
+	// KeyIDs are the cached key ids, sorted.
+	KeyIDs []string
+	// FetchedAt is when the cached keys were fetched; zero if never.
+	FetchedAt   time.Time
+	CachedUntil time.Time
+	// LastError is the most recent fetch failure, which may predate a later
+	// successful fetch; compare LastErrorAt with FetchedAt.
+	LastError   string
+	LastErrorAt time.Time
+	// FromDisk reports that the cached keys were read from the JWKS cache
+	// file because the JWKS could not be fetched.
+	FromDisk bool
+}
+
+// JWKSStatus returns a snapshot of the JWKS cache. It never fetches keys.
+func (v *Validator) JWKSStatus() JWKSStatus {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	status := JWKSStatus{
+		URL:         v.jwksURL,
+		KeyIDs:      make([]string, 0, len(v.cachedKeys)),
+		FetchedAt:   v.fetchedAt,
+		CachedUntil: v.cachedUntil,
+		LastErrorAt: v.lastErrAt,
+		FromDisk:    v.fromDisk,
+	}
+	for kid := range v.cachedKeys {
+		status.KeyIDs = append(status.KeyIDs, kid)
+	}
+	sort.Strings(status.KeyIDs)
+	if v.lastErr != nil {
+		status.LastError = v.lastErr.Error()
+	}
+	return status
+}
+
+// DevMode reports whether signature verification is disabled.
+func (v *Validator) DevMode() bool {
+	return v.devMode
+}
+
+// tokenHashLength is the number of hex characters kept from the token hash;
+// enough to correlate requests without making the hash a useful oracle.
+const tokenHashLength = 12
+
+// TokenHash returns a short SHA-256 fingerprint of the raw token, so log
+// entries for the same token can be correlated without logging the token.
+func TokenHash(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])[:tokenHashLength]
+}
+
+// RedactToken replaces the raw token and each of its segments in msg, so
+// error messages derived from a token are safe to log.
+func RedactToken(msg, tokenString string) string {
+	if tokenString == "" {
+		return msg
+	}
+	msg = strings.ReplaceAll(msg, tokenString, "[REDACTED]")
+	for _, segment := range strings.Split(tokenString, ".") {
+		// Short segments would redact unrelated text and carry no secret
+		if len(segment) >= 8 {
+			msg = strings.ReplaceAll(msg, segment, "[REDACTED]")
+		}
+	}
+	return msg
+}
+
 // InspectToken parses token header and claims without signature verification.
-// It is intended only for diagnostics and logging.
+// It is intended only for diagnostics and logging: the raw token is never
+// included in the result, only its TokenHash.
 func InspectToken(tokenString string) TokenInspection {
+	return inspectToken(tokenString, GitHubClaims)
+}
+
+// InspectToken is like the InspectToken function, but reads the claims of a
+// token of an issuer added with AddIssuer with its ClaimMapping.
+func (v *Validator) InspectToken(tokenString string) TokenInspection {
+	return inspectToken(tokenString, v.ForToken(tokenString).claims)
+}
+
+// inspectToken inspects tokenString, reading its claims with mapping.
+func inspectToken(tokenString string, mapping ClaimMapping) TokenInspection {
 	var claims Claims
 	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
-	token, _, err := parser.ParseUnverified(tokenString, &claims)
+	token, _, err := parser.ParseUnverified(tokenString, &mappedClaims{&claims, mapping})
 	if err != nil {
 		return TokenInspection{
-			ParseError: err.Error(),
+			TokenHash:  TokenHash(tokenString),
+			ParseError: RedactToken(err.Error(), tokenString),
 		}
 	}
 
 	inspection := TokenInspection{
+		TokenHash:       TokenHash(tokenString),
 		Issuer:          claims.Issuer,
 		Audience:        []string(claims.Audience),
 		RepositoryOwner: claims.RepositoryOwner,
@@ -119,11 +418,18 @@ func InspectToken(tokenString string) TokenInspection {
 }
 
 // ValidateToken validates the given JWT token string and returns the parsed claims.
+// Successful results are cached until the token expires, so a workflow that
+// posts several events with one token is only verified once. Tokens whose
+// iss claim is an issuer added with AddIssuer are validated by its rules.
 func (v *Validator) ValidateToken(tokenString string) (*Claims, error) {
-	parserOpts := []jwt.ParserOption{
-		jwt.WithAudience(v.audience),
-		jwt.WithIssuer(GitHubOIDCIssuer),
-		jwt.WithExpirationRequired(),
+	if issuer := v.ForToken(tokenString); issuer != v {
+		return issuer.ValidateToken(tokenString)
+	}
+	if claims, ok := v.cache.Get(tokenString, time.Now()); ok {
+		return claims, nil
+	}
+	if v.faults.Fail(fault.JWKS) {
+		return nil, fmt.Errorf("%w: %w", ErrJWKSUnavailable, fault.ErrInjected)
 	}
 
 	var claims Claims
@@ -132,16 +438,13 @@ func (v *Validator) ValidateToken(tokenString string) (*Claims, error) {
 
 	if v.devMode {
 		// In dev mode, parse without signature verification
-		parser := jwt.NewParser(append(parserOpts,
-			jwt.WithoutClaimsValidation(),
-		)...)
-		token, _, err = parser.ParseUnverified(tokenString, &claims)
+		token, _, err = v.parser.ParseUnverified(tokenString, &mappedClaims{&claims, v.claims})
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse token: %w", err)
 		}
 	} else {
 		// Production mode: verify signature using JWKS
-		token, err = jwt.ParseWithClaims(tokenString, &claims, v.keyFunc, parserOpts...)
+		token, err = v.parser.ParseWithClaims(tokenString, &mappedClaims{&claims, v.claims}, v.keyFunc)
 		if err != nil {
 			return nil, fmt.Errorf("token validation failed: %w", err)
 		}
@@ -150,15 +453,41 @@ func (v *Validator) ValidateToken(tokenString string) (*Claims, error) {
 	if !token.Valid && !v.devMode {
 		return nil, fmt.Errorf("invalid token")
 	}
+	if !v.devMode {
+		if err := v.checkLifetime(&claims); err != nil {
+			return nil, fmt.Errorf("token validation failed: %w", err)
+		}
+	}
 
 	// Enforce organization restriction
 	if !strings.EqualFold(claims.RepositoryOwner, v.allowedOrg) {
-		return nil, fmt.Errorf("token organization %q does not match allowed org %q", claims.RepositoryOwner, v.allowedOrg)
+		return nil, fmt.Errorf("%w: token organization %q does not match allowed org %q", ErrWrongOrg, claims.RepositoryOwner, v.allowedOrg)
+	}
+
+	// Dev mode tokens are not verified, so there is no work worth caching
+	if !v.devMode && claims.ExpiresAt != nil {
+		v.cache.Add(tokenString, &claims, claims.ExpiresAt.Time)
 	}
 
 	return &claims, nil
 }
 
+// checkLifetime enforces the maximum lifetime of a token whose registered
+// claims the parser validated.
+func (v *Validator) checkLifetime(claims *Claims) error {
+	if v.limits.MaxLifetime <= 0 {
+		return nil
+	}
+	if claims.IssuedAt == nil {
+		return fmt.Errorf("%w: iat is required to bound the token lifetime", jwt.ErrTokenRequiredClaimMissing)
+	}
+	lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+	if lifetime > v.limits.MaxLifetime {
+		return fmt.Errorf("%w: token is valid for %s, more than %s", ErrLifetimeTooLong, lifetime, v.limits.MaxLifetime)
+	}
+	return nil
+}
+
 func (v *Validator) keyFunc(token *jwt.Token) (any, error) {
 	// Ensure the signing method is RSA
 	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
@@ -172,23 +501,19 @@ func (v *Validator) keyFunc(token *jwt.Token) (any, error) {
 
 	keys, err := v.getKeys()
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+		return nil, fmt.Errorf("%w: failed to fetch JWKS: %w", ErrJWKSUnavailable, err)
 	}
 
 	key, ok := keys[kid]
 	if !ok {
 		// Try refreshing the cache in case keys rotated
-		v.mu.Lock()
-		v.cachedUntil = time.Time{}
-		v.mu.Unlock()
-
-		keys, err = v.getKeys()
+		keys, err = v.loadKeys(true)
 		if err != nil {
-			return nil, fmt.Errorf("failed to refresh JWKS: %w", err)
+			return nil, fmt.Errorf("%w: failed to refresh JWKS: %w", ErrJWKSUnavailable, err)
 		}
 		key, ok = keys[kid]
 		if !ok {
-			return nil, fmt.Errorf("key %q not found in JWKS", kid)
+			return nil, fmt.Errorf("%w: key %q", ErrUnknownKey, kid)
 		}
 	}
 
@@ -204,24 +529,87 @@ func (v *Validator) getKeys() (map[string]crypto.PublicKey, error) {
 	}
 	v.mu.RUnlock()
 
+	return v.loadKeys(false)
+}
+
+// loadKeys returns the cached keys if they are fresh, and otherwise fetches
+// the JWKS. Concurrent callers share a single in-flight fetch rather than each
+// fetching. With force, cached keys are only reused if they were fetched less
+// than jwksMinRefreshInterval ago.
+func (v *Validator) loadKeys(force bool) (map[string]crypto.PublicKey, error) {
 	v.mu.Lock()
-	defer v.mu.Unlock()
+	fresh := time.Now().Before(v.cachedUntil)
+	if force {
+		fresh = time.Since(v.fetchedAt) < jwksMinRefreshInterval
+	}
+	if v.cachedKeys != nil && fresh {
+		keys := v.cachedKeys
+		v.mu.Unlock()
+		return keys, nil
+	}
 
-	// Double-check after acquiring write lock
-	if v.cachedKeys != nil && time.Now().Before(v.cachedUntil) {
-		return v.cachedKeys, nil
+	if call := v.inflight; call != nil {
+		v.mu.Unlock()
+		<-call.done
+		return call.keys, call.err
 	}
+	call := &jwksFetch{done: make(chan struct{})}
+	v.inflight = call
+	v.mu.Unlock()
 
-	keys, err := v.fetchJWKS()
-	if err != nil {
-		return nil, err
+	call.body, call.err = v.fetchJWKS()
+	if call.err == nil {
+		call.keys, call.err = parseJWKS(call.body, v.logger)
 	}
+	fetched := call.err == nil
 
-	v.cachedKeys = keys
-	v.cachedUntil = time.Now().Add(jwksCacheTTL)
-	v.logger.Debug("refreshed JWKS cache", "key_count", len(keys))
+	v.mu.Lock()
+	now := time.Now()
+	if fetched {
+		v.cachedKeys = call.keys
+		v.cachedUntil = now.Add(jwksCacheTTL)
+		v.fetchedAt = now
+		v.fromDisk = false
+		v.logger.Debug("refreshed JWKS cache", "key_count", len(call.keys))
+	} else {
+		v.lastErr = call.err
+		v.lastErrAt = now
+		if v.cacheFile != "" {
+			v.loadKeysFromDisk(call, now)
+		}
+	}
+	v.inflight = nil
+	v.mu.Unlock()
+	close(call.done)
 
-	return keys, nil
+	if fetched && v.cacheFile != "" {
+		if err := v.writeJWKSCache(call.body, now); err != nil {
+			v.logger.Warn("failed to persist JWKS", "file", v.cacheFile, "error", err)
+		}
+	}
+	return call.keys, call.err
+}
+
+// loadKeysFromDisk replaces the failed result of call with the keys of the
+// cache file, if they are recent enough. They are only trusted until the
+// next fetch attempt, jwksMinRefreshInterval later. v.mu must be held.
+func (v *Validator) loadKeysFromDisk(call *jwksFetch, now time.Time) {
+	keys, fetchedAt, err := v.readJWKSCache(now)
+	if err != nil {
+		v.logger.Warn("JWKS unavailable and no usable JWKS cache file", "file", v.cacheFile, "fetch_error", call.err, "error", err)
+		return
+	}
+	v.logger.Warn("JWKS unavailable, using keys from the JWKS cache file",
+		"file", v.cacheFile,
+		"fetched_at", fetchedAt,
+		"key_count", len(keys),
+		"error", call.err,
+	)
+	v.cachedKeys = keys
+	v.cachedUntil = now.Add(jwksMinRefreshInterval)
+	v.fetchedAt = fetchedAt
+	v.fromDisk = true
+	call.keys, call.err = keys, nil
 }
 
 type jwksResponse struct {
@@ -235,7 +623,8 @@ type jwkKey struct {
 	E   string `json:"e"`
 }
 
-func (v *Validator) fetchJWKS() (map[string]crypto.PublicKey, error) {
+// fetchJWKS fetches the JWKS document.
+func (v *Validator) fetchJWKS() ([]byte, error) {
 	resp, err := v.httpClient.Get(v.jwksURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch JWKS from %s: %w", v.jwksURL, err)
@@ -250,38 +639,67 @@ func (v *Validator) fetchJWKS() (map[string]crypto.PublicKey, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read JWKS response: %w", err)
 	}
+	return body, nil
+}
 
+// RSA modulus sizes accepted from the JWKS. Smaller keys are weak, and larger
+// ones would make every signature check slow.
+const (
+	minRSAKeyBits = 2048
+	maxRSAKeyBits = 8192
+)
+
+// parseJWKS parses a JWKS document into its RSA public keys by key ID. Keys
+// of other types are skipped, and invalid RSA keys are logged and skipped.
+func parseJWKS(body []byte, logger *slog.Logger) (map[string]crypto.PublicKey, error) {
 	var jwks jwksResponse
 	if err := json.Unmarshal(body, &jwks); err != nil {
 		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
 	}
 
-	keys := make(map[string]crypto.PublicKey)
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
 	for _, k := range jwks.Keys {
 		if k.KTY != "RSA" {
 			continue
 		}
-
-		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		key, err := decodeRSAKey(k.N, k.E)
 		if err != nil {
-			v.logger.Warn("failed to decode JWK modulus", "kid", k.KID, "error", err)
+			logger.Warn("skipping invalid JWK", "kid", k.KID, "error", err)
 			continue
 		}
+		keys[k.KID] = key
+	}
 
-		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
-		if err != nil {
-			v.logger.Warn("failed to decode JWK exponent", "kid", k.KID, "error", err)
-			continue
-		}
+	return keys, nil
+}
 
-		n := new(big.Int).SetBytes(nBytes)
-		e := 0
-		for _, b := range eBytes {
-			e = e<<8 + int(b)
-		}
+// decodeRSAKey decodes the base64url modulus and exponent of an RSA JWK.
+func decodeRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exponent: %w", err)
+	}
 
-		keys[k.KID] = &rsa.PublicKey{N: n, E: e}
+	modulus := new(big.Int).SetBytes(nBytes)
+	if bits := modulus.BitLen(); bits < minRSAKeyBits || bits > maxRSAKeyBits {
+		return nil, fmt.Errorf("modulus of %d bits is outside %d to %d bits", bits, minRSAKeyBits, maxRSAKeyBits)
+	}
+	// Exponents are at most 32 bits in practice, which also keeps the
+	// conversion below from overflowing
+	if len(eBytes) == 0 || len(eBytes) > 4 {
+		return nil, fmt.Errorf("exponent must be 1 to 4 bytes, got %d", len(eBytes))
+	}
+	exponent := 0
+	for _, b := range eBytes {
+		exponent = exponent<<8 + int(b)
+	}
+	if exponent < 3 || exponent%2 == 0 {
+		return nil, fmt.Errorf("exponent %d is not an odd number of at least 3", exponent)
 	}
 
-	return keys, nil
+	return &rsa.PublicKey{N: modulus, E: exponent}, nil
 }
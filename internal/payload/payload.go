@@ -1,43 +1,399 @@
 package payload
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/logging"
 )
 
-// Event represents the webhook event payload.
+// digestPattern matches an OCI content digest such as sha256:<64 hex chars>.
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+
+// Event represents the webhook event payload. It names either a single image
+// with Image, Tags and Digest, or several images pushed together with Images.
 type Event struct {
-	Image string   `json:"image"`
-	Tags  []string `json:"tags"`
+	Image string   `json:"image,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	// Digest is the optional content digest of the pushed image manifest.
+	Digest string `json:"digest,omitempty"`
+	// Images lists the images of a multi-image event, such as an application
+	// and its migration job built by the same workflow run.
+	Images []EventImage `json:"images,omitempty"`
+	// Priority is PriorityNormal (the default when empty) or PriorityHigh.
+	Priority string `json:"priority,omitempty"`
+}
+
+// EventImage is one image of a multi-image event.
+type EventImage struct {
+	Image  string   `json:"image"`
+	Tags   []string `json:"tags"`
+	Digest string   `json:"digest,omitempty"`
+}
+
+// maxEventImages bounds the number of images in a multi-image event.
+const maxEventImages = 16
+
+// Event priorities. High priority events are published on a separate
+// channel that the worker drains before normal events.
+const (
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// Trigger identifies the authenticated GitHub Actions workflow run that caused
+// an event. It is populated by the web mode from validated OIDC claims and is
+// never accepted from the HTTP request body.
+type Trigger struct {
+	// Issuer is the iss claim of the token, which tells repositories of the
+	// same name on different hosts apart.
+	Issuer          string `json:"issuer,omitempty"`
+	Repository      string `json:"repository,omitempty"`
+	RepositoryOwner string `json:"repository_owner,omitempty"`
+	Actor           string `json:"actor,omitempty"`
+	RunID           string `json:"run_id,omitempty"`
+	SHA             string `json:"sha,omitempty"`
+}
+
+// Message types. Messages without a type are image push events, as published
+// by older web instances.
+const (
+	// MessageTypeEvent carries an image push Event.
+	MessageTypeEvent = "event"
+
+	// MessageTypeRestart carries a manual RestartRequest from the admin API.
+	MessageTypeRestart = "restart"
+
+	// MessageTypeMatchQuery carries a MatchQuery the worker answers on its reply channel.
+	MessageTypeMatchQuery = "match_query"
+
+	// MessageTypePause asks the worker to hold events and restarts until resumed.
+	MessageTypePause = "pause"
+
+	// MessageTypeResume asks a paused worker to process the events it held.
+	MessageTypeResume = "resume"
+
+	// MessageTypeLogLevel asks the worker to change its log level to LogLevel.
+	MessageTypeLogLevel = "log_level"
+)
+
+// RestartRequest asks the worker to restart a single Deployment.
+type RestartRequest struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	// Reason is an optional free-form note recorded for auditing.
+	Reason string `json:"reason,omitempty"`
+}
+
+// MatchQuery asks the worker which Deployments an image:tag would currently
+// restart. The worker publishes a MatchReply to ReplyTo.
+type MatchQuery struct {
+	Image   string `json:"image"`
+	Tag     string `json:"tag"`
+	ReplyTo string `json:"reply_to"`
+}
+
+// MatchResult describes one Deployment running the queried image reference.
+type MatchResult struct {
+	Namespace  string   `json:"namespace"`
+	Deployment string   `json:"deployment"`
+	Containers []string `json:"containers"`
+	// Excluded is the reason the Deployment would not be restarted, if any.
+	Excluded string `json:"excluded,omitempty"`
+}
+
+// MatchReply is the worker's answer to a MatchQuery.
+type MatchReply struct {
+	Matches []MatchResult `json:"matches"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Message is the envelope published to Valkey: an event or control request
+// plus the identity that triggered it.
+type Message struct {
+	Type string `json:"type,omitempty"`
+	*Event
+	Restart *RestartRequest `json:"restart,omitempty"`
+	Query   *MatchQuery     `json:"query,omitempty"`
+	Trigger *Trigger        `json:"trigger,omitempty"`
+	// LogLevel is the level set by a log_level message.
+	LogLevel string `json:"log_level,omitempty"`
+	// Namespaces optionally restricts an event to namespaces matching any of
+	// these patterns (path.Match syntax), as decided by the web authorizer.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// dnsLabelPattern matches a Kubernetes namespace name (RFC 1123 label).
+var dnsLabelPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// dnsSubdomainPattern matches a Kubernetes Deployment name (RFC 1123 subdomain).
+var dnsSubdomainPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// maxReasonLength bounds the audit reason of a restart request.
+const maxReasonLength = 256
+
+// Strictness controls how payload fields unknown to this version are
+// handled, so that older versions can accept payloads of newer ones during a
+// rolling upgrade.
+type Strictness string
+
+const (
+	// StrictnessStrict rejects payloads with unknown fields. The default.
+	StrictnessStrict Strictness = "strict"
+	// StrictnessWarn accepts payloads with unknown fields and reports the
+	// first one, for the caller to log.
+	StrictnessWarn Strictness = "warn"
+	// StrictnessIgnore accepts payloads with unknown fields silently.
+	StrictnessIgnore Strictness = "ignore"
+)
+
+// ParseStrictness parses strict, warn or ignore.
+func ParseStrictness(s string) (Strictness, error) {
+	switch strictness := Strictness(s); strictness {
+	case StrictnessStrict, StrictnessWarn, StrictnessIgnore:
+		return strictness, nil
+	default:
+		return "", fmt.Errorf("strictness must be strict, warn or ignore, got %q", s)
+	}
+}
+
+// decodeStrict decodes a single JSON value from data into v, rejecting
+// unknown fields and trailing content. It reads data in place rather than
+// copying it into a string.
+func decodeStrict(data []byte, v any) error {
+	return decodeJSON(data, v, true)
+}
+
+// decode decodes data into v, a pointer to a struct, handling unknown fields
+// according to strictness. It returns the first unknown field of a payload
+// accepted in warn mode.
+func decode(data []byte, v any, strictness Strictness) (string, error) {
+	err := decodeStrict(data, v)
+	field, ok := unknownField(err)
+	if !ok || strictness != StrictnessWarn && strictness != StrictnessIgnore {
+		return "", err
+	}
+	// The strict decode stopped at the unknown field, leaving v half filled
+	reflect.ValueOf(v).Elem().SetZero()
+	if err := decodeJSON(data, v, false); err != nil {
+		return "", err
+	}
+	if strictness == StrictnessIgnore {
+		return "", nil
+	}
+	return field, nil
+}
+
+// unknownField returns the field named by an unknown field error of
+// decodeStrict.
+func unknownField(err error) (string, bool) {
+	inner := errors.Unwrap(err)
+	if inner == nil {
+		return "", false
+	}
+	quoted, ok := strings.CutPrefix(inner.Error(), "json: unknown field ")
+	if !ok {
+		return "", false
+	}
+	if field, err := strconv.Unquote(quoted); err == nil {
+		return field, true
+	}
+	return quoted, true
+}
+
+// decodeJSON decodes a single JSON value from data into v, rejecting
+// trailing content and, if disallowUnknown is set, unknown fields.
+func decodeJSON(data []byte, v any, disallowUnknown bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if disallowUnknown {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	// Token also catches a stray closing bracket, which More does not
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid JSON payload: unexpected trailing content")
+	}
+	return nil
 }
 
 // ParseAndValidate parses JSON bytes into an Event and validates all fields.
-// allowedPrefix is the required prefix for the image field.
+// allowedPrefix is the required prefix for the image field. Unknown fields
+// are rejected.
 func ParseAndValidate(data []byte, allowedPrefix string) (*Event, error) {
-	// Reject unexpected fields by using a strict decoder
-	dec := json.NewDecoder(strings.NewReader(string(data)))
-	dec.DisallowUnknownFields()
+	evt, _, err := ParseAndValidateWith(data, allowedPrefix, StrictnessStrict)
+	return evt, err
+}
 
+// ParseAndValidateWith is ParseAndValidate with unknown fields handled
+// according to strictness. It returns the first unknown field of an event
+// accepted in warn mode.
+func ParseAndValidateWith(data []byte, allowedPrefix string, strictness Strictness) (*Event, string, error) {
 	var evt Event
-	if err := dec.Decode(&evt); err != nil {
-		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	unknown, err := decode(data, &evt, strictness)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Ensure no trailing content
-	if dec.More() {
-		return nil, fmt.Errorf("invalid JSON payload: unexpected trailing content")
+	if err := ValidateEvent(&evt, allowedPrefix); err != nil {
+		return nil, "", err
 	}
 
-	if err := ValidateEvent(&evt, allowedPrefix); err != nil {
+	return &evt, unknown, nil
+}
+
+// ParseRestartRequest parses and validates a manual restart request body.
+func ParseRestartRequest(data []byte) (*RestartRequest, error) {
+	var req RestartRequest
+	if err := decodeStrict(data, &req); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateRestart(&req); err != nil {
 		return nil, err
 	}
+	return &req, nil
+}
+
+// ValidateRestart validates an already-parsed RestartRequest.
+func ValidateRestart(req *RestartRequest) error {
+	if req.Namespace == "" {
+		return fmt.Errorf("missing required field: namespace")
+	}
+	if req.Deployment == "" {
+		return fmt.Errorf("missing required field: deployment")
+	}
+	if !dnsLabelPattern.MatchString(req.Namespace) {
+		return fmt.Errorf("namespace %q is not a valid Kubernetes namespace name", req.Namespace)
+	}
+	if len(req.Deployment) > 253 || !dnsSubdomainPattern.MatchString(req.Deployment) {
+		return fmt.Errorf("deployment %q is not a valid Kubernetes Deployment name", req.Deployment)
+	}
+	if len(req.Reason) > maxReasonLength {
+		return fmt.Errorf("reason must be at most %d characters", maxReasonLength)
+	}
+	return nil
+}
+
+// ValidateMatchQuery validates an already-parsed MatchQuery.
+func ValidateMatchQuery(q *MatchQuery, allowedPrefix string) error {
+	if err := ValidateEvent(&Event{Image: q.Image, Tags: []string{q.Tag}}, allowedPrefix); err != nil {
+		return err
+	}
+	if q.ReplyTo == "" {
+		return fmt.Errorf("missing required field: reply_to")
+	}
+	return nil
+}
+
+// ParseMessage parses a message received from Valkey and validates the event
+// or request it carries. Messages published by older web instances without a
+// type or trigger are accepted as events. Unknown fields are rejected.
+func ParseMessage(data []byte, allowedPrefix string) (*Message, error) {
+	msg, _, err := ParseMessageWith(data, allowedPrefix, StrictnessStrict)
+	return msg, err
+}
+
+// ParseMessageWith is ParseMessage with unknown fields handled according to
+// strictness, so that an older worker accepts messages of a newer web
+// during a rolling upgrade. It returns the first unknown field of a message
+// accepted in warn mode.
+func ParseMessageWith(data []byte, allowedPrefix string, strictness Strictness) (*Message, string, error) {
+	var msg Message
+	unknown, err := decode(data, &msg, strictness)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if msg.LogLevel != "" && msg.Type != MessageTypeLogLevel {
+		return nil, "", fmt.Errorf("only %s messages carry a log level", MessageTypeLogLevel)
+	}
+
+	switch msg.Type {
+	case "", MessageTypeEvent:
+		if msg.Event == nil || msg.Restart != nil || msg.Query != nil {
+			return nil, "", fmt.Errorf("event message must carry only an event")
+		}
+		if err := ValidateEvent(msg.Event, allowedPrefix); err != nil {
+			return nil, "", err
+		}
+		for _, pattern := range msg.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return nil, "", fmt.Errorf("invalid namespace pattern %q", pattern)
+			}
+		}
+	case MessageTypeRestart:
+		if msg.Restart == nil || msg.Event != nil || msg.Query != nil || msg.Namespaces != nil {
+			return nil, "", fmt.Errorf("restart message must carry only a restart request")
+		}
+		if err := ValidateRestart(msg.Restart); err != nil {
+			return nil, "", err
+		}
+	case MessageTypeMatchQuery:
+		if msg.Query == nil || msg.Event != nil || msg.Restart != nil || msg.Namespaces != nil {
+			return nil, "", fmt.Errorf("match query message must carry only a query")
+		}
+		if err := ValidateMatchQuery(msg.Query, allowedPrefix); err != nil {
+			return nil, "", err
+		}
+	case MessageTypePause, MessageTypeResume:
+		if msg.Event != nil || msg.Restart != nil || msg.Query != nil || msg.Namespaces != nil {
+			return nil, "", fmt.Errorf("%s message must not carry an event or request", msg.Type)
+		}
+	case MessageTypeLogLevel:
+		if msg.Event != nil || msg.Restart != nil || msg.Query != nil || msg.Namespaces != nil {
+			return nil, "", fmt.Errorf("log level message must carry only a log level")
+		}
+		if _, err := logging.ParseLevel(msg.LogLevel); err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", fmt.Errorf("unknown message type %q", msg.Type)
+	}
 
-	return &evt, nil
+	return &msg, unknown, nil
 }
 
 // ValidateEvent validates an already-parsed Event.
 func ValidateEvent(evt *Event, allowedPrefix string) error {
+	if evt.Priority != "" && evt.Priority != PriorityNormal && evt.Priority != PriorityHigh {
+		return fmt.Errorf("priority must be %q or %q, got %q", PriorityNormal, PriorityHigh, evt.Priority)
+	}
+
+	if evt.Images == nil {
+		return validateImage(evt, allowedPrefix)
+	}
+	if evt.Image != "" || evt.Tags != nil || evt.Digest != "" {
+		return fmt.Errorf("images must not be combined with image, tags or digest")
+	}
+	if len(evt.Images) == 0 || len(evt.Images) > maxEventImages {
+		return fmt.Errorf("images must list between 1 and %d images", maxEventImages)
+	}
+	seen := make(map[string]bool)
+	for i, part := range evt.Parts() {
+		if err := validateImage(part, allowedPrefix); err != nil {
+			return fmt.Errorf("images[%d]: %w", i, err)
+		}
+		if seen[part.Image] {
+			return fmt.Errorf("images[%d]: image %q is listed more than once", i, part.Image)
+		}
+		seen[part.Image] = true
+	}
+	return nil
+}
+
+// validateImage validates the image, tags and digest of a single-image event.
+func validateImage(evt *Event, allowedPrefix string) error {
 	if evt.Image == "" {
 		return fmt.Errorf("missing required field: image")
 	}
@@ -45,15 +401,18 @@ func ValidateEvent(evt *Event, allowedPrefix string) error {
 		return fmt.Errorf("missing required field: tags (must be a non-empty array)")
 	}
 
-	// Validate each tag is non-empty
+	// Validate each tag is non-empty and a valid image tag
 	for i, tag := range evt.Tags {
 		if tag == "" {
 			return fmt.Errorf("tags[%d] is empty", i)
 		}
+		if err := imageref.ValidateTag(tag); err != nil {
+			return err
+		}
 	}
 
-	// Validate image starts with allowed prefix
-	if !strings.HasPrefix(evt.Image, allowedPrefix) {
+	// Validate image starts with allowed prefix, ignoring the registry host case
+	if !imageref.HasPrefix(evt.Image, allowedPrefix) {
 		return fmt.Errorf("image %q does not start with allowed prefix %q", evt.Image, allowedPrefix)
 	}
 
@@ -61,15 +420,61 @@ func ValidateEvent(evt *Event, allowedPrefix string) error {
 	if !strings.Contains(evt.Image, "/") {
 		return fmt.Errorf("image %q is not a valid container image reference", evt.Image)
 	}
+	if err := imageref.ValidateName(evt.Image); err != nil {
+		return err
+	}
+
+	if evt.Digest != "" && !digestPattern.MatchString(evt.Digest) {
+		return fmt.Errorf("digest %q is not a valid content digest", evt.Digest)
+	}
+
+	return nil
+}
+
+// Parts returns the event as one single-image event per image. An event
+// without Images is returned as its only part.
+func (e *Event) Parts() []*Event {
+	if len(e.Images) == 0 {
+		return []*Event{e}
+	}
+	parts := make([]*Event, len(e.Images))
+	for i, img := range e.Images {
+		parts[i] = &Event{Image: img.Image, Tags: img.Tags, Digest: img.Digest, Priority: e.Priority}
+	}
+	return parts
+}
 
+// RequireDigest returns an error if an image of the event has a tag matching
+// any of the protected tag patterns (path.Match syntax) but no digest.
+func (e *Event) RequireDigest(protectedTags []string) error {
+	for _, part := range e.Parts() {
+		if part.Digest != "" {
+			continue
+		}
+		for _, tag := range part.Tags {
+			for _, pattern := range protectedTags {
+				if ok, _ := path.Match(pattern, tag); ok {
+					return fmt.Errorf("tag %q is protected and requires a digest", tag)
+				}
+			}
+		}
+	}
 	return nil
 }
 
-// ImageRefs returns all full image references (image:tag) for each tag in the event.
+// HighPriority reports whether the event is flagged priority=high.
+func (e *Event) HighPriority() bool {
+	return e.Priority == PriorityHigh
+}
+
+// ImageRefs returns all full image references (image:tag) for each tag of
+// each image in the event.
 func (e *Event) ImageRefs() []string {
-	refs := make([]string, len(e.Tags))
-	for i, tag := range e.Tags {
-		refs[i] = e.Image + ":" + tag
+	var refs []string
+	for _, part := range e.Parts() {
+		for _, tag := range part.Tags {
+			refs = append(refs, part.Image+":"+tag)
+		}
 	}
 	return refs
 }
@@ -78,3 +483,22 @@ func (e *Event) ImageRefs() []string {
 func (e *Event) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
 }
+
+// AllowsNamespace reports whether the message may restart workloads in ns.
+// A message without namespace restrictions allows every namespace.
+func (m *Message) AllowsNamespace(ns string) bool {
+	if len(m.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range m.Namespaces {
+		if ok, _ := path.Match(pattern, ns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ToJSON serializes the message to minimized JSON.
+func (m *Message) ToJSON() ([]byte, error) {
+	return json.Marshal(m)
+}
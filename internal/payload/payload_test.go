@@ -1,6 +1,8 @@
 package payload
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -99,6 +101,16 @@ func TestParseAndValidate_Invalid(t *testing.T) {
 			input:  `{"image":"ghcr.io/test/myservice","tags":["dev"]}extra`,
 			prefix: "ghcr.io/test/",
 		},
+		{
+			name:   "trailing closing brace",
+			input:  `{"image":"ghcr.io/test/myservice","tags":["dev"]}}`,
+			prefix: "ghcr.io/test/",
+		},
+		{
+			name:   "second value",
+			input:  `{"image":"ghcr.io/test/myservice","tags":["dev"]} {}`,
+			prefix: "ghcr.io/test/",
+		},
 	}
 
 	for _, tt := range tests {
@@ -161,3 +173,439 @@ func TestEvent_ToJSON(t *testing.T) {
 		t.Errorf("expected %s, got %s", expected, string(data))
 	}
 }
+
+func TestParseAndValidate_RejectsTrigger(t *testing.T) {
+	input := `{"image":"ghcr.io/test/myservice","tags":["dev"],"trigger":{"repository":"test/repo"}}`
+	if _, err := ParseAndValidate([]byte(input), "ghcr.io/test/"); err == nil {
+		t.Fatal("expected error: trigger must not be accepted from the request body")
+	}
+}
+
+func TestParseWith_Strictness(t *testing.T) {
+	event := `{"image":"ghcr.io/test/myservice","tags":["dev"],"rollout_window":"5m"}`
+	message := `{"type":"event","image":"ghcr.io/test/myservice","tags":["dev"],"trigger":{"repository":"test/repo","workflow_ref":"x"}}`
+
+	if _, _, err := ParseAndValidateWith([]byte(event), "ghcr.io/test/", StrictnessStrict); err == nil {
+		t.Error("expected strict mode to reject an unknown event field")
+	}
+	if _, _, err := ParseMessageWith([]byte(message), "ghcr.io/test/", ""); err == nil {
+		t.Error("expected the default to reject an unknown message field")
+	}
+
+	evt, unknown, err := ParseAndValidateWith([]byte(event), "ghcr.io/test/", StrictnessWarn)
+	if err != nil || unknown != "rollout_window" || evt.Image != "ghcr.io/test/myservice" || len(evt.Tags) != 1 {
+		t.Errorf("expected warn mode to accept the event and report the field, got %+v %q %v", evt, unknown, err)
+	}
+	msg, unknown, err := ParseMessageWith([]byte(message), "ghcr.io/test/", StrictnessWarn)
+	if err != nil || unknown != "workflow_ref" || msg.Trigger == nil || msg.Trigger.Repository != "test/repo" {
+		t.Errorf("expected warn mode to accept the message and report the field, got %+v %q %v", msg, unknown, err)
+	}
+	msg, unknown, err = ParseMessageWith([]byte(message), "ghcr.io/test/", StrictnessIgnore)
+	if err != nil || unknown != "" || msg.Image != "ghcr.io/test/myservice" {
+		t.Errorf("expected ignore mode to accept the message silently, got %+v %q %v", msg, unknown, err)
+	}
+
+	// Other errors are still reported in lenient modes
+	for _, input := range []string{
+		`{"image":"ghcr.io/test/myservice","tags":["dev"],"extra":1}{}`,
+		`{"image":"docker.io/test/myservice","tags":["dev"],"extra":1}`,
+		`{"image":"ghcr.io/test/myservice","tags":"dev","extra":1}`,
+	} {
+		if _, _, err := ParseAndValidateWith([]byte(input), "ghcr.io/test/", StrictnessIgnore); err == nil {
+			t.Errorf("expected an error for %s", input)
+		}
+	}
+}
+
+func TestParseStrictness(t *testing.T) {
+	for _, s := range []string{"strict", "warn", "ignore"} {
+		if got, err := ParseStrictness(s); err != nil || string(got) != s {
+			t.Errorf("ParseStrictness(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseStrictness("lenient"); err == nil {
+		t.Error("expected an error for an unknown strictness")
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantTrigger bool
+	}{
+		{
+			name:        "with trigger",
+			input:       `{"image":"ghcr.io/test/myservice","tags":["dev"],"trigger":{"repository":"test/repo","repository_owner":"test","actor":"octocat","run_id":"42"}}`,
+			wantTrigger: true,
+		},
+		{
+			name:  "without trigger",
+			input: `{"image":"ghcr.io/test/myservice","tags":["dev"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseMessage([]byte(tt.input), "ghcr.io/test/")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg.Image != "ghcr.io/test/myservice" {
+				t.Errorf("expected image ghcr.io/test/myservice, got %s", msg.Image)
+			}
+			if (msg.Trigger != nil) != tt.wantTrigger {
+				t.Fatalf("expected trigger present = %v, got %+v", tt.wantTrigger, msg.Trigger)
+			}
+			if tt.wantTrigger && msg.Trigger.Actor != "octocat" {
+				t.Errorf("expected actor octocat, got %s", msg.Trigger.Actor)
+			}
+		})
+	}
+}
+
+func TestParseMessage_Invalid(t *testing.T) {
+	if _, err := ParseMessage([]byte(`{"image":"docker.io/test/myservice","tags":["dev"]}`), "ghcr.io/test/"); err == nil {
+		t.Fatal("expected error for wrong prefix")
+	}
+	if _, err := ParseMessage([]byte(`{"image":"ghcr.io/test/myservice","tags":["dev"],"trigger":{"unknown":"x"}}`), "ghcr.io/test/"); err == nil {
+		t.Fatal("expected error for unknown trigger field")
+	}
+}
+
+func TestMessage_ToJSON(t *testing.T) {
+	msg := &Message{
+		Event:   &Event{Image: "ghcr.io/test/myservice", Tags: []string{"dev"}},
+		Trigger: &Trigger{Repository: "test/repo", RunID: "42"},
+	}
+	data, err := msg.ToJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"image":"ghcr.io/test/myservice","tags":["dev"],"trigger":{"repository":"test/repo","run_id":"42"}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, string(data))
+	}
+}
+
+func TestParseMessage_Restart(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"restart","restart":{"namespace":"dev","deployment":"my-app","reason":"config reload"},"trigger":{"actor":"admin"}}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Restart == nil || msg.Restart.Namespace != "dev" || msg.Restart.Deployment != "my-app" {
+		t.Errorf("unexpected restart request %+v", msg.Restart)
+	}
+	if msg.Event != nil {
+		t.Errorf("expected no event, got %+v", msg.Event)
+	}
+
+	invalid := []string{
+		`{"type":"restart"}`,
+		`{"type":"restart","restart":{"namespace":"dev","deployment":"my-app"},"image":"ghcr.io/test/svc","tags":["dev"]}`,
+		`{"type":"restart","restart":{"namespace":"Dev","deployment":"my-app"}}`,
+		`{"restart":{"namespace":"dev","deployment":"my-app"}}`,
+		`{"type":"unknown","image":"ghcr.io/test/svc","tags":["dev"]}`,
+	}
+	for _, input := range invalid {
+		if _, err := ParseMessage([]byte(input), "ghcr.io/test/"); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParseMessage_MatchQuery(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"match_query","query":{"image":"ghcr.io/test/svc","tag":"dev","reply_to":"kuberollouttrigger:reply:abc"}}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Query == nil || msg.Query.Tag != "dev" || msg.Query.ReplyTo != "kuberollouttrigger:reply:abc" {
+		t.Errorf("unexpected query %+v", msg.Query)
+	}
+
+	invalid := []string{
+		`{"type":"match_query","query":{"image":"ghcr.io/test/svc","tag":"dev"}}`,
+		`{"type":"match_query","query":{"image":"docker.io/test/svc","tag":"dev","reply_to":"r"}}`,
+		`{"type":"match_query","query":{"image":"ghcr.io/test/svc","tag":"","reply_to":"r"}}`,
+	}
+	for _, input := range invalid {
+		if _, err := ParseMessage([]byte(input), "ghcr.io/test/"); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParseMessage_PauseResume(t *testing.T) {
+	for _, input := range []string{
+		`{"type":"pause","trigger":{"actor":"admin"}}`,
+		`{"type":"resume","trigger":{"actor":"admin"}}`,
+	} {
+		if _, err := ParseMessage([]byte(input), "ghcr.io/test/"); err != nil {
+			t.Errorf("unexpected error for %s: %v", input, err)
+		}
+	}
+
+	invalid := []string{
+		`{"type":"pause","image":"ghcr.io/test/svc","tags":["dev"]}`,
+		`{"type":"resume","restart":{"namespace":"dev","deployment":"svc"}}`,
+		`{"type":"pause","namespaces":["dev"]}`,
+	}
+	for _, input := range invalid {
+		if _, err := ParseMessage([]byte(input), "ghcr.io/test/"); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParseMessage_LogLevel(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"log_level","log_level":"debug","trigger":{"actor":"admin"}}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.LogLevel != "debug" {
+		t.Errorf("expected log level debug, got %q", msg.LogLevel)
+	}
+
+	invalid := []string{
+		`{"type":"log_level"}`,
+		`{"type":"log_level","log_level":"verbose"}`,
+		`{"type":"log_level","log_level":"debug","namespaces":["dev"]}`,
+		`{"type":"pause","log_level":"debug"}`,
+		`{"image":"ghcr.io/test/svc","tags":["dev"],"log_level":"debug"}`,
+	}
+	for _, input := range invalid {
+		if _, err := ParseMessage([]byte(input), "ghcr.io/test/"); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParseMessage_Namespaces(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"image":"ghcr.io/test/svc","tags":["dev"],"namespaces":["team-a-*","shared"]}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for ns, want := range map[string]bool{"team-a-dev": true, "shared": true, "team-b-dev": false} {
+		if got := msg.AllowsNamespace(ns); got != want {
+			t.Errorf("AllowsNamespace(%q) = %v, want %v", ns, got, want)
+		}
+	}
+
+	unrestricted := &Message{Event: &Event{Image: "ghcr.io/test/svc", Tags: []string{"dev"}}}
+	if !unrestricted.AllowsNamespace("anything") {
+		t.Error("expected a message without namespaces to allow every namespace")
+	}
+
+	invalid := []string{
+		`{"image":"ghcr.io/test/svc","tags":["dev"],"namespaces":["[bad"]}`,
+		`{"image":"ghcr.io/test/svc","tags":["dev"],"namespaces":[""]}`,
+		`{"type":"restart","restart":{"namespace":"dev","deployment":"my-app"},"namespaces":["dev"]}`,
+	}
+	for _, input := range invalid {
+		if _, err := ParseMessage([]byte(input), "ghcr.io/test/"); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParseRestartRequest(t *testing.T) {
+	req, err := ParseRestartRequest([]byte(`{"namespace":"prod","deployment":"api.v2"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Namespace != "prod" || req.Deployment != "api.v2" {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	invalid := []string{
+		`{"namespace":"prod"}`,
+		`{"deployment":"api"}`,
+		`{"namespace":"prod","deployment":"API"}`,
+		`{"namespace":"prod","deployment":"api","extra":true}`,
+		`{"namespace":"prod","deployment":"api","reason":"` + strings.Repeat("x", 300) + `"}`,
+	}
+	for _, input := range invalid {
+		if _, err := ParseRestartRequest([]byte(input)); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestParseAndValidate_Digest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	evt, err := ParseAndValidate([]byte(`{"image":"ghcr.io/test/myservice","tags":["prod"],"digest":"`+digest+`"}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evt.Digest != digest {
+		t.Errorf("expected digest %s, got %s", digest, evt.Digest)
+	}
+
+	if _, err := ParseAndValidate([]byte(`{"image":"ghcr.io/test/myservice","tags":["prod"],"digest":"not-a-digest"}`), "ghcr.io/test/"); err == nil {
+		t.Fatal("expected error for invalid digest")
+	}
+}
+
+func TestParseAndValidate_Priority(t *testing.T) {
+	evt, err := ParseAndValidate([]byte(`{"image":"ghcr.io/test/myservice","tags":["prod"],"priority":"high"}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !evt.HighPriority() {
+		t.Errorf("expected a high priority event, got priority %q", evt.Priority)
+	}
+
+	if _, err := ParseAndValidate([]byte(`{"image":"ghcr.io/test/myservice","tags":["prod"],"priority":"urgent"}`), "ghcr.io/test/"); err == nil {
+		t.Fatal("expected error for unknown priority")
+	}
+}
+
+func TestParseAndValidate_ImageReferences(t *testing.T) {
+	tests := []struct {
+		image   string
+		prefix  string
+		wantErr bool
+	}{
+		{"registry.internal:5000/team/app", "registry.internal:5000/team/", false},
+		{"Registry.Internal:5000/team/app", "registry.internal:5000/", false},
+		{"registry.internal:5000/team/app", "registry.internal:5000", false},
+		{"registry.internal:50001/team/app", "registry.internal:5000", true},
+		{"registry.internal:5000/team/app:v1", "registry.internal:5000/", true},
+		{"registry.internal:5000/team/app@sha256:abc", "registry.internal:5000/", true},
+		{"registry.internal:5000/Team/app", "registry.internal:5000/", true},
+		{"localhost:5000/app", "localhost:5000/", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseAndValidate([]byte(`{"image":"`+tt.image+`","tags":["dev"]}`), tt.prefix)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("image %q with prefix %q: expected error %v, got %v", tt.image, tt.prefix, tt.wantErr, err)
+		}
+	}
+
+	if _, err := ParseAndValidate([]byte(`{"image":"ghcr.io/test/app","tags":["dev:1"]}`), "ghcr.io/test/"); err == nil {
+		t.Error("expected error for invalid tag")
+	}
+}
+
+func TestParseAndValidate_Images(t *testing.T) {
+	evt, err := ParseAndValidate([]byte(`{"images":[{"image":"ghcr.io/test/app","tags":["dev","v1"]},{"image":"ghcr.io/test/migrate","tags":["dev"]}],"priority":"high"}`), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts := evt.Parts()
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if parts[1].Image != "ghcr.io/test/migrate" || !reflect.DeepEqual(parts[1].Tags, []string{"dev"}) || !parts[1].HighPriority() {
+		t.Errorf("unexpected second part %+v", parts[1])
+	}
+	want := []string{"ghcr.io/test/app:dev", "ghcr.io/test/app:v1", "ghcr.io/test/migrate:dev"}
+	if got := evt.ImageRefs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected refs %v, got %v", want, got)
+	}
+
+	single := &Event{Image: "ghcr.io/test/app", Tags: []string{"dev"}}
+	if parts := single.Parts(); len(parts) != 1 || parts[0] != single {
+		t.Errorf("expected a single-image event to be its only part, got %+v", parts)
+	}
+
+	invalid := []string{
+		`{"images":[]}`,
+		`{"image":"ghcr.io/test/app","tags":["dev"],"images":[{"image":"ghcr.io/test/migrate","tags":["dev"]}]}`,
+		`{"images":[{"image":"ghcr.io/test/app","tags":["dev"]},{"image":"ghcr.io/test/app","tags":["v1"]}]}`,
+		`{"images":[{"image":"ghcr.io/other/app","tags":["dev"]}]}`,
+		`{"images":[{"image":"ghcr.io/test/app","tags":[]}]}`,
+		`{"images":[{"image":"ghcr.io/test/app","tags":["dev"],"digest":"not-a-digest"}]}`,
+	}
+	for _, body := range invalid {
+		if _, err := ParseAndValidate([]byte(body), "ghcr.io/test/"); err == nil {
+			t.Errorf("expected error for %s", body)
+		}
+	}
+}
+
+func TestEvent_RequireDigest(t *testing.T) {
+	protected := []string{"prod", "latest", "release-*"}
+	digest := "sha256:" + strings.Repeat("b", 64)
+
+	tests := []struct {
+		name    string
+		evt     *Event
+		wantErr bool
+	}{
+		{"unprotected tag", &Event{Image: "ghcr.io/test/svc", Tags: []string{"dev"}}, false},
+		{"protected tag without digest", &Event{Image: "ghcr.io/test/svc", Tags: []string{"dev", "latest"}}, true},
+		{"protected glob without digest", &Event{Image: "ghcr.io/test/svc", Tags: []string{"release-1"}}, true},
+		{"protected tag with digest", &Event{Image: "ghcr.io/test/svc", Tags: []string{"prod"}, Digest: digest}, false},
+		{"protected tag of one image without digest", &Event{Images: []EventImage{
+			{Image: "ghcr.io/test/svc", Tags: []string{"prod"}, Digest: digest},
+			{Image: "ghcr.io/test/migrate", Tags: []string{"prod"}},
+		}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.evt.RequireDigest(protected)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RequireDigest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func BenchmarkParseAndValidate(b *testing.B) {
+	data := []byte(`{"image":"ghcr.io/test-org/myservice","tags":["dev","v1.0.0","latest"],"digest":"sha256:4bf92f3577b34da6a3ce929d0e0e47364bf92f3577b34da6a3ce929d0e0e4736"}`)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := ParseAndValidate(data, "ghcr.io/test-org/"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func FuzzParseAndValidate(f *testing.F) {
+	f.Add([]byte(`{"image":"ghcr.io/test/myservice","tags":["dev","latest"]}`))
+	f.Add([]byte(`{"image":"ghcr.io/test/myservice","tags":["v1"],"digest":"sha256:4bf92f3577b34da6a3ce929d0e0e47364bf92f3577b34da6a3ce929d0e0e4736","priority":"high"}`))
+	f.Add([]byte(`{"images":[{"image":"ghcr.io/test/a","tags":["dev"]},{"image":"ghcr.io/test/b","tags":["dev"]}]}`))
+	f.Add([]byte(`{"image":"ghcr.io/test/myservice","tags":["dev"]}}`))
+	f.Add([]byte(`{"image":"GHCR.io:443/test/x","tags":[""]}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		evt, err := ParseAndValidate(data, "ghcr.io/test/")
+		if err != nil {
+			return
+		}
+		// An accepted event survives the round trip to the worker
+		out, err := evt.ToJSON()
+		if err != nil {
+			t.Fatalf("accepted event cannot be encoded: %v", err)
+		}
+		if _, err := ParseAndValidate(out, "ghcr.io/test/"); err != nil {
+			t.Fatalf("re-encoded event %s rejected: %v", out, err)
+		}
+	})
+}
+
+func FuzzParseMessage(f *testing.F) {
+	f.Add([]byte(`{"type":"event","image":"ghcr.io/test/svc","tags":["dev"],"trigger":{"repository":"test-org/svc","actor":"octocat","run_id":"42"}}`))
+	f.Add([]byte(`{"type":"restart","restart":{"namespace":"dev","deployment":"svc","reason":"rotated secret"}}`))
+	f.Add([]byte(`{"type":"match_query","query":{"image":"ghcr.io/test/svc","tag":"dev","reply_to":"kuberollouttrigger:reply:1"}}`))
+	f.Add([]byte(`{"type":"pause","trigger":{"actor":"admin"}}`))
+	f.Add([]byte(`{"type":"log_level","log_level":"debug"}`))
+	f.Add([]byte(`{"image":"ghcr.io/test/svc","tags":["dev"],"namespaces":["team-[a"]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := ParseMessage(data, "ghcr.io/test/")
+		if err != nil {
+			return
+		}
+		out, err := msg.ToJSON()
+		if err != nil {
+			t.Fatalf("accepted message cannot be encoded: %v", err)
+		}
+		if _, err := ParseMessage(out, "ghcr.io/test/"); err != nil {
+			t.Fatalf("re-encoded message %s rejected: %v", out, err)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package payload
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/jsonschema"
+)
+
+// eventSchemaJSON is the JSON Schema of the event payload, served at
+// /schema/event.json for external tooling.
+//
+//go:embed event.schema.json
+var eventSchemaJSON []byte
+
+var eventSchema = jsonschema.MustCompile(eventSchemaJSON)
+
+// EventSchema returns the JSON Schema document of the event payload. The
+// caller must not modify it.
+func EventSchema() []byte {
+	return eventSchemaJSON
+}
+
+// ValidateEventSchema validates an event payload against the event JSON
+// Schema. It checks the same rules as ParseAndValidate except the allowed
+// image prefix and duplicate images, but reports the JSON Pointer of the
+// invalid value, as other schema validators do.
+func ValidateEventSchema(data []byte) error {
+	if err := eventSchema.Validate(data); err != nil {
+		return fmt.Errorf("payload does not match the event schema: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package payload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateEventSchema(t *testing.T) {
+	valid := []string{
+		`{"image":"ghcr.io/test/myservice","tags":["dev","v1.0.0"]}`,
+		`{"image":"registry.internal:5000/team/app","tags":["latest"],"digest":"sha256:4bf92f3577b34da6a3ce929d0e0e47364bf92f3577b34da6a3ce929d0e0e4736"}`,
+		`{"image":"my_org/app","tags":["dev"],"priority":"high"}`,
+		`{"images":[{"image":"ghcr.io/test/a","tags":["dev"]},{"image":"ghcr.io/test/b","tags":["dev"]}],"priority":"normal"}`,
+	}
+	for _, body := range valid {
+		if err := ValidateEventSchema([]byte(body)); err != nil {
+			t.Errorf("%s: unexpected error: %v", body, err)
+		}
+		// The schema accepts nothing ParseAndValidate rejects
+		if _, err := ParseAndValidate([]byte(body), ""); err != nil {
+			t.Errorf("%s: rejected by ParseAndValidate: %v", body, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`{}`:                                     "exactly one of",
+		`{"image":"ghcr.io/test/app"}`:           "exactly one of",
+		`{"image":"ghcr.io/test/app","tags":[]}`: "/tags: must have at least 1 items",
+		`{"image":"ghcr.io/test/app","tags":["dev",""]}`:                                                   "/tags/1:",
+		`{"image":"ghcr.io/test/app:v1","tags":["dev"]}`:                                                   "/image:",
+		`{"image":"app","tags":["dev"]}`:                                                                   "/image:",
+		`{"image":"ghcr.io/test/app","tags":["dev"],"digest":"md5:abc"}`:                                   "/digest:",
+		`{"image":"ghcr.io/test/app","tags":["dev"],"priority":"urgent"}`:                                  `/priority: must be one of "normal", "high"`,
+		`{"image":"ghcr.io/test/app","tags":["dev"],"trigger":{}}`:                                         `property "trigger" is not allowed`,
+		`{"image":"ghcr.io/test/app","tags":["dev"],"images":[{"image":"ghcr.io/test/b","tags":["dev"]}]}`: "exactly one of",
+		`{"images":[{"image":"ghcr.io/test/a","tags":["dev"],"priority":"high"}]}`:                         `/images/0: property "priority" is not allowed`,
+		`{"images":[]}`:         "/images: must have at least 1 items",
+		`{"image":1,"tags":[]}`: "/image: must be of type string",
+		`[]`:                    "must be of type object",
+		`{"image":`:             "invalid JSON",
+	}
+	for body, want := range invalid {
+		err := ValidateEventSchema([]byte(body))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", body, want, err)
+		}
+	}
+}
+
+func FuzzValidateEventSchema(f *testing.F) {
+	f.Add([]byte(`{"image":"ghcr.io/test/myservice","tags":["dev","latest"]}`))
+	f.Add([]byte(`{"images":[{"image":"ghcr.io/test/a","tags":["dev"],"digest":"sha256:4bf92f3577b34da6a3ce929d0e0e47364bf92f3577b34da6a3ce929d0e0e4736"}]}`))
+	f.Add([]byte(`{"image":"my_org/app","tags":["v1"],"priority":"high"}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if ValidateEventSchema(data) != nil {
+			return
+		}
+		// The schema is at least as strict as ParseAndValidate, apart from
+		// the image prefix and duplicate images it cannot express
+		if _, err := ParseAndValidate(data, ""); err != nil && !strings.Contains(err.Error(), "listed more than once") {
+			t.Fatalf("%s matches the schema but is rejected: %v", data, err)
+		}
+	})
+}
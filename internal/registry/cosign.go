@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// cosignSignatureAnnotation holds the base64 signature of a cosign signature layer.
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// ErrNoValidSignature is returned when no signature for a digest verifies
+// against any of the configured keys.
+var ErrNoValidSignature = errors.New("no valid cosign signature")
+
+// SignatureVerifier checks that an image digest has been signed with cosign
+// using one of a set of public keys.
+type SignatureVerifier struct {
+	client *Client
+	keys   []crypto.PublicKey
+	logger *slog.Logger
+}
+
+// ParsePublicKeys parses one or more PEM encoded PKIX public keys, as written
+// by `cosign generate-key-pair`.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public keys found")
+	}
+	return keys, nil
+}
+
+// NewSignatureVerifier creates a verifier that fetches signatures with client.
+func NewSignatureVerifier(client *Client, keys []crypto.PublicKey, logger *slog.Logger) *SignatureVerifier {
+	return &SignatureVerifier{
+		client: client,
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+// signatureTag returns the tag cosign stores signatures for digest under.
+func signatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// Verify checks that digest of image has at least one cosign signature that
+// verifies against a configured key and whose payload names the digest.
+func (v *SignatureVerifier) Verify(ctx context.Context, image, digest string) error {
+	raw, err := v.client.Manifest(ctx, image, signatureTag(digest))
+	if err != nil {
+		if errors.Is(err, ErrManifestNotFound) {
+			return fmt.Errorf("%s@%s: %w: image is not signed", image, digest, ErrNoValidSignature)
+		}
+		return fmt.Errorf("failed to fetch signatures for %s@%s: %w", image, digest, err)
+	}
+
+	var manifest struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return fmt.Errorf("failed to decode signature manifest for %s@%s: %w", image, digest, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		sig, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		payload, err := v.client.Blob(ctx, image, layer.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature payload for %s@%s: %w", image, digest, err)
+		}
+		if err := v.verifyLayer(payload, sig, digest); err != nil {
+			v.logger.Debug("cosign signature rejected", "image", image, "digest", digest, "layer", layer.Digest, "error", err)
+			continue
+		}
+		v.logger.Debug("cosign signature verified", "image", image, "digest", digest, "layer", layer.Digest)
+		return nil
+	}
+	return fmt.Errorf("%s@%s: %w", image, digest, ErrNoValidSignature)
+}
+
+// verifyLayer checks a single simple-signing payload and its signature.
+func (v *SignatureVerifier) verifyLayer(payload []byte, signature, digest string) error {
+	var simple struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simple); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+	if got := simple.Critical.Image.DockerManifestDigest; got != digest {
+		return fmt.Errorf("signature payload is for digest %q", got)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	hash := sha256.Sum256(payload)
+	for _, key := range v.keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, hash[:], sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig) == nil {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, payload, sig) {
+				return nil
+			}
+		}
+	}
+	return errors.New("signature does not match any configured key")
+}
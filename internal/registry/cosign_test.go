@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func publicKeyPEM(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// sign stores a cosign signature for digest in reg, signed by key over a
+// payload naming payloadDigest.
+func sign(t *testing.T, reg *fakeRegistry, key *ecdsa.PrivateKey, digest, payloadDigest string) {
+	t.Helper()
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"org/svc"},"image":{"docker-manifest-digest":"` + payloadDigest + `"},"type":"cosign container image signature"},"optional":null}`)
+	hash := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	layerDigest := reg.putBlob(payload)
+
+	manifest, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers": []map[string]any{{
+			"mediaType": "application/vnd.dev.cosign.simplesigning.v1+json",
+			"digest":    layerDigest,
+			"size":      len(payload),
+			"annotations": map[string]string{
+				cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+			},
+		}},
+	})
+	reg.putManifest(signatureTag(digest), manifest)
+}
+
+func newTestVerifier(t *testing.T, key *ecdsa.PrivateKey) *SignatureVerifier {
+	t.Helper()
+	keys, err := ParsePublicKeys(publicKeyPEM(t, key))
+	if err != nil {
+		t.Fatalf("failed to parse keys: %v", err)
+	}
+	return NewSignatureVerifier(newTestClient(), keys, testLogger())
+}
+
+func TestSignatureTag(t *testing.T) {
+	if got := signatureTag("sha256:abc"); got != "sha256-abc.sig" {
+		t.Errorf("unexpected tag %q", got)
+	}
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	data := append(publicKeyPEM(t, generateKey(t)), publicKeyPEM(t, generateKey(t))...)
+	keys, err := ParsePublicKeys(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected 2 keys, got %d", len(keys))
+	}
+
+	if _, err := ParsePublicKeys([]byte("not a key")); err == nil {
+		t.Error("expected error for input without PEM blocks")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	reg, srv := newFakeRegistry(t, "org/svc")
+	digest := reg.putManifest("dev", []byte(`{"schemaVersion":2}`))
+	key := generateKey(t)
+	sign(t, reg, key, digest, digest)
+
+	if err := newTestVerifier(t, key).Verify(context.Background(), image(srv, "org/svc"), digest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVerify_Rejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(reg *fakeRegistry, key *ecdsa.PrivateKey, digest string)
+	}{
+		{"unsigned", func(*fakeRegistry, *ecdsa.PrivateKey, string) {}},
+		{"wrong key", func(reg *fakeRegistry, _ *ecdsa.PrivateKey, digest string) {
+			sign(t, reg, generateKey(t), digest, digest)
+		}},
+		{"payload for another digest", func(reg *fakeRegistry, key *ecdsa.PrivateKey, digest string) {
+			sign(t, reg, key, digest, "sha256:0000000000000000000000000000000000000000000000000000000000000000")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, srv := newFakeRegistry(t, "org/svc")
+			digest := reg.putManifest("dev", []byte(`{"schemaVersion":2}`))
+			key := generateKey(t)
+			tt.setup(reg, key, digest)
+
+			err := newTestVerifier(t, key).Verify(context.Background(), image(srv, "org/svc"), digest)
+			if !errors.Is(err, ErrNoValidSignature) {
+				t.Fatalf("expected ErrNoValidSignature, got %v", err)
+			}
+		})
+	}
+}
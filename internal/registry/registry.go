@@ -0,0 +1,367 @@
+// Package registry is a minimal, dependency-free OCI distribution client used
+// by the worker to inspect pushed images before restarting Deployments.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrManifestNotFound is returned when the registry reports that a manifest
+// does not exist.
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// maxManifestSize bounds manifest and signature payload reads.
+const maxManifestSize = 4 << 20
+
+// maxWaitBackoff caps the delay between manifest polls in WaitForManifest.
+const maxWaitBackoff = 15 * time.Second
+
+// manifestMediaTypes are accepted when fetching or resolving manifests.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Options configures registry access.
+type Options struct {
+	// Username and Password are sent as basic credentials, either directly or
+	// to the registry's token endpoint. Both empty means anonymous access.
+	Username string
+	Password string
+	// Timeout bounds each HTTP request. Zero uses 30 seconds.
+	Timeout time.Duration
+	// Transport sends the HTTP requests, for example through a proxy. Nil
+	// uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Client talks to OCI distribution (v2) registries.
+type Client struct {
+	opts       Options
+	httpClient *http.Client
+	logger     *slog.Logger
+	// scheme is "https" except in tests against plain HTTP servers.
+	scheme string
+	// waitBackoff is the initial delay between manifest polls in WaitForManifest.
+	waitBackoff time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient creates a new registry client.
+func NewClient(opts Options, logger *slog.Logger) *Client {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &Client{
+		opts:        opts,
+		httpClient:  &http.Client{Timeout: timeout, Transport: opts.Transport},
+		logger:      logger,
+		scheme:      "https",
+		waitBackoff: time.Second,
+		tokens:      make(map[string]string),
+	}
+}
+
+// splitImage splits an image name without tag or digest into the registry
+// host and repository path, applying Docker Hub defaults.
+func splitImage(image string) (host, repo string) {
+	i := strings.IndexByte(image, '/')
+	if i < 0 {
+		return "registry-1.docker.io", "library/" + image
+	}
+	host, repo = image[:i], image[i+1:]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "registry-1.docker.io", image
+	}
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(repo, "/") {
+			repo = "library/" + repo
+		}
+	}
+	return host, repo
+}
+
+// Resolve returns the digest of the manifest that reference (a tag or digest)
+// points to for image. It returns an error wrapping ErrManifestNotFound if
+// the registry does not have it.
+func (c *Client) Resolve(ctx context.Context, image, reference string) (string, error) {
+	resp, err := c.do(ctx, http.MethodHead, image, "/manifests/"+reference, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if err := checkStatus(resp, image, reference); err != nil {
+		return "", err
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Not every registry returns the digest on HEAD; compute it from the body.
+	body, err := c.Manifest(ctx, image, reference)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// WaitForManifest resolves reference like Resolve, but while the registry
+// reports the manifest as missing it keeps polling with exponential backoff
+// until timeout elapses. This covers CI sending the event shortly before the
+// push or registry replication has finished. Other errors are returned
+// immediately.
+func (c *Client) WaitForManifest(ctx context.Context, image, reference string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := c.waitBackoff
+	for attempt := 1; ; attempt++ {
+		digest, err := c.Resolve(ctx, image, reference)
+		if err == nil || !errors.Is(err, ErrManifestNotFound) {
+			return digest, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return "", fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		c.logger.Debug("manifest not found yet, retrying",
+			"image", image,
+			"reference", reference,
+			"attempt", attempt,
+			"retry_in", min(backoff, remaining).String(),
+		)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(min(backoff, remaining)):
+		}
+		backoff = min(backoff*2, maxWaitBackoff)
+	}
+}
+
+// Manifest fetches the raw manifest that reference points to for image.
+func (c *Client) Manifest(ctx context.Context, image, reference string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, image, "/manifests/"+reference, manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, image, reference); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+}
+
+// PlatformDigests returns the digests of the per-platform manifests listed by
+// the image index or manifest list that reference points to for image. It
+// returns nil for a single-platform manifest. Multi-platform images are
+// usually tagged and announced by their index digest, while nodes pull and
+// report the digest of their own platform's manifest.
+func (c *Client) PlatformDigests(ctx context.Context, image, reference string) ([]string, error) {
+	body, err := c.Manifest(ctx, image, reference)
+	if err != nil {
+		return nil, err
+	}
+	var index struct {
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s@%s: %w", image, reference, err)
+	}
+	digests := make([]string, 0, len(index.Manifests))
+	for _, m := range index.Manifests {
+		if m.Digest != "" {
+			digests = append(digests, m.Digest)
+		}
+	}
+	if len(digests) == 0 {
+		return nil, nil
+	}
+	return digests, nil
+}
+
+// Blob fetches a blob by digest and verifies its content against the digest.
+func (c *Client) Blob(ctx context.Context, image, digest string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, image, "/blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, image, digest); err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", digest, err)
+	}
+	sum := sha256.Sum256(body)
+	if got := "sha256:" + hex.EncodeToString(sum[:]); got != digest {
+		return nil, fmt.Errorf("blob %s has digest %s", digest, got)
+	}
+	return body, nil
+}
+
+func checkStatus(resp *http.Response, image, reference string) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s@%s: %w", image, reference, ErrManifestNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("registry returned status %d for %s@%s", resp.StatusCode, image, reference)
+	}
+	return nil
+}
+
+// do sends a request to the repository of image, answering a single
+// authentication challenge if the registry requires one.
+func (c *Client) do(ctx context.Context, method, image, path string, accept []string) (*http.Response, error) {
+	host, repo := splitImage(image)
+	target := c.scheme + "://" + host + "/v2/" + repo + path
+
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build registry request: %w", err)
+		}
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("registry request to %s failed: %w", host, err)
+		}
+		return resp, nil
+	}
+
+	key := host + "/" + repo
+	c.mu.Lock()
+	authorization := c.tokens[key]
+	c.mu.Unlock()
+
+	resp, err := send(authorization)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	authorization, err = c.authenticate(ctx, challenge, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate to %s: %w", host, err)
+	}
+	c.mu.Lock()
+	c.tokens[key] = authorization
+	c.mu.Unlock()
+	return send(authorization)
+}
+
+// authenticate answers a WWW-Authenticate challenge and returns the value for
+// the Authorization header.
+func (c *Client) authenticate(ctx context.Context, challenge, repo string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.opts.Username == "" {
+			return "", errors.New("registry requires credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.opts.Username+":"+c.opts.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("bearer challenge has no realm")
+	}
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repo + ":pull"
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	if tok.Token == "" {
+		return "", errors.New("token endpoint returned an empty token")
+	}
+	return "Bearer " + tok.Token, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// `Bearer realm="https://ghcr.io/token",service="ghcr.io"`.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[key] = strings.TrimSpace(value)
+		}
+	}
+	return scheme, params
+}
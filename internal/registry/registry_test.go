@@ -0,0 +1,254 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fakeRegistry serves manifests and blobs for a single repository behind a
+// bearer token challenge.
+type fakeRegistry struct {
+	t    *testing.T
+	repo string
+
+	mu        sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	requests  int
+}
+
+func newFakeRegistry(t *testing.T, repo string) (*fakeRegistry, *httptest.Server) {
+	r := &fakeRegistry{
+		t:         t,
+		repo:      repo,
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+// image returns the image name for the fake repository on srv.
+func image(srv *httptest.Server, repo string) string {
+	return strings.TrimPrefix(srv.URL, "http://") + "/" + repo
+}
+
+func (r *fakeRegistry) putManifest(tag string, body []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digest := digestOf(body)
+	r.manifests[tag] = body
+	r.manifests[digest] = body
+	return digest
+}
+
+func (r *fakeRegistry) putBlob(body []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digest := digestOf(body)
+	r.blobs[digest] = body
+	return digest
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests++
+	r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		if req.URL.Query().Get("scope") != "repository:"+r.repo+":pull" {
+			r.t.Errorf("unexpected token scope %q", req.URL.Query().Get("scope"))
+		}
+		w.Write([]byte(`{"token":"test-token"}`))
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer test-token" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+req.Host+`/token",service="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/" + r.repo + "/"
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		http.NotFound(w, req)
+		return
+	}
+	kind, ref, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, prefix), "/")
+
+	r.mu.Lock()
+	var body []byte
+	var ok bool
+	switch kind {
+	case "manifests":
+		body, ok = r.manifests[ref]
+	case "blobs":
+		body, ok = r.blobs[ref]
+	}
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digestOf(body))
+	if req.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+func newTestClient() *Client {
+	c := NewClient(Options{}, testLogger())
+	c.scheme = "http"
+	return c
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, host, repo string
+	}{
+		{"ghcr.io/org/svc", "ghcr.io", "org/svc"},
+		{"localhost:5000/svc", "localhost:5000", "svc"},
+		{"nginx", "registry-1.docker.io", "library/nginx"},
+		{"org/svc", "registry-1.docker.io", "org/svc"},
+		{"docker.io/nginx", "registry-1.docker.io", "library/nginx"},
+	}
+	for _, tt := range tests {
+		host, repo := splitImage(tt.image)
+		if host != tt.host || repo != tt.repo {
+			t.Errorf("splitImage(%q) = %q, %q; want %q, %q", tt.image, host, repo, tt.host, tt.repo)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:org/svc:pull"`)
+	if scheme != "Bearer" {
+		t.Errorf("unexpected scheme %q", scheme)
+	}
+	if params["realm"] != "https://ghcr.io/token" || params["service"] != "ghcr.io" || params["scope"] != "repository:org/svc:pull" {
+		t.Errorf("unexpected params %v", params)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	reg, srv := newFakeRegistry(t, "org/svc")
+	want := reg.putManifest("dev", []byte(`{"schemaVersion":2}`))
+
+	c := newTestClient()
+	got, err := c.Resolve(context.Background(), image(srv, "org/svc"), "dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// The token is cached, so a second lookup does not re-authenticate
+	before := reg.requests
+	if _, err := c.Resolve(context.Background(), image(srv, "org/svc"), "dev"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg.requests-before != 1 {
+		t.Errorf("expected cached token to be reused, got %d requests", reg.requests-before)
+	}
+}
+
+func TestPlatformDigests(t *testing.T) {
+	reg, srv := newFakeRegistry(t, "org/svc")
+	amd64 := reg.putManifest("amd64", []byte(`{"schemaVersion":2,"config":{"digest":"sha256:aa"}}`))
+	arm64 := reg.putManifest("arm64", []byte(`{"schemaVersion":2,"config":{"digest":"sha256:bb"}}`))
+	index := reg.putManifest("dev", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[`+
+		`{"digest":"`+amd64+`","platform":{"architecture":"amd64","os":"linux"}},`+
+		`{"digest":"`+arm64+`","platform":{"architecture":"arm64","os":"linux"}}]}`))
+
+	c := newTestClient()
+	got, err := c.PlatformDigests(context.Background(), image(srv, "org/svc"), index)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0] != amd64 || got[1] != arm64 {
+		t.Errorf("unexpected platform digests %v", got)
+	}
+
+	got, err = c.PlatformDigests(context.Background(), image(srv, "org/svc"), "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected no platform digests for a single-platform manifest, got %v", got)
+	}
+}
+
+func TestResolve_NotFound(t *testing.T) {
+	_, srv := newFakeRegistry(t, "org/svc")
+
+	_, err := newTestClient().Resolve(context.Background(), image(srv, "org/svc"), "missing")
+	if !errors.Is(err, ErrManifestNotFound) {
+		t.Fatalf("expected ErrManifestNotFound, got %v", err)
+	}
+}
+
+func TestBlob_DigestMismatch(t *testing.T) {
+	reg, srv := newFakeRegistry(t, "org/svc")
+	digest := reg.putBlob([]byte("original"))
+	reg.blobs[digest] = []byte("tampered")
+
+	if _, err := newTestClient().Blob(context.Background(), image(srv, "org/svc"), digest); err == nil {
+		t.Fatal("expected error for tampered blob")
+	}
+}
+
+func TestWaitForManifest(t *testing.T) {
+	reg, srv := newFakeRegistry(t, "org/svc")
+	c := newTestClient()
+	c.waitBackoff = 10 * time.Millisecond
+
+	// The tag appears shortly after the event arrives
+	timer := time.AfterFunc(30*time.Millisecond, func() {
+		reg.putManifest("dev", []byte(`{"schemaVersion":2}`))
+	})
+	defer timer.Stop()
+
+	digest, err := c.WaitForManifest(context.Background(), image(srv, "org/svc"), "dev", 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if digest != digestOf([]byte(`{"schemaVersion":2}`)) {
+		t.Errorf("unexpected digest %s", digest)
+	}
+}
+
+func TestWaitForManifest_Timeout(t *testing.T) {
+	_, srv := newFakeRegistry(t, "org/svc")
+	c := newTestClient()
+	c.waitBackoff = 10 * time.Millisecond
+
+	start := time.Now()
+	_, err := c.WaitForManifest(context.Background(), image(srv, "org/svc"), "dev", 50*time.Millisecond)
+	if !errors.Is(err, ErrManifestNotFound) {
+		t.Fatalf("expected ErrManifestNotFound, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected to wait for the timeout, returned after %s", elapsed)
+	}
+}
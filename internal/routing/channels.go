@@ -0,0 +1,104 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/imageref"
+)
+
+// ChannelRule sends events for matching images and tags to a Valkey channel,
+// so separate workers can own separate registries or environments.
+type ChannelRule struct {
+	// ImagePrefix is matched against the start of the event image. Empty matches every image.
+	ImagePrefix string `json:"image_prefix,omitempty"`
+
+	// Tags are glob patterns (path.Match syntax) matched against each event tag.
+	// Empty matches every tag.
+	Tags []string `json:"tags,omitempty"`
+
+	// Channel is the Valkey channel matching events are published to.
+	Channel string `json:"channel"`
+}
+
+// ChannelTable is an ordered list of channel rules; the first rule matching an
+// image and tag wins.
+type ChannelTable struct {
+	rules []ChannelRule
+}
+
+// ParseChannels parses a JSON array of channel rules. An empty spec returns an
+// empty table that sends every event to the default channel.
+func ParseChannels(spec string) (*ChannelTable, error) {
+	if spec == "" {
+		return &ChannelTable{}, nil
+	}
+
+	var rules []ChannelRule
+	if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+		return nil, fmt.Errorf("invalid channel routes: %w", err)
+	}
+
+	for i, r := range rules {
+		if r.Channel == "" {
+			return nil, fmt.Errorf("invalid channel routes: rule %d has no channel", i)
+		}
+		if r.ImagePrefix == "" && len(r.Tags) == 0 {
+			return nil, fmt.Errorf("invalid channel routes: rule %d needs an image_prefix or tags", i)
+		}
+		for _, pattern := range r.Tags {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid channel routes: rule %d pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+
+	return &ChannelTable{rules: rules}, nil
+}
+
+// Len returns the number of rules in the table.
+func (t *ChannelTable) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rules)
+}
+
+// Channel returns the channel for an event tag of image, or defaultChannel if
+// no rule matches.
+func (t *ChannelTable) Channel(image, tag, defaultChannel string) string {
+	if t == nil {
+		return defaultChannel
+	}
+	for _, r := range t.rules {
+		if !imageref.HasPrefix(image, r.ImagePrefix) {
+			continue
+		}
+		if len(r.Tags) == 0 {
+			return r.Channel
+		}
+		for _, pattern := range r.Tags {
+			if ok, _ := path.Match(pattern, tag); ok {
+				return r.Channel
+			}
+		}
+	}
+	return defaultChannel
+}
+
+// Channels returns the distinct channels named by the rules, in rule order.
+func (t *ChannelTable) Channels() []string {
+	if t == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var channels []string
+	for _, r := range t.rules {
+		if !seen[r.Channel] {
+			seen[r.Channel] = true
+			channels = append(channels, r.Channel)
+		}
+	}
+	return channels
+}
@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testChannelRoutes = `[
+	{"image_prefix": "ghcr.io/org/infra/", "channel": "krt-infra"},
+	{"tags": ["prod", "release-*"], "channel": "krt-prod"},
+	{"image_prefix": "ghcr.io/org/", "tags": ["dev"], "channel": "krt-dev"}
+]`
+
+func TestParseChannels_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"not json", "krt-prod"},
+		{"missing channel", `[{"tags":["prod"]}]`},
+		{"no match criteria", `[{"channel":"krt-prod"}]`},
+		{"bad tag pattern", `[{"tags":["[prod"],"channel":"krt-prod"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseChannels(tt.spec); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestChannelTable_Channel(t *testing.T) {
+	table, err := ParseChannels(testChannelRoutes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		image string
+		tag   string
+		want  string
+	}{
+		{"ghcr.io/org/infra/dns", "prod", "krt-infra"},
+		{"ghcr.io/org/app", "prod", "krt-prod"},
+		{"ghcr.io/org/app", "release-1.2", "krt-prod"},
+		{"ghcr.io/org/app", "dev", "krt-dev"},
+		{"ghcr.io/org/app", "staging", "default"},
+	}
+	for _, tt := range tests {
+		if got := table.Channel(tt.image, tt.tag, "default"); got != tt.want {
+			t.Errorf("Channel(%q, %q) = %q, want %q", tt.image, tt.tag, got, tt.want)
+		}
+	}
+
+	if got := table.Channels(); !reflect.DeepEqual(got, []string{"krt-infra", "krt-prod", "krt-dev"}) {
+		t.Errorf("unexpected channels %v", got)
+	}
+}
+
+func TestChannelTable_Empty(t *testing.T) {
+	table, err := ParseChannels("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table.Len() != 0 || table.Channels() != nil {
+		t.Errorf("expected empty table, got %d rules", table.Len())
+	}
+	if got := table.Channel("ghcr.io/org/app", "dev", "default"); got != "default" {
+		t.Errorf("expected default channel, got %q", got)
+	}
+
+	var nilTable *ChannelTable
+	if got := nilTable.Channel("ghcr.io/org/app", "dev", "default"); got != "default" {
+		t.Errorf("expected default channel for nil table, got %q", got)
+	}
+}
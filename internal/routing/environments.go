@@ -0,0 +1,88 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// EnvironmentRule maps a GitHub deployment environment to the image tag it
+// rolls out and the namespaces it may restart workloads in.
+type EnvironmentRule struct {
+	// Environment is the GitHub environment name, compared case-insensitively
+	// as GitHub does.
+	Environment string `json:"environment"`
+
+	// Tag is the image tag restarted for deployments to the environment.
+	Tag string `json:"tag"`
+
+	// Namespaces are glob patterns (path.Match syntax) for the namespaces the
+	// deployment may restart workloads in.
+	Namespaces []string `json:"namespaces"`
+}
+
+// EnvironmentTable maps GitHub deployment environments to rollouts.
+type EnvironmentTable struct {
+	rules []EnvironmentRule
+}
+
+// ParseEnvironments parses a JSON array of environment rules. An empty spec
+// returns an empty table that maps no environment.
+func ParseEnvironments(spec string) (*EnvironmentTable, error) {
+	if spec == "" {
+		return &EnvironmentTable{}, nil
+	}
+
+	var rules []EnvironmentRule
+	if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+		return nil, fmt.Errorf("invalid deployment environment routes: %w", err)
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		if r.Environment == "" {
+			return nil, fmt.Errorf("invalid deployment environment routes: rule %d has no environment", i)
+		}
+		name := strings.ToLower(r.Environment)
+		if seen[name] {
+			return nil, fmt.Errorf("invalid deployment environment routes: environment %q is mapped twice", r.Environment)
+		}
+		seen[name] = true
+		if r.Tag == "" {
+			return nil, fmt.Errorf("invalid deployment environment routes: rule %d has no tag", i)
+		}
+		// A deployment must never restart workloads in every namespace by omission
+		if len(r.Namespaces) == 0 {
+			return nil, fmt.Errorf("invalid deployment environment routes: rule %d has no namespaces", i)
+		}
+		for _, pattern := range r.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid deployment environment routes: rule %d pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+
+	return &EnvironmentTable{rules: rules}, nil
+}
+
+// Len returns the number of rules in the table.
+func (t *EnvironmentTable) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rules)
+}
+
+// Lookup returns the rule for environment, or nil if it is not mapped.
+func (t *EnvironmentTable) Lookup(environment string) *EnvironmentRule {
+	if t == nil {
+		return nil
+	}
+	for i := range t.rules {
+		if strings.EqualFold(t.rules[i].Environment, environment) {
+			return &t.rules[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testEnvironmentRoutes = `[
+	{"environment": "production", "tag": "prod", "namespaces": ["prod-*"]},
+	{"environment": "staging", "tag": "staging", "namespaces": ["staging"]}
+]`
+
+func TestParseEnvironments_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"not json", "production=prod"},
+		{"missing environment", `[{"tag":"prod","namespaces":["prod"]}]`},
+		{"missing tag", `[{"environment":"production","namespaces":["prod"]}]`},
+		{"missing namespaces", `[{"environment":"production","tag":"prod"}]`},
+		{"bad namespace pattern", `[{"environment":"production","tag":"prod","namespaces":["[prod"]}]`},
+		{"duplicate environment", `[{"environment":"production","tag":"prod","namespaces":["prod"]},{"environment":"Production","tag":"prod","namespaces":["prod"]}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseEnvironments(tt.spec); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestEnvironmentTable_Lookup(t *testing.T) {
+	table, err := ParseEnvironments(testEnvironmentRoutes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("expected 2 rules, got %d", table.Len())
+	}
+
+	rule := table.Lookup("Production")
+	if rule == nil || rule.Tag != "prod" || !reflect.DeepEqual(rule.Namespaces, []string{"prod-*"}) {
+		t.Errorf("unexpected rule for Production: %+v", rule)
+	}
+	if rule := table.Lookup("preview"); rule != nil {
+		t.Errorf("expected no rule for an unmapped environment, got %+v", rule)
+	}
+
+	var nilTable *EnvironmentTable
+	if nilTable.Len() != 0 || nilTable.Lookup("production") != nil {
+		t.Error("expected a nil table to map nothing")
+	}
+}
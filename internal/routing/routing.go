@@ -0,0 +1,117 @@
+// Package routing maps image tags to the Kubernetes namespaces and Deployment
+// labels they are allowed to restart, so that a push of :dev can never restart
+// a production workload that happens to reference the same image reference.
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Rule restricts which Deployments may be restarted for matching tags.
+type Rule struct {
+	// Tags are glob patterns (path.Match syntax) matched against the event tag.
+	Tags []string `json:"tags"`
+
+	// Namespaces are glob patterns for allowed namespaces. Empty allows all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Selector is a Kubernetes label selector the Deployment must match. Empty matches all.
+	Selector string `json:"selector,omitempty"`
+
+	selector labels.Selector
+}
+
+// Table is an ordered list of rules; the first rule whose tag pattern matches wins.
+type Table struct {
+	rules []Rule
+}
+
+// Parse parses a JSON array of rules. An empty spec returns an empty table
+// that allows everything.
+func Parse(spec string) (*Table, error) {
+	if spec == "" {
+		return &Table{}, nil
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+		return nil, fmt.Errorf("invalid tag routes: %w", err)
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		if len(r.Tags) == 0 {
+			return nil, fmt.Errorf("invalid tag routes: rule %d has no tags", i)
+		}
+		for _, pattern := range append(append([]string{}, r.Tags...), r.Namespaces...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid tag routes: rule %d pattern %q: %w", i, pattern, err)
+			}
+		}
+		selector, err := labels.Parse(r.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag routes: rule %d selector %q: %w", i, r.Selector, err)
+		}
+		r.selector = selector
+	}
+
+	return &Table{rules: rules}, nil
+}
+
+// Len returns the number of rules in the table.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rules)
+}
+
+// Route returns the first rule matching tag, or nil if no rule applies and the
+// tag is unrestricted.
+func (t *Table) Route(tag string) *Rule {
+	if t == nil {
+		return nil
+	}
+	for i := range t.rules {
+		for _, pattern := range t.rules[i].Tags {
+			if ok, _ := path.Match(pattern, tag); ok {
+				return &t.rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether a Deployment in namespace with the given labels may
+// be restarted under this rule. A nil rule allows everything.
+func (r *Rule) Allows(namespace string, deploymentLabels map[string]string) bool {
+	return r.Explain(namespace, deploymentLabels) == ""
+}
+
+// Explain returns why a Deployment in namespace with the given labels is not
+// allowed under this rule, or an empty string if it is allowed.
+func (r *Rule) Explain(namespace string, deploymentLabels map[string]string) string {
+	if r == nil {
+		return ""
+	}
+	if len(r.Namespaces) > 0 {
+		allowed := false
+		for _, pattern := range r.Namespaces {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("namespace %q does not match %v", namespace, r.Namespaces)
+		}
+	}
+	if r.selector != nil && !r.selector.Matches(labels.Set(deploymentLabels)) {
+		return fmt.Sprintf("labels do not match selector %q", r.Selector)
+	}
+	return ""
+}
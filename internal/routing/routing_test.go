@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRoutes = `[
+	{"tags": ["dev"], "namespaces": ["dev", "dev-*"]},
+	{"tags": ["staging"], "namespaces": ["staging"]},
+	{"tags": ["prod-*"], "selector": "env=prod"}
+]`
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"not json", "dev=dev"},
+		{"missing tags", `[{"namespaces":["dev"]}]`},
+		{"bad tag pattern", `[{"tags":["[dev"]}]`},
+		{"bad namespace pattern", `[{"tags":["dev"],"namespaces":["[dev"]}]`},
+		{"bad selector", `[{"tags":["dev"],"selector":"env in (prod"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.spec); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	table, err := Parse("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table.Len() != 0 {
+		t.Errorf("expected empty table, got %d rules", table.Len())
+	}
+	if table.Route("dev") != nil {
+		t.Error("expected no route from empty table")
+	}
+}
+
+func TestTable_RouteAndAllows(t *testing.T) {
+	table, err := Parse(testRoutes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		tag       string
+		namespace string
+		labels    map[string]string
+		allowed   bool
+	}{
+		{"dev in dev", "dev", "dev", nil, true},
+		{"dev in dev glob", "dev", "dev-team-a", nil, true},
+		{"dev in prod", "dev", "prod", nil, false},
+		{"staging in staging", "staging", "staging", nil, true},
+		{"staging in dev", "staging", "dev", nil, false},
+		{"prod tag with prod label", "prod-eu", "any", map[string]string{"env": "prod"}, true},
+		{"prod tag without label", "prod-eu", "any", map[string]string{"env": "dev"}, false},
+		{"unrouted tag", "v1.2.3", "anywhere", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := table.Route(tt.tag)
+			if got := rule.Allows(tt.namespace, tt.labels); got != tt.allowed {
+				t.Errorf("Allows(%q, %v) for tag %q = %v, want %v", tt.namespace, tt.labels, tt.tag, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestTable_FirstMatchWins(t *testing.T) {
+	table, err := Parse(`[{"tags":["dev"],"namespaces":["a"]},{"tags":["*"],"namespaces":["b"]}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !table.Route("dev").Allows("a", nil) {
+		t.Error("expected first rule to apply to dev")
+	}
+	if !table.Route("other").Allows("b", nil) || table.Route("other").Allows("a", nil) {
+		t.Error("expected catch-all rule to apply to other tags")
+	}
+}
+
+func TestRule_Explain(t *testing.T) {
+	table, err := Parse(testRoutes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reason := table.Route("dev").Explain("prod", nil); !strings.Contains(reason, `namespace "prod"`) {
+		t.Errorf("unexpected namespace reason %q", reason)
+	}
+	if reason := table.Route("prod-eu").Explain("any", map[string]string{"env": "dev"}); !strings.Contains(reason, "selector") {
+		t.Errorf("unexpected selector reason %q", reason)
+	}
+	if reason := table.Route("dev").Explain("dev", nil); reason != "" {
+		t.Errorf("expected no reason for allowed deployment, got %q", reason)
+	}
+}
@@ -0,0 +1,89 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SubscriptionRule restricts which Deployments may be restarted for events
+// received on matching channels, so one worker can consume the channels of
+// several environments without one restarting the workloads of another.
+type SubscriptionRule struct {
+	// Channel is a glob pattern (path.Match syntax) matched against the
+	// channel the event was published to.
+	Channel string `json:"channel"`
+
+	// Namespaces are glob patterns for allowed namespaces. Empty allows all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Selector is a Kubernetes label selector the Deployment must match. Empty matches all.
+	Selector string `json:"selector,omitempty"`
+}
+
+// SubscriptionTable is an ordered list of subscription rules; the first rule
+// whose channel pattern matches wins.
+type SubscriptionTable struct {
+	rules []SubscriptionRule
+	// restrictions holds the namespaces and selector of each rule.
+	restrictions []Rule
+}
+
+// ParseSubscriptions parses a JSON array of subscription rules. An empty spec
+// returns an empty table that allows everything.
+func ParseSubscriptions(spec string) (*SubscriptionTable, error) {
+	if spec == "" {
+		return &SubscriptionTable{}, nil
+	}
+
+	var rules []SubscriptionRule
+	if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+		return nil, fmt.Errorf("invalid channel rules: %w", err)
+	}
+
+	restrictions := make([]Rule, len(rules))
+	for i, r := range rules {
+		if r.Channel == "" {
+			return nil, fmt.Errorf("invalid channel rules: rule %d has no channel", i)
+		}
+		if len(r.Namespaces) == 0 && r.Selector == "" {
+			return nil, fmt.Errorf("invalid channel rules: rule %d needs namespaces or a selector", i)
+		}
+		for _, pattern := range append([]string{r.Channel}, r.Namespaces...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid channel rules: rule %d pattern %q: %w", i, pattern, err)
+			}
+		}
+		selector, err := labels.Parse(r.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel rules: rule %d selector %q: %w", i, r.Selector, err)
+		}
+		restrictions[i] = Rule{Namespaces: r.Namespaces, Selector: r.Selector, selector: selector}
+	}
+
+	return &SubscriptionTable{rules: rules, restrictions: restrictions}, nil
+}
+
+// Len returns the number of rules in the table.
+func (t *SubscriptionTable) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.rules)
+}
+
+// Route returns the restriction of the first rule matching channel, or nil
+// if no rule applies and events on the channel are unrestricted.
+func (t *SubscriptionTable) Route(channel string) *Rule {
+	if t == nil {
+		return nil
+	}
+	for i := range t.rules {
+		if ok, _ := path.Match(t.rules[i].Channel, channel); ok {
+			return &t.restrictions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package routing
+
+import "testing"
+
+func TestParseSubscriptions_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"not json", "kuberollouttrigger.prod=prod"},
+		{"missing channel", `[{"namespaces":["prod"]}]`},
+		{"no restriction", `[{"channel":"kuberollouttrigger.prod"}]`},
+		{"bad channel pattern", `[{"channel":"[prod","namespaces":["prod"]}]`},
+		{"bad selector", `[{"channel":"kuberollouttrigger.prod","selector":"=="}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSubscriptions(tt.spec); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestSubscriptionTable_Route(t *testing.T) {
+	table, err := ParseSubscriptions(`[
+		{"channel": "kuberollouttrigger.prod", "namespaces": ["prod-*"]},
+		{"channel": "kuberollouttrigger.*", "selector": "environment!=production"}
+	]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("expected 2 rules, got %d", table.Len())
+	}
+
+	prod := table.Route("kuberollouttrigger.prod")
+	if !prod.Allows("prod-api", nil) || prod.Allows("dev", nil) {
+		t.Error("expected prod events to be restricted to prod-* namespaces")
+	}
+	dev := table.Route("kuberollouttrigger.dev")
+	if !dev.Allows("dev", map[string]string{"environment": "dev"}) || dev.Allows("dev", map[string]string{"environment": "production"}) {
+		t.Error("expected dev events to be restricted by the selector")
+	}
+	if rule := table.Route("kuberollouttrigger"); rule != nil {
+		t.Errorf("expected an unmatched channel to be unrestricted, got %+v", rule)
+	}
+
+	var nilTable *SubscriptionTable
+	if nilTable.Len() != 0 || nilTable.Route("kuberollouttrigger.prod") != nil {
+		t.Error("expected a nil table to restrict nothing")
+	}
+}
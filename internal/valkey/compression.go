@@ -0,0 +1,50 @@
+package valkey
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream. JSON messages never start with it, so
+// it marks a compressed message without a separate envelope.
+const gzipMagic = "\x1f\x8b"
+
+// maxDecompressedSize bounds a decompressed message so a small compressed
+// message cannot exhaust the worker's memory.
+const maxDecompressedSize = 16 << 20 // 16MB
+
+// compress gzips message.
+func compress(message string) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, message); err != nil {
+		return "", fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress message: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// decodeMessage returns message, decompressed if it is gzipped.
+func decodeMessage(message string) (string, error) {
+	if !strings.HasPrefix(message, gzipMagic) {
+		return message, nil
+	}
+	zr, err := gzip.NewReader(strings.NewReader(message))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress message: %w", err)
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress message: %w", err)
+	}
+	if len(data) > maxDecompressedSize {
+		return "", fmt.Errorf("decompressed message exceeds %d bytes", maxDecompressedSize)
+	}
+	return string(data), nil
+}
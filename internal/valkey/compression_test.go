@@ -0,0 +1,47 @@
+package valkey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	message := `{"image":"ghcr.io/test/svc","tags":["` + strings.Repeat("v1.2.3-", 200) + `"]}`
+	compressed, err := compress(message)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(compressed, gzipMagic) || len(compressed) >= len(message) {
+		t.Errorf("expected a smaller gzip message, got %d bytes from %d", len(compressed), len(message))
+	}
+
+	decoded, err := decodeMessage(compressed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded != message {
+		t.Error("decoded message does not match the original")
+	}
+}
+
+func TestDecodeMessage_PlainJSON(t *testing.T) {
+	message := `{"image":"ghcr.io/test/svc","tags":["dev"]}`
+	decoded, err := decodeMessage(message)
+	if err != nil || decoded != message {
+		t.Errorf("expected plain message unchanged, got %q, %v", decoded, err)
+	}
+}
+
+func TestDecodeMessage_Invalid(t *testing.T) {
+	if _, err := decodeMessage(gzipMagic + "not gzip"); err == nil {
+		t.Error("expected error for corrupt gzip data")
+	}
+
+	bomb, err := compress(strings.Repeat("a", maxDecompressedSize+1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := decodeMessage(bomb); err == nil {
+		t.Error("expected error for a message exceeding the decompressed size limit")
+	}
+}
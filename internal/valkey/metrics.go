@@ -0,0 +1,82 @@
+package valkey
+
+import (
+	"github.com/redis/go-redis/v9"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+)
+
+// Connection pool metrics of the Valkey clients, labeled by client
+// (publisher or subscriber). They are read from the go-redis pool stats on
+// every scrape.
+var (
+	poolHits = metrics.NewCounterFuncVec(
+		"kuberollouttrigger_valkey_pool_hits_total",
+		"Valkey commands that found an idle connection in the pool.",
+		"client",
+	)
+	poolMisses = metrics.NewCounterFuncVec(
+		"kuberollouttrigger_valkey_pool_misses_total",
+		"Valkey commands that found no idle connection in the pool and had to open or wait for one.",
+		"client",
+	)
+	poolTimeouts = metrics.NewCounterFuncVec(
+		"kuberollouttrigger_valkey_pool_timeouts_total",
+		"Valkey commands that failed waiting for a pool connection, a sign of pool exhaustion.",
+		"client",
+	)
+	poolStaleConns = metrics.NewCounterFuncVec(
+		"kuberollouttrigger_valkey_pool_stale_connections_total",
+		"Idle Valkey connections removed from the pool because they were stale.",
+		"client",
+	)
+	poolConns = metrics.NewGaugeFuncVec(
+		"kuberollouttrigger_valkey_pool_connections",
+		"Open Valkey connections in the pool.",
+		"client",
+	)
+	poolIdleConns = metrics.NewGaugeFuncVec(
+		"kuberollouttrigger_valkey_pool_idle_connections",
+		"Idle Valkey connections in the pool.",
+		"client",
+	)
+	pubSubConns = metrics.NewGaugeFuncVec(
+		"kuberollouttrigger_valkey_pubsub_connections",
+		"Open Valkey PubSub connections, which are not part of the pool.",
+		"client",
+	)
+)
+
+// Liveness metrics of the Valkey publisher, updated by Publisher.KeepAlive.
+var (
+	connected = metrics.NewGaugeVec(
+		"kuberollouttrigger_valkey_connected",
+		"1 while the last liveness ping to Valkey succeeded, 0 after it failed.",
+		"client",
+	)
+	pingFailures = metrics.NewCounterVec(
+		"kuberollouttrigger_valkey_ping_failures_total",
+		"Liveness pings to Valkey that failed.",
+		"client",
+	)
+	reconnects = metrics.NewCounterVec(
+		"kuberollouttrigger_valkey_reconnects_total",
+		"Times a liveness ping to Valkey succeeded again after failing.",
+		"client",
+	)
+)
+
+// exportPoolStats exports the pool stats of c as the metrics of client,
+// replacing the client previously exported under that name.
+func exportPoolStats(client string, c *redis.Client) {
+	stat := func(read func(*redis.PoolStats) uint32) func() float64 {
+		return func() float64 { return float64(read(c.PoolStats())) }
+	}
+	poolHits.Set(stat(func(s *redis.PoolStats) uint32 { return s.Hits }), client)
+	poolMisses.Set(stat(func(s *redis.PoolStats) uint32 { return s.Misses }), client)
+	poolTimeouts.Set(stat(func(s *redis.PoolStats) uint32 { return s.Timeouts }), client)
+	poolStaleConns.Set(stat(func(s *redis.PoolStats) uint32 { return s.StaleConns }), client)
+	poolConns.Set(stat(func(s *redis.PoolStats) uint32 { return s.TotalConns }), client)
+	poolIdleConns.Set(stat(func(s *redis.PoolStats) uint32 { return s.IdleConns }), client)
+	pubSubConns.Set(stat(func(s *redis.PoolStats) uint32 { return s.PubSubStats.Active }), client)
+}
@@ -0,0 +1,35 @@
+package valkey
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+)
+
+func TestExportPoolStats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// No connection is opened until the first command
+	p := NewPublisher(&redis.Options{Addr: "127.0.0.1:0"}, "test", logger)
+	defer p.Close()
+	s := NewSubscriber(&redis.Options{Addr: "127.0.0.1:0"}, "test", logger, SubscriberOptions{})
+	defer s.Close()
+
+	var buf bytes.Buffer
+	metrics.Default.Write(&buf)
+	for _, want := range []string{
+		`kuberollouttrigger_valkey_pool_hits_total{client="publisher"} 0`,
+		`kuberollouttrigger_valkey_pool_timeouts_total{client="subscriber"} 0`,
+		`kuberollouttrigger_valkey_pool_connections{client="publisher"} 0`,
+		`kuberollouttrigger_valkey_pubsub_connections{client="subscriber"} 0`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected %q in metrics output", want)
+		}
+	}
+}
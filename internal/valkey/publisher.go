@@ -2,10 +2,16 @@ package valkey
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
 )
 
 // Publisher publishes messages to a Valkey PubSub channel.
@@ -13,32 +19,208 @@ type Publisher struct {
 	client  *redis.Client
 	channel string
 	logger  *slog.Logger
+
+	// compressMinSize is the message size from which messages are gzipped.
+	// Zero disables compression.
+	compressMinSize int
+
+	// faults injects simulated publish failures in dev mode.
+	faults *fault.Injector
+
+	// pingErr holds the error of the last KeepAlive ping, nil if it
+	// succeeded or KeepAlive has not run.
+	mu      sync.Mutex
+	pingErr error
 }
 
-// NewPublisher creates a new Valkey publisher.
+// NewPublisher creates a new Valkey publisher. Its connection pool stats are
+// exported as metrics with the client label publisher.
 func NewPublisher(opts *redis.Options, channel string, logger *slog.Logger) *Publisher {
+	client := redis.NewClient(opts)
+	exportPoolStats("publisher", client)
 	return &Publisher{
-		client:  redis.NewClient(opts),
+		client:  client,
 		channel: channel,
 		logger:  logger,
 	}
 }
 
-// Publish publishes a message to the configured channel.
-func (p *Publisher) Publish(ctx context.Context, message string) error {
-	result := p.client.Publish(ctx, p.channel, message)
-	if result.Err() != nil {
-		return fmt.Errorf("failed to publish to channel %s: %w", p.channel, result.Err())
+// Publish publishes a message to the configured channel and returns the number
+// of subscribers that received it.
+func (p *Publisher) Publish(ctx context.Context, message string) (int64, error) {
+	return p.PublishTo(ctx, p.channel, message)
+}
+
+// EnableCompression gzips published messages of at least minSize bytes.
+// Subscribers decompress them transparently. Zero disables compression.
+func (p *Publisher) EnableCompression(minSize int) {
+	p.compressMinSize = minSize
+}
+
+// InjectFaults makes publishing fail at the rate configured for
+// fault.ValkeyPublish.
+func (p *Publisher) InjectFaults(faults *fault.Injector) {
+	p.faults = faults
+}
+
+// PublishTo publishes a message to channel instead of the configured one and
+// returns the number of subscribers that received it.
+func (p *Publisher) PublishTo(ctx context.Context, channel, message string) (int64, error) {
+	if p.faults.Fail(fault.ValkeyPublish) {
+		return 0, fmt.Errorf("failed to publish to channel %s: %w", channel, fault.ErrInjected)
+	}
+	if p.compressMinSize > 0 && len(message) >= p.compressMinSize {
+		compressed, err := compress(message)
+		if err != nil {
+			return 0, err
+		}
+		p.logger.Debug("compressed message", "size", len(message), "compressed_size", len(compressed))
+		message = compressed
+	}
+	receivers, err := p.client.Publish(ctx, channel, message).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish to channel %s: %w", channel, err)
+	}
+	p.logger.Debug("published message to Valkey", "channel", channel, "receivers", receivers)
+	return receivers, nil
+}
+
+// PriorityChannel returns the channel that high priority events for the given
+// event channel are published to. Workers drain it before the event channel.
+func PriorityChannel(channel string) string {
+	return channel + ":priority"
+}
+
+// HeartbeatChannel returns the control channel that web instances publish
+// heartbeats to for the given event channel.
+func HeartbeatChannel(channel string) string {
+	return channel + ":heartbeat"
+}
+
+// Heartbeat is published periodically by web instances so workers can detect
+// that messages from the web no longer reach them.
+type Heartbeat struct {
+	Source string    `json:"source"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// PublishHeartbeat publishes a heartbeat from source to the heartbeat channel
+// of the event channel eventChannel.
+func (p *Publisher) PublishHeartbeat(ctx context.Context, eventChannel, source string) error {
+	data, err := json.Marshal(Heartbeat{Source: source, SentAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode heartbeat: %w", err)
+	}
+	channel := HeartbeatChannel(eventChannel)
+	if err := p.client.Publish(ctx, channel, string(data)).Err(); err != nil {
+		return fmt.Errorf("failed to publish heartbeat to channel %s: %w", channel, err)
 	}
-	p.logger.Debug("published message to Valkey", "channel", p.channel)
 	return nil
 }
 
+// Channel returns the channel messages are published to.
+func (p *Publisher) Channel() string {
+	return p.channel
+}
+
+// ErrNoReceivers is returned by Request when no subscriber received the
+// request, so no reply can arrive.
+var ErrNoReceivers = errors.New("no subscriber received the message")
+
+// Request subscribes to replyChannel, publishes message to the configured
+// channel, and returns the first reply. It returns ctx.Err() if no reply
+// arrives before ctx is done, and ErrNoReceivers without waiting if no
+// subscriber received the message.
+func (p *Publisher) Request(ctx context.Context, replyChannel, message string) (string, error) {
+	pubsub := p.client.Subscribe(ctx, replyChannel)
+	defer pubsub.Close()
+
+	// The subscription must be active before publishing or the reply may be missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return "", fmt.Errorf("failed to subscribe to reply channel %s: %w", replyChannel, err)
+	}
+	receivers, err := p.Publish(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	if receivers == 0 {
+		return "", ErrNoReceivers
+	}
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case msg, ok := <-pubsub.Channel():
+		if !ok {
+			return "", fmt.Errorf("reply channel %s closed", replyChannel)
+		}
+		return decodeMessage(msg.Payload)
+	}
+}
+
 // Ping checks the connection to Valkey.
 func (p *Publisher) Ping(ctx context.Context) error {
 	return p.client.Ping(ctx).Err()
 }
 
+// KeepAlive pings Valkey every interval until ctx is cancelled, so a lost
+// connection is noticed before an event needs it rather than by the event.
+// go-redis discards a connection that fails, so each ping after a failure
+// dials Valkey again. Healthy reports the result of the last ping, which is
+// also exported as metrics with the client label publisher.
+func (p *Publisher) KeepAlive(ctx context.Context, interval time.Duration) {
+	connected.WithLabelValues("publisher").Set(1)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := p.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		p.recordPing(err)
+	}
+}
+
+// recordPing records the result of a KeepAlive ping, logging when the
+// connection is lost and when it is restored.
+func (p *Publisher) recordPing(err error) {
+	p.mu.Lock()
+	wasDown := p.pingErr != nil
+	p.pingErr = err
+	p.mu.Unlock()
+
+	if err != nil {
+		pingFailures.WithLabelValues("publisher").Inc()
+		connected.WithLabelValues("publisher").Set(0)
+		if !wasDown {
+			p.logger.Warn("lost connection to Valkey", "error", err)
+		}
+		return
+	}
+	connected.WithLabelValues("publisher").Set(1)
+	if wasDown {
+		reconnects.WithLabelValues("publisher").Inc()
+		p.logger.Info("reconnected to Valkey")
+	}
+}
+
+// Healthy returns an error if the last KeepAlive ping failed.
+func (p *Publisher) Healthy() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pingErr != nil {
+		return fmt.Errorf("last ping to Valkey failed: %w", p.pingErr)
+	}
+	return nil
+}
+
 // Close closes the Valkey client connection.
 func (p *Publisher) Close() error {
 	return p.client.Close()
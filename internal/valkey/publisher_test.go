@@ -0,0 +1,55 @@
+package valkey
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPublisher_KeepAlive(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Nothing listens on port 1, so every ping fails
+	p := NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test", logger)
+	defer p.Close()
+	if err := p.Healthy(); err != nil {
+		t.Fatalf("expected healthy before the first ping, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.KeepAlive(ctx, 20*time.Millisecond)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Healthy() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a failed ping to make the publisher unhealthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if got := connected.WithLabelValues("publisher").Value(); got != 0 {
+		t.Errorf("expected connected 0 after a failed ping, got %v", got)
+	}
+
+	// A successful ping after failures counts as a reconnect
+	before := reconnects.WithLabelValues("publisher").Value()
+	p.recordPing(errors.New("connection refused"))
+	p.recordPing(nil)
+	if err := p.Healthy(); err != nil {
+		t.Errorf("expected healthy after a successful ping, got %v", err)
+	}
+	if got := reconnects.WithLabelValues("publisher").Value(); got != before+1 {
+		t.Errorf("expected one reconnect, got %v", got-before)
+	}
+	if got := connected.WithLabelValues("publisher").Value(); got != 1 {
+		t.Errorf("expected connected 1 after a successful ping, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package valkey
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimiter counts events per key in fixed windows stored in Valkey, so
+// that every web replica enforces the same limit. Each window admits burst
+// events and lasts burst/perMinute minutes, which keeps the average rate of
+// the in-memory token bucket but not its bound on bursts: a key may send
+// burst events at the end of one window and burst more at the start of the
+// next, so up to twice burst in quick succession.
+type RateLimiter struct {
+	client *redis.Client
+	prefix string
+	limit  int64
+	window time.Duration
+	now    func() time.Time
+}
+
+// RateLimiter returns a limiter admitting perMinute events per key on
+// average, in bursts of up to burst events, counted with the publisher's
+// connection under keys prefixed by its channel. perMinute and burst must
+// be positive.
+func (p *Publisher) RateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		client: p.client,
+		prefix: p.channel + ":ratelimit:",
+		limit:  int64(burst),
+		window: time.Duration(burst) * time.Minute / time.Duration(perMinute),
+		now:    time.Now,
+	}
+}
+
+// windowKey returns the counter of key for the window containing now, and
+// when that window ends. Windows are aligned on the zero time, so replicas
+// agree on them without coordination.
+func (l *RateLimiter) windowKey(key string, now time.Time) (string, time.Time) {
+	start := now.Truncate(l.window)
+	return fmt.Sprintf("%s%s:%d", l.prefix, key, start.UnixMilli()), start.Add(l.window)
+}
+
+// Allow counts an event of key. It returns whether the event is within the
+// limit, how long until the window ends if not, and how many more events
+// key may send in the window.
+func (l *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, int, error) {
+	now := l.now()
+	counter, end := l.windowKey(key, now)
+
+	// The counter expires with its window, also on replicas whose clock is
+	// slightly behind
+	pipe := l.client.TxPipeline()
+	incr := pipe.Incr(ctx, counter)
+	pipe.PExpire(ctx, counter, 2*l.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, 0, fmt.Errorf("failed to count event in Valkey: %w", err)
+	}
+
+	if count := incr.Val(); count <= l.limit {
+		return true, 0, int(l.limit - count), nil
+	}
+	return false, end.Sub(now), 0, nil
+}
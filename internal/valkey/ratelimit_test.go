@@ -0,0 +1,39 @@
+package valkey
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimiter_Windows(t *testing.T) {
+	p := NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "events", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer p.Close()
+
+	l := p.RateLimiter(6, 3)
+	if l.window != 30*time.Second || l.limit != 3 {
+		t.Fatalf("expected 3 events per 30s window, got %d per %v", l.limit, l.window)
+	}
+
+	now := time.Date(2026, 10, 16, 9, 0, 10, 0, time.UTC)
+	key, end := l.windowKey("myorg/api", now)
+	if !strings.HasPrefix(key, "events:ratelimit:myorg/api:") || !end.Equal(now.Add(20*time.Second)) {
+		t.Errorf("unexpected window %s ending %v", key, end)
+	}
+	if later, _ := l.windowKey("myorg/api", now.Add(19*time.Second)); later != key {
+		t.Errorf("expected the same counter within the window, got %s and %s", key, later)
+	}
+	if next, _ := l.windowKey("myorg/api", end); next == key {
+		t.Error("expected a new counter in the next window")
+	}
+
+	// Nothing listens on port 1
+	if _, _, _, err := l.Allow(context.Background(), "myorg/api"); err == nil {
+		t.Error("expected an error without Valkey")
+	}
+}
@@ -2,34 +2,136 @@ package valkey
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// MessageHandler is called for each message received from the subscription.
-type MessageHandler func(ctx context.Context, message string)
+// MessageHandler is called for each message received from the subscription
+// with the event channel it was published to. Messages of a priority channel
+// and those matched by a pattern are passed with the event channel itself,
+// such as kuberollouttrigger.prod for kuberollouttrigger.prod:priority.
+type MessageHandler func(ctx context.Context, channel, message string)
 
-// Subscriber subscribes to a Valkey PubSub channel and processes messages.
+// delivery is a received message and the event channel it was published to.
+type delivery struct {
+	channel string
+	message string
+}
+
+const (
+	// keepaliveInterval is how often the subscriber publishes a keepalive to
+	// its own keepalive channel.
+	keepaliveInterval = 10 * time.Second
+
+	// keepaliveTimeout is how long the subscription may go without receiving
+	// a keepalive before Healthy reports it as dead.
+	keepaliveTimeout = 3 * keepaliveInterval
+)
+
+// Subscriber subscribes to Valkey PubSub channels and processes messages.
 type Subscriber struct {
 	client  *redis.Client
 	channel string
 	logger  *slog.Logger
+	opts    SubscriberOptions
+
+	// queue holds received messages until the handler takes them. It
+	// outlives a single subscription so buffered messages survive a
+	// reconnect.
+	queue chan delivery
+	// priority holds messages received on priority channels, which are
+	// handled before any message in queue.
+	priority chan delivery
+	// exact holds the event channels subscribed by name.
+	exact map[string]bool
+	// dropped counts messages discarded because the queue was full.
+	dropped atomic.Int64
+
+	// subscribed is set while Subscribe holds a confirmed subscription.
+	subscribed atomic.Bool
+	// handling is set while the handler processes a message, during which
+	// a full queue can hold back keepalives.
+	handling atomic.Bool
+	// lastKeepalive is the Unix time in nanoseconds at which the subscription
+	// last received a keepalive or message.
+	lastKeepalive atomic.Int64
+	// lastHeartbeat is the Unix time in nanoseconds at which the last web
+	// heartbeat was received, or zero if none was.
+	lastHeartbeat atomic.Int64
 }
 
-// NewSubscriber creates a new Valkey subscriber.
-func NewSubscriber(opts *redis.Options, channel string, logger *slog.Logger) *Subscriber {
+// defaultBufferSize matches the go-redis PubSub channel default.
+const defaultBufferSize = 100
+
+// SubscriberOptions tunes how received messages are buffered for the handler.
+type SubscriberOptions struct {
+	// BufferSize is the number of received messages held while the handler
+	// is busy. Zero uses 100.
+	BufferSize int
+
+	// HealthCheckInterval is how often go-redis pings the subscription
+	// connection while no messages arrive. Zero uses the go-redis default.
+	HealthCheckInterval time.Duration
+
+	// DropOldest discards the oldest buffered message when the buffer is full,
+	// so the newest events are processed first. Otherwise receiving blocks
+	// until the handler catches up.
+	DropOldest bool
+
+	// Channels are event channels subscribed besides the main channel, each
+	// with its priority and heartbeat channels.
+	Channels []string
+
+	// Pattern is a glob-style pattern of event channels subscribed with
+	// PSUBSCRIBE, along with their priority and heartbeat channels. Empty
+	// subscribes no pattern.
+	Pattern string
+}
+
+// NewSubscriber creates a new Valkey subscriber. Its connection pool stats are
+// exported as metrics with the client label subscriber.
+func NewSubscriber(opts *redis.Options, channel string, logger *slog.Logger, subOpts SubscriberOptions) *Subscriber {
+	if subOpts.BufferSize <= 0 {
+		subOpts.BufferSize = defaultBufferSize
+	}
+	client := redis.NewClient(opts)
+	exportPoolStats("subscriber", client)
+	exact := map[string]bool{channel: true}
+	for _, c := range subOpts.Channels {
+		exact[c] = true
+	}
 	return &Subscriber{
-		client:  redis.NewClient(opts),
-		channel: channel,
-		logger:  logger,
+		client:   client,
+		channel:  channel,
+		logger:   logger,
+		opts:     subOpts,
+		queue:    make(chan delivery, subOpts.BufferSize),
+		priority: make(chan delivery, subOpts.BufferSize),
+		exact:    exact,
 	}
 }
 
-// Subscribe starts listening on the configured channel and calls handler for each message.
-// This blocks until the context is cancelled.
+// keepaliveChannel is subscribed alongside the main channel. Keepalives
+// published to it travel the same path as events, so receiving them proves
+// the subscription connection is alive end to end.
+func (s *Subscriber) keepaliveChannel() string {
+	return s.channel + ":keepalive"
+}
+
+// Subscribe starts listening on the configured channels, pattern and their
+// priority channels and calls handler for each message, taking priority
+// messages first. This blocks until the context is cancelled.
 func (s *Subscriber) Subscribe(ctx context.Context, handler MessageHandler) error {
-	pubsub := s.client.Subscribe(ctx, s.channel)
+	channels := []string{s.keepaliveChannel()}
+	for _, c := range append([]string{s.channel}, s.opts.Channels...) {
+		channels = append(channels, c, PriorityChannel(c), HeartbeatChannel(c))
+	}
+	pubsub := s.client.Subscribe(ctx, channels...)
 	defer pubsub.Close()
 
 	// Wait for subscription confirmation
@@ -37,23 +139,225 @@ func (s *Subscriber) Subscribe(ctx context.Context, handler MessageHandler) erro
 	if err != nil {
 		return err
 	}
+	if s.opts.Pattern != "" {
+		if err := pubsub.PSubscribe(ctx, s.opts.Pattern, PriorityChannel(s.opts.Pattern), HeartbeatChannel(s.opts.Pattern)); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Info("subscribed to Valkey channel", "channel", s.channel, "channels", strings.Join(s.opts.Channels, ","), "pattern", s.opts.Pattern)
+	s.lastKeepalive.Store(time.Now().UnixNano())
+	s.subscribed.Store(true)
+	defer s.subscribed.Store(false)
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	channelOpts := []redis.ChannelOption{redis.WithChannelSize(s.opts.BufferSize)}
+	if s.opts.HealthCheckInterval > 0 {
+		channelOpts = append(channelOpts, redis.WithChannelHealthCheckInterval(s.opts.HealthCheckInterval))
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	closed := make(chan struct{})
+	go s.receive(pubsub.Channel(channelOpts...), stop, closed)
 
-	s.logger.Info("subscribed to Valkey channel", "channel", s.channel)
+	handle := func(d delivery) {
+		s.handling.Store(true)
+		handler(ctx, d.channel, d.message)
+		s.handling.Store(false)
+	}
 
-	ch := pubsub.Channel()
 	for {
+		// Drain priority messages before waiting on anything else
+		select {
+		case message := <-s.priority:
+			handle(message)
+			continue
+		default:
+		}
+
 		select {
 		case <-ctx.Done():
 			s.logger.Info("shutting down Valkey subscriber")
 			return ctx.Err()
-		case msg, ok := <-ch:
-			if !ok {
-				s.logger.Warn("Valkey subscription channel closed, reconnecting")
-				return nil
+		case <-ticker.C:
+			if err := s.client.Publish(ctx, s.keepaliveChannel(), "keepalive").Err(); err != nil {
+				s.logger.Warn("failed to publish Valkey keepalive", "error", err)
 			}
-			handler(ctx, msg.Payload)
+		case <-closed:
+			s.logger.Warn("Valkey subscription channel closed, reconnecting")
+			return nil
+		case message := <-s.priority:
+			handle(message)
+		case message := <-s.queue:
+			handle(message)
+		}
+	}
+}
+
+// receive moves messages from the subscription into the queue, handling
+// keepalives and heartbeats itself so a busy handler does not delay them. It
+// closes closed when the subscription channel closes, and returns early when
+// stop is closed.
+func (s *Subscriber) receive(ch <-chan *redis.Message, stop <-chan struct{}, closed chan<- struct{}) {
+	defer close(closed)
+	for msg := range ch {
+		s.lastKeepalive.Store(time.Now().UnixNano())
+		if msg.Channel == s.keepaliveChannel() {
+			continue
+		}
+		channel, kind, ok := s.classify(msg)
+		if !ok {
+			continue
+		}
+		if kind == heartbeatMessage {
+			s.lastHeartbeat.Store(time.Now().UnixNano())
+			continue
+		}
+		message, err := decodeMessage(msg.Payload)
+		if err != nil {
+			s.logger.Error("discarding undecodable message", "channel", channel, "error", err)
+			continue
+		}
+		queue := s.queue
+		if kind == priorityMessage {
+			queue = s.priority
+		}
+		if !s.enqueue(queue, delivery{channel: channel, message: message}, stop) {
+			return
+		}
+	}
+}
+
+// Kinds of received messages.
+const (
+	eventMessage = iota
+	priorityMessage
+	heartbeatMessage
+)
+
+// classify returns the event channel and kind of a received message. ok is
+// false for pattern matches that are not for the subscriber: messages on
+// channels also subscribed by name, which arrive twice, and control channels
+// such as keepalives and replies that the event channel pattern matches too.
+func (s *Subscriber) classify(msg *redis.Message) (channel string, kind int, ok bool) {
+	if msg.Pattern == "" {
+		if base, ok := strings.CutSuffix(msg.Channel, HeartbeatChannel("")); ok && s.exact[base] {
+			return base, heartbeatMessage, true
+		}
+		if base, ok := strings.CutSuffix(msg.Channel, PriorityChannel("")); ok && s.exact[base] {
+			return base, priorityMessage, true
+		}
+		return msg.Channel, eventMessage, true
+	}
+
+	switch msg.Pattern {
+	case HeartbeatChannel(s.opts.Pattern):
+		channel, kind = strings.TrimSuffix(msg.Channel, HeartbeatChannel("")), heartbeatMessage
+	case PriorityChannel(s.opts.Pattern):
+		channel, kind = strings.TrimSuffix(msg.Channel, PriorityChannel("")), priorityMessage
+	default:
+		if isControlChannel(msg.Channel) {
+			return "", 0, false
+		}
+		channel, kind = msg.Channel, eventMessage
+	}
+	return channel, kind, !s.exact[channel]
+}
+
+// isControlChannel reports whether channel carries heartbeats, priority
+// events, keepalives or replies rather than events.
+func isControlChannel(channel string) bool {
+	for _, suffix := range []string{HeartbeatChannel(""), PriorityChannel(""), ":keepalive"} {
+		if strings.HasSuffix(channel, suffix) {
+			return true
+		}
+	}
+	return strings.Contains(channel, ":reply:")
+}
+
+// enqueue adds message to queue. When the queue is full it either drops the
+// oldest message or waits for room, depending on DropOldest. It returns false
+// if stop was closed while waiting.
+func (s *Subscriber) enqueue(queue chan delivery, message delivery, stop <-chan struct{}) bool {
+	if !s.opts.DropOldest {
+		select {
+		case queue <- message:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		select {
+		case queue <- message:
+			return true
+		default:
 		}
+		select {
+		case <-queue:
+			s.dropped.Add(1)
+			s.logger.Warn("subscriber buffer full, dropped oldest message", "buffer_size", s.opts.BufferSize)
+		default:
+		}
+	}
+}
+
+// Buffered returns the number of messages waiting for the handler, including
+// priority messages.
+func (s *Subscriber) Buffered() int {
+	return len(s.queue) + len(s.priority)
+}
+
+// Dropped returns the number of messages discarded because the buffer was full.
+func (s *Subscriber) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Healthy returns an error if the subscriber cannot receive messages: it is
+// not subscribed, Valkey does not answer a PING, or the subscription has not
+// received its own keepalive for keepaliveTimeout. A connection can drop
+// without an error while the subscription still looks open, so the
+// keepalive is the only reliable sign that published messages arrive. The
+// keepalive age is not checked while a message is being handled.
+func (s *Subscriber) Healthy(ctx context.Context) error {
+	if !s.subscribed.Load() {
+		return fmt.Errorf("not subscribed to channel %s", s.channel)
+	}
+	if err := s.Ping(ctx); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	if s.handling.Load() {
+		return nil
+	}
+	if age := time.Since(time.Unix(0, s.lastKeepalive.Load())); age > keepaliveTimeout {
+		return fmt.Errorf("no keepalive received on channel %s for %s", s.keepaliveChannel(), age.Round(time.Second))
+	}
+	return nil
+}
+
+// Channel returns the channel the subscriber receives messages on.
+func (s *Subscriber) Channel() string {
+	return s.channel
+}
+
+// LastHeartbeat returns when the last web heartbeat was received, or the
+// zero time if none was.
+func (s *Subscriber) LastHeartbeat() time.Time {
+	ns := s.lastHeartbeat.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Reply publishes a response to a request/reply channel named by a request.
+func (s *Subscriber) Reply(ctx context.Context, channel, message string) error {
+	if err := s.client.Publish(ctx, channel, message).Err(); err != nil {
+		return fmt.Errorf("failed to publish reply to channel %s: %w", channel, err)
 	}
+	return nil
 }
 
 // Ping checks the connection to Valkey.
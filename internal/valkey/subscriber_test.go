@@ -0,0 +1,44 @@
+package valkey
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSubscriber_Classify(t *testing.T) {
+	s := &Subscriber{
+		channel: "krt",
+		opts:    SubscriberOptions{Channels: []string{"krt.dev"}, Pattern: "krt.*"},
+		exact:   map[string]bool{"krt": true, "krt.dev": true},
+	}
+
+	tests := []struct {
+		name    string
+		msg     redis.Message
+		channel string
+		kind    int
+		ok      bool
+	}{
+		{"main channel", redis.Message{Channel: "krt"}, "krt", eventMessage, true},
+		{"extra channel", redis.Message{Channel: "krt.dev"}, "krt.dev", eventMessage, true},
+		{"extra priority", redis.Message{Channel: "krt.dev:priority"}, "krt.dev", priorityMessage, true},
+		{"main heartbeat", redis.Message{Channel: "krt:heartbeat"}, "krt", heartbeatMessage, true},
+		{"pattern event", redis.Message{Channel: "krt.prod", Pattern: "krt.*"}, "krt.prod", eventMessage, true},
+		{"pattern priority", redis.Message{Channel: "krt.prod:priority", Pattern: "krt.*:priority"}, "krt.prod", priorityMessage, true},
+		{"pattern heartbeat", redis.Message{Channel: "krt.prod:heartbeat", Pattern: "krt.*:heartbeat"}, "krt.prod", heartbeatMessage, true},
+		{"priority matched by event pattern", redis.Message{Channel: "krt.prod:priority", Pattern: "krt.*"}, "", 0, false},
+		{"reply matched by event pattern", redis.Message{Channel: "krt.prod:reply:1", Pattern: "krt.*"}, "", 0, false},
+		{"keepalive matched by event pattern", redis.Message{Channel: "krt.dev:keepalive", Pattern: "krt.*"}, "", 0, false},
+		{"exact channel matched by pattern", redis.Message{Channel: "krt.dev", Pattern: "krt.*"}, "krt.dev", eventMessage, false},
+		{"exact priority matched by pattern", redis.Message{Channel: "krt.dev:priority", Pattern: "krt.*:priority"}, "krt.dev", priorityMessage, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel, kind, ok := s.classify(&tt.msg)
+			if ok != tt.ok || (ok && (channel != tt.channel || kind != tt.kind)) {
+				t.Errorf("classify(%q, %q) = %q, %d, %v; want %q, %d, %v", tt.msg.Channel, tt.msg.Pattern, channel, kind, ok, tt.channel, tt.kind, tt.ok)
+			}
+		})
+	}
+}
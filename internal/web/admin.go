@@ -0,0 +1,389 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/admintoken"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/logging"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+)
+
+// adminActor is the actor recorded for requests made with the admin token.
+// Requests made with a scoped token record "admin:<name>".
+const adminActor = "admin"
+
+// matchQueryTimeout bounds how long a match query waits for a worker reply.
+const matchQueryTimeout = 5 * time.Second
+
+// globalAdmin is the principal for the global admin token, allowed in every
+// namespace.
+var globalAdmin = &admintoken.Token{Name: adminActor, Namespaces: []string{"*"}}
+
+// authorizeAdmin checks the admin bearer token against the global token and
+// the scoped tokens. It writes a 401 response and returns nil if the token is
+// missing or wrong.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request, logger *slog.Logger) *admintoken.Token {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	var principal *admintoken.Token
+	if ok && s.opts.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AdminToken)) == 1 {
+		principal = globalAdmin
+	} else if ok {
+		principal = s.opts.AdminTokens.Lookup(token)
+	}
+	if principal != nil {
+		s.audit(r, authAttempt{Method: authMethodAdminToken, Outcome: auditSuccess, Verified: true, Actor: actorFor(principal)})
+		return principal
+	}
+
+	outcome := auditInvalidToken
+	if !ok {
+		outcome = auditMissingToken
+	}
+	s.audit(r, authAttempt{Method: authMethodAdminToken, Outcome: outcome})
+	s.authFailures.Log(logger, "admin_token", "admin authentication failed", []any{"path", r.URL.Path})
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return nil
+}
+
+// actorFor returns the actor recorded for requests made by principal.
+func actorFor(principal *admintoken.Token) string {
+	if principal == globalAdmin {
+		return adminActor
+	}
+	return adminActor + ":" + principal.Name
+}
+
+// handleAdminRestart publishes a manual restart request for a single
+// Deployment, reusing the worker pipeline so the restart is audited the same
+// way as one triggered by an image push.
+func (s *Server) handleAdminRestart(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	principal := s.authorizeAdmin(w, r, logger)
+	if principal == nil {
+		return
+	}
+	actor := actorFor(principal)
+
+	ct := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		logger.Error("failed to read request body", "error", err)
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	req, err := payload.ParseRestartRequest(body)
+	if err != nil {
+		logger.Warn("restart request validation failed", "error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !principal.Allows(req.Namespace) {
+		logger.Warn("restart request outside token scope", "actor", actor, "namespace", req.Namespace)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	msg := &payload.Message{
+		Type:    payload.MessageTypeRestart,
+		Restart: req,
+		Trigger: &payload.Trigger{Actor: actor},
+	}
+	jsonBytes, err := msg.ToJSON()
+	if err != nil {
+		logger.Error("failed to serialize restart request", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	receivers, err := s.publisher.Publish(r.Context(), string(jsonBytes))
+	if err != nil {
+		logger.Error("failed to publish to Valkey", "error", err)
+		http.Error(w, "Service unavailable", http.StatusBadGateway)
+		return
+	}
+	if !s.checkReceivers(w, logger, s.publisher.Channel(), receivers) {
+		return
+	}
+
+	logger.Info("manual restart requested",
+		"namespace", req.Namespace,
+		"deployment", req.Deployment,
+		"reason", req.Reason,
+		"actor", actor,
+	)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleAdminPause asks the workers to stop restarting and hold incoming
+// events until resumed, for example during cluster maintenance.
+func (s *Server) handleAdminPause(w http.ResponseWriter, r *http.Request) {
+	s.publishControl(w, r, payload.MessageTypePause)
+}
+
+// handleAdminResume asks paused workers to process the events they held.
+func (s *Server) handleAdminResume(w http.ResponseWriter, r *http.Request) {
+	s.publishControl(w, r, payload.MessageTypeResume)
+}
+
+// publishControl publishes a worker control message of msgType.
+func (s *Server) publishControl(w http.ResponseWriter, r *http.Request, msgType string) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	actor, ok := s.authorizeControl(w, r, logger, msgType)
+	if !ok {
+		return
+	}
+	if !s.sendControl(w, r, logger, &payload.Message{Type: msgType, Trigger: &payload.Trigger{Actor: actor}}) {
+		return
+	}
+
+	logger.Info("worker control requested", "type", msgType, "actor", actor)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorizeControl authorizes a worker control request and returns the
+// actor. Control messages affect every namespace, so scoped tokens are
+// refused. It writes the error response and returns false if not allowed.
+func (s *Server) authorizeControl(w http.ResponseWriter, r *http.Request, logger *slog.Logger, msgType string) (string, bool) {
+	principal := s.authorizeAdmin(w, r, logger)
+	if principal == nil {
+		return "", false
+	}
+	actor := actorFor(principal)
+	if principal != globalAdmin {
+		logger.Warn("worker control requires the global admin token", "actor", actor, "type", msgType)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", false
+	}
+	return actor, true
+}
+
+// sendControl publishes a control message on the default channel. It writes
+// the error response and returns false if publishing failed, or if no worker
+// received it and RequireReceivers is set.
+func (s *Server) sendControl(w http.ResponseWriter, r *http.Request, logger *slog.Logger, msg *payload.Message) bool {
+	jsonBytes, err := msg.ToJSON()
+	if err != nil {
+		logger.Error("failed to serialize control message", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	receivers, err := s.publisher.Publish(r.Context(), string(jsonBytes))
+	if err != nil {
+		logger.Error("failed to publish to Valkey", "error", err)
+		http.Error(w, "Service unavailable", http.StatusBadGateway)
+		return false
+	}
+	return s.checkReceivers(w, logger, s.publisher.Channel(), receivers)
+}
+
+// logLevelRequest is the body of POST /admin/log-level.
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// handleAdminLogLevel changes the log level of this web instance and asks
+// every worker to do the same, so debug logs can be enabled during an
+// incident without restarting. Other web replicas keep their level.
+func (s *Server) handleAdminLogLevel(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	actor, ok := s.authorizeControl(w, r, logger, payload.MessageTypeLogLevel)
+	if !ok {
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxPayloadSize))
+	dec.DisallowUnknownFields()
+	var req logLevelRequest
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := &payload.Message{
+		Type:     payload.MessageTypeLogLevel,
+		LogLevel: strings.ToLower(req.Level),
+		Trigger:  &payload.Trigger{Actor: actor},
+	}
+	if !s.sendControl(w, r, logger, msg) {
+		return
+	}
+	if s.opts.LogLevel != nil {
+		s.opts.LogLevel.Set(level)
+	}
+
+	// Logged at warn so the change is recorded whatever the new level
+	logger.Warn("log level changed", "level", msg.LogLevel, "actor", actor)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleAdminMatches asks a worker which Deployments an image:tag would
+// currently restart and returns its reply. The query travels over the same
+// channel as events and is answered on a per-request reply channel. Matches
+// outside the namespaces of a scoped token are removed from the reply.
+func (s *Server) handleAdminMatches(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	principal := s.authorizeAdmin(w, r, logger)
+	if principal == nil {
+		return
+	}
+
+	query := &payload.MatchQuery{
+		Image:   r.URL.Query().Get("image"),
+		Tag:     r.URL.Query().Get("tag"),
+		ReplyTo: s.publisher.Channel() + ":reply:" + generateRequestID(),
+	}
+	if err := payload.ValidateMatchQuery(query, s.imagePrefix); err != nil {
+		logger.Warn("match query validation failed", "error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := &payload.Message{
+		Type:    payload.MessageTypeMatchQuery,
+		Query:   query,
+		Trigger: &payload.Trigger{Actor: actorFor(principal)},
+	}
+	jsonBytes, err := msg.ToJSON()
+	if err != nil {
+		logger.Error("failed to serialize match query", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), matchQueryTimeout)
+	defer cancel()
+	reply, err := s.publisher.Request(ctx, query.ReplyTo, string(jsonBytes))
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Warn("no worker replied to match query", "image", query.Image, "tag", query.Tag)
+		http.Error(w, "No worker replied", http.StatusGatewayTimeout)
+		return
+	}
+	if errors.Is(err, valkey.ErrNoReceivers) {
+		publishedWithoutReceivers.WithLabelValues(s.publisher.Channel()).Inc()
+		logger.Warn("no worker subscribed to answer match query", "image", query.Image, "tag", query.Tag)
+		http.Error(w, "No worker is subscribed", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to query worker", "error", err)
+		http.Error(w, "Service unavailable", http.StatusBadGateway)
+		return
+	}
+	var matchReply payload.MatchReply
+	if err := json.Unmarshal([]byte(reply), &matchReply); err != nil {
+		logger.Error("worker sent an invalid match reply", "error", err)
+		http.Error(w, "Invalid worker reply", http.StatusBadGateway)
+		return
+	}
+	allowed := make([]payload.MatchResult, 0, len(matchReply.Matches))
+	for _, m := range matchReply.Matches {
+		if principal.Allows(m.Namespace) {
+			allowed = append(allowed, m)
+		}
+	}
+	matchReply.Matches = allowed
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(matchReply); err != nil {
+		logger.Error("failed to write match reply", "error", err)
+	}
+}
+
+// oidcStatus is the response body of GET /admin/oidc-status.
+type oidcStatus struct {
+	Issuer          string     `json:"issuer"`
+	Audience        string     `json:"audience"`
+	AllowedOrg      string     `json:"allowed_org"`
+	DevMode         bool       `json:"dev_mode"`
+	JWKSURL         string     `json:"jwks_url"`
+	KeyIDs          []string   `json:"key_ids"`
+	FetchedAt       *time.Time `json:"fetched_at,omitempty"`
+	CacheAgeSeconds *int64     `json:"cache_age_seconds,omitempty"`
+	CachedUntil     *time.Time `json:"cached_until,omitempty"`
+	KeysFromDisk    bool       `json:"keys_from_disk,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+	// Issuers are the issuers accepted besides the one above.
+	Issuers []oidcStatus `json:"issuers,omitempty"`
+}
+
+// handleAdminOIDCStatus reports the OIDC configuration and the state of the
+// JWKS cache, to tell JWKS fetch failures apart from bad tokens when
+// authentication failures spike. It never triggers a fetch.
+func (s *Server) handleAdminOIDCStatus(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	if s.authorizeAdmin(w, r, logger) == nil {
+		return
+	}
+
+	status := validatorStatus(s.validator)
+	for _, issuer := range s.validator.Issuers() {
+		status.Issuers = append(status.Issuers, validatorStatus(issuer))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.Error("failed to write OIDC status", "error", err)
+	}
+}
+
+// validatorStatus reports the configuration and JWKS cache of the validator
+// of one issuer.
+func validatorStatus(v *oidc.Validator) oidcStatus {
+	jwks := v.JWKSStatus()
+	status := oidcStatus{
+		Issuer:      v.Issuer(),
+		Audience:    v.Audience(),
+		AllowedOrg:  v.AllowedOrg(),
+		DevMode:     v.DevMode(),
+		JWKSURL:     jwks.URL,
+		KeyIDs:      jwks.KeyIDs,
+		LastError:   jwks.LastError,
+		LastErrorAt: optionalTime(jwks.LastErrorAt),
+	}
+	if !jwks.FetchedAt.IsZero() {
+		age := int64(time.Since(jwks.FetchedAt).Seconds())
+		status.FetchedAt = optionalTime(jwks.FetchedAt)
+		status.CacheAgeSeconds = &age
+		status.CachedUntil = optionalTime(jwks.CachedUntil)
+		status.KeysFromDisk = jwks.FromDisk
+	}
+	return status
+}
+
+// optionalTime returns nil for the zero time so it is omitted from JSON.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,305 @@
+package web
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/admintoken"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+)
+
+func newAdminTestServer(adminToken string) *Server {
+	return newAdminTestServerWithOptions(Options{AdminToken: adminToken})
+}
+
+func newAdminTestServerWithOptions(opts Options) *Server {
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	// Nothing listens on this address, so publishing always fails
+	pub := valkey.NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test", testLogger())
+	return NewServer(v, pub, "ghcr.io/test/", testLogger(), opts)
+}
+
+func TestHandleAdminRestart(t *testing.T) {
+	srv := newAdminTestServer("s3cret")
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"missing token", "", `{"namespace":"dev","deployment":"my-app"}`, http.StatusUnauthorized},
+		{"wrong token", "wrong", `{"namespace":"dev","deployment":"my-app"}`, http.StatusUnauthorized},
+		{"invalid body", "s3cret", `{"namespace":"dev"}`, http.StatusBadRequest},
+		{"unknown field", "s3cret", `{"namespace":"dev","deployment":"my-app","image":"x"}`, http.StatusBadRequest},
+		// A valid request reaches the publisher, which is unavailable in tests
+		{"valid", "s3cret", `{"namespace":"dev","deployment":"my-app","reason":"config change"}`, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/restart", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAdminRestart_DisabledWithoutToken(t *testing.T) {
+	srv := newAdminTestServer("")
+
+	req := httptest.NewRequest("POST", "/admin/restart", strings.NewReader(`{"namespace":"dev","deployment":"my-app"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 when admin API is disabled, got %d", w.Code)
+	}
+}
+
+func TestHandleAdminMatches(t *testing.T) {
+	srv := newAdminTestServer("s3cret")
+
+	tests := []struct {
+		name   string
+		token  string
+		query  string
+		status int
+	}{
+		{"missing token", "", "image=ghcr.io/test/svc&tag=dev", http.StatusUnauthorized},
+		{"missing tag", "s3cret", "image=ghcr.io/test/svc", http.StatusBadRequest},
+		{"wrong prefix", "s3cret", "image=docker.io/other/svc&tag=dev", http.StatusBadRequest},
+		// A valid query reaches Valkey, which is unavailable in tests
+		{"valid", "s3cret", "image=ghcr.io/test/svc&tag=dev", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/matches?"+tt.query, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAdminOIDCStatus(t *testing.T) {
+	key := generateTestKey(t)
+	jwksSrv := serveJWKS(t, key, "test-kid")
+	v := oidc.NewValidator("test-audience", "test-org", false, testLogger())
+	v.SetJWKSURL(jwksSrv.URL)
+	v.AddIssuer(oidc.IssuerConfig{Issuer: "https://gitlab.example.com", Audience: "gitlab-audience", AllowedOrg: "gitlab-group"})
+	pub := valkey.NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{AdminToken: "s3cret"})
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin/oidc-status", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", w.Code)
+	}
+
+	var status oidcStatus
+	w := get("s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if status.Audience != "test-audience" || status.AllowedOrg != "test-org" || status.Issuer != oidc.GitHubOIDCIssuer {
+		t.Errorf("unexpected configuration %+v", status)
+	}
+	if len(status.Issuers) != 1 || status.Issuers[0].Issuer != "https://gitlab.example.com" || status.Issuers[0].JWKSURL != "https://gitlab.example.com/.well-known/jwks" {
+		t.Errorf("expected the additional issuer, got %+v", status.Issuers)
+	}
+	if len(status.KeyIDs) != 0 || status.FetchedAt != nil || status.CacheAgeSeconds != nil {
+		t.Errorf("expected an empty cache before any token, got %+v", status)
+	}
+
+	// Validating a token fills the JWKS cache
+	tokenStr := createSignedToken(t, key, "test-kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+	})
+	if _, err := v.ValidateToken(tokenStr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status = oidcStatus{}
+	if err := json.Unmarshal(get("s3cret").Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(status.KeyIDs) != 1 || status.KeyIDs[0] != "test-kid" {
+		t.Errorf("unexpected key ids %v", status.KeyIDs)
+	}
+	if status.FetchedAt == nil || status.CacheAgeSeconds == nil || status.LastError != "" {
+		t.Errorf("unexpected cache state %+v", status)
+	}
+}
+
+func TestHandleAdminRestart_ScopedTokens(t *testing.T) {
+	tokens, err := admintoken.Parse(`[{"name":"team-a","token":"a-secret","namespaces":["team-a-*"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scoped tokens alone enable the admin API
+	srv := newAdminTestServerWithOptions(Options{AdminTokens: tokens})
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"unknown token", "b-secret", `{"namespace":"team-a-dev","deployment":"my-app"}`, http.StatusUnauthorized},
+		{"outside scope", "a-secret", `{"namespace":"team-b-dev","deployment":"my-app"}`, http.StatusForbidden},
+		// An in-scope request reaches the publisher, which is unavailable in tests
+		{"inside scope", "a-secret", `{"namespace":"team-a-dev","deployment":"my-app"}`, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/restart", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleAdminPauseResume(t *testing.T) {
+	tokens, err := admintoken.Parse(`[{"name":"team-a","token":"a-secret","namespaces":["team-a-*"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newAdminTestServerWithOptions(Options{AdminToken: "s3cret", AdminTokens: tokens})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"scoped token", "a-secret", http.StatusForbidden},
+		// The global token reaches the publisher, which is unavailable in tests
+		{"global token", "s3cret", http.StatusBadGateway},
+	}
+	for _, path := range []string{"/admin/pause", "/admin/resume"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest("POST", path, nil)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				w := httptest.NewRecorder()
+				srv.Handler().ServeHTTP(w, req)
+
+				if w.Code != tt.status {
+					t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestHandleAdminLogLevel(t *testing.T) {
+	tokens, err := admintoken.Parse(`[{"name":"team-a","token":"a-secret","namespaces":["team-a-*"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level := new(slog.LevelVar)
+	pub := &mockPublisher{}
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{AdminToken: "s3cret", AdminTokens: tokens, LogLevel: level})
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"missing token", "", `{"level":"debug"}`, http.StatusUnauthorized},
+		{"scoped token", "a-secret", `{"level":"debug"}`, http.StatusForbidden},
+		{"unknown level", "s3cret", `{"level":"verbose"}`, http.StatusBadRequest},
+		{"unknown field", "s3cret", `{"level":"debug","scope":"all"}`, http.StatusBadRequest},
+		{"global token", "s3cret", `{"level":"DEBUG"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/admin/log-level", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("expected the server level to be debug, got %s", level.Level())
+	}
+	if len(pub.published) != 1 {
+		t.Fatalf("expected 1 published message, got %d", len(pub.published))
+	}
+	msg, err := payload.ParseMessage([]byte(pub.published[0]), "ghcr.io/test/")
+	if err != nil {
+		t.Fatalf("invalid published message: %v", err)
+	}
+	if msg.Type != payload.MessageTypeLogLevel || msg.LogLevel != "debug" || msg.Trigger.Actor != "admin" {
+		t.Errorf("unexpected published message %+v", msg)
+	}
+}
+
+func TestActorFor(t *testing.T) {
+	if got := actorFor(globalAdmin); got != "admin" {
+		t.Errorf("expected admin, got %q", got)
+	}
+	if got := actorFor(&admintoken.Token{Name: "team-a"}); got != "admin:team-a" {
+		t.Errorf("expected admin:team-a, got %q", got)
+	}
+}
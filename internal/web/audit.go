@@ -0,0 +1,84 @@
+package web
+
+import (
+	"net"
+	"net/http"
+)
+
+// Authentication methods of audit records.
+const (
+	authMethodOIDC       = "oidc"
+	authMethodAdminToken = "admin_token"
+	authMethodWebhook    = "webhook_signature"
+)
+
+// Outcomes of audit records besides the oidc.FailureReason of a rejected
+// token.
+const (
+	auditSuccess          = "success"
+	auditMissingToken     = "missing_token"
+	auditInvalidToken     = "invalid_token"
+	auditInvalidSignature = "invalid_signature"
+)
+
+// authAttempt is the audit record of one authentication attempt.
+type authAttempt struct {
+	// Method is the authentication method, one of the authMethod constants.
+	Method string
+	// Outcome is auditSuccess or why the attempt failed.
+	Outcome string
+	// Verified reports whether the identity fields were authenticated.
+	// Those of a rejected token are what the token claims.
+	Verified        bool
+	TokenHash       string
+	Repository      string
+	RepositoryOwner string
+	Actor           string
+	RunID           string
+	// Delivery is the GitHub webhook delivery id.
+	Delivery string
+}
+
+// audit records attempt for request r on the audit logger, if any. Records
+// are always logged at info level, whatever the level of the operational
+// logs, and only hold what identifies the caller: never a token.
+func (s *Server) audit(r *http.Request, attempt authAttempt) {
+	if s.opts.AuditLogger == nil {
+		return
+	}
+	attrs := []any{
+		"request_id", requestIDFromContext(r.Context()),
+		"method", attempt.Method,
+		"outcome", attempt.Outcome,
+		"path", r.URL.Path,
+		"source_ip", sourceIP(r),
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		attrs = append(attrs, "forwarded_for", forwarded)
+	}
+	for _, field := range []struct{ key, value string }{
+		{"token_hash", attempt.TokenHash},
+		{"repository_owner", attempt.RepositoryOwner},
+		{"repository", attempt.Repository},
+		{"actor", attempt.Actor},
+		{"run_id", attempt.RunID},
+		{"delivery", attempt.Delivery},
+	} {
+		if field.value != "" {
+			attrs = append(attrs, field.key, field.value)
+		}
+	}
+	attrs = append(attrs, "verified", attempt.Verified)
+	s.opts.AuditLogger.Info("authentication attempt", attrs...)
+}
+
+// sourceIP returns the IP address of the peer that sent r. Proxies in front
+// of the web mode are the peer; the client they forward for is only in the
+// unverified X-Forwarded-For header.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
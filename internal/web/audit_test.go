@@ -0,0 +1,164 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+// auditRecords decodes the JSON audit records written to buf.
+func auditRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid audit record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	buf.Reset()
+	return records
+}
+
+func TestAudit_Event(t *testing.T) {
+	var audit, all bytes.Buffer
+	key := generateTestKey(t)
+	jwksSrv := serveJWKS(t, key, "kid")
+	v := oidc.NewValidator("test-audience", "test-org", false, testLogger())
+	v.SetJWKSURL(jwksSrv.URL)
+	srv := NewServer(v, &mockPublisher{}, "ghcr.io/test/", testLogger(), Options{
+		AuditLogger: slog.New(slog.NewJSONHandler(io.MultiWriter(&audit, &all), nil)),
+	})
+
+	claims := oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		RepositoryOwner: "test-org",
+		Repository:      "test-org/svc",
+		Actor:           "octocat",
+		RunID:           "42",
+	}
+	wrongOrg := claims
+	wrongOrg.RepositoryOwner = "other-org"
+	wrongOrg.Repository = "other-org/svc"
+
+	send := func(token string) {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
+		req.RemoteAddr = "192.0.2.10:54321"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-Id", "req-1")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	valid := createSignedToken(t, key, "kid", claims)
+	send(valid)
+	records := auditRecords(t, &audit)
+	if len(records) != 1 {
+		t.Fatalf("expected one audit record, got %v", records)
+	}
+	want := map[string]any{
+		"msg":              "authentication attempt",
+		"request_id":       "req-1",
+		"method":           authMethodOIDC,
+		"outcome":          auditSuccess,
+		"path":             "/event",
+		"source_ip":        "192.0.2.10",
+		"token_hash":       oidc.TokenHash(valid),
+		"repository_owner": "test-org",
+		"repository":       "test-org/svc",
+		"actor":            "octocat",
+		"run_id":           "42",
+		"verified":         true,
+	}
+	for k, v := range want {
+		if records[0][k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, records[0][k])
+		}
+	}
+
+	// Rejected tokens record the claimed identity as unverified
+	invalid := createSignedToken(t, key, "kid", wrongOrg)
+	send(invalid)
+	records = auditRecords(t, &audit)
+	if len(records) != 1 || records[0]["outcome"] != oidc.ReasonWrongOrg || records[0]["repository_owner"] != "other-org" || records[0]["verified"] != false {
+		t.Errorf("unexpected audit record for a rejected token: %v", records)
+	}
+
+	send("")
+	records = auditRecords(t, &audit)
+	if len(records) != 1 || records[0]["outcome"] != auditMissingToken {
+		t.Errorf("unexpected audit record for a missing token: %v", records)
+	}
+
+	for _, token := range []string{valid, invalid} {
+		for _, segment := range strings.Split(token, ".") {
+			if strings.Contains(all.String(), segment) {
+				t.Error("audit records must never contain the token")
+			}
+		}
+	}
+}
+
+func TestAudit_AdminAndWebhook(t *testing.T) {
+	var audit bytes.Buffer
+	srv := newAdminTestServerWithOptions(Options{
+		AdminToken:  "s3cret",
+		AuditLogger: slog.New(slog.NewJSONHandler(&audit, nil)),
+	})
+
+	for _, tt := range []struct {
+		token   string
+		outcome string
+	}{
+		{"s3cret", auditSuccess},
+		{"wrong", auditInvalidToken},
+		{"", auditMissingToken},
+	} {
+		req := httptest.NewRequest("POST", "/admin/pause", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+		records := auditRecords(t, &audit)
+		if len(records) != 1 || records[0]["method"] != authMethodAdminToken || records[0]["outcome"] != tt.outcome {
+			t.Errorf("unexpected audit record for token %q: %v", tt.token, records)
+		}
+		if tt.outcome == auditSuccess && records[0]["actor"] != adminActor {
+			t.Errorf("expected the admin actor, got %v", records[0]["actor"])
+		}
+	}
+
+	pub := &mockPublisher{}
+	srv = newDeploymentServer(t, pub, Options{AuditLogger: slog.New(slog.NewJSONHandler(&audit, nil))})
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, deploymentRequest("deployment", deploymentBody("test-org", "production", `{}`), "other"))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	records := auditRecords(t, &audit)
+	if len(records) != 1 || records[0]["method"] != authMethodWebhook || records[0]["outcome"] != auditInvalidSignature || records[0]["delivery"] == nil {
+		t.Errorf("unexpected audit record for an invalid webhook signature: %v", records)
+	}
+}
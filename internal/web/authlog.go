@@ -0,0 +1,96 @@
+package web
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxAuthFailureSignatures bounds the number of distinct failure signatures
+// tracked per window so that randomized garbage cannot grow memory unbounded.
+const maxAuthFailureSignatures = 256
+
+// authFailureLogger aggregates repeated authentication failures. The first
+// failure for a signature in each window is logged at warn level with full
+// detail; repeats are logged at debug level and summarized with a count when
+// the window closes. A window of zero logs every failure at warn level.
+type authFailureLogger struct {
+	logger *slog.Logger
+	window time.Duration
+
+	mu         sync.Mutex
+	counts     map[string]*authFailureCount
+	overflow   int
+	flushTimer *time.Timer
+}
+
+type authFailureCount struct {
+	count int
+	attrs []any
+}
+
+func newAuthFailureLogger(logger *slog.Logger, window time.Duration) *authFailureLogger {
+	return &authFailureLogger{
+		logger: logger,
+		window: window,
+		counts: make(map[string]*authFailureCount),
+	}
+}
+
+// Log records an authentication failure identified by signature.
+func (a *authFailureLogger) Log(logger *slog.Logger, signature, msg string, attrs []any) {
+	if a.window <= 0 {
+		logger.Warn(msg, attrs...)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.flushTimer == nil {
+		a.flushTimer = time.AfterFunc(a.window, a.flush)
+	}
+
+	if entry, ok := a.counts[signature]; ok {
+		entry.count++
+		logger.Debug(msg, attrs...)
+		return
+	}
+	if len(a.counts) >= maxAuthFailureSignatures {
+		a.overflow++
+		logger.Debug(msg, attrs...)
+		return
+	}
+
+	a.counts[signature] = &authFailureCount{count: 1, attrs: attrs}
+	logger.Warn(msg, attrs...)
+}
+
+// flush emits a summary for every signature that was suppressed during the
+// window and starts a new window.
+func (a *authFailureLogger) flush() {
+	a.mu.Lock()
+	counts := a.counts
+	overflow := a.overflow
+	a.counts = make(map[string]*authFailureCount)
+	a.overflow = 0
+	a.flushTimer = nil
+	a.mu.Unlock()
+
+	for _, entry := range counts {
+		if entry.count <= 1 {
+			continue
+		}
+		attrs := append([]any{
+			"suppressed_count", entry.count - 1,
+			"window", a.window.String(),
+		}, entry.attrs...)
+		a.logger.Warn("repeated authentication failures suppressed", attrs...)
+	}
+	if overflow > 0 {
+		a.logger.Warn("authentication failures suppressed for untracked signatures",
+			"suppressed_count", overflow,
+			"window", a.window.String(),
+		)
+	}
+}
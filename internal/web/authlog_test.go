@@ -0,0 +1,65 @@
+package web
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func bufferLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+}
+
+func TestAuthFailureLogger_AggregatesRepeats(t *testing.T) {
+	var buf bytes.Buffer
+	logger := bufferLogger(&buf)
+	a := newAuthFailureLogger(logger, time.Hour)
+
+	for i := 0; i < 5; i++ {
+		a.Log(logger, "sig-a", "OIDC token validation failed", []any{"error", "bad"})
+	}
+	a.Log(logger, "sig-b", "OIDC token validation failed", []any{"error", "other"})
+
+	if got := strings.Count(buf.String(), "OIDC token validation failed"); got != 2 {
+		t.Fatalf("expected 2 warnings before flush (one per signature), got %d:\n%s", got, buf.String())
+	}
+
+	buf.Reset()
+	a.mu.Lock()
+	a.flushTimer.Stop()
+	a.mu.Unlock()
+	a.flush()
+
+	out := buf.String()
+	if strings.Count(out, "repeated authentication failures suppressed") != 1 {
+		t.Fatalf("expected one summary for the repeated signature, got:\n%s", out)
+	}
+	if !strings.Contains(out, "suppressed_count=4") {
+		t.Errorf("expected suppressed_count=4 in summary, got:\n%s", out)
+	}
+
+	// A new window logs the first failure again
+	buf.Reset()
+	a.Log(logger, "sig-a", "OIDC token validation failed", nil)
+	if !strings.Contains(buf.String(), "OIDC token validation failed") {
+		t.Error("expected first failure of a new window to be logged at warn")
+	}
+	a.mu.Lock()
+	a.flushTimer.Stop()
+	a.mu.Unlock()
+}
+
+func TestAuthFailureLogger_Disabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := bufferLogger(&buf)
+	a := newAuthFailureLogger(logger, 0)
+
+	for i := 0; i < 3; i++ {
+		a.Log(logger, "sig-a", "OIDC token validation failed", nil)
+	}
+	if got := strings.Count(buf.String(), "OIDC token validation failed"); got != 3 {
+		t.Fatalf("expected every failure logged when aggregation is disabled, got %d", got)
+	}
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"context"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+)
+
+// Authorizer decides whether an authenticated workflow may publish an event.
+// It is called after the OIDC token and the payload have been validated, and
+// a non-nil error rejects the request with 403 Forbidden. The error is logged
+// but not returned to the client.
+type Authorizer interface {
+	Authorize(ctx context.Context, claims *oidc.Claims, evt *payload.Event) error
+}
+
+// AuthorizerFunc adapts an ordinary function to the Authorizer interface.
+type AuthorizerFunc func(ctx context.Context, claims *oidc.Claims, evt *payload.Event) error
+
+// Authorize calls f(ctx, claims, evt).
+func (f AuthorizerFunc) Authorize(ctx context.Context, claims *oidc.Claims, evt *payload.Event) error {
+	return f(ctx, claims, evt)
+}
+
+// AllowAll is the default Authorizer. It allows every event, leaving access
+// control to the organization, audience and image prefix checks.
+var AllowAll Authorizer = allowAll{}
+
+type allowAll struct{}
+
+func (allowAll) Authorize(context.Context, *oidc.Claims, *payload.Event) error {
+	return nil
+}
+
+// Decision is the outcome of a ScopedAuthorizer that allowed an event.
+type Decision struct {
+	// Namespaces restricts the event to namespaces matching any of these
+	// patterns (path.Match syntax). Empty leaves the event unrestricted.
+	Namespaces []string
+}
+
+// ScopedAuthorizer is an Authorizer that can also narrow the namespaces an
+// allowed event may restart workloads in. The server calls AuthorizeScoped
+// instead of Authorize when the configured Authorizer implements it, and the
+// worker skips matches outside the returned namespaces.
+type ScopedAuthorizer interface {
+	Authorizer
+	AuthorizeScoped(ctx context.Context, claims *oidc.Claims, evt *payload.Event) (*Decision, error)
+}
+
+// authorize asks the configured Authorizer about evt, returning an empty
+// Decision for authorizers that do not restrict namespaces.
+func (s *Server) authorize(ctx context.Context, claims *oidc.Claims, evt *payload.Event) (*Decision, error) {
+	scoped, ok := s.opts.Authorizer.(ScopedAuthorizer)
+	if !ok {
+		if err := s.opts.Authorizer.Authorize(ctx, claims, evt); err != nil {
+			return nil, err
+		}
+		return &Decision{}, nil
+	}
+	decision, err := scoped.AuthorizeScoped(ctx, claims, evt)
+	if err != nil {
+		return nil, err
+	}
+	if decision == nil {
+		decision = &Decision{}
+	}
+	return decision, nil
+}
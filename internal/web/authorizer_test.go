@@ -0,0 +1,76 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+)
+
+func TestHandleEvent_Authorizer(t *testing.T) {
+	var seenRepository, seenImage string
+	authorizer := AuthorizerFunc(func(ctx context.Context, claims *oidc.Claims, evt *payload.Event) error {
+		seenRepository, seenImage = claims.Repository, evt.Image
+		if evt.Image == "ghcr.io/test/denied" {
+			return errors.New("denied by policy")
+		}
+		return nil
+	})
+
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	// Nothing listens on this address, so authorized events fail to publish
+	pub := valkey.NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{Authorizer: authorizer})
+
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+		Repository:      "test-org/svc",
+	})
+
+	tests := []struct {
+		image  string
+		status int
+	}{
+		{"ghcr.io/test/denied", http.StatusForbidden},
+		{"ghcr.io/test/allowed", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"`+tt.image+`","tags":["dev"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.image, tt.status, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "denied by policy") {
+			t.Errorf("%s: authorizer error must not be returned to the client", tt.image)
+		}
+		if seenRepository != "test-org/svc" || seenImage != tt.image {
+			t.Errorf("%s: authorizer saw repository %q image %q", tt.image, seenRepository, seenImage)
+		}
+	}
+}
+
+func TestNewServer_DefaultAuthorizer(t *testing.T) {
+	srv := NewServer(nil, nil, "ghcr.io/test/", testLogger(), Options{})
+	if srv.opts.Authorizer != AllowAll {
+		t.Error("expected AllowAll when no authorizer is configured")
+	}
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// errBodyTooLarge is returned when a request body exceeds maxPayloadSize,
+	// compressed or after decompression.
+	errBodyTooLarge = fmt.Errorf("request body exceeds %d bytes", maxPayloadSize)
+
+	// errUnsupportedEncoding is returned for a Content-Encoding other than
+	// gzip or identity.
+	errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+	// errInvalidGzip is returned when a gzip request body cannot be
+	// decompressed.
+	errInvalidGzip = errors.New("invalid gzip request body")
+)
+
+// readBody reads the body of r, decompressing it if its Content-Encoding is
+// gzip, as some CI HTTP clients send by default. The compressed and the
+// decompressed body are both limited to maxPayloadSize, so a small
+// compressed body cannot inflate without bound.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body := http.MaxBytesReader(w, r.Body, maxPayloadSize)
+	var reader io.Reader = body
+	compressed := false
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, bodyError(err, true)
+		}
+		defer zr.Close()
+		reader, compressed = zr, true
+	default:
+		return nil, fmt.Errorf("%w %q, only gzip is accepted", errUnsupportedEncoding, encoding)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxPayloadSize+1))
+	if err != nil {
+		return nil, bodyError(err, compressed)
+	}
+	if len(data) > maxPayloadSize {
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
+
+// bodyError classifies an error reading a request body.
+func bodyError(err error, compressed bool) error {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytes):
+		return errBodyTooLarge
+	case compressed:
+		return fmt.Errorf("%w: %w", errInvalidGzip, err)
+	default:
+		return err
+	}
+}
+
+// writeBodyError writes the response for an error returned by readBody.
+func writeBodyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		// RFC 7694: tell the client which encodings are accepted
+		w.Header().Set("Accept-Encoding", "gzip")
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, errBodyTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errInvalidGzip):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandleEvent_ContentEncoding(t *testing.T) {
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+		Repository:      "test-org/svc",
+	})
+	event := `{"image":"ghcr.io/test/svc","tags":["dev"]}`
+	padded := event + strings.Repeat(" ", maxPayloadSize)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+	}{
+		{"identity", "", []byte(event), http.StatusAccepted},
+		{"gzip", "gzip", gzipped(t, event), http.StatusAccepted},
+		{"x-gzip", "X-Gzip", gzipped(t, event), http.StatusAccepted},
+		{"corrupt gzip", "gzip", []byte(event), http.StatusBadRequest},
+		{"truncated gzip", "gzip", gzipped(t, event)[:20], http.StatusBadRequest},
+		{"unsupported encoding", "br", []byte(event), http.StatusUnsupportedMediaType},
+		{"too large", "", []byte(padded), http.StatusRequestEntityTooLarge},
+		{"too large decompressed", "gzip", gzipped(t, padded), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &mockPublisher{}
+			srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
+			req := httptest.NewRequest("POST", "/event", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tokenStr)
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusAccepted && (len(pub.published) != 1 || !strings.Contains(pub.published[0], `"image":"ghcr.io/test/svc"`)) {
+				t.Errorf("expected the event to be published, got %v", pub.published)
+			}
+			if tt.status == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Encoding") != "gzip" {
+				t.Errorf("expected Accept-Encoding: gzip, got %q", w.Header().Get("Accept-Encoding"))
+			}
+		})
+	}
+}
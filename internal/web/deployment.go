@@ -0,0 +1,249 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Outcome label values of the deployment webhook metric.
+const (
+	webhookPublished        = "published"
+	webhookInvalidSignature = "invalid_signature"
+	webhookIgnored          = "ignored"
+	webhookRejected         = "rejected"
+)
+
+// deploymentWebhook holds the fields used from a GitHub deployment webhook.
+type deploymentWebhook struct {
+	Action     string `json:"action"`
+	Deployment struct {
+		SHA         string          `json:"sha"`
+		Environment string          `json:"environment"`
+		Payload     json.RawMessage `json:"payload"`
+		Creator     struct {
+			Login string `json:"login"`
+		} `json:"creator"`
+	} `json:"deployment"`
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		Owner    struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	// WorkflowRun is set when the deployment was created by a workflow job
+	// with an environment.
+	WorkflowRun *struct {
+		ID int64 `json:"id"`
+	} `json:"workflow_run"`
+}
+
+// handleGitHubDeployment publishes an event for a GitHub deployment webhook
+// to a mapped environment, restricted to the namespaces of the environment.
+func (s *Server) handleGitHubDeployment(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		logger.Error("failed to read request body", "error", err)
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if !validWebhookSignature(s.opts.GitHubWebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		deploymentWebhooks.WithLabelValues(webhookInvalidSignature).Inc()
+		s.audit(r, authAttempt{Method: authMethodWebhook, Outcome: auditInvalidSignature, Delivery: delivery})
+		s.authFailures.Log(logger, "webhook_signature", "GitHub webhook signature verification failed", []any{"delivery", delivery})
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.audit(r, authAttempt{Method: authMethodWebhook, Outcome: auditSuccess, Verified: true, Delivery: delivery})
+	logger = logger.With("delivery", delivery)
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "deployment":
+	case "ping":
+		logger.Info("received GitHub webhook ping")
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		deploymentWebhooks.WithLabelValues(webhookIgnored).Inc()
+		logger.Debug("ignoring GitHub webhook event", "event", event)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var hook deploymentWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		deploymentWebhooks.WithLabelValues(webhookRejected).Inc()
+		logger.Warn("invalid deployment webhook payload", "error", err)
+		http.Error(w, "invalid deployment webhook payload", http.StatusBadRequest)
+		return
+	}
+	repository := hook.Repository.FullName
+	logger = logger.With("repository", repository, "environment", hook.Deployment.Environment)
+
+	// The signature only proves the webhook comes from GitHub, not from
+	// which organization, as one secret can be shared by several
+	if !strings.EqualFold(hook.Repository.Owner.Login, s.validator.AllowedOrg()) {
+		deploymentWebhooks.WithLabelValues(webhookRejected).Inc()
+		logger.Warn("deployment webhook from another organization rejected", "repository_owner", hook.Repository.Owner.Login)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if hook.Action != "created" {
+		deploymentWebhooks.WithLabelValues(webhookIgnored).Inc()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	rule := s.opts.DeploymentEnvironments.Lookup(hook.Deployment.Environment)
+	if rule == nil {
+		deploymentWebhooks.WithLabelValues(webhookIgnored).Inc()
+		logger.Info("ignoring deployment to unmapped environment")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Deployments are created on the GitHub of GITHUB_OIDC_ISSUER, and the
+	// rate limit and the authorizer see one as they would see the token of
+	// the deploying workflow
+	trigger := &payload.Trigger{
+		Issuer:          s.validator.Issuer(),
+		Repository:      repository,
+		RepositoryOwner: hook.Repository.Owner.Login,
+		Actor:           hook.Deployment.Creator.Login,
+		SHA:             hook.Deployment.SHA,
+	}
+	if hook.WorkflowRun != nil {
+		trigger.RunID = strconv.FormatInt(hook.WorkflowRun.ID, 10)
+	}
+	claims := &oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: trigger.Issuer},
+		Repository:       trigger.Repository,
+		RepositoryOwner:  trigger.RepositoryOwner,
+		Actor:            trigger.Actor,
+		RunID:            trigger.RunID,
+		SHA:              trigger.SHA,
+	}
+
+	if ok, retryAfter, _ := s.allowEvent(r.Context(), logger, claims); !ok {
+		eventsThrottled.Inc()
+		logger.Warn("event rate limit exceeded", "retry_after", retryAfter.String())
+		writeTooManyRequests(w, "event rate limit exceeded for repository "+repository, retryAfter)
+		return
+	}
+
+	evt, unknown, err := s.deploymentEvent(&hook, rule.Tag)
+	if unknown != "" {
+		logger.Warn("deployment payload has unknown field", "field", unknown)
+	}
+	if err == nil {
+		err = evt.RequireDigest(s.opts.ProtectedTags)
+	}
+	if err != nil {
+		deploymentWebhooks.WithLabelValues(webhookRejected).Inc()
+		logger.Warn("deployment webhook validation failed", "error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The authorizer may only narrow the environment's namespaces
+	decision, err := s.authorize(r.Context(), claims, evt)
+	var namespaces []string
+	if err == nil {
+		namespaces = narrowNamespaces(rule.Namespaces, decision.Namespaces)
+		if len(namespaces) == 0 {
+			err = errNoNamespaces
+		}
+	}
+	if err != nil {
+		deploymentWebhooks.WithLabelValues(webhookRejected).Inc()
+		logger.Warn("deployment not authorized", "image", evt.Image, "tags", evt.Tags, "error", err.Error())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if _, ok := s.publishEvent(w, r, logger, evt, trigger, namespaces); !ok {
+		return
+	}
+	deploymentWebhooks.WithLabelValues(webhookPublished).Inc()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deploymentEvent returns the event rolled out by a deployment. The
+// deployment payload may name the image, tags and digest like an /event
+// payload; by default the tag of the environment of the image named after
+// the repository under the allowed prefix is rolled out. It returns the
+// first unknown field of a deployment payload accepted in warn mode.
+func (s *Server) deploymentEvent(hook *deploymentWebhook, tag string) (*payload.Event, string, error) {
+	var custom struct {
+		Image string `json:"image"`
+	}
+	if json.Unmarshal(hook.Deployment.Payload, &custom) == nil && custom.Image != "" {
+		return payload.ParseAndValidateWith(hook.Deployment.Payload, s.imagePrefix, s.opts.PayloadStrictness)
+	}
+
+	prefix := s.imagePrefix
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	evt := &payload.Event{
+		Image: prefix + strings.ToLower(hook.Repository.Name),
+		Tags:  []string{tag},
+	}
+	if err := payload.ValidateEvent(evt, s.imagePrefix); err != nil {
+		return nil, "", err
+	}
+	return evt, "", nil
+}
+
+// errNoNamespaces is returned when the authorizer allows none of the
+// namespaces of a deployment environment.
+var errNoNamespaces = errors.New("the authorizer allows none of the environment's namespaces")
+
+// narrowNamespaces returns the environment namespace patterns that one of
+// the authorizer's patterns matches as a whole. No authorizer patterns leaves
+// the environment patterns unchanged.
+func narrowNamespaces(environment, allowed []string) []string {
+	if len(allowed) == 0 {
+		return environment
+	}
+	var narrowed []string
+	for _, pattern := range environment {
+		for _, a := range allowed {
+			if ok, _ := path.Match(a, pattern); ok {
+				narrowed = append(narrowed, pattern)
+				break
+			}
+		}
+	}
+	return narrowed
+}
+
+// validWebhookSignature reports whether signature is the X-Hub-Signature-256
+// header of body signed with secret.
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/routing"
+)
+
+const testWebhookSecret = "webhook-s3cret"
+
+func newDeploymentServer(t *testing.T, pub *mockPublisher, opts Options) *Server {
+	t.Helper()
+	environments, err := routing.ParseEnvironments(`[
+		{"environment": "production", "tag": "prod", "namespaces": ["prod-*", "shared"]},
+		{"environment": "staging", "tag": "staging", "namespaces": ["staging"]}
+	]`)
+	if err != nil {
+		t.Fatalf("failed to parse environments: %v", err)
+	}
+	opts.GitHubWebhookSecret = testWebhookSecret
+	opts.DeploymentEnvironments = environments
+	v := oidc.NewValidator("aud", "test-org", true, testLogger())
+	return NewServer(v, pub, "ghcr.io/test-org/", testLogger(), opts)
+}
+
+func deploymentRequest(event, body, secret string) *http.Request {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest("POST", "/github/deployment", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func deploymentBody(owner, environment, deploymentPayload string) string {
+	return `{
+		"action": "created",
+		"deployment": {
+			"sha": "ffac537e6cbbf934b08745a378932722df287a53",
+			"environment": "` + environment + `",
+			"payload": ` + deploymentPayload + `,
+			"creator": {"login": "octocat"}
+		},
+		"repository": {"name": "MyService", "full_name": "` + owner + `/MyService", "owner": {"login": "` + owner + `"}},
+		"workflow_run": {"id": 1234567890}
+	}`
+}
+
+func TestHandleGitHubDeployment(t *testing.T) {
+	pub := &mockPublisher{}
+	srv := newDeploymentServer(t, pub, Options{})
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, deploymentRequest("deployment", deploymentBody("test-org", "Production", `{}`), testWebhookSecret))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(pub.published) != 1 {
+		t.Fatalf("expected one published message, got %d", len(pub.published))
+	}
+	msg, err := payload.ParseMessage([]byte(pub.published[0]), "ghcr.io/test-org/")
+	if err != nil {
+		t.Fatalf("failed to parse published message: %v", err)
+	}
+	if msg.Event.Image != "ghcr.io/test-org/myservice" || !reflect.DeepEqual(msg.Event.Tags, []string{"prod"}) {
+		t.Errorf("unexpected event %+v", msg.Event)
+	}
+	if !reflect.DeepEqual(msg.Namespaces, []string{"prod-*", "shared"}) {
+		t.Errorf("expected the environment namespaces, got %v", msg.Namespaces)
+	}
+	want := payload.Trigger{
+		Issuer:          oidc.GitHubOIDCIssuer,
+		Repository:      "test-org/MyService",
+		RepositoryOwner: "test-org",
+		Actor:           "octocat",
+		RunID:           "1234567890",
+		SHA:             "ffac537e6cbbf934b08745a378932722df287a53",
+	}
+	if *msg.Trigger != want {
+		t.Errorf("unexpected trigger %+v", msg.Trigger)
+	}
+
+	// The deployment payload can name the image and tags
+	pub.published = nil
+	w = httptest.NewRecorder()
+	body := deploymentBody("test-org", "staging", `{"image": "ghcr.io/test-org/worker", "tags": ["rc"]}`)
+	srv.Handler().ServeHTTP(w, deploymentRequest("deployment", body, testWebhookSecret))
+	if w.Code != http.StatusAccepted || len(pub.published) != 1 || !strings.Contains(pub.published[0], `"image":"ghcr.io/test-org/worker","tags":["rc"]`) {
+		t.Errorf("expected the payload image to be published, got %d %v", w.Code, pub.published)
+	}
+}
+
+func TestHandleGitHubDeployment_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"wrong secret", deploymentRequest("deployment", deploymentBody("test-org", "production", `{}`), "other"), http.StatusUnauthorized},
+		{"ping", deploymentRequest("ping", `{"zen":"Keep it logically awesome."}`, testWebhookSecret), http.StatusOK},
+		{"other event", deploymentRequest("push", `{}`, testWebhookSecret), http.StatusNoContent},
+		{"other organization", deploymentRequest("deployment", deploymentBody("other-org", "production", `{}`), testWebhookSecret), http.StatusForbidden},
+		{"unmapped environment", deploymentRequest("deployment", deploymentBody("test-org", "preview", `{}`), testWebhookSecret), http.StatusNoContent},
+		{"payload image outside prefix", deploymentRequest("deployment", deploymentBody("test-org", "production", `{"image": "docker.io/evil/app", "tags": ["prod"]}`), testWebhookSecret), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &mockPublisher{}
+			srv := newDeploymentServer(t, pub, Options{})
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, tt.req)
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if len(pub.published) != 0 {
+				t.Errorf("expected nothing to be published, got %v", pub.published)
+			}
+		})
+	}
+
+	// Without a secret the route does not exist
+	v := oidc.NewValidator("aud", "test-org", true, testLogger())
+	srv := NewServer(v, &mockPublisher{}, "ghcr.io/test-org/", testLogger(), Options{})
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, deploymentRequest("deployment", deploymentBody("test-org", "production", `{}`), ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a webhook secret, got %d", w.Code)
+	}
+}
+
+func TestHandleGitHubDeployment_AuthorizerNarrowsNamespaces(t *testing.T) {
+	pub := &mockPublisher{}
+	var authorized *oidc.Claims
+	srv := newDeploymentServer(t, pub, Options{Authorizer: scopedFunc(func(ctx context.Context, claims *oidc.Claims, evt *payload.Event) (*Decision, error) {
+		authorized = claims
+		return &Decision{Namespaces: []string{"prod-*"}}, nil
+	})})
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, deploymentRequest("deployment", deploymentBody("test-org", "production", `{}`), testWebhookSecret))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if authorized == nil || authorized.Repository != "test-org/MyService" || authorized.Actor != "octocat" {
+		t.Errorf("unexpected claims passed to the authorizer %+v", authorized)
+	}
+	msg, err := payload.ParseMessage([]byte(pub.published[0]), "ghcr.io/test-org/")
+	if err != nil {
+		t.Fatalf("failed to parse published message: %v", err)
+	}
+	if !reflect.DeepEqual(msg.Namespaces, []string{"prod-*"}) {
+		t.Errorf("expected the authorizer to narrow the namespaces, got %v", msg.Namespaces)
+	}
+
+	// None of the staging namespaces is allowed
+	pub.published = nil
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, deploymentRequest("deployment", deploymentBody("test-org", "staging", `{}`), testWebhookSecret))
+	if w.Code != http.StatusForbidden || len(pub.published) != 0 {
+		t.Errorf("expected 403 and nothing published, got %d %v", w.Code, pub.published)
+	}
+}
+
+// scopedFunc is a ScopedAuthorizer returning the decision of a function.
+type scopedFunc func(ctx context.Context, claims *oidc.Claims, evt *payload.Event) (*Decision, error)
+
+func (f scopedFunc) Authorize(ctx context.Context, claims *oidc.Claims, evt *payload.Event) error {
+	_, err := f(ctx, claims, evt)
+	return err
+}
+
+func (f scopedFunc) AuthorizeScoped(ctx context.Context, claims *oidc.Claims, evt *payload.Event) (*Decision, error) {
+	return f(ctx, claims, evt)
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"crypto/sha256"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeys bounds the number of idempotency keys remembered. When
+// it is reached, expired keys are dropped; if none has expired, further keys
+// are not remembered until one does.
+const maxIdempotencyKeys = 4096
+
+// idempotencyKeyPattern matches the accepted Idempotency-Key header values:
+// 1 to 255 printable ASCII characters, enough for a UUID or a run id with
+// attempt and step.
+var idempotencyKeyPattern = regexp.MustCompile(`^[!-~]{1,255}$`)
+
+// idempotencyState is the state of a key when a request begins with it.
+type idempotencyState int
+
+const (
+	// idempotencyNew means no request with the key was accepted within the
+	// TTL; the caller processes the request and reports the result.
+	idempotencyNew idempotencyState = iota
+	// idempotencyReplay means a request with the key was accepted within
+	// the TTL; the caller answers as it did without processing it again.
+	idempotencyReplay
+	// idempotencyInProgress means a request with the key is being processed.
+	idempotencyInProgress
+	// idempotencyMismatch means the key was used, within the TTL or by a
+	// request in progress, with a different request body.
+	idempotencyMismatch
+)
+
+// acceptedEvent is what the response to an accepted event reported.
+type acceptedEvent struct {
+	// ID is the request ID of the request that published the event.
+	ID string
+	// Receivers is the number of workers that received it.
+	Receivers int64
+}
+
+// idempotencyEntry is a remembered key.
+type idempotencyEntry struct {
+	// expires is when the key is forgotten; zero while its request is in
+	// progress.
+	expires time.Time
+	event   acceptedEvent
+	// body is the SHA-256 of the body of the request that used the key.
+	body [sha256.Size]byte
+}
+
+// idempotencyCache remembers the keys of accepted requests for a TTL.
+type idempotencyCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+// newIdempotencyCache returns a cache remembering keys for ttl. It returns
+// nil if ttl is zero, which disables idempotency keys.
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &idempotencyCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Begin starts a request with key and body. A new key is marked in progress
+// until Complete or Abort is called for it. A replay returns the event
+// accepted with the key. A key used with another body is a mismatch, as a
+// client reusing a key for a different event would otherwise lose it.
+func (c *idempotencyCache) Begin(key string, body []byte) (idempotencyState, acceptedEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	sum := sha256.Sum256(body)
+	entry, ok := c.entries[key]
+	if ok && (entry.expires.IsZero() || now.Before(entry.expires)) && entry.body != sum {
+		return idempotencyMismatch, acceptedEvent{}
+	}
+	switch {
+	case ok && entry.expires.IsZero():
+		return idempotencyInProgress, acceptedEvent{}
+	case ok && now.Before(entry.expires):
+		return idempotencyReplay, entry.event
+	}
+
+	if len(c.entries) >= maxIdempotencyKeys {
+		c.prune(now)
+	}
+	if len(c.entries) < maxIdempotencyKeys {
+		c.entries[key] = &idempotencyEntry{body: sum}
+	}
+	return idempotencyNew, acceptedEvent{}
+}
+
+// Complete remembers key as accepted with event for the TTL.
+func (c *idempotencyCache) Complete(key string, event acceptedEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok && entry.expires.IsZero() {
+		entry.expires = c.now().Add(c.ttl)
+		entry.event = event
+	}
+}
+
+// Abort forgets key after its request failed, so a retry is processed.
+func (c *idempotencyCache) Abort(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok && entry.expires.IsZero() {
+		delete(c.entries, key)
+	}
+}
+
+// prune drops expired keys.
+func (c *idempotencyCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
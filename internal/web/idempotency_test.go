@@ -0,0 +1,191 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newIdempotencyCache(time.Minute)
+	c.now = func() time.Time { return now }
+	body := []byte(`{"image":"ghcr.io/test/svc","tags":["dev"]}`)
+
+	if got, _ := c.Begin("key", body); got != idempotencyNew {
+		t.Fatalf("expected a new key, got %v", got)
+	}
+	if got, _ := c.Begin("key", body); got != idempotencyInProgress {
+		t.Errorf("expected the key to be in progress, got %v", got)
+	}
+	if got, _ := c.Begin("key", []byte(`{}`)); got != idempotencyMismatch {
+		t.Errorf("expected another body to mismatch the key in progress, got %v", got)
+	}
+	c.Complete("key", acceptedEvent{ID: "req-1", Receivers: 2})
+	if got, event := c.Begin("key", body); got != idempotencyReplay || event.ID != "req-1" || event.Receivers != 2 {
+		t.Errorf("expected a replay of the accepted event within the TTL, got %v %+v", got, event)
+	}
+	if got, _ := c.Begin("key", []byte(`{}`)); got != idempotencyMismatch {
+		t.Errorf("expected another body to mismatch the accepted key, got %v", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got, _ := c.Begin("key", body); got != idempotencyNew {
+		t.Errorf("expected the key to expire after the TTL, got %v", got)
+	}
+
+	// A failed request is forgotten so the retry is processed
+	c.Abort("key")
+	if got, _ := c.Begin("key", body); got != idempotencyNew {
+		t.Errorf("expected an aborted key to be new, got %v", got)
+	}
+}
+
+func TestIdempotencyCache_Disabled(t *testing.T) {
+	if c := newIdempotencyCache(0); c != nil {
+		t.Fatal("expected a nil cache when disabled")
+	}
+}
+
+func TestIdempotencyCache_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newIdempotencyCache(time.Minute)
+	c.now = func() time.Time { return now }
+	for i := range maxIdempotencyKeys {
+		c.Begin(strconv.Itoa(i), nil)
+		c.Complete(strconv.Itoa(i), acceptedEvent{})
+	}
+
+	// Full of unexpired keys, a new key is processed but not remembered
+	c.Begin("new", nil)
+	c.Complete("new", acceptedEvent{})
+	if got, _ := c.Begin("new", nil); got != idempotencyNew {
+		t.Errorf("expected a key beyond the bound not to be remembered, got %v", got)
+	}
+
+	now = now.Add(time.Minute)
+	c.Begin("later", nil)
+	if len(c.entries) != 1 {
+		t.Errorf("expected expired keys to be pruned, %d remain", len(c.entries))
+	}
+}
+
+func TestHandleEvent_IdempotencyKey(t *testing.T) {
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	token := func(repository string) string {
+		return createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    oidc.GitHubOIDCIssuer,
+				Audience:  jwt.ClaimStrings{"test-audience"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			},
+			RepositoryOwner: "test-org",
+			Repository:      repository,
+		})
+	}
+	pub := &mockPublisher{}
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{IdempotencyKeyTTL: time.Minute})
+
+	send := func(token, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", key)
+		req.Header.Set("X-Request-Id", "client-chosen")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	event := `{"image":"ghcr.io/test/svc","tags":["dev"]}`
+	svc := token("test-org/svc")
+
+	// A rejected request does not use up the key
+	if w := send(svc, "run-1", `{"image":"docker.io/other/svc","tags":["dev"]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	var eventID string
+	for i, replayed := range []string{"", "true"} {
+		w := send(svc, "run-1", event)
+		if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != replayed {
+			t.Errorf("request %d: expected 202 with Idempotent-Replayed %q, got %d %q", i, replayed, w.Code, w.Header().Get("Idempotent-Replayed"))
+		}
+		// The replay reports the event published by the first request
+		if i == 0 {
+			eventID = w.Header().Get("X-Event-Id")
+			if eventID == "" || eventID == "client-chosen" {
+				t.Errorf("expected an event ID generated by the server, got %q", eventID)
+			}
+		}
+		if w.Header().Get("X-Event-Id") != eventID || w.Header().Get("X-Published-Receivers") != "1" {
+			t.Errorf("request %d: expected event %s received by 1 worker, got %s %s", i, eventID, w.Header().Get("X-Event-Id"), w.Header().Get("X-Published-Receivers"))
+		}
+	}
+	if len(pub.published) != 1 {
+		t.Errorf("expected the event to be published once, got %d", len(pub.published))
+	}
+
+	// Keys are scoped to the repository, and other keys are processed
+	if w := send(token("test-org/other"), "run-1", event); w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected another repository's key to be processed, got %d", w.Code)
+	}
+	if w := send(svc, "run-2", event); w.Code != http.StatusAccepted || len(pub.published) != 3 {
+		t.Errorf("expected another key to be published, got %d with %d published", w.Code, len(pub.published))
+	}
+	if w := send(svc, "bad key", event); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid key, got %d", w.Code)
+	}
+
+	// A key reused for another event is rejected rather than replayed
+	published := len(pub.published)
+	if w := send(svc, "run-1", `{"image":"ghcr.io/test/svc","tags":["prod"]}`); w.Code != http.StatusUnprocessableEntity || len(pub.published) != published {
+		t.Errorf("expected 422 without publishing for a key reused with another body, got %d", w.Code)
+	}
+}
+
+func TestHandleEvent_KeysScopedToIssuer(t *testing.T) {
+	const enterprise = "https://github.example.com/_services/token"
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	v.AddIssuer(oidc.IssuerConfig{Issuer: enterprise, Audience: "test-audience", AllowedOrg: "test-org"})
+	token := func(issuer string) string {
+		return createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Audience:  jwt.ClaimStrings{"test-audience"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			},
+			RepositoryOwner: "test-org",
+			Repository:      "test-org/svc",
+		})
+	}
+	pub := &mockPublisher{}
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{IdempotencyKeyTTL: time.Minute, EventRateLimit: 1, EventRateBurst: 1})
+
+	// The same repository name on two issuers is two callers, with their own
+	// keys and rate limits
+	for _, issuer := range []string{oidc.GitHubOIDCIssuer, enterprise} {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token(issuer))
+		req.Header.Set("Idempotency-Key", "run-1")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("%s: expected 202 without a replay, got %d %q", issuer, w.Code, w.Header().Get("Idempotent-Replayed"))
+		}
+	}
+	if len(pub.published) != 2 {
+		t.Fatalf("expected an event published per issuer, got %d", len(pub.published))
+	}
+	for i, issuer := range []string{oidc.GitHubOIDCIssuer, enterprise} {
+		if !strings.Contains(pub.published[i], `"issuer":"`+issuer+`"`) {
+			t.Errorf("expected the trigger to carry issuer %s, got %s", issuer, pub.published[i])
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package web
+
+import "github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+
+// Outcome label values for token validation metrics that are not produced by
+// oidc.FailureReason.
+const (
+	outcomeSuccess      = "success"
+	outcomeMissingToken = "missing_token"
+)
+
+var tokenValidations = metrics.NewCounterVec(
+	"kuberollouttrigger_token_validations_total",
+	"OIDC token validation attempts on /event by outcome (success or failure reason).",
+	"outcome",
+)
+
+var publishedWithoutReceivers = metrics.NewCounterVec(
+	"kuberollouttrigger_published_without_receivers_total",
+	"Messages published to a Valkey channel no worker was subscribed to, which are lost.",
+	"channel",
+)
+
+var deploymentWebhooks = metrics.NewCounterVec(
+	"kuberollouttrigger_deployment_webhooks_total",
+	"GitHub deployment webhooks on /github/deployment by outcome.",
+	"outcome",
+)
+
+var idempotentReplays = metrics.NewCounter(
+	"kuberollouttrigger_idempotent_replays_total",
+	"Events on /event answered with 202 without publishing because their Idempotency-Key was already accepted.",
+)
+
+var eventsThrottled = metrics.NewCounter(
+	"kuberollouttrigger_events_throttled_total",
+	"Events on /event rejected with 429 because the repository exceeded the event rate limit.",
+)
+
+var rateLimitErrors = metrics.NewCounter(
+	"kuberollouttrigger_rate_limit_errors_total",
+	"Events allowed without counting them against the event rate limit because the shared rate limiter in Valkey failed.",
+)
+
+var readOnly = metrics.NewGauge(
+	"kuberollouttrigger_web_read_only",
+	"1 while this web instance is in read-only mode, otherwise 0.",
+)
+
+var eventsRejectedReadOnly = metrics.NewCounter(
+	"kuberollouttrigger_events_rejected_read_only_total",
+	"Event requests rejected with 503 because the web instance was in read-only mode.",
+)
+
+var requestsShed = metrics.NewCounterVec(
+	"kuberollouttrigger_requests_shed_total",
+	"Requests on /event and /github/deployment rejected with 503 because the web mode was overloaded, by reason (in_flight or memory).",
+	"reason",
+)
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+)
+
+// maxOPAResponseSize bounds the policy decision response body.
+const maxOPAResponseSize = 1 << 20 // 1MB
+
+// OPAAuthorizer authorizes events by querying an Open Policy Agent server
+// through its Data API. The policy receives the validated token claims and
+// the event as input and returns either a boolean or an object:
+//
+//	{"allow": true, "namespaces": ["team-a-*"], "reason": "..."}
+//
+// An undefined decision, a server error or a timeout denies the event.
+type OPAAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+// NewOPAAuthorizer creates an authorizer that POSTs decision requests to
+// decisionURL, such as http://localhost:8181/v1/data/kuberollouttrigger/decision.
+func NewOPAAuthorizer(decisionURL string, timeout time.Duration) *OPAAuthorizer {
+	return &OPAAuthorizer{
+		url:    decisionURL,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// opaInput is the input document passed to the policy.
+type opaInput struct {
+	Claims *oidc.Claims   `json:"claims"`
+	Event  *payload.Event `json:"event"`
+}
+
+// opaDecision is the object form of a policy result.
+type opaDecision struct {
+	Allow      bool     `json:"allow"`
+	Namespaces []string `json:"namespaces"`
+	Reason     string   `json:"reason"`
+}
+
+// Authorize implements Authorizer.
+func (a *OPAAuthorizer) Authorize(ctx context.Context, claims *oidc.Claims, evt *payload.Event) error {
+	_, err := a.AuthorizeScoped(ctx, claims, evt)
+	return err
+}
+
+// AuthorizeScoped implements ScopedAuthorizer, returning the namespaces the
+// policy restricted the event to.
+func (a *OPAAuthorizer) AuthorizeScoped(ctx context.Context, claims *oidc.Claims, evt *payload.Event) (*Decision, error) {
+	body, err := json.Marshal(map[string]opaInput{"input": {Claims: claims, Event: evt}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("policy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy request returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOPAResponseSize)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode policy response: %w", err)
+	}
+	return parseOPAResult(result.Result)
+}
+
+// parseOPAResult interprets a policy result as a Decision, returning an error
+// for anything other than an explicit allow.
+func parseOPAResult(raw json.RawMessage) (*Decision, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("policy decision is undefined")
+	}
+
+	var allow bool
+	if err := json.Unmarshal(raw, &allow); err == nil {
+		if !allow {
+			return nil, fmt.Errorf("denied by policy")
+		}
+		return &Decision{}, nil
+	}
+
+	var decision opaDecision
+	if err := json.Unmarshal(raw, &decision); err != nil {
+		return nil, fmt.Errorf("policy decision must be a boolean or an object: %w", err)
+	}
+	if !decision.Allow {
+		if decision.Reason != "" {
+			return nil, fmt.Errorf("denied by policy: %s", decision.Reason)
+		}
+		return nil, fmt.Errorf("denied by policy")
+	}
+	// An explicit empty list allows no namespace at all, rather than every one
+	if decision.Namespaces != nil && len(decision.Namespaces) == 0 {
+		return nil, fmt.Errorf("policy allowed no namespaces")
+	}
+	for _, pattern := range decision.Namespaces {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("policy returned invalid namespace pattern %q", pattern)
+		}
+	}
+	return &Decision{Namespaces: decision.Namespaces}, nil
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+)
+
+func TestOPAAuthorizer_AuthorizeScoped(t *testing.T) {
+	var input struct {
+		Input struct {
+			Claims map[string]any `json:"claims"`
+			Event  payload.Event  `json:"event"`
+		} `json:"input"`
+	}
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/data/kuberollouttrigger/decision" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Errorf("failed to decode input: %v", err)
+		}
+		w.Write([]byte(`{"result":{"allow":true,"namespaces":["team-a-*"]}}`))
+	}))
+	defer opa.Close()
+
+	a := NewOPAAuthorizer(opa.URL+"/v1/data/kuberollouttrigger/decision", time.Second)
+	claims := &oidc.Claims{Repository: "test-org/svc", RepositoryOwner: "test-org", Actor: "octocat"}
+	evt := &payload.Event{Image: "ghcr.io/test/svc", Tags: []string{"dev"}}
+
+	decision, err := a.AuthorizeScoped(context.Background(), claims, evt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decision.Namespaces, []string{"team-a-*"}) {
+		t.Errorf("unexpected namespaces %v", decision.Namespaces)
+	}
+	if input.Input.Claims["repository"] != "test-org/svc" || input.Input.Claims["actor"] != "octocat" {
+		t.Errorf("unexpected claims input %v", input.Input.Claims)
+	}
+	if input.Input.Event.Image != "ghcr.io/test/svc" {
+		t.Errorf("unexpected event input %+v", input.Input.Event)
+	}
+}
+
+func TestOPAAuthorizer_FailsClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, `{}`},
+		{"undefined decision", http.StatusOK, `{}`},
+		{"malformed response", http.StatusOK, `not json`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer opa.Close()
+
+			a := NewOPAAuthorizer(opa.URL, time.Second)
+			if err := a.Authorize(context.Background(), &oidc.Claims{}, &payload.Event{}); err == nil {
+				t.Error("expected the event to be denied")
+			}
+		})
+	}
+}
+
+func TestParseOPAResult(t *testing.T) {
+	tests := []struct {
+		result     string
+		wantErr    bool
+		namespaces []string
+	}{
+		{`true`, false, nil},
+		{`false`, true, nil},
+		{`null`, true, nil},
+		{`{"allow":true}`, false, nil},
+		{`{"allow":true,"namespaces":["dev","team-*"]}`, false, []string{"dev", "team-*"}},
+		{`{"allow":false,"reason":"repository not onboarded"}`, true, nil},
+		{`{"allow":true,"namespaces":[]}`, true, nil},
+		{`{"allow":true,"namespaces":["[bad"]}`, true, nil},
+		{`"yes"`, true, nil},
+	}
+	for _, tt := range tests {
+		decision, err := parseOPAResult(json.RawMessage(tt.result))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.result, tt.wantErr, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(decision.Namespaces, tt.namespaces) {
+			t.Errorf("%s: expected namespaces %v, got %v", tt.result, tt.namespaces, decision.Namespaces)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+// maxRateLimitKeys bounds the number of repositories tracked by the event rate
+// limiter. When it is reached, buckets that have refilled completely are
+// dropped, since forgetting them does not change any decision. If none has,
+// the bucket closest to refilling is dropped, giving its repository a full
+// burst early rather than letting the map grow.
+const maxRateLimitKeys = 1024
+
+// rateLimiter is a token bucket per key, refilled at rate tokens per second up
+// to burst tokens.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing perMinute events per key on
+// average with bursts of up to burst events. It returns nil if perMinute is
+// zero, which disables limiting.
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for key. If none is available it returns false and how
+// long until one will be.
+func (l *rateLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitKeys {
+			l.prune(now)
+		}
+		if len(l.buckets) >= maxRateLimitKeys {
+			l.evict(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Remaining returns the number of events key may send at once right now.
+// It is -1 if l is nil, as nothing is limited.
+func (l *rateLimiter) Remaining(key string) int {
+	if l == nil {
+		return -1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return int(l.burst)
+	}
+	tokens := math.Min(l.burst, b.tokens+l.now().Sub(b.last).Seconds()*l.rate)
+	return int(math.Floor(tokens))
+}
+
+// prune drops buckets that have refilled completely.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// evict drops the bucket closest to refilling completely.
+func (l *rateLimiter) evict(now time.Time) {
+	var fullest string
+	most := math.Inf(-1)
+	for key, b := range l.buckets {
+		if tokens := b.tokens + now.Sub(b.last).Seconds()*l.rate; tokens > most {
+			fullest, most = key, tokens
+		}
+	}
+	delete(l.buckets, fullest)
+}
+
+// SharedRateLimiter counts events in a store shared by all web replicas,
+// such as valkey.RateLimiter.
+type SharedRateLimiter interface {
+	// Allow counts an event of key. It returns whether the event is within
+	// the limit, how long until the next one will be if not, and how many
+	// more events key may send right away.
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, remaining int, err error)
+}
+
+// allowEvent takes one event of the rate limit of the repository of claims.
+// It returns whether the event is allowed, how long until the next one will
+// be if not, and how many events the repository may still send right away,
+// or -1 if that is unknown. An event is allowed if the shared limiter fails,
+// since rejecting every event during a Valkey outage would not protect
+// anything that the failing publish does not already.
+func (s *Server) allowEvent(ctx context.Context, logger *slog.Logger, claims *oidc.Claims) (bool, time.Duration, int) {
+	key := repositoryKey(claims)
+	if s.opts.SharedRateLimiter != nil {
+		ok, retryAfter, remaining, err := s.opts.SharedRateLimiter.Allow(ctx, key)
+		if err != nil {
+			rateLimitErrors.Inc()
+			logger.Warn("shared event rate limiter failed, allowing event", "repository", claims.Repository, "error", err)
+			return true, 0, -1
+		}
+		return ok, retryAfter, remaining
+	}
+	if ok, retryAfter := s.eventLimiter.Allow(key); !ok {
+		return false, retryAfter, 0
+	}
+	return true, 0, s.eventLimiter.Remaining(key)
+}
+
+// repositoryKey identifies the repository of claims across issuers, since
+// repositories of the same name on GitHub and, for example, a GitHub
+// Enterprise Server are different callers.
+func repositoryKey(claims *oidc.Claims) string {
+	return claims.Issuer + "\x00" + claims.Repository
+}
+
+// problem is an RFC 9457 problem details response body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeTooManyRequests writes a 429 problem+json response with a Retry-After
+// header in whole seconds, rounded up.
+func writeTooManyRequests(w http.ResponseWriter, detail string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  "Too Many Requests",
+		Status: http.StatusTooManyRequests,
+		Detail: detail,
+	})
+}
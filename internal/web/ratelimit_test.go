@@ -0,0 +1,184 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(6, 2) // one token every 10s, bursts of 2
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if ok, _ := l.Allow("org/repo"); !ok {
+			t.Fatalf("expected request %d within burst to be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("org/repo")
+	if ok {
+		t.Fatal("expected request beyond burst to be limited")
+	}
+	if wait != 10*time.Second {
+		t.Errorf("expected 10s wait, got %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.Allow("org/other"); !ok {
+		t.Error("expected a different repository to be allowed")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := l.Allow("org/repo"); !ok {
+		t.Error("expected a token after the refill interval")
+	}
+}
+
+func TestRateLimiter_Remaining(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(6, 2)
+	l.now = func() time.Time { return now }
+
+	if got := l.Remaining("org/repo"); got != 2 {
+		t.Errorf("expected the burst to remain for a new key, got %d", got)
+	}
+	l.Allow("org/repo")
+	l.Allow("org/repo")
+	if got := l.Remaining("org/repo"); got != 0 {
+		t.Errorf("expected nothing to remain after the burst, got %d", got)
+	}
+	now = now.Add(15 * time.Second)
+	if got := l.Remaining("org/repo"); got != 1 {
+		t.Errorf("expected one event to remain after a refill, got %d", got)
+	}
+
+	var disabled *rateLimiter
+	if got := disabled.Remaining("org/repo"); got != -1 {
+		t.Errorf("expected -1 without a limit, got %d", got)
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	l := newRateLimiter(0, 10)
+	if l != nil {
+		t.Fatal("expected nil limiter when disabled")
+	}
+	for range 100 {
+		if ok, _ := l.Allow("org/repo"); !ok {
+			t.Fatal("expected nil limiter to allow everything")
+		}
+	}
+}
+
+func TestRateLimiter_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(60, 1)
+	l.now = func() time.Time { return now }
+	for i := range maxRateLimitKeys {
+		l.Allow(strconv.Itoa(i))
+	}
+	now = now.Add(time.Minute)
+	l.Allow("new")
+	if len(l.buckets) != 1 {
+		t.Errorf("expected refilled buckets to be pruned, %d remain", len(l.buckets))
+	}
+}
+
+func TestRateLimiter_EvictsAtCapacity(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(6, 1) // one token every 10s
+	l.now = func() time.Time { return now }
+	for i := range maxRateLimitKeys {
+		l.Allow(strconv.Itoa(i))
+		now = now.Add(time.Millisecond)
+	}
+
+	// No bucket has refilled, so the one closest to it makes room
+	l.Allow("new")
+	if len(l.buckets) != maxRateLimitKeys {
+		t.Errorf("expected %d buckets to be tracked, got %d", maxRateLimitKeys, len(l.buckets))
+	}
+	if _, ok := l.buckets["0"]; ok {
+		t.Error("expected the bucket closest to refilling to be evicted")
+	}
+	if ok, _ := l.Allow(strconv.Itoa(maxRateLimitKeys - 1)); ok {
+		t.Error("expected a recently limited repository to stay limited")
+	}
+}
+
+// fakeSharedLimiter answers every Allow with its fields.
+type fakeSharedLimiter struct {
+	allowed    bool
+	retryAfter time.Duration
+	remaining  int
+	err        error
+	keys       []string
+}
+
+func (f *fakeSharedLimiter) Allow(_ context.Context, key string) (bool, time.Duration, int, error) {
+	f.keys = append(f.keys, key)
+	return f.allowed, f.retryAfter, f.remaining, f.err
+}
+
+func TestAllowEvent_Shared(t *testing.T) {
+	shared := &fakeSharedLimiter{allowed: true, remaining: 4}
+	srv := NewServer(nil, &mockPublisher{}, "ghcr.io/test/", testLogger(), Options{EventRateLimit: 1, EventRateBurst: 1, SharedRateLimiter: shared})
+	claims := &oidc.Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: oidc.GitHubOIDCIssuer}, Repository: "org/repo"}
+
+	// The shared limiter replaces the in-memory one, whose burst of 1 would throttle
+	for range 2 {
+		if ok, _, remaining := srv.allowEvent(context.Background(), testLogger(), claims); !ok || remaining != 4 {
+			t.Fatalf("expected the shared limiter to allow with 4 remaining, got %v %d", ok, remaining)
+		}
+	}
+	if len(shared.keys) != 2 || shared.keys[0] != oidc.GitHubOIDCIssuer+"\x00org/repo" {
+		t.Errorf("expected events counted by issuer and repository, got %q", shared.keys)
+	}
+
+	shared.allowed, shared.retryAfter, shared.remaining = false, 3*time.Second, 0
+	if ok, retryAfter, _ := srv.allowEvent(context.Background(), testLogger(), claims); ok || retryAfter != 3*time.Second {
+		t.Errorf("expected the shared limiter to throttle for 3s, got %v %v", ok, retryAfter)
+	}
+
+	// A failing shared limiter lets events through
+	shared.err = errors.New("connection refused")
+	before := rateLimitErrors.Value()
+	if ok, _, remaining := srv.allowEvent(context.Background(), testLogger(), claims); !ok || remaining != -1 {
+		t.Errorf("expected the event to be allowed with unknown remaining, got %v %d", ok, remaining)
+	}
+	if errs := rateLimitErrors.Value() - before; errs != 1 {
+		t.Errorf("expected 1 rate limit error counted, got %v", errs)
+	}
+}
+
+func TestWriteTooManyRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeTooManyRequests(w, "slow down", 1500*time.Millisecond)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2, got %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("unexpected content type %q", got)
+	}
+	var p problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 429 || p.Detail != "slow down" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+}
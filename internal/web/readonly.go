@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readOnlyRetryAfter is the Retry-After of events rejected in read-only
+// mode. Maintenance usually takes minutes, so clients need not retry sooner.
+const readOnlyRetryAfter = 30 * time.Second
+
+// readOnlyRequest is the body of POST /admin/read-only.
+type readOnlyRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// setReadOnly enables or disables read-only mode and reports whether it
+// changed.
+func (s *Server) setReadOnly(enabled bool) bool {
+	if s.readOnly.Swap(enabled) == enabled {
+		return false
+	}
+	if enabled {
+		readOnly.Set(1)
+	} else {
+		readOnly.Set(0)
+	}
+	return true
+}
+
+// writable wraps next so that it is answered with 503 and Retry-After while
+// the server is in read-only mode, without authenticating or publishing.
+func (s *Server) writable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly.Load() {
+			eventsRejectedReadOnly.Inc()
+			s.logger.Info("request rejected in read-only mode", "path", r.URL.Path, "request_id", requestIDFromContext(r.Context()))
+			w.Header().Set("Retry-After", strconv.Itoa(int(readOnlyRetryAfter.Seconds())))
+			http.Error(w, "Read-only for maintenance, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleAdminReadOnly enables or disables read-only mode on this web
+// instance, so that events are rejected during planned Valkey maintenance
+// while health checks stay green.
+func (s *Server) handleAdminReadOnly(w http.ResponseWriter, r *http.Request) {
+	logger := s.logger.With("request_id", requestIDFromContext(r.Context()))
+
+	actor, ok := s.authorizeControl(w, r, logger, "read_only")
+	if !ok {
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxPayloadSize))
+	dec.DisallowUnknownFields()
+	var req readOnlyRequest
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid JSON payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Enabled == nil {
+		http.Error(w, "enabled is required", http.StatusBadRequest)
+		return
+	}
+
+	if s.setReadOnly(*req.Enabled) {
+		// Logged at warn so the change is recorded whatever the level
+		logger.Warn("read-only mode changed", "enabled", *req.Enabled, "actor", actor)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	srv := newAdminTestServerWithOptions(Options{
+		AdminToken: "s3cret",
+		ReadOnly:   true,
+		Ready:      func() error { return errors.New("valkey connection lost") },
+	})
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	ready := func() int {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code
+	}
+
+	before := eventsRejectedReadOnly.Value()
+	w := post("/event", `{"image":"ghcr.io/test/svc","tags":["dev"]}`)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("expected 503 with Retry-After 30, got %d %v", w.Code, w.Header())
+	}
+	if rejected := eventsRejectedReadOnly.Value() - before; rejected != 1 {
+		t.Errorf("expected 1 rejected event counted, got %v", rejected)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected readiness to ignore Valkey while read-only, got %d", code)
+	}
+	if readOnly.Value() != 1 {
+		t.Errorf("expected the read-only gauge to be 1, got %v", readOnly.Value())
+	}
+
+	for _, body := range []string{`{}`, `{"enabled":"no"}`, `{"enabled":false,"until":"noon"}`} {
+		if w := post("/admin/read-only", body); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	if w := post("/admin/read-only", `{"enabled":false}`); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	// The admin token is no OIDC token, so the event now fails authentication instead
+	if w := post("/event", `{"image":"ghcr.io/test/svc","tags":["dev"]}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the event to be processed after disabling read-only, got %d", w.Code)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to check Valkey again, got %d", code)
+	}
+
+	if w := post("/admin/read-only", `{"enabled":true}`); w.Code != http.StatusNoContent || !srv.readOnly.Load() {
+		t.Errorf("expected read-only to be enabled again, got %d", w.Code)
+	}
+}
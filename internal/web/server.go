@@ -4,15 +4,18 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/admintoken"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/routing"
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
 )
 
@@ -20,33 +23,203 @@ const maxPayloadSize = 1 << 20 // 1MB
 
 type requestIDContextKey struct{}
 
+// Options configures optional web server behavior.
+type Options struct {
+	// AuthFailureLogWindow aggregates identical authentication failure warnings
+	// into one entry per window. Zero logs every failure at warn level.
+	AuthFailureLogWindow time.Duration
+
+	// AuditLogger receives an audit record of every authentication attempt,
+	// apart from the operational logs. Nil records nothing.
+	AuditLogger *slog.Logger
+
+	// ProtectedTags are tag patterns only accepted when the event includes a digest.
+	ProtectedTags []string
+
+	// AdminToken enables the /admin endpoints, authenticated with this static
+	// bearer token. Empty disables them.
+	AdminToken string
+
+	// AdminTokens are namespace-scoped tokens that also enable the /admin
+	// endpoints, limited to the namespaces each token allows.
+	AdminTokens *admintoken.Set
+
+	// EventRateLimit is the average number of events per minute accepted from
+	// one repository. Zero disables rate limiting.
+	EventRateLimit int
+
+	// EventRateBurst is the number of events a repository may send at once
+	// before EventRateLimit applies.
+	EventRateBurst int
+
+	// SharedRateLimiter, if set, replaces the in-memory limiter of
+	// EventRateLimit so that the limit holds across web replicas.
+	SharedRateLimiter SharedRateLimiter
+
+	// IdempotencyKeyTTL is how long the Idempotency-Key of an accepted event
+	// is remembered: a repeated request with the key is answered with 202
+	// without publishing again. Zero ignores the header.
+	IdempotencyKeyTTL time.Duration
+
+	// LoadShedMaxInFlight is the number of /event and deployment webhook
+	// requests processed at once, beyond which requests are rejected with
+	// 503. Zero disables the limit.
+	LoadShedMaxInFlight int
+
+	// LoadShedMaxHeapBytes is the heap size beyond which /event and
+	// deployment webhook requests are rejected with 503. Zero disables the
+	// limit.
+	LoadShedMaxHeapBytes uint64
+
+	// ReadOnly starts the server in read-only mode, rejecting events with
+	// 503 until it is disabled through POST /admin/read-only.
+	ReadOnly bool
+
+	// Authorizer decides whether an authenticated event may be published.
+	// Nil uses AllowAll.
+	Authorizer Authorizer
+
+	// ChannelRoutes publishes events to other channels by image prefix or
+	// tag. Tags of one event that route to different channels are published
+	// as separate events. Nil publishes everything to the default channel.
+	ChannelRoutes *routing.ChannelTable
+
+	// LogLevel is the level of the server logger, changed by
+	// POST /admin/log-level. Nil only changes the level of the workers.
+	LogLevel *slog.LevelVar
+
+	// RequireReceivers fails requests with 503 when a message was published
+	// while no worker was subscribed to its channel. Either way it is
+	// logged and counted.
+	RequireReceivers bool
+
+	// SchemaValidation validates /event payloads against the event JSON
+	// Schema before decoding them, so errors name the invalid value by
+	// JSON Pointer.
+	SchemaValidation bool
+
+	// PayloadStrictness is how unknown fields of /event and deployment
+	// payloads are handled. Empty is strict.
+	PayloadStrictness payload.Strictness
+
+	// Ready returns an error while the server cannot publish events, failing
+	// GET /readyz with 503. Nil is always ready.
+	Ready func() error
+
+	// GitHubWebhookSecret verifies the signature of GitHub deployment
+	// webhooks. Empty disables POST /github/deployment.
+	GitHubWebhookSecret string
+
+	// DeploymentEnvironments maps the environments of GitHub deployment
+	// webhooks to the tag and namespaces they roll out. Deployments to other
+	// environments are ignored.
+	DeploymentEnvironments *routing.EnvironmentTable
+}
+
+// Publisher publishes messages for workers. *valkey.Publisher implements it.
+type Publisher interface {
+	// Publish publishes message to the default channel and returns the
+	// number of subscribers that received it.
+	Publish(ctx context.Context, message string) (int64, error)
+	// PublishTo publishes message to channel and returns the number of
+	// subscribers that received it.
+	PublishTo(ctx context.Context, channel, message string) (int64, error)
+	// Request publishes message to the default channel and waits for the
+	// first reply on replyChannel. It returns valkey.ErrNoReceivers if no
+	// worker received the message.
+	Request(ctx context.Context, replyChannel, message string) (string, error)
+	// Channel returns the default channel.
+	Channel() string
+}
+
 // Server is the HTTP server for web mode.
 type Server struct {
 	validator    *oidc.Validator
-	publisher    *valkey.Publisher
+	publisher    Publisher
 	imagePrefix  string
 	logger       *slog.Logger
+	authFailures *authFailureLogger
+	eventLimiter *rateLimiter
+	idempotency  *idempotencyCache
+	shedder      *loadShedder
+	opts         Options
 	publishCount atomic.Int64
+	readOnly     atomic.Bool
 }
 
 // NewServer creates a new web mode HTTP server.
-func NewServer(validator *oidc.Validator, publisher *valkey.Publisher, imagePrefix string, logger *slog.Logger) *Server {
-	return &Server{
-		validator:   validator,
-		publisher:   publisher,
-		imagePrefix: imagePrefix,
-		logger:      logger,
+func NewServer(validator *oidc.Validator, publisher Publisher, imagePrefix string, logger *slog.Logger, opts Options) *Server {
+	s := &Server{
+		validator:    validator,
+		publisher:    publisher,
+		imagePrefix:  imagePrefix,
+		logger:       logger,
+		authFailures: newAuthFailureLogger(logger, opts.AuthFailureLogWindow),
+		eventLimiter: newRateLimiter(opts.EventRateLimit, opts.EventRateBurst),
+		idempotency:  newIdempotencyCache(opts.IdempotencyKeyTTL),
+		shedder:      newLoadShedder(opts.LoadShedMaxInFlight, opts.LoadShedMaxHeapBytes),
+		opts:         opts,
+	}
+	if s.opts.Authorizer == nil {
+		s.opts.Authorizer = AllowAll
 	}
+	s.setReadOnly(opts.ReadOnly)
+	return s
 }
 
 // Handler returns the HTTP handler with all routes configured.
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /event", s.handleEvent)
-	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.registerEventRoutes(mux)
+	s.registerOperationalRoutes(mux)
+	return s.requestLoggingMiddleware(mux)
+}
+
+// EventHandler returns the HTTP handler serving only POST /event, the event
+// schema and the GitHub deployment webhook, for a listener exposed through an
+// ingress.
+func (s *Server) EventHandler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerEventRoutes(mux)
 	return s.requestLoggingMiddleware(mux)
 }
 
+// OperationalHandler returns the HTTP handler serving /healthz, /readyz,
+// /metrics and the /admin routes, for a listener that is not exposed
+// publicly.
+func (s *Server) OperationalHandler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerOperationalRoutes(mux)
+	return s.requestLoggingMiddleware(mux)
+}
+
+// registerEventRoutes registers POST /event and /events/stream, the schema
+// of the event payload and, when configured, the GitHub deployment webhook.
+func (s *Server) registerEventRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /event", s.writable(s.shed(s.handleEvent)))
+	mux.HandleFunc("POST /events/stream", s.writable(s.shed(s.handleEventStream)))
+	mux.HandleFunc("GET /schema/event.json", handleEventSchema)
+	if s.opts.GitHubWebhookSecret != "" {
+		mux.HandleFunc("POST /github/deployment", s.writable(s.shed(s.handleGitHubDeployment)))
+	}
+}
+
+// registerOperationalRoutes registers every route except the event routes.
+func (s *Server) registerOperationalRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.Handle("GET /metrics", metrics.Default.Handler())
+	if s.opts.AdminToken != "" || s.opts.AdminTokens.Len() > 0 {
+		mux.HandleFunc("POST /admin/restart", s.handleAdminRestart)
+		mux.HandleFunc("GET /admin/matches", s.handleAdminMatches)
+		mux.HandleFunc("GET /admin/oidc-status", s.handleAdminOIDCStatus)
+		mux.HandleFunc("POST /admin/pause", s.handleAdminPause)
+		mux.HandleFunc("POST /admin/resume", s.handleAdminResume)
+		mux.HandleFunc("POST /admin/log-level", s.handleAdminLogLevel)
+		mux.HandleFunc("POST /admin/read-only", s.handleAdminReadOnly)
+	}
+}
+
 func generateRequestID() string {
 	b := make([]byte, 8)
 	if _, err := rand.Read(b); err != nil {
@@ -55,6 +228,78 @@ func generateRequestID() string {
 	return hex.EncodeToString(b)
 }
 
+// generateEventID returns the ID of an accepted event. Unlike the request
+// ID, which a client or proxy may choose, it is always generated here, so a
+// caller cannot make two events share an ID.
+func generateEventID() string {
+	return generateRequestID()
+}
+
+// maxRequestIDLength caps request IDs accepted from upstream proxies.
+const maxRequestIDLength = 128
+
+// incomingRequestID returns the request ID set by an upstream proxy or
+// client: a valid X-Request-Id, or else the trace ID of a valid W3C
+// traceparent header. It returns "" if neither is usable.
+func incomingRequestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); validRequestID(id) {
+		return id
+	}
+	if traceID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		return traceID
+	}
+	return ""
+}
+
+// validRequestID reports whether id is short and only uses characters that
+// are safe to log and echo in a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceparent returns the trace ID of a W3C traceparent header,
+// version-traceid-parentid-flags, such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(header string) (string, bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", false
+	}
+	// Future versions may append fields, but version 00 has exactly four
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", false
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	if !isLowerHex(parts[0]) || len(traceID) != 32 || !isLowerHex(traceID) ||
+		len(parentID) != 16 || !isLowerHex(parentID) || len(flags) != 2 || !isLowerHex(flags) {
+		return "", false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return "", false
+	}
+	return traceID, true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func withRequestID(ctx context.Context, requestID string) context.Context {
 	return context.WithValue(ctx, requestIDContextKey{}, requestID)
 }
@@ -85,7 +330,11 @@ func (r *statusRecorder) Write(b []byte) (int, error) {
 
 func (s *Server) requestLoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := generateRequestID()
+		// Reuse the ID of an ingress or client so their logs correlate
+		requestID := incomingRequestID(r)
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
 		start := time.Now()
 		logger := s.logger.With("request_id", requestID)
 
@@ -126,24 +375,171 @@ func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	claims, ok := s.authenticate(w, r, logger)
+	if !ok {
+		return
+	}
+
+	// The body is read first, as a replayed request must carry the same one
+	body, err := readBody(w, r)
+	if err != nil {
+		logger.Warn("failed to read request body", "content_encoding", r.Header.Get("Content-Encoding"), "error", err.Error())
+		writeBodyError(w, err)
+		return
+	}
+
+	accepted := acceptedEvent{ID: generateEventID()}
+
+	// A workflow retrying after a network timeout sends the key of a request
+	// that may have been accepted, which is answered without publishing again
+	if key := r.Header.Get("Idempotency-Key"); key != "" && s.idempotency != nil {
+		if !idempotencyKeyPattern.MatchString(key) {
+			http.Error(w, "Idempotency-Key must be 1 to 255 printable ASCII characters", http.StatusBadRequest)
+			return
+		}
+		// Keys are scoped to the repository, so one cannot suppress another's events
+		cacheKey := repositoryKey(claims) + "\x00" + key
+		switch state, original := s.idempotency.Begin(cacheKey, body); state {
+		case idempotencyReplay:
+			idempotentReplays.Inc()
+			logger.Info("event already accepted for idempotency key", "repository", claims.Repository, "idempotency_key", key, "event_id", original.ID)
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeAccepted(w, original)
+			return
+		case idempotencyInProgress:
+			logger.Warn("event with idempotency key already in progress", "repository", claims.Repository, "idempotency_key", key)
+			http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+			return
+		case idempotencyMismatch:
+			logger.Warn("idempotency key reused with a different request body", "repository", claims.Repository, "idempotency_key", key)
+			http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			if recorder.status == http.StatusAccepted {
+				s.idempotency.Complete(cacheKey, accepted)
+			} else {
+				s.idempotency.Abort(cacheKey)
+			}
+		}()
+	}
+
+	ok, retryAfter, remaining := s.allowEvent(r.Context(), logger, claims)
+	if !ok {
+		eventsThrottled.Inc()
+		logger.Warn("event rate limit exceeded", "repository", claims.Repository, "retry_after", retryAfter.String())
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		writeTooManyRequests(w, "event rate limit exceeded for repository "+claims.Repository, retryAfter)
+		return
+	}
+	if remaining >= 0 {
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	}
+
+	evt, decision, rerr := s.acceptEvent(r.Context(), logger, claims, body)
+	if rerr != nil {
+		http.Error(w, rerr.message, rerr.status)
+		return
+	}
+
+	receivers, ok := s.publishEvent(w, r, logger, evt, triggerFor(claims), decision.Namespaces)
+	if !ok {
+		return
+	}
+	accepted.Receivers = receivers
+	writeAccepted(w, accepted)
+}
+
+// acceptEvent validates an event payload sent by the holder of claims and
+// authorizes it. It returns the error to answer if the event is rejected.
+func (s *Server) acceptEvent(ctx context.Context, logger *slog.Logger, claims *oidc.Claims, body []byte) (*payload.Event, *Decision, *responseError) {
+	if s.opts.SchemaValidation {
+		if err := payload.ValidateEventSchema(body); err != nil {
+			logger.Warn("payload schema validation failed", "error", err.Error())
+			return nil, nil, &responseError{http.StatusBadRequest, err.Error()}
+		}
+	}
+
+	evt, unknown, err := payload.ParseAndValidateWith(body, s.imagePrefix, s.opts.PayloadStrictness)
+	if err != nil {
+		logger.Warn("payload validation failed", "error", err.Error())
+		return nil, nil, &responseError{http.StatusBadRequest, err.Error()}
+	}
+	if unknown != "" {
+		logger.Warn("payload has unknown field", "field", unknown)
+	}
+
+	if err := evt.RequireDigest(s.opts.ProtectedTags); err != nil {
+		logger.Warn("protected tag without digest rejected", "image", evt.Image, "tags", evt.Tags, "error", err.Error())
+		return nil, nil, &responseError{http.StatusBadRequest, err.Error()}
+	}
+
+	decision, err := s.authorize(ctx, claims, evt)
+	if err != nil {
+		logger.Warn("event not authorized",
+			"repository", claims.Repository,
+			"image", evt.Image,
+			"tags", evt.Tags,
+			"error", err.Error(),
+		)
+		return nil, nil, &responseError{http.StatusForbidden, "Forbidden"}
+	}
+	return evt, decision, nil
+}
+
+// triggerFor returns the trigger attached to events sent by the holder of
+// claims, so the worker can attribute the restart. Only selected claims are
+// forwarded, never the token itself.
+func triggerFor(claims *oidc.Claims) *payload.Trigger {
+	return &payload.Trigger{
+		Issuer:          claims.Issuer,
+		Repository:      claims.Repository,
+		RepositoryOwner: claims.RepositoryOwner,
+		Actor:           claims.Actor,
+		RunID:           claims.RunID,
+		SHA:             claims.SHA,
+	}
+}
+
+// authenticate validates the bearer token of r and returns its claims. It
+// writes the 401 response and returns false if the token is missing or
+// invalid.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (*oidc.Claims, bool) {
 	// Extract and validate Bearer token
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		logger.Warn("missing or invalid authorization header")
+		tokenValidations.WithLabelValues(outcomeMissingToken).Inc()
+		s.audit(r, authAttempt{Method: authMethodOIDC, Outcome: auditMissingToken})
+		s.authFailures.Log(logger, "missing_authorization", "missing or invalid authorization header", nil)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return nil, false
 	}
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 	// Validate OIDC token
 	claims, err := s.validator.ValidateToken(tokenString)
 	if err != nil {
-		inspection := oidc.InspectToken(tokenString)
+		reason := oidc.FailureReason(err)
+		tokenValidations.WithLabelValues(reason).Inc()
+
+		inspection := s.validator.InspectToken(tokenString)
+		expected := s.validator.ForToken(tokenString)
+		s.audit(r, authAttempt{
+			Method:          authMethodOIDC,
+			Outcome:         reason,
+			TokenHash:       inspection.TokenHash,
+			Repository:      inspection.Repository,
+			RepositoryOwner: inspection.RepositoryOwner,
+		})
 		logAttrs := []any{
-			"error", err.Error(),
-			"expected_issuer", oidc.GitHubOIDCIssuer,
-			"expected_audience", s.validator.Audience(),
-			"expected_repository_owner", s.validator.AllowedOrg(),
+			"error", oidc.RedactToken(err.Error(), tokenString),
+			"reason", reason,
+			"token_hash", inspection.TokenHash,
+			"expected_issuer", expected.Issuer(),
+			"expected_audience", expected.Audience(),
+			"expected_repository_owner", expected.AllowedOrg(),
 		}
 		if inspection.ParseError != "" {
 			logAttrs = append(logAttrs, "token_parse_error", inspection.ParseError)
@@ -157,57 +553,210 @@ func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
 				"token_claim_repository", inspection.Repository,
 			)
 		}
-		logger.Warn("OIDC token validation failed", logAttrs...)
+		// Scanners produce bursts of identical failures; aggregate them by
+		// error and claimed issuer/owner so the warning stream stays readable.
+		signature := oidc.RedactToken(err.Error(), tokenString) + "|" + inspection.Issuer + "|" + inspection.RepositoryOwner
+		s.authFailures.Log(logger, signature, "OIDC token validation failed", logAttrs)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return nil, false
 	}
 
+	tokenValidations.WithLabelValues(outcomeSuccess).Inc()
+	s.audit(r, authAttempt{
+		Method:          authMethodOIDC,
+		Outcome:         auditSuccess,
+		Verified:        true,
+		TokenHash:       oidc.TokenHash(tokenString),
+		Repository:      claims.Repository,
+		RepositoryOwner: claims.RepositoryOwner,
+		Actor:           claims.Actor,
+		RunID:           claims.RunID,
+	})
 	logger.Info("authenticated request",
+		"token_hash", oidc.TokenHash(tokenString),
 		"repository_owner", claims.RepositoryOwner,
 		"repository", claims.Repository,
+		"actor", claims.Actor,
+		"run_id", claims.RunID,
 	)
+	return claims, true
+}
 
-	// Read and validate payload
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+// writeAccepted writes the 202 response for an accepted event, with headers
+// identifying the event and how many workers received it, so callers and
+// proxies see them without a body.
+func writeAccepted(w http.ResponseWriter, event acceptedEvent) {
+	w.Header().Set("X-Event-Id", event.ID)
+	w.Header().Set("X-Published-Receivers", strconv.FormatInt(event.Receivers, 10))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// publishEvent publishes evt with publish. It writes the error response and
+// returns false if the event could not be published.
+func (s *Server) publishEvent(w http.ResponseWriter, r *http.Request, logger *slog.Logger, evt *payload.Event, trigger *payload.Trigger, namespaces []string) (int64, bool) {
+	receivers, err := s.publish(r.Context(), logger, evt, trigger, namespaces)
 	if err != nil {
-		logger.Error("failed to read request body", "error", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+		http.Error(w, err.message, err.status)
+		return 0, false
 	}
+	return receivers, true
+}
 
-	evt, err := payload.ParseAndValidate(body, s.imagePrefix)
-	if err != nil {
-		logger.Warn("payload validation failed", "error", err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// responseError is a failure answered with an HTTP status and message.
+type responseError struct {
+	status  int
+	message string
+}
+
+// publish publishes evt for trigger, restricted to namespaces if any, as one
+// message per channel with the tags routed to it, and returns the number of
+// workers that received the messages. It returns the error to answer if a
+// message could not be published, or if no worker received it and
+// RequireReceivers is set.
+func (s *Server) publish(ctx context.Context, logger *slog.Logger, evt *payload.Event, trigger *payload.Trigger, namespaces []string) (int64, *responseError) {
+	var total int64
+	for _, route := range s.routeEvent(evt) {
+		msg := &payload.Message{
+			Event:      route.event,
+			Trigger:    trigger,
+			Namespaces: namespaces,
+		}
+
+		// Serialize to minimal JSON for publishing
+		jsonBytes, err := msg.ToJSON()
+		if err != nil {
+			logger.Error("failed to serialize event", "error", err)
+			return 0, &responseError{http.StatusInternalServerError, "Internal server error"}
+		}
+
+		// Publish to Valkey
+		receivers, err := s.publisher.PublishTo(ctx, route.channel, string(jsonBytes))
+		if err != nil {
+			logger.Error("failed to publish to Valkey", "channel", route.channel, "error", err)
+			return 0, &responseError{http.StatusBadGateway, "Service unavailable"}
+		}
+		if err := s.receiversError(logger, route.channel, receivers); err != nil {
+			return 0, err
+		}
+
+		total += receivers
+		count := s.publishCount.Add(1)
+		logger.Info("event published",
+			"channel", route.channel,
+			"image", route.event.Image,
+			"tags", route.event.Tags,
+			"digest", route.event.Digest,
+			"image_refs", route.event.ImageRefs(),
+			"priority", route.event.Priority,
+			"receivers", receivers,
+			"total_published", count,
+		)
 	}
+	return total, nil
+}
 
-	// Serialize to minimal JSON for publishing
-	jsonBytes, err := evt.ToJSON()
-	if err != nil {
-		logger.Error("failed to serialize event", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+// handleEventSchema serves the JSON Schema of the /event payload.
+func handleEventSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(payload.EventSchema())
+}
+
+// checkReceivers checks receivers with receiversError. It writes the 503
+// response and returns false if the message must be failed.
+func (s *Server) checkReceivers(w http.ResponseWriter, logger *slog.Logger, channel string, receivers int64) bool {
+	if err := s.receiversError(logger, channel, receivers); err != nil {
+		http.Error(w, err.message, err.status)
+		return false
 	}
+	return true
+}
 
-	// Publish to Valkey
-	if err := s.publisher.Publish(r.Context(), string(jsonBytes)); err != nil {
-		logger.Error("failed to publish to Valkey", "error", err)
-		http.Error(w, "Service unavailable", http.StatusBadGateway)
-		return
+// receiversError logs and counts a message published to channel while no
+// worker was subscribed, since it is lost. With RequireReceivers it returns
+// a 503 error.
+func (s *Server) receiversError(logger *slog.Logger, channel string, receivers int64) *responseError {
+	if receivers > 0 {
+		return nil
 	}
+	publishedWithoutReceivers.WithLabelValues(channel).Inc()
+	logger.Warn("message published with no worker subscribed, it was not delivered", "channel", channel)
+	if s.opts.RequireReceivers {
+		return &responseError{http.StatusServiceUnavailable, "No worker is subscribed"}
+	}
+	return nil
+}
 
-	count := s.publishCount.Add(1)
-	logger.Info("event published",
-		"image", evt.Image,
-		"tags", evt.Tags,
-		"total_published", count,
-	)
+// routedEvent is the part of an event published to one channel.
+type routedEvent struct {
+	channel string
+	event   *payload.Event
+}
 
-	w.WriteHeader(http.StatusAccepted)
+// routeEvent splits evt by the channel each tag routes to, in order of each
+// channel's first tag. Without channel routes the whole event goes to the
+// default channel. High priority events go to the priority channel of each
+// channel instead.
+func (s *Server) routeEvent(evt *payload.Event) []routedEvent {
+	routes := s.routeTags(evt)
+	if evt.HighPriority() {
+		for i := range routes {
+			routes[i].channel = valkey.PriorityChannel(routes[i].channel)
+		}
+	}
+	return routes
+}
+
+// routeTags splits evt by the channel each tag routes to. The tags of a
+// multi-image event are routed per image, and each channel receives only the
+// images with a tag routed to it.
+func (s *Server) routeTags(evt *payload.Event) []routedEvent {
+	defaultChannel := s.publisher.Channel()
+	if s.opts.ChannelRoutes.Len() == 0 {
+		return []routedEvent{{channel: defaultChannel, event: evt}}
+	}
+
+	var routes []routedEvent
+	index := make(map[string]int)
+	for _, part := range evt.Parts() {
+		for _, tag := range part.Tags {
+			channel := s.opts.ChannelRoutes.Channel(part.Image, tag, defaultChannel)
+			i, ok := index[channel]
+			if !ok {
+				i = len(routes)
+				index[channel] = i
+				routes = append(routes, routedEvent{channel: channel, event: &payload.Event{Priority: evt.Priority}})
+			}
+			routed := routes[i].event
+			if evt.Images == nil {
+				routed.Image, routed.Digest = part.Image, part.Digest
+				routed.Tags = append(routed.Tags, tag)
+				continue
+			}
+			// Parts are visited in order, so the image is either the last one
+			// added to this channel or not there yet
+			if n := len(routed.Images); n == 0 || routed.Images[n-1].Image != part.Image {
+				routed.Images = append(routed.Images, payload.EventImage{Image: part.Image, Digest: part.Digest})
+			}
+			last := &routed.Images[len(routed.Images)-1]
+			last.Tags = append(last.Tags, tag)
+		}
+	}
+	return routes
 }
 
 func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
 }
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	// Valkey is expected to be down while in read-only mode
+	if s.opts.Ready != nil && !s.readOnly.Load() {
+		if err := s.opts.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
@@ -1,23 +1,29 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/jsonschema"
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/routing"
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
 
 	"github.com/redis/go-redis/v9"
@@ -74,24 +80,39 @@ func createSignedToken(t *testing.T, key *rsa.PrivateKey, kid string, claims oid
 	return signed
 }
 
-// mockPublisher is a test double for valkey.Publisher
+// mockPublisher is a test double for valkey.Publisher. Unless noReceivers is
+// set, every message is received by one worker.
 type mockPublisher struct {
-	published []string
-	failNext  bool
+	published   []string
+	failNext    bool
+	noReceivers bool
 }
 
-func (m *mockPublisher) Publish(ctx context.Context, message string) error {
+func (m *mockPublisher) Publish(ctx context.Context, message string) (int64, error) {
 	if m.failNext {
-		return context.DeadlineExceeded
+		return 0, context.DeadlineExceeded
 	}
 	m.published = append(m.published, message)
-	return nil
+	if m.noReceivers {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (m *mockPublisher) PublishTo(ctx context.Context, channel, message string) (int64, error) {
+	return m.Publish(ctx, message)
 }
 
+func (m *mockPublisher) Request(ctx context.Context, replyChannel, message string) (string, error) {
+	return "", context.DeadlineExceeded
+}
+
+func (m *mockPublisher) Channel() string { return "test" }
+
 func TestHandleHealthz(t *testing.T) {
 	v := oidc.NewValidator("aud", "org", true, testLogger())
 	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
-	srv := NewServer(v, pub, "ghcr.io/test/", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
 
 	req := httptest.NewRequest("GET", "/healthz", nil)
 	w := httptest.NewRecorder()
@@ -108,7 +129,7 @@ func TestHandleHealthz(t *testing.T) {
 func TestHandleEvent_MissingAuth(t *testing.T) {
 	v := oidc.NewValidator("aud", "org", true, testLogger())
 	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
-	srv := NewServer(v, pub, "ghcr.io/test/", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
 
 	req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
 	req.Header.Set("Content-Type", "application/json")
@@ -123,7 +144,7 @@ func TestHandleEvent_MissingAuth(t *testing.T) {
 func TestHandleEvent_InvalidContentType(t *testing.T) {
 	v := oidc.NewValidator("aud", "org", true, testLogger())
 	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
-	srv := NewServer(v, pub, "ghcr.io/test/", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
 
 	req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
 	req.Header.Set("Content-Type", "text/plain")
@@ -145,7 +166,7 @@ func TestHandleEvent_WrongOrg(t *testing.T) {
 	v.SetJWKSURL(jwksSrv.URL)
 
 	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
-	srv := NewServer(v, pub, "ghcr.io/test/", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
 
 	claims := oidc.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -180,7 +201,7 @@ func TestHandleEvent_InvalidPayload(t *testing.T) {
 	v.SetJWKSURL(jwksSrv.URL)
 
 	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
-	srv := NewServer(v, pub, "ghcr.io/test/", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
 
 	claims := oidc.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -210,7 +231,7 @@ func TestHandleEvent_InvalidPayload(t *testing.T) {
 func TestHandleEvent_MethodNotAllowed(t *testing.T) {
 	v := oidc.NewValidator("aud", "org", true, testLogger())
 	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
-	srv := NewServer(v, pub, "ghcr.io/test/", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
 
 	req := httptest.NewRequest("GET", "/event", nil)
 	w := httptest.NewRecorder()
@@ -220,3 +241,405 @@ func TestHandleEvent_MethodNotAllowed(t *testing.T) {
 		t.Errorf("expected 405, got %d", w.Code)
 	}
 }
+
+func TestHandleMetrics_TokenValidationOutcomes(t *testing.T) {
+	v := oidc.NewValidator("aud", "org", true, testLogger())
+	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
+
+	before := tokenValidations.WithLabelValues(outcomeMissingToken).Value()
+
+	req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := tokenValidations.WithLabelValues(outcomeMissingToken).Value(); got != before+1 {
+		t.Errorf("expected missing_token counter to increase by 1, got %v -> %v", before, got)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `kuberollouttrigger_token_validations_total{outcome="missing_token"}`) {
+		t.Errorf("expected token validation metric in output, got:\n%s", w.Body.String())
+	}
+}
+
+func TestHandleEvent_ProtectedTagRequiresDigest(t *testing.T) {
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{ProtectedTags: []string{"prod"}})
+
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+	})
+
+	req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["prod"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "requires a digest") {
+		t.Errorf("expected digest error, got %q", w.Body.String())
+	}
+}
+
+func TestHandleEvent_RateLimited(t *testing.T) {
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	// Nothing listens on this address, so the event within the limit fails to publish
+	pub := valkey.NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{EventRateLimit: 1, EventRateBurst: 1})
+
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+		Repository:      "test-org/svc",
+	})
+
+	var codes []int
+	for range 2 {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("expected Retry-After header on 429")
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+			t.Errorf("expected X-RateLimit-Remaining 0, got %q", got)
+		}
+	}
+
+	if codes[0] != http.StatusBadGateway || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("expected 502 then 429, got %v", codes)
+	}
+}
+
+func TestHandleEvent_NoReceivers(t *testing.T) {
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+	})
+
+	// A lost event is only counted unless receivers are required
+	for _, tc := range []struct {
+		require bool
+		want    int
+	}{
+		{require: false, want: http.StatusAccepted},
+		{require: true, want: http.StatusServiceUnavailable},
+	} {
+		v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+		pub := &mockPublisher{noReceivers: true}
+		srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{RequireReceivers: tc.require})
+		before := publishedWithoutReceivers.WithLabelValues("test").Value()
+
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+
+		if w.Code != tc.want {
+			t.Errorf("require=%v: expected %d, got %d", tc.require, tc.want, w.Code)
+		}
+		if got := publishedWithoutReceivers.WithLabelValues("test").Value() - before; got != 1 {
+			t.Errorf("require=%v: expected 1 message counted without receivers, got %v", tc.require, got)
+		}
+	}
+}
+
+func TestHandleEvent_SchemaValidation(t *testing.T) {
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+	})
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	srv := NewServer(v, &mockPublisher{}, "ghcr.io/test/", testLogger(), Options{SchemaValidation: true})
+
+	req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev",""]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "/tags/1") {
+		t.Errorf("expected the error to point at /tags/1, got %q", w.Body.String())
+	}
+}
+
+func TestHandleEventSchema(t *testing.T) {
+	v := oidc.NewValidator("aud", "org", true, testLogger())
+	srv := NewServer(v, &mockPublisher{}, "ghcr.io/test/", testLogger(), Options{})
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/schema/event.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/schema+json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if _, err := jsonschema.Compile(w.Body.Bytes()); err != nil {
+		t.Errorf("served schema does not compile: %v", err)
+	}
+}
+
+func TestHandleEvent_LogsNeverContainToken(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	key := generateTestKey(t)
+	jwksSrv := serveJWKS(t, key, "kid")
+	v := oidc.NewValidator("test-audience", "test-org", false, logger)
+	v.SetJWKSURL(jwksSrv.URL)
+	pub := valkey.NewPublisher(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, "test", logger)
+	srv := NewServer(v, pub, "ghcr.io/test/", logger, Options{})
+
+	validClaims := oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		RepositoryOwner: "test-org",
+		Repository:      "test-org/svc",
+	}
+	wrongOrg := validClaims
+	wrongOrg.RepositoryOwner = "other-org"
+
+	tokens := []string{
+		createSignedToken(t, key, "kid", validClaims),
+		createSignedToken(t, key, "kid", wrongOrg),
+		createSignedToken(t, generateTestKey(t), "kid", validClaims),
+		"garbage.secretpayloadsegment.secretsignaturesegment",
+	}
+	for _, tok := range tokens {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(`{"image":"ghcr.io/test/svc","tags":["dev"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tok)
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	output := logs.String()
+	for _, tok := range tokens {
+		for _, segment := range strings.Split(tok, ".") {
+			if len(segment) >= 8 && strings.Contains(output, segment) {
+				t.Errorf("logs contain token segment %q", segment)
+			}
+		}
+		if !strings.Contains(output, oidc.TokenHash(tok)) {
+			t.Errorf("expected logs to contain hash %s", oidc.TokenHash(tok))
+		}
+	}
+}
+
+func TestRouteEvent(t *testing.T) {
+	routes, err := routing.ParseChannels(`[{"tags":["prod","v*"],"channel":"krt-prod"}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pub := valkey.NewPublisher(&redis.Options{Addr: "127.0.0.1:1"}, "krt", testLogger())
+	srv := NewServer(nil, pub, "ghcr.io/test/", testLogger(), Options{ChannelRoutes: routes})
+
+	evt := &payload.Event{Image: "ghcr.io/test/svc", Tags: []string{"v1.2", "latest", "prod", "dev"}, Digest: "sha256:abc"}
+	got := srv.routeEvent(evt)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 channels, got %d", len(got))
+	}
+	if got[0].channel != "krt-prod" || !reflect.DeepEqual(got[0].event.Tags, []string{"v1.2", "prod"}) {
+		t.Errorf("unexpected first route %s %v", got[0].channel, got[0].event.Tags)
+	}
+	if got[1].channel != "krt" || !reflect.DeepEqual(got[1].event.Tags, []string{"latest", "dev"}) {
+		t.Errorf("unexpected second route %s %v", got[1].channel, got[1].event.Tags)
+	}
+	for _, r := range got {
+		if r.event.Image != evt.Image || r.event.Digest != evt.Digest {
+			t.Errorf("expected image and digest to be kept, got %+v", r.event)
+		}
+	}
+
+	unrouted := NewServer(nil, pub, "ghcr.io/test/", testLogger(), Options{})
+	if got := unrouted.routeEvent(evt); len(got) != 1 || got[0].channel != "krt" || got[0].event != evt {
+		t.Errorf("expected the whole event on the default channel, got %+v", got)
+	}
+
+	urgent := &payload.Event{Image: "ghcr.io/test/svc", Tags: []string{"prod", "dev"}, Priority: payload.PriorityHigh}
+	got = srv.routeEvent(urgent)
+	if len(got) != 2 || got[0].channel != "krt-prod:priority" || got[1].channel != "krt:priority" {
+		t.Fatalf("expected priority channels, got %+v", got)
+	}
+	if got[0].event.Priority != payload.PriorityHigh {
+		t.Errorf("expected priority to be kept, got %q", got[0].event.Priority)
+	}
+
+	multi := &payload.Event{Images: []payload.EventImage{
+		{Image: "ghcr.io/test/svc", Tags: []string{"prod", "dev"}, Digest: "sha256:abc"},
+		{Image: "ghcr.io/test/migrate", Tags: []string{"dev"}},
+	}}
+	got = srv.routeEvent(multi)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 channels, got %d", len(got))
+	}
+	wantProd := []payload.EventImage{{Image: "ghcr.io/test/svc", Tags: []string{"prod"}, Digest: "sha256:abc"}}
+	if got[0].channel != "krt-prod" || !reflect.DeepEqual(got[0].event.Images, wantProd) {
+		t.Errorf("unexpected first route %s %+v", got[0].channel, got[0].event.Images)
+	}
+	wantDefault := []payload.EventImage{
+		{Image: "ghcr.io/test/svc", Tags: []string{"dev"}, Digest: "sha256:abc"},
+		{Image: "ghcr.io/test/migrate", Tags: []string{"dev"}},
+	}
+	if got[1].channel != "krt" || !reflect.DeepEqual(got[1].event.Images, wantDefault) {
+		t.Errorf("unexpected second route %s %+v", got[1].channel, got[1].event.Images)
+	}
+}
+
+func TestIncomingRequestID(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name        string
+		requestID   string
+		traceparent string
+		want        string
+	}{
+		{"none", "", "", ""},
+		{"request id", "abc-123_DEF.4", "", "abc-123_DEF.4"},
+		{"request id preferred", "abc-123", traceparent, "abc-123"},
+		{"traceparent", "", traceparent, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"invalid request id falls back", "abc 123", traceparent, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"request id with newline", "abc\nlevel=ERROR", "", ""},
+		{"request id too long", strings.Repeat("a", maxRequestIDLength+1), "", ""},
+		{"uppercase traceparent", "", strings.ToUpper(traceparent), ""},
+		{"zero trace id", "", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"invalid version", "", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"extra field in version 00", "", traceparent + "-extra", ""},
+		{"extra field in future version", "", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"short trace id", "", "00-4bf92f35-00f067aa0ba902b7-01", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/healthz", nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-Id", tt.requestID)
+			}
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			if got := incomingRequestID(req); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	v := oidc.NewValidator("aud", "org", true, testLogger())
+	var readyErr error
+	srv := NewServer(v, &mockPublisher{}, "ghcr.io/test/", testLogger(), Options{
+		Ready: func() error { return readyErr },
+	})
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 while ready, got %d", w.Code)
+	}
+
+	readyErr = errors.New("last ping to Valkey failed: connection refused")
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while not ready, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "connection refused") {
+		t.Errorf("expected the reason in the body, got %q", w.Body.String())
+	}
+}
+
+func TestRequestLoggingMiddleware_RequestID(t *testing.T) {
+	v := oidc.NewValidator("aud", "org", true, testLogger())
+	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{})
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("X-Request-Id", "ingress-42")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-Id"); got != "ingress-42" {
+		t.Errorf("expected the incoming request ID to be echoed, got %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("X-Request-Id", "bad id")
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-Id"); len(got) != 16 {
+		t.Errorf("expected a generated request ID, got %q", got)
+	}
+}
+
+func TestSeparateHandlers(t *testing.T) {
+	v := oidc.NewValidator("aud", "org", true, testLogger())
+	pub := valkey.NewPublisher(&redis.Options{Addr: "localhost:6379"}, "test", testLogger())
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{AdminToken: "s3cret"})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		status  int
+	}{
+		{"event on event handler", srv.EventHandler(), "POST", "/event", http.StatusBadRequest},
+		{"healthz on event handler", srv.EventHandler(), "GET", "/healthz", http.StatusNotFound},
+		{"metrics on event handler", srv.EventHandler(), "GET", "/metrics", http.StatusNotFound},
+		{"admin on event handler", srv.EventHandler(), "GET", "/admin/oidc-status", http.StatusNotFound},
+		{"schema on event handler", srv.EventHandler(), "GET", "/schema/event.json", http.StatusOK},
+		{"event on operational handler", srv.OperationalHandler(), "POST", "/event", http.StatusNotFound},
+		{"schema on operational handler", srv.OperationalHandler(), "GET", "/schema/event.json", http.StatusNotFound},
+		{"healthz on operational handler", srv.OperationalHandler(), "GET", "/healthz", http.StatusOK},
+		{"readyz on operational handler", srv.OperationalHandler(), "GET", "/readyz", http.StatusOK},
+		{"admin on operational handler", srv.OperationalHandler(), "GET", "/admin/oidc-status", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+}
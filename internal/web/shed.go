@@ -0,0 +1,109 @@
+package web
+
+import (
+	"net/http"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a request is shed.
+const (
+	shedInFlight = "in_flight"
+	shedMemory   = "memory"
+)
+
+// heapSampleInterval bounds how often the heap size is read, so a burst of
+// requests does not read it for every one.
+const heapSampleInterval = 100 * time.Millisecond
+
+// heapMetric is the runtime metric of the memory held by live and not yet
+// swept heap objects, which is read without stopping the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// loadShedder rejects requests while too many are in flight or the heap is
+// too large, so an overloaded web mode keeps answering quickly instead of
+// piling up token validations and publishes until it collapses.
+type loadShedder struct {
+	maxInFlight int64
+	maxHeap     uint64
+	heap        func() uint64
+	now         func() time.Time
+
+	inFlight atomic.Int64
+
+	mu         sync.Mutex
+	heapBytes  uint64
+	heapReadAt time.Time
+}
+
+// newLoadShedder returns a shedder admitting at most maxInFlight concurrent
+// requests while the heap is below maxHeap bytes. Zero disables a limit; it
+// returns nil if both are disabled.
+func newLoadShedder(maxInFlight int, maxHeap uint64) *loadShedder {
+	if maxInFlight <= 0 && maxHeap == 0 {
+		return nil
+	}
+	return &loadShedder{
+		maxInFlight: int64(maxInFlight),
+		maxHeap:     maxHeap,
+		heap:        readHeapBytes,
+		now:         time.Now,
+	}
+}
+
+// Admit reserves a slot for a request. It returns a release function to call
+// when the request is done, or the reason the request is shed.
+func (l *loadShedder) Admit() (release func(), reason string) {
+	if l.maxHeap > 0 && l.heapSize() > l.maxHeap {
+		return nil, shedMemory
+	}
+	inFlight := l.inFlight.Add(1)
+	if l.maxInFlight > 0 && inFlight > l.maxInFlight {
+		l.inFlight.Add(-1)
+		return nil, shedInFlight
+	}
+	return func() { l.inFlight.Add(-1) }, ""
+}
+
+// heapSize returns the heap size, read at most every heapSampleInterval.
+func (l *loadShedder) heapSize() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now := l.now(); now.Sub(l.heapReadAt) >= heapSampleInterval {
+		l.heapBytes = l.heap()
+		l.heapReadAt = now
+	}
+	return l.heapBytes
+}
+
+// readHeapBytes reads heapMetric.
+func readHeapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// shed wraps next with the load shedder, answering 503 with Retry-After
+// when the request is shed. Without a shedder next is returned unchanged.
+func (s *Server) shed(next http.HandlerFunc) http.HandlerFunc {
+	if s.shedder == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, reason := s.shedder.Admit()
+		if reason != "" {
+			requestsShed.WithLabelValues(reason).Inc()
+			s.logger.Warn("request shed under load", "path", r.URL.Path, "reason", reason, "request_id", requestIDFromContext(r.Context()))
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server overloaded, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadShedder_Admit(t *testing.T) {
+	if newLoadShedder(0, 0) != nil {
+		t.Fatal("expected no shedder without limits")
+	}
+
+	l := newLoadShedder(2, 0)
+	first, reason := l.Admit()
+	if reason != "" {
+		t.Fatalf("expected the first request to be admitted, got %q", reason)
+	}
+	if _, reason := l.Admit(); reason != "" {
+		t.Fatalf("expected the second request to be admitted, got %q", reason)
+	}
+	if _, reason := l.Admit(); reason != shedInFlight {
+		t.Fatalf("expected the third request to be shed for in-flight requests, got %q", reason)
+	}
+	first()
+	if _, reason := l.Admit(); reason != "" {
+		t.Fatalf("expected a request to be admitted after one finished, got %q", reason)
+	}
+
+	now := time.Unix(0, 0)
+	heap := uint64(100)
+	reads := 0
+	l = newLoadShedder(0, 150)
+	l.now = func() time.Time { return now }
+	l.heap = func() uint64 { reads++; return heap }
+	if _, reason := l.Admit(); reason != "" {
+		t.Fatalf("expected a request below the heap limit to be admitted, got %q", reason)
+	}
+	heap = 200
+	if _, reason := l.Admit(); reason != "" || reads != 1 {
+		t.Fatalf("expected the heap size to be sampled, got %q after %d reads", reason, reads)
+	}
+	now = now.Add(heapSampleInterval)
+	if _, reason := l.Admit(); reason != shedMemory {
+		t.Fatalf("expected a request above the heap limit to be shed, got %q", reason)
+	}
+}
+
+func TestLoadShedding(t *testing.T) {
+	srv := newAdminTestServerWithOptions(Options{LoadShedMaxInFlight: 1})
+	release, _ := srv.shedder.Admit()
+	defer release()
+
+	before := requestsShed.WithLabelValues(shedInFlight).Value()
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/event", strings.NewReader(`{}`)))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if shed := requestsShed.WithLabelValues(shedInFlight).Value() - before; shed != 1 {
+		t.Errorf("expected 1 shed request counted, got %v", shed)
+	}
+
+	// Health checks are never shed
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected /healthz to stay healthy, got %d", w.Code)
+	}
+}
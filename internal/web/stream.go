@@ -0,0 +1,118 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxStreamEvents bounds the number of events of a /events/stream request.
+const maxStreamEvents = 100
+
+// streamResult is the outcome of one line of a /events/stream request.
+type streamResult struct {
+	// Line is the line number of the event, from 1.
+	Line int `json:"line"`
+	// Status is the status /event would have answered for the event.
+	Status int `json:"status"`
+	// EventID identifies an accepted event.
+	EventID string `json:"event_id,omitempty"`
+	// Receivers is the number of workers that received an accepted event.
+	Receivers int64 `json:"receivers"`
+	// Error is why the event was rejected.
+	Error string `json:"error,omitempty"`
+	// RetryAfterSeconds is when to retry an event throttled with 429.
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+}
+
+// streamResponse is the response body of POST /events/stream.
+type streamResponse struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Results  []streamResult `json:"results"`
+}
+
+// handleEventStream accepts up to maxStreamEvents newline-delimited events
+// in one request, for bulk backfills by release tooling. The request is
+// authenticated once, and each event is then validated, rate limited,
+// authorized and published like an /event request, independently of the
+// others. The response lists the outcome of every event.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFromContext(r.Context())
+	logger := s.logger.With("request_id", requestID)
+
+	ct := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "application/x-ndjson") {
+		logger.Warn("invalid content type", "content_type", ct)
+		http.Error(w, "Content-Type must be application/x-ndjson", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := s.authenticate(w, r, logger)
+	if !ok {
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		logger.Warn("failed to read request body", "content_encoding", r.Header.Get("Content-Encoding"), "error", err.Error())
+		writeBodyError(w, err)
+		return
+	}
+
+	lines := bytes.Split(body, []byte("\n"))
+	events := 0
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) > 0 {
+			events++
+		}
+	}
+	if events == 0 || events > maxStreamEvents {
+		logger.Warn("invalid event stream", "events", events)
+		http.Error(w, "request must contain between 1 and "+strconv.Itoa(maxStreamEvents)+" events, one per line", http.StatusBadRequest)
+		return
+	}
+
+	trigger := triggerFor(claims)
+	streamID := generateEventID()
+	response := streamResponse{Results: make([]streamResult, 0, events)}
+	for i, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		result := streamResult{Line: i + 1}
+		eventID := streamID + "-" + strconv.Itoa(result.Line)
+		eventLogger := logger.With("line", result.Line, "event_id", eventID)
+
+		if ok, retryAfter, _ := s.allowEvent(r.Context(), eventLogger, claims); !ok {
+			eventsThrottled.Inc()
+			eventLogger.Warn("event rate limit exceeded", "repository", claims.Repository, "retry_after", retryAfter.String())
+			result.Status = http.StatusTooManyRequests
+			result.Error = "event rate limit exceeded for repository " + claims.Repository
+			result.RetryAfterSeconds = max(1, int(math.Ceil(retryAfter.Seconds())))
+		} else if evt, decision, rerr := s.acceptEvent(r.Context(), eventLogger, claims, line); rerr != nil {
+			result.Status, result.Error = rerr.status, rerr.message
+		} else if receivers, rerr := s.publish(r.Context(), eventLogger, evt, trigger, decision.Namespaces); rerr != nil {
+			result.Status, result.Error = rerr.status, rerr.message
+		} else {
+			result.Status, result.EventID, result.Receivers = http.StatusAccepted, eventID, receivers
+		}
+
+		if result.Status == http.StatusAccepted {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	logger.Info("event stream processed", "repository", claims.Repository, "accepted", response.Accepted, "rejected", response.Rejected)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("failed to write event stream response", "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+)
+
+func TestHandleEventStream(t *testing.T) {
+	v := oidc.NewValidator("test-audience", "test-org", true, testLogger())
+	pub := &mockPublisher{}
+	srv := NewServer(v, pub, "ghcr.io/test/", testLogger(), Options{EventRateLimit: 60, EventRateBurst: 3})
+
+	tokenStr := createSignedToken(t, generateTestKey(t), "kid", oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    oidc.GitHubOIDCIssuer,
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+		},
+		RepositoryOwner: "test-org",
+		Repository:      "test-org/svc",
+	})
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/events/stream", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		req.Header.Set("X-Request-Id", "req-1")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("application/x-ndjson", strings.Join([]string{
+		`{"image":"ghcr.io/test/svc","tags":["v1"]}`,
+		``,
+		`{"image":"docker.io/test/svc","tags":["v2"]}`,
+		`{"image":"ghcr.io/test/svc","tags":["v3"]}`,
+		`{"image":"ghcr.io/test/svc","tags":["v4"]}`,
+	}, "\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp streamResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 2 || len(resp.Results) != 4 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	// Event IDs are generated by the server, not taken from the request ID
+	streamID, _, _ := strings.Cut(resp.Results[0].EventID, "-")
+	if streamID == "" || streamID == "req" {
+		t.Errorf("expected an event ID generated by the server, got %q", resp.Results[0].EventID)
+	}
+	for i, want := range []streamResult{
+		{Line: 1, Status: http.StatusAccepted, EventID: streamID + "-1", Receivers: 1},
+		{Line: 3, Status: http.StatusBadRequest},
+		{Line: 4, Status: http.StatusAccepted, EventID: streamID + "-4", Receivers: 1},
+		{Line: 5, Status: http.StatusTooManyRequests},
+	} {
+		got := resp.Results[i]
+		if got.Line != want.Line || got.Status != want.Status || got.EventID != want.EventID || got.Receivers != want.Receivers {
+			t.Errorf("result %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if resp.Results[3].RetryAfterSeconds < 1 || resp.Results[1].Error == "" {
+		t.Errorf("expected rejection details, got %+v", resp.Results)
+	}
+	if len(pub.published) != 2 || !strings.Contains(pub.published[1], `"v3"`) {
+		t.Errorf("expected the accepted events to be published, got %v", pub.published)
+	}
+
+	if w := post("application/json", `{"image":"ghcr.io/test/svc","tags":["v1"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a JSON content type, got %d", w.Code)
+	}
+	if w := post("application/x-ndjson", "\n\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without events, got %d", w.Code)
+	}
+	tooMany := strings.Repeat(`{"image":"ghcr.io/test/svc","tags":["v1"]}`+"\n", maxStreamEvents+1)
+	if w := post("application/x-ndjson", tooMany); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 above %d events, got %d", maxStreamEvents, w.Code)
+	}
+}
@@ -2,29 +2,47 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
 	"os"
-	"os/signal"
 	"runtime/debug"
-	"sort"
-	"strings"
-	"syscall"
-	"time"
 
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/config"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/e2e"
 	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
-	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
-	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
-	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
-	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/web"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/lifecycle"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/logging"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/pkg/app"
 )
 
 // Version is the application version, injected at build time via ldflags
 var Version = "dev"
 
+// Exit codes of the binary, so that restart policies and alerting can tell
+// misconfiguration, which restarting does not fix, from a dependency that
+// was unavailable at startup.
+const (
+	exitError      = 1 // any other failure
+	exitConfig     = 2 // invalid configuration or usage
+	exitBroker     = 3 // Valkey unreachable at startup
+	exitKubernetes = 4 // Kubernetes client or credentials could not be set up
+)
+
 func main() {
+	// The exec credential plugin wrapper must not write anything else to
+	// stdout, which client-go reads as the ExecCredential response.
+	if len(os.Args) > 1 && os.Args[1] == k8s.ExecPluginSubcommand {
+		os.Exit(k8s.RunExecPlugin(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	// config print writes nothing but the JSON document to stdout, so it can
+	// be piped into other tools.
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Set the build version from the build info if not set by the build system
 	if Version == "dev" || Version == "" {
 		if bi, ok := debug.ReadBuildInfo(); ok {
@@ -38,92 +56,70 @@ func main() {
 	fmt.Printf("kuberollouttrigger version: %s\n", Version)
 
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <web|worker> [flags]\n", os.Args[0])
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Usage: %s <web|worker> [flags] or %s config print <web|worker> [flags]\n", os.Args[0], os.Args[0])
+		os.Exit(exitConfig)
 	}
 
 	subcommand := os.Args[1]
 	args := os.Args[2:]
 
+	var run func(*lifecycle.Lifecycle, []string) error
 	switch subcommand {
 	case "web":
-		if err := runWeb(args); err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
-		}
+		run = runWeb
 	case "worker":
-		if err := runWorker(args); err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
-		}
+		run = runWorker
+	case "e2e":
+		// Not listed in the usage: it is a development tool, see docs/TESTING.md
+		run = runE2E
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command %q. Usage: %s <web|worker> [flags]\n", subcommand, os.Args[0])
-		os.Exit(1)
+		os.Exit(exitConfig)
 	}
-}
 
-func runWeb(args []string) error {
-	cfg, err := config.ParseWebConfig(args)
+	// Graceful shutdown on the platform's shutdown signals
+	life := lifecycle.New(context.Background(), lifecycle.ShutdownSignals()...)
+	err := run(life, args)
+	life.Close()
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitCode(err))
 	}
+}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: config.ParseLogLevel(cfg.LogLevel),
-	}))
-	cfg.LogSummary(logger)
-
-	if cfg.DevMode {
-		logger.Warn("DEV MODE ENABLED: OIDC signature verification is disabled. Do not use in production.")
-	}
-
-	// Initialize OIDC validator
-	validator := oidc.NewValidator(cfg.GithubOIDCAudience, cfg.GithubAllowedOrg, cfg.DevMode, logger)
-
-	// Initialize Valkey publisher
-	publisher := valkey.NewPublisher(cfg.CommonConfig.NewRedisOptions(), cfg.ValkeyChannel, logger)
-	defer publisher.Close()
-
-	// Test Valkey connectivity
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := publisher.Ping(ctx); err != nil {
-		return fmt.Errorf("failed to connect to Valkey at %s: %w", cfg.ValkeyAddr, err)
+// exitCode returns the exit code for the error a mode failed with.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, app.ErrInvalidConfig):
+		return exitConfig
+	case errors.Is(err, app.ErrBrokerUnavailable):
+		return exitBroker
+	case errors.Is(err, app.ErrKubernetesClient):
+		return exitKubernetes
+	default:
+		return exitError
 	}
-	logger.Info("connected to Valkey", "addr", cfg.ValkeyAddr)
+}
 
-	// Initialize web server
-	server := web.NewServer(validator, publisher, cfg.AllowedImagePrefix, logger)
-	httpServer := &http.Server{
-		Addr:         cfg.ListenAddr,
-		Handler:      server.Handler(),
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+// runWeb runs the web mode until life is stopped.
+func runWeb(life *lifecycle.Lifecycle, args []string) error {
+	cfg, err := app.ParseWebConfig(args)
+	if err != nil {
+		return err
 	}
 
-	// Graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigCh
-		logger.Info("shutting down web server")
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer shutdownCancel()
-		httpServer.Shutdown(shutdownCtx)
-	}()
-
-	logger.Info("starting web server", "addr", cfg.ListenAddr)
-	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		return fmt.Errorf("HTTP server error: %w", err)
+	logger, level, logCloser, err := newLogger(life, &cfg.CommonConfig)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	defer logCloser.Close()
+	return app.NewWeb(cfg, logger, app.WebOptions{LogLevel: level, Version: Version}).Start(life.Context())
 }
 
-func runWorker(args []string) error {
-	cfg, err := config.ParseWorkerConfig(args)
+// runE2E publishes test events through running web and worker instances and
+// fails unless every event restarts the test Deployment.
+func runE2E(life *lifecycle.Lifecycle, args []string) error {
+	cfg, err := config.ParseE2EConfig(args)
 	if err != nil {
 		return err
 	}
@@ -131,139 +127,91 @@ func runWorker(args []string) error {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: config.ParseLogLevel(cfg.LogLevel),
 	}))
-	cfg.LogSummary(logger)
 
-	// Initialize Kubernetes restarter
-	restarter, err := k8s.NewRestarter(cfg.Kubeconfig, logger)
+	clientset, err := k8s.NewClientset(k8s.Options{
+		Kubeconfig: cfg.Kubeconfig,
+		Context:    cfg.KubeContext,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to initialize Kubernetes client: %w", err)
+		return err
 	}
 
-	// Initialize Valkey subscriber
-	subscriber := valkey.NewSubscriber(cfg.CommonConfig.NewRedisOptions(), cfg.ValkeyChannel, logger)
-	defer subscriber.Close()
-
-	// Test Valkey connectivity
-	pingCtx, pingCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer pingCancel()
-	if err := subscriber.Ping(pingCtx); err != nil {
-		return fmt.Errorf("failed to connect to Valkey at %s: %w", cfg.ValkeyAddr, err)
+	ctx := life.Context()
+
+	harness := e2e.New(e2e.Options{
+		WebURL:    cfg.WebURL,
+		Namespace: cfg.Namespace,
+		Image:     cfg.Image,
+		Org:       cfg.GithubAllowedOrg,
+		Audience:  cfg.GithubOIDCAudience,
+		Events:    cfg.Events,
+		Timeout:   cfg.EventTimeout,
+	}, clientset, logger)
+	result, err := harness.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("e2e run failed: %w", err)
 	}
-	logger.Info("connected to Valkey", "addr", cfg.ValkeyAddr)
-
-	// Context with cancellation for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		<-sigCh
-		logger.Info("shutting down worker")
-		cancel()
-	}()
-
-	var messageCount int64
-	handler := func(ctx context.Context, message string) {
-		messageCount++
-		logger.Info("received message", "message_count", messageCount)
-
-		evt, err := payload.ParseAndValidate([]byte(message), cfg.AllowedImagePrefix)
-		if err != nil {
-			logger.Error("invalid message payload, skipping", "error", err.Error())
-			return
-		}
-
-		imageRefs := evt.ImageRefs()
-		logger.Info("processing event", "image", evt.Image, "tags", strings.Join(evt.Tags, ","), "image_refs_count", len(imageRefs))
-
-		// Collect all matching deployments for any of the image references.
-		// Use a map with namespace/name as key to deduplicate deployments that match multiple tags.
-		matchMap := make(map[string]k8s.MatchingDeployment)
-		for _, imageRef := range imageRefs {
-			matches, err := restarter.FindMatchingDeployments(ctx, imageRef)
-			if err != nil {
-				logger.Error("failed to find matching deployments", "image_ref", imageRef, "error", err)
-				continue
-			}
-
-			// Add matches to the map (keyed by namespace/name to avoid duplicates)
-			for _, m := range matches {
-				key := m.Namespace + "/" + m.Name
-				if existing, found := matchMap[key]; found {
-					// Merge container names, avoiding duplicates.
-					// Use a map to ensure each container name appears only once when the same
-					// deployment matches multiple tags.
-					containerSet := make(map[string]bool)
-					for _, c := range existing.ContainerNames {
-						containerSet[c] = true
-					}
-					for _, c := range m.ContainerNames {
-						containerSet[c] = true
-					}
-					merged := make([]string, 0, len(containerSet))
-					for c := range containerSet {
-						merged = append(merged, c)
-					}
-					sort.Strings(merged) // Ensure deterministic ordering
-					existing.ContainerNames = merged
-					matchMap[key] = existing
-				} else {
-					matchMap[key] = m
-				}
-			}
-		}
+	logger.Info("e2e run finished",
+		"events", cfg.Events,
+		"delivered", result.Delivered,
+		"lost", result.Lost,
+		"max_latency", result.MaxLatency().String(),
+	)
+	if result.Lost > 0 {
+		return fmt.Errorf("%d of %d events were not delivered", result.Lost, cfg.Events)
+	}
+	return nil
+}
 
-		if len(matchMap) == 0 {
-			logger.Info("no matching deployments found", "image", evt.Image, "tags", strings.Join(evt.Tags, ","))
-			return
-		}
+// runConfig runs config print <web|worker> [flags], which writes the
+// effective configuration of the mode as JSON with secrets redacted.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 2 || args[0] != "print" {
+		fmt.Fprintf(stderr, "Usage: %s config print <web|worker> [flags]\n", os.Args[0])
+		return exitConfig
+	}
+	effective, err := config.EffectiveConfig(args[1], args[2:])
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitConfig
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(effective); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	return 0
+}
 
-		// Extract matches to a slice and sort for deterministic processing
-		matches := make([]k8s.MatchingDeployment, 0, len(matchMap))
-		matchKeys := make([]string, 0, len(matchMap))
-		for key := range matchMap {
-			matchKeys = append(matchKeys, key)
-		}
-		sort.Strings(matchKeys)
-		for _, key := range matchKeys {
-			matches = append(matches, matchMap[key])
-		}
+// runWorker runs the worker mode until life is stopped.
+func runWorker(life *lifecycle.Lifecycle, args []string) error {
+	cfg, err := app.ParseWorkerConfig(args)
+	if err != nil {
+		return err
+	}
 
-		for _, m := range matches {
-			logger.Info("found matching deployment",
-				"namespace", m.Namespace,
-				"deployment", m.Name,
-				"containers", strings.Join(m.ContainerNames, ","),
-				"image", evt.Image,
-			)
-			if err := restarter.RestartDeployment(ctx, m.Namespace, m.Name); err != nil {
-				logger.Error("failed to restart deployment",
-					"namespace", m.Namespace,
-					"deployment", m.Name,
-					"error", err,
-				)
-			}
-		}
+	logger, level, logCloser, err := newLogger(life, &cfg.CommonConfig)
+	if err != nil {
+		return err
 	}
+	defer logCloser.Close()
+	return app.NewWorker(cfg, logger, app.WorkerOptions{LogLevel: level, Version: Version}).Start(life.Context())
+}
 
-	logger.Info("starting worker, subscribing to Valkey channel", "channel", cfg.ValkeyChannel)
+// newLogger creates the logger configured in cfg. Its level can be changed
+// while running and SIGUSR1 toggles it between debug and the configured level.
+func newLogger(life *lifecycle.Lifecycle, cfg *config.CommonConfig) (*slog.Logger, *slog.LevelVar, io.Closer, error) {
+	opts := cfg.LogOptions()
+	level := new(slog.LevelVar)
+	level.Set(opts.Level.Level())
+	opts.Level = level
 
-	// Retry loop for subscriber
-	for {
-		err := subscriber.Subscribe(ctx, handler)
-		if ctx.Err() != nil {
-			// Context cancelled, exit gracefully
-			return nil
-		}
-		if err != nil {
-			logger.Error("Valkey subscription error, retrying in 5s", "error", err)
-		}
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-time.After(5 * time.Second):
-		}
+	logger, closer, err := logging.New(opts)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to set up logging: %w", err)
 	}
+	go logging.ToggleDebugOnSignal(life.Context(), level, logger)
+	return logger, level, closer, nil
 }
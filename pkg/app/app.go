@@ -0,0 +1,240 @@
+// Package app runs the web and worker modes of kuberollouttrigger, so other
+// Go programs can embed the trigger pipeline instead of running the binary.
+//
+// A Web or Worker is created from its configuration, usually parsed with
+// ParseWebConfig or ParseWorkerConfig, and runs from Start until Stop is
+// called or the context passed to Start is cancelled. The message broker and
+// the Kubernetes restarter can be replaced through WebOptions and
+// WorkerOptions; by default they are Valkey and the cluster configured in
+// WorkerConfig. Startup failures are classified by ErrInvalidConfig,
+// ErrBrokerUnavailable and ErrKubernetesClient.
+//
+// Web and Worker export their metrics on a process-wide registry while
+// started, and can be started again once stopped. When several are started
+// at once, a metric is exported for the first that registered it.
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/config"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/lifecycle"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+)
+
+// WebConfig configures a Web. See docs/CONFIGURATION.md for the settings.
+type WebConfig = config.WebConfig
+
+// WorkerConfig configures a Worker. See docs/CONFIGURATION.md for the settings.
+type WorkerConfig = config.WorkerConfig
+
+// ParseWebConfig parses web mode configuration from environment variables,
+// overridden by command line flags in args.
+func ParseWebConfig(args []string) (*WebConfig, error) {
+	cfg, err := config.ParseWebConfig(args)
+	if err != nil {
+		return nil, &classError{class: ErrInvalidConfig, err: err}
+	}
+	return cfg, nil
+}
+
+// ParseWorkerConfig parses worker mode configuration from environment
+// variables, overridden by command line flags in args.
+func ParseWorkerConfig(args []string) (*WorkerConfig, error) {
+	cfg, err := config.ParseWorkerConfig(args)
+	if err != nil {
+		return nil, &classError{class: ErrInvalidConfig, err: err}
+	}
+	return cfg, nil
+}
+
+// Types used by the Publisher, Subscriber and Restarter interfaces.
+type (
+	MessageHandler     = valkey.MessageHandler
+	RestartCause       = k8s.RestartCause
+	DeferredError      = k8s.DeferredError
+	MatchingDeployment = k8s.MatchingDeployment
+	MatchingWorkload   = k8s.MatchingWorkload
+	Target             = k8s.Target
+	MatchDecision      = k8s.MatchDecision
+	StaleDeployment    = k8s.StaleDeployment
+	Inventory          = k8s.Inventory
+	ResolveFunc        = k8s.ResolveFunc
+)
+
+// ErrNoReceivers is returned by Publisher.Request when no worker received
+// the request.
+var ErrNoReceivers = valkey.ErrNoReceivers
+
+// Publisher is the broker side of the web: it publishes messages for
+// workers. The Valkey publisher implements it.
+type Publisher interface {
+	// Publish publishes message to the default channel and returns the
+	// number of subscribers that received it.
+	Publish(ctx context.Context, message string) (int64, error)
+	// PublishTo publishes message to channel and returns the number of
+	// subscribers that received it.
+	PublishTo(ctx context.Context, channel, message string) (int64, error)
+	// PublishHeartbeat publishes a heartbeat from source for the workers of
+	// eventChannel.
+	PublishHeartbeat(ctx context.Context, eventChannel, source string) error
+	// Request publishes message to the default channel and waits for the
+	// first reply on replyChannel. It returns ErrNoReceivers if no worker
+	// received the message.
+	Request(ctx context.Context, replyChannel, message string) (string, error)
+	// Channel returns the default channel.
+	Channel() string
+	// Ping checks the connection to the broker.
+	Ping(ctx context.Context) error
+}
+
+// Subscriber is the broker side of the worker: it delivers the messages
+// published by the web. The Valkey subscriber implements it.
+type Subscriber interface {
+	// Subscribe calls handler for each message, with the channel it was
+	// published to, until ctx is cancelled or the subscription fails.
+	Subscribe(ctx context.Context, handler MessageHandler) error
+	// Reply publishes message to channel, answering a request.
+	Reply(ctx context.Context, channel, message string) error
+	// Channel returns the subscribed channel.
+	Channel() string
+	// LastHeartbeat returns when the last web heartbeat arrived, or the zero
+	// time if none has.
+	LastHeartbeat() time.Time
+	// Healthy returns an error while messages are not being received.
+	Healthy(ctx context.Context) error
+	// Buffered returns the number of messages waiting to be handled.
+	Buffered() int
+	// Dropped returns the number of messages discarded because the buffer
+	// was full.
+	Dropped() int64
+	// Ping checks the connection to the broker.
+	Ping(ctx context.Context) error
+}
+
+// Restarter finds and restarts the workloads running an image. The
+// Kubernetes restarter implements it.
+type Restarter interface {
+	// FindMatchingDeployments returns the Deployments running imageRef.
+	FindMatchingDeployments(ctx context.Context, imageRef string) ([]MatchingDeployment, error)
+	// FindMatchingWorkloads returns the custom workloads running imageRef.
+	FindMatchingWorkloads(ctx context.Context, imageRef string) ([]MatchingWorkload, error)
+	// RestartDeployment restarts a Deployment. It returns a *DeferredError
+	// when the restart is not safe yet and should be retried.
+	RestartDeployment(ctx context.Context, namespace, name string, cause *RestartCause) error
+	// Restart restarts a Deployment or custom workload with the restart
+	// strategy of its kind. Like RestartDeployment, it returns a
+	// *DeferredError for a Deployment that should be retried.
+	Restart(ctx context.Context, t Target, cause *RestartCause) error
+	// ExplainMatches reports why each Deployment running the repository of
+	// imageRef did or did not match it.
+	ExplainMatches(ctx context.Context, imageRef string) (decisions []MatchDecision, examined int, err error)
+	// Inventory counts the Deployments running an image under imagePrefix.
+	Inventory(ctx context.Context, imagePrefix string) (Inventory, error)
+	// FindStaleDeployments returns the Deployments under imagePrefix whose
+	// running digest differs from the one resolve returns for their tag.
+	FindStaleDeployments(ctx context.Context, imagePrefix string, resolve ResolveFunc) ([]StaleDeployment, error)
+	// CleanupTriggerAnnotations removes trigger annotations older than maxAge
+	// and returns the number of Deployments cleaned.
+	CleanupTriggerAnnotations(ctx context.Context, maxAge time.Duration) (int, error)
+	// NamespaceAnnotations returns the annotations of a namespace.
+	NamespaceAnnotations(ctx context.Context, namespace string) (map[string]string, error)
+}
+
+var (
+	_ Publisher  = (*valkey.Publisher)(nil)
+	_ Subscriber = (*valkey.Subscriber)(nil)
+	_ Restarter  = (*k8s.Restarter)(nil)
+)
+
+// stopper lets Stop end a run, even one that has not started yet.
+type stopper struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newStopper() *stopper {
+	return &stopper{ch: make(chan struct{})}
+}
+
+func (s *stopper) stop() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// lifecycle returns a Lifecycle derived from ctx that is also stopped by
+// stop. It must be closed when the run ends.
+func (s *stopper) lifecycle(ctx context.Context) *lifecycle.Lifecycle {
+	life := lifecycle.New(ctx)
+	select {
+	case <-s.ch:
+		life.Stop()
+		return life
+	default:
+	}
+	go func() {
+		select {
+		case <-s.ch:
+			life.Stop()
+		case <-life.Done():
+		}
+	}()
+	return life
+}
+
+// valkeyClientName returns the default name of the Valkey connections of
+// mode, identifying them in CLIENT LIST.
+func valkeyClientName(mode, version string) string {
+	if version == "" {
+		version = "dev"
+	}
+	// Valkey rejects names with spaces, which a custom build version could contain
+	return "kuberollouttrigger-" + mode + "/" + strings.ReplaceAll(version, " ", "_")
+}
+
+// kubeUserAgent returns userAgent, or kuberollouttrigger-worker/<version>
+// if it is empty, so API server audit logs name the worker and its version.
+func kubeUserAgent(userAgent, version string) string {
+	if userAgent != "" {
+		return userAgent
+	}
+	if version == "" {
+		version = "dev"
+	}
+	return "kuberollouttrigger-worker/" + version
+}
+
+// logConfigWarnings logs each semantic configuration warning.
+func logConfigWarnings(logger *slog.Logger, warnings []config.Warning) {
+	for _, w := range warnings {
+		logger.Warn("configuration warning", "setting", w.Setting, "message", w.Message)
+	}
+}
+
+// newFaultInjector creates the fault injector for the configured rates, which
+// configuration only allows in dev mode, and counts injected failures. It
+// returns nil when no fault is enabled.
+func newFaultInjector(registry *metrics.Registry, rates map[fault.Point]float64, logger *slog.Logger) *fault.Injector {
+	var injected *metrics.CounterVec
+	faults := fault.New(rates, func(p fault.Point) {
+		injected.WithLabelValues(string(p)).Inc()
+	})
+	if faults == nil {
+		return nil
+	}
+	injected = registry.NewCounterVec(
+		"kuberollouttrigger_faults_injected_total",
+		"Failures injected on purpose in dev mode.",
+		"point",
+	)
+	for _, p := range faults.Points() {
+		logger.Warn("FAULT INJECTION ENABLED: failures are simulated on purpose. Do not use in production.", "point", string(p), "rate", rates[p])
+	}
+	return faults
+}
@@ -0,0 +1,283 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/config"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/registry"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+)
+
+// monitorHeartbeat warns once when no web heartbeat has arrived for timeout,
+// and again when heartbeats resume. The age of the last heartbeat is exported
+// as a gauge; before the first heartbeat it counts from worker startup.
+func monitorHeartbeat(ctx context.Context, timeout time.Duration, subscriber Subscriber, registry *metrics.Registry, logger *slog.Logger) {
+	started := time.Now()
+	age := func() time.Duration {
+		last := subscriber.LastHeartbeat()
+		if last.IsZero() {
+			last = started
+		}
+		return time.Since(last)
+	}
+	registry.NewGaugeFunc(
+		"kuberollouttrigger_heartbeat_age_seconds",
+		"Seconds since the worker last received a heartbeat from the web.",
+		func() float64 { return age().Seconds() },
+	)
+	missing := registry.NewGauge(
+		"kuberollouttrigger_heartbeat_missing",
+		"1 while no web heartbeat has arrived within HEARTBEAT_TIMEOUT, otherwise 0.",
+	)
+
+	ticker := time.NewTicker(min(timeout/4, 15*time.Second))
+	defer ticker.Stop()
+	alarmed := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		switch a := age(); {
+		case a > timeout && !alarmed:
+			alarmed = true
+			missing.Set(1)
+			logger.Warn("no heartbeat received from web, events may not be reaching this worker",
+				"channel", valkey.HeartbeatChannel(subscriber.Channel()),
+				"last_heartbeat_age", a.Round(time.Second).String(),
+				"timeout", timeout.String(),
+			)
+		case a <= timeout && alarmed:
+			alarmed = false
+			missing.Set(0)
+			logger.Info("heartbeat from web restored")
+		}
+	}
+}
+
+// serveWorkerHealth serves the worker's /metrics, /healthz, which only
+// reports that the process is running, and /readyz, which fails while the
+// Valkey subscription is not receiving messages. It stops when ctx is
+// cancelled.
+func serveWorkerHealth(ctx context.Context, addr string, subscriber Subscriber, logger *slog.Logger) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /metrics", metrics.Default.Handler())
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		checkCtx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err := subscriber.Healthy(checkCtx); err != nil {
+			logger.Warn("worker not ready", "error", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	httpServer := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("starting worker health server", "addr", addr)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error("worker health server error", "error", err)
+	}
+}
+
+// runInventory lists the Deployments running an image under
+// ALLOWED_IMAGE_PREFIX at startup and then every INVENTORY_RESYNC_INTERVAL,
+// exporting the result as metrics. It warns when no Deployment uses the
+// prefix, which usually means ALLOWED_IMAGE_PREFIX is misspelled or the
+// worker cannot see the namespaces it should manage.
+func runInventory(ctx context.Context, cfg *config.WorkerConfig, restarter Restarter, registry *metrics.Registry, logger *slog.Logger) {
+	matching := registry.NewGauge(
+		"kuberollouttrigger_prefix_deployments",
+		"Deployments running an image under ALLOWED_IMAGE_PREFIX.",
+	)
+	perNamespace := registry.NewGaugeVec(
+		"kuberollouttrigger_inventory_deployments",
+		"Deployments running an image under ALLOWED_IMAGE_PREFIX, per namespace.",
+		"namespace",
+	)
+	images := registry.NewGauge(
+		"kuberollouttrigger_inventory_images",
+		"Distinct image references under ALLOWED_IMAGE_PREFIX run by Deployments.",
+	)
+	lastSync := registry.NewGauge(
+		"kuberollouttrigger_inventory_last_sync_timestamp_seconds",
+		"Unix time of the last successful Deployment inventory.",
+	)
+
+	var ticker *time.Ticker
+	if cfg.InventoryResyncInterval > 0 {
+		ticker = time.NewTicker(cfg.InventoryResyncInterval)
+		defer ticker.Stop()
+	}
+
+	previous := -1
+	for {
+		inv, err := restarter.Inventory(ctx, cfg.AllowedImagePrefix)
+		if err != nil {
+			logger.Error("deployment inventory failed", "error", err)
+		} else {
+			matching.Set(float64(inv.Deployments()))
+			perNamespace.Reset()
+			for ns, count := range inv.Namespaces {
+				perNamespace.WithLabelValues(ns).Set(float64(count))
+			}
+			images.Set(float64(len(inv.Images)))
+			lastSync.Set(float64(time.Now().Unix()))
+
+			attrs := []any{
+				"allowed_image_prefix", cfg.AllowedImagePrefix,
+				"deployments_examined", inv.Examined,
+				"matching_deployments", inv.Deployments(),
+				"namespaces", len(inv.Namespaces),
+				"images", len(inv.Images),
+			}
+			switch {
+			case inv.Deployments() == 0 && previous != 0:
+				logger.Warn("no deployments use the allowed image prefix, check ALLOWED_IMAGE_PREFIX and the worker's RBAC scope", attrs...)
+			case previous == -1:
+				logger.Info("startup image prefix check complete", attrs...)
+			default:
+				logger.Debug("deployment inventory resynced", attrs...)
+			}
+			previous = inv.Deployments()
+		}
+
+		if ticker == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runAnnotationGC periodically removes trigger annotations older than
+// AnnotationGCMaxAge until ctx is cancelled.
+func runAnnotationGC(ctx context.Context, cfg *config.WorkerConfig, restarter Restarter, logger *slog.Logger) {
+	ticker := time.NewTicker(cfg.AnnotationGCInterval)
+	defer ticker.Stop()
+	for {
+		cleaned, err := restarter.CleanupTriggerAnnotations(ctx, cfg.AnnotationGCMaxAge)
+		if err != nil {
+			logger.Error("trigger annotation cleanup failed", "error", err)
+		} else {
+			logger.Info("trigger annotation cleanup complete", "deployments_cleaned", cleaned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runBackfill restarts Deployments whose image tag was pushed while the worker
+// was not running, detected by comparing the digest each tag currently points
+// to in the registry with the digest the Deployment's pods are running. The
+// digest is held to the checks of an event: its signature, with verify set,
+// the channel rules, the tag routes and the namespace digest policy.
+func runBackfill(ctx context.Context, cfg *config.WorkerConfig, restarter Restarter, client *registry.Client, verify func(ctx context.Context, image, digest string) error, policy *digestPolicy, deferred *k8s.DeferredQueue, pause *pauseGate, logger *slog.Logger) {
+	logger.Info("starting backfill of pushes missed during downtime")
+	stale, err := restarter.FindStaleDeployments(ctx, cfg.AllowedImagePrefix, resolveDigests(client, cfg.RegistryPlatformDigests))
+	if err != nil {
+		logger.Error("backfill failed", "error", err)
+		return
+	}
+
+	var restarted int
+	verified := make(map[string]error)
+	for _, s := range stale {
+		logger := logger.With("namespace", s.Namespace, "deployment", s.Name, "image", s.Image, "tag", s.Tag, "digest", s.Digest)
+		if verify != nil {
+			err, done := verified[s.Image+"@"+s.Digest]
+			if !done {
+				err = verify(ctx, s.Image, s.Digest)
+				verified[s.Image+"@"+s.Digest] = err
+			}
+			if err != nil {
+				logger.Error("image signature verification failed, skipping deployment", "error", err)
+				continue
+			}
+		}
+		if reason := subscribedChannelsExplain(cfg, s.Namespace, s.Labels); reason != "" {
+			logger.Info("deployment excluded by channel rule", "reason", reason)
+			continue
+		}
+		if reason := cfg.TagRoutes.Route(s.Tag).Explain(s.Namespace, s.Labels); reason != "" {
+			logger.Info("deployment excluded by tag route", "reason", reason)
+			continue
+		}
+		if policy.Excludes(ctx, s.Namespace, s.Digest) {
+			logger.Info("deployment excluded by namespace digest policy", "reason", digestRequiredReason)
+			continue
+		}
+
+		logger.Info("backfilling missed push")
+		cause := &k8s.RestartCause{Image: s.Image, Containers: s.Containers}
+		if pause.Paused() {
+			// The deferred queue does not retry until the worker is resumed
+			logger.Info("worker paused, deferring restart")
+			deferred.Add(ctx, s.Namespace, s.Name, cause)
+			continue
+		}
+		err := restarter.RestartDeployment(ctx, s.Namespace, s.Name, cause)
+		var deferredErr *k8s.DeferredError
+		switch {
+		case errors.As(err, &deferredErr):
+			logger.Warn("restart deferred", "reason", deferredErr.Reason)
+			deferred.Add(ctx, s.Namespace, s.Name, cause)
+		case err != nil:
+			logger.Error("failed to restart deployment", "error", err)
+		default:
+			restarted++
+		}
+	}
+	logger.Info("backfill complete", "stale_deployments", len(stale), "restarted", restarted)
+}
+
+// subscribedChannelsExplain returns why the rule of no channel the worker
+// subscribes to allows a Deployment in namespace with the given labels, or an
+// empty string if one does: a missed push could have been published on any
+// of them.
+func subscribedChannelsExplain(cfg *config.WorkerConfig, namespace string, labels map[string]string) string {
+	var reason string
+	for _, channel := range append([]string{cfg.ValkeyChannel}, cfg.ValkeyChannels...) {
+		explained := cfg.ChannelRules.Route(channel).Explain(namespace, labels)
+		if explained == "" {
+			return ""
+		}
+		if reason == "" {
+			reason = fmt.Sprintf("channel %s: %s", channel, explained)
+		}
+	}
+	return reason
+}
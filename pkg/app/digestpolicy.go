@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+)
+
+// digestRequiredReason is the reason logged for a Deployment or workload
+// excluded because its namespace requires a digest and the event has none.
+const digestRequiredReason = "digest_required"
+
+// digestPolicyCacheTTL bounds how long the policy of a namespace is cached,
+// so annotation changes apply within a minute.
+const digestPolicyCacheTTL = time.Minute
+
+// cachedDigestPolicy is the policy of a namespace and when it was read.
+type cachedDigestPolicy struct {
+	required bool
+	fetched  time.Time
+}
+
+// digestPolicy enforces the k8s.RequireDigestAnnotation of namespaces: only
+// events carrying an image digest may restart workloads in a namespace that
+// requires one, so a mutable tag cannot roll out there.
+type digestPolicy struct {
+	lookup func(ctx context.Context, namespace string) (map[string]string, error)
+	now    func() time.Time
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedDigestPolicy
+
+	excluded atomic.Int64
+}
+
+// newDigestPolicy creates a digestPolicy reading namespace annotations with
+// lookup.
+func newDigestPolicy(lookup func(ctx context.Context, namespace string) (map[string]string, error), logger *slog.Logger) *digestPolicy {
+	return &digestPolicy{
+		lookup: lookup,
+		now:    time.Now,
+		logger: logger,
+		cache:  make(map[string]cachedDigestPolicy),
+	}
+}
+
+// Excludes reports whether an event with digest may not restart workloads in
+// namespace, and counts it if so. A nil policy excludes nothing.
+func (p *digestPolicy) Excludes(ctx context.Context, namespace, digest string) bool {
+	if p == nil || digest != "" {
+		return false
+	}
+	if !p.required(ctx, namespace) {
+		return false
+	}
+	p.excluded.Add(1)
+	return true
+}
+
+// Excluded returns the number of Deployments and workloads excluded.
+func (p *digestPolicy) Excluded() int64 {
+	return p.excluded.Load()
+}
+
+// required reports whether namespace requires a digest. A namespace whose
+// annotations cannot be read is treated as requiring one, so a failed lookup
+// never lets a tag-only event through; the failure is not cached.
+func (p *digestPolicy) required(ctx context.Context, namespace string) bool {
+	p.mu.Lock()
+	cached, ok := p.cache[namespace]
+	p.mu.Unlock()
+	if ok && p.now().Sub(cached.fetched) < digestPolicyCacheTTL {
+		return cached.required
+	}
+
+	annotations, err := p.lookup(ctx, namespace)
+	if err != nil {
+		p.logger.Warn("failed to read namespace digest policy, requiring a digest", "namespace", namespace, "error", err)
+		return true
+	}
+	required := false
+	if value, ok := annotations[k8s.RequireDigestAnnotation]; ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			// A typo must not silently disable the policy
+			p.logger.Warn("invalid namespace digest policy annotation, requiring a digest", "namespace", namespace, "value", value)
+			parsed = true
+		}
+		required = parsed
+	}
+
+	p.mu.Lock()
+	p.cache[namespace] = cachedDigestPolicy{required: required, fetched: p.now()}
+	p.mu.Unlock()
+	return required
+}
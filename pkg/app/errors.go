@@ -0,0 +1,31 @@
+package app
+
+import "errors"
+
+// Classes of the errors returned by the configuration parsing and by Start,
+// matched with errors.Is, so that a supervisor can tell misconfiguration,
+// which restarting does not fix, from a dependency that may come back. The
+// underlying error stays in the chain and its message is unchanged.
+var (
+	// ErrInvalidConfig is returned when the configuration is invalid or
+	// incomplete.
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrBrokerUnavailable is returned when Valkey cannot be reached at
+	// startup.
+	ErrBrokerUnavailable = errors.New("broker unavailable")
+
+	// ErrKubernetesClient is returned when the worker cannot set up its
+	// Kubernetes client, for example because no credentials are found, the
+	// kubeconfig cannot be loaded or the API server rejects the credentials.
+	ErrKubernetesClient = errors.New("kubernetes client unavailable")
+)
+
+// classError is a startup error together with its class.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string   { return e.err.Error() }
+func (e *classError) Unwrap() []error { return []error{e.class, e.err} }
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+)
+
+// Middleware wraps the worker's MessageHandler with a cross-cutting concern,
+// such as logging, metrics or deduplication, so it stays out of the event
+// handling itself.
+type Middleware func(next MessageHandler) MessageHandler
+
+// Chain returns handler wrapped by middlewares, the first one outermost.
+func Chain(handler MessageHandler, middlewares ...Middleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// logMessages logs each message received, numbered from worker startup.
+func logMessages(logger *slog.Logger) Middleware {
+	var count atomic.Int64
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, channel, message string) {
+			logger.Info("received message", "message_count", count.Add(1), "channel", channel)
+			next(ctx, channel, message)
+		}
+	}
+}
+
+// countMessages counts the messages handled and the time spent handling
+// them.
+func countMessages(handled *metrics.Counter, seconds *metrics.Counter) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, channel, message string) {
+			start := time.Now()
+			defer func() {
+				handled.Inc()
+				seconds.Add(time.Since(start).Seconds())
+			}()
+			next(ctx, channel, message)
+		}
+	}
+}
+
+// replayKey is the context key of the time a paused worker was resumed.
+type replayKey struct{}
+
+// replayContext returns ctx for replaying the messages held until the worker
+// was resumed at resumed.
+func replayContext(ctx context.Context, resumed time.Time) context.Context {
+	return context.WithValue(ctx, replayKey{}, resumed)
+}
+
+// isEventMessage reports whether message is an event, including one that
+// does not parse, which the worker rejects after deduplication anyway.
+func isEventMessage(message string) bool {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(message), &envelope); err != nil {
+		return true
+	}
+	return envelope.Type == "" || envelope.Type == payload.MessageTypeEvent
+}
+
+// dedupeMessages drops an event identical to one received on the same
+// channel less than window ago, such as an event the web published twice
+// after a client retry, counting it in dropped. Messages are remembered by
+// hash, so the memory held is bounded by the message rate, not their size.
+// A replayed held message is only a duplicate of one handled since the
+// worker was resumed, not of its own arrival. Control messages such as
+// pause and resume are never dropped: repeating one is deliberate.
+func dedupeMessages(window time.Duration, dropped *metrics.Counter, logger *slog.Logger) Middleware {
+	var mu sync.Mutex
+	seen := make(map[[sha256.Size]byte]time.Time)
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, channel, message string) {
+			if !isEventMessage(message) {
+				next(ctx, channel, message)
+				return
+			}
+			key := sha256.Sum256([]byte(channel + "\x00" + message))
+			now := time.Now()
+			resumed, _ := ctx.Value(replayKey{}).(time.Time)
+			mu.Lock()
+			for k, at := range seen {
+				if now.Sub(at) >= window {
+					delete(seen, k)
+				}
+			}
+			at, duplicate := seen[key]
+			if duplicate && at.Before(resumed) {
+				duplicate = false
+			}
+			if !duplicate {
+				seen[key] = now
+			}
+			mu.Unlock()
+			if duplicate {
+				dropped.Inc()
+				logger.Info("dropping duplicate message", "channel", channel, "dedupe_window", window.String())
+				return
+			}
+			next(ctx, channel, message)
+		}
+	}
+}
+
+// timeoutMessages cancels the handling of a message after timeout, counting
+// it in timedOut, so one slow event cannot hold up the messages behind it.
+func timeoutMessages(timeout time.Duration, timedOut *metrics.Counter, logger *slog.Logger) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, channel, message string) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			next(ctx, channel, message)
+			if ctx.Err() == context.DeadlineExceeded {
+				timedOut.Inc()
+				logger.Warn("message handling timed out", "channel", channel, "message_timeout", timeout.String())
+			}
+		}
+	}
+}
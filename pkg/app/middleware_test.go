@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, channel, message string) {
+				calls = append(calls, name)
+				next(ctx, channel, message)
+			}
+		}
+	}
+	handler := Chain(func(ctx context.Context, channel, message string) {
+		calls = append(calls, "handler")
+	}, record("outer"), record("inner"))
+
+	handler(context.Background(), "events", "{}")
+	if want := []string{"outer", "inner", "handler"}; !slices.Equal(calls, want) {
+		t.Errorf("expected %v, got %v", want, calls)
+	}
+}
+
+func TestDedupeMessages(t *testing.T) {
+	registry := metrics.NewRegistry()
+	dropped := registry.NewCounter("dropped_total", "")
+	var handled []string
+	handler := dedupeMessages(50*time.Millisecond, dropped, testLogger())(func(ctx context.Context, channel, message string) {
+		handled = append(handled, channel+" "+message)
+	})
+
+	handler(context.Background(), "events", "a")
+	handler(context.Background(), "events", "a")
+	handler(context.Background(), "other", "a")
+	handler(context.Background(), "events", "b")
+	time.Sleep(60 * time.Millisecond)
+	handler(context.Background(), "events", "a")
+
+	if want := []string{"events a", "other a", "events b", "events a"}; !slices.Equal(handled, want) {
+		t.Errorf("expected %v, got %v", want, handled)
+	}
+	if dropped.Value() != 1 {
+		t.Errorf("expected 1 duplicate dropped, got %v", dropped.Value())
+	}
+}
+
+func TestTimeoutMessages(t *testing.T) {
+	registry := metrics.NewRegistry()
+	timedOut := registry.NewCounter("timed_out_total", "")
+	handler := timeoutMessages(10*time.Millisecond, timedOut, testLogger())(func(ctx context.Context, channel, message string) {
+		if message == "slow" {
+			<-ctx.Done()
+		}
+	})
+
+	handler(context.Background(), "events", "fast")
+	handler(context.Background(), "events", "slow")
+	if timedOut.Value() != 1 {
+		t.Errorf("expected 1 message timed out, got %v", timedOut.Value())
+	}
+}
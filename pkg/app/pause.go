@@ -0,0 +1,80 @@
+package app
+
+import (
+	"sync"
+)
+
+// maxHeldMessages bounds the messages held while the worker is paused. When
+// more arrive, the oldest are dropped.
+const maxHeldMessages = 1000
+
+// heldMessage is a message held while the worker is paused and the channel
+// it was published to.
+type heldMessage struct {
+	channel string
+	message string
+}
+
+// pauseGate holds the messages received while the worker is paused, so they
+// can be processed in order once it is resumed.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	held   []heldMessage
+}
+
+// Pause starts holding messages. It returns false if already paused.
+func (g *pauseGate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	return true
+}
+
+// Resume stops holding messages and returns the held ones in the order they
+// arrived. It returns false if the gate was not paused.
+func (g *pauseGate) Resume() ([]heldMessage, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return nil, false
+	}
+	held := g.held
+	g.paused = false
+	g.held = nil
+	return held, true
+}
+
+// Hold keeps message, published to channel, if the gate is paused and
+// reports whether it did, and whether the oldest held message was dropped to
+// make room.
+func (g *pauseGate) Hold(channel, message string) (held, dropped bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false, false
+	}
+	if len(g.held) >= maxHeldMessages {
+		g.held = g.held[1:]
+		dropped = true
+	}
+	g.held = append(g.held, heldMessage{channel: channel, message: message})
+	return true, dropped
+}
+
+// Paused reports whether the gate is paused.
+func (g *pauseGate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// Held returns the number of held messages.
+func (g *pauseGate) Held() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.held)
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/registry"
+)
+
+// existingTags returns the tags of the event that exist in the registry, so
+// Deployments are never restarted into an image that cannot be pulled. Missing
+// tags are polled for until wait elapses, shared across all tags of the event.
+// Tags that cannot be checked are kept and logged.
+func existingTags(ctx context.Context, client *registry.Client, evt *payload.Event, wait time.Duration, logger *slog.Logger) []string {
+	deadline := time.Now().Add(wait)
+	var tags []string
+	for _, tag := range evt.Tags {
+		_, err := client.WaitForManifest(ctx, evt.Image, tag, time.Until(deadline))
+		switch {
+		case errors.Is(err, registry.ErrManifestNotFound):
+			logger.Warn("image tag not found in registry, skipping tag", "image", evt.Image, "tag", tag)
+			continue
+		case err != nil:
+			logger.Warn("failed to check image tag in registry, continuing", "image", evt.Image, "tag", tag, "error", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// resolveDigests returns a backfill ResolveFunc that resolves image:tag to its
+// manifest digest and, with platforms set, the platform digests it lists.
+func resolveDigests(client *registry.Client, platforms bool) k8s.ResolveFunc {
+	return func(ctx context.Context, image, tag string) ([]string, error) {
+		digest, err := client.Resolve(ctx, image, tag)
+		if err != nil {
+			return nil, err
+		}
+		if !platforms {
+			return []string{digest}, nil
+		}
+		children, err := client.PlatformDigests(ctx, image, digest)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{digest}, children...), nil
+	}
+}
+
+// signatureVerifier checks the signature of an image digest.
+// *registry.SignatureVerifier implements it.
+type signatureVerifier interface {
+	Verify(ctx context.Context, image, digest string) error
+}
+
+// verifySignatures resolves every tag of the event and checks that the digest
+// it points to carries a valid cosign signature. If the event names a digest,
+// every tag must still point to it or, with platforms set, to an image index
+// listing it.
+func verifySignatures(ctx context.Context, client *registry.Client, verifier signatureVerifier, evt *payload.Event, platforms bool) error {
+	verified := make(map[string]bool)
+	for _, tag := range evt.Tags {
+		digest, err := client.Resolve(ctx, evt.Image, tag)
+		if err != nil {
+			return fmt.Errorf("failed to resolve tag %s: %w", tag, err)
+		}
+		if evt.Digest != "" && digest != evt.Digest {
+			var children []string
+			if platforms {
+				if children, err = client.PlatformDigests(ctx, evt.Image, digest); err != nil {
+					return fmt.Errorf("failed to read platform digests of tag %s: %w", tag, err)
+				}
+			}
+			if !slices.Contains(children, evt.Digest) {
+				return fmt.Errorf("tag %s points to %s, not the event digest %s", tag, digest, evt.Digest)
+			}
+		}
+		if verified[digest] {
+			continue
+		}
+		if err := verifier.Verify(ctx, evt.Image, digest); err != nil {
+			return err
+		}
+		verified[digest] = true
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+)
+
+// rolloutGroup collects the Deployments and workloads matched by the images
+// of one event. A target matched through several containers or images is
+// restarted once, with a single patch, for the whole event.
+type rolloutGroup struct {
+	targets map[string]k8s.Target
+	// images lists the event images matching each target key
+	images map[string][]string
+}
+
+func newRolloutGroup() *rolloutGroup {
+	return &rolloutGroup{
+		targets: make(map[string]k8s.Target),
+		images:  make(map[string][]string),
+	}
+}
+
+// add adds t, matched by image, merging its containers with any earlier
+// match of the same target.
+func (g *rolloutGroup) add(t k8s.Target, image string) {
+	key := t.Key()
+	if existing, found := g.targets[key]; found {
+		existing.ContainerNames = mergeContainers(existing.ContainerNames, t.ContainerNames)
+		existing.Containers = mergeContainerMatches(existing.Containers, t.Containers)
+		t = existing
+	}
+	g.targets[key] = t
+	g.addImage(key, image)
+}
+
+func (g *rolloutGroup) addImage(key, image string) {
+	if !slices.Contains(g.images[key], image) {
+		g.images[key] = append(g.images[key], image)
+	}
+}
+
+// cause describes the whole group, naming every image that matched a target.
+func (g *rolloutGroup) cause(trigger *payload.Trigger) *k8s.RestartCause {
+	var images []string
+	for _, matched := range g.images {
+		for _, image := range matched {
+			if !slices.Contains(images, image) {
+				images = append(images, image)
+			}
+		}
+	}
+	sort.Strings(images)
+	cause := &k8s.RestartCause{
+		Repository:      trigger.Repository,
+		RepositoryOwner: trigger.RepositoryOwner,
+		Actor:           trigger.Actor,
+		RunID:           trigger.RunID,
+	}
+	if len(images) == 1 {
+		cause.Image = images[0]
+	} else {
+		cause.Images = images
+	}
+	return cause
+}
+
+func (g *rolloutGroup) empty() bool {
+	return len(g.targets) == 0
+}
+
+// sortedTargets returns the Deployments sorted by namespace and name, then
+// the workloads sorted by kind, namespace and name, for deterministic
+// processing.
+func (g *rolloutGroup) sortedTargets() []k8s.Target {
+	targets := make([]k8s.Target, 0, len(g.targets))
+	for _, t := range g.targets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if a, b := targets[i].IsDeployment(), targets[j].IsDeployment(); a != b {
+			return a
+		}
+		return targets[i].Key() < targets[j].Key()
+	})
+	return targets
+}
+
+// selfLast moves the Deployment namespace/name, the worker's own, to the end
+// of targets, so that the restart replacing this worker is triggered only
+// once the rest of the event has been. It reports whether targets contain
+// it.
+func selfLast(targets []k8s.Target, namespace, name string) ([]k8s.Target, bool) {
+	if name == "" {
+		return targets, false
+	}
+	i := slices.IndexFunc(targets, func(t k8s.Target) bool {
+		return t.IsDeployment() && t.Namespace == namespace && t.Name == name
+	})
+	if i < 0 {
+		return targets, false
+	}
+	self := targets[i]
+	targets = append(slices.Delete(targets, i, i+1), self)
+	return targets, true
+}
+
+// mergeContainers returns the sorted union of two container name lists, so
+// each container appears once when a target matches multiple tags or images.
+func mergeContainers(a, b []string) []string {
+	containerSet := make(map[string]bool)
+	for _, c := range a {
+		containerSet[c] = true
+	}
+	for _, c := range b {
+		containerSet[c] = true
+	}
+	merged := make([]string, 0, len(containerSet))
+	for c := range containerSet {
+		merged = append(merged, c)
+	}
+	sort.Strings(merged) // Ensure deterministic ordering
+	return merged
+}
+
+// mergeContainerMatches returns the union of two container match lists,
+// sorted by container name and image reference, so each container and
+// reference pair appears once when a target matches multiple tags.
+func mergeContainerMatches(a, b []k8s.ContainerMatch) []k8s.ContainerMatch {
+	merged := slices.Clone(a)
+	for _, m := range b {
+		if !slices.ContainsFunc(merged, func(e k8s.ContainerMatch) bool { return e.Name == m.Name && e.ImageRef == m.ImageRef }) {
+			merged = append(merged, m)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Name != merged[j].Name {
+			return merged[i].Name < merged[j].Name
+		}
+		return merged[i].ImageRef < merged[j].ImageRef
+	})
+	return merged
+}
+
+// rolloutOutcome counts the results of restarting a rollout group.
+type rolloutOutcome struct {
+	restarted int
+	deferred  int
+	failed    int
+	skipped   int
+}
+
+// result summarizes the outcome as succeeded when every target was restarted
+// or deferred, failed when none was, and partial otherwise.
+func (o rolloutOutcome) result() string {
+	switch {
+	case o.failed+o.skipped == 0:
+		return "succeeded"
+	case o.restarted+o.deferred == 0:
+		return "failed"
+	default:
+		return "partial"
+	}
+}
@@ -0,0 +1,275 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/httpclient"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/logging"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/oidc"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/web"
+)
+
+// WebOptions configures optional Web behavior.
+type WebOptions struct {
+	// Publisher publishes events for workers. Nil publishes to the Valkey
+	// server configured in WebConfig. A Publisher passed here is not closed
+	// by the Web, and fault injection, compression and VALKEY_PING_INTERVAL
+	// do not apply to it.
+	Publisher Publisher
+	// LogLevel is the level of the logger passed to NewWeb, changed by
+	// POST /admin/log-level. Nil leaves the web level unchanged.
+	LogLevel *slog.LevelVar
+	// AuditLogger receives the authentication audit records. Nil writes
+	// them as configured by AUDIT_LOG_OUTPUT.
+	AuditLogger *slog.Logger
+	// Version is the program version in the default Valkey client name,
+	// kuberollouttrigger-web/<Version>. Empty uses dev.
+	Version string
+}
+
+// Web receives GitHub Actions events over HTTP and publishes them for
+// workers.
+type Web struct {
+	cfg    *WebConfig
+	logger *slog.Logger
+	opts   WebOptions
+	stop   *stopper
+}
+
+// NewWeb creates a Web. It does nothing until started.
+func NewWeb(cfg *WebConfig, logger *slog.Logger, opts WebOptions) *Web {
+	return &Web{
+		cfg:    cfg,
+		logger: logger,
+		opts:   opts,
+		stop:   newStopper(),
+	}
+}
+
+// Stop requests a graceful shutdown, waiting up to 10 seconds for requests in
+// flight. It may be called before Start, which then returns immediately.
+func (w *Web) Stop() {
+	w.stop.stop()
+}
+
+// Start serves the web mode until Stop is called or ctx is cancelled. It
+// returns an error if it could not start or the HTTP server failed.
+func (w *Web) Start(ctx context.Context) error {
+	life := w.stop.lifecycle(ctx)
+	defer life.Close()
+	if life.Context().Err() != nil {
+		return nil
+	}
+
+	cfg, logger := w.cfg, w.logger
+	cfg.LogSummary(logger)
+	logConfigWarnings(logger, cfg.Warnings())
+
+	if cfg.DevMode {
+		logger.Warn("DEV MODE ENABLED: OIDC signature verification is disabled. Do not use in production.")
+	}
+
+	// Metrics are registered afresh for each run, so the web can be
+	// started again
+	runMetrics := metrics.NewRegistry()
+	defer metrics.Default.Include(runMetrics)()
+
+	faults := newFaultInjector(runMetrics, map[fault.Point]float64{
+		fault.ValkeyPublish: cfg.FaultValkeyPublishRate,
+		fault.JWKS:          cfg.FaultJWKSRate,
+	}, logger)
+
+	// Initialize OIDC validator
+	validator := oidc.NewValidator(cfg.GithubOIDCAudience, cfg.GithubAllowedOrg, cfg.DevMode, logger)
+	validator.InjectFaults(faults)
+	validator.SetTokenLimits(oidc.TokenLimits{
+		ClockSkew:   cfg.OIDCClockSkew,
+		MaxLifetime: cfg.OIDCMaxTokenLifetime,
+	})
+	// A WebConfig built by hand rather than parsed may leave them empty
+	if cfg.GithubOIDCIssuer != "" {
+		validator.SetIssuer(cfg.GithubOIDCIssuer)
+	}
+	if cfg.GithubOIDCJWKSURL != "" {
+		validator.SetJWKSURL(cfg.GithubOIDCJWKSURL)
+	}
+	for _, issuer := range cfg.OIDCIssuers {
+		validator.AddIssuer(issuer)
+	}
+	jwksClient, err := httpclient.New(cfg.JWKSClientOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS client: %w", err)
+	}
+	validator.SetHTTPClient(jwksClient)
+	validator.SetJWKSCacheFile(cfg.JWKSCacheFile, cfg.JWKSCacheMaxAge)
+
+	// Initialize Valkey publisher
+	publisher := w.opts.Publisher
+	var valkeyPublisher *valkey.Publisher
+	if publisher == nil {
+		p := valkey.NewPublisher(cfg.CommonConfig.NewRedisOptions(valkeyClientName("web", w.opts.Version)), cfg.ValkeyChannel, logger)
+		defer p.Close()
+		if cfg.MessageCompression == "gzip" {
+			p.EnableCompression(cfg.MessageCompressionMinSize)
+		}
+		p.InjectFaults(faults)
+		publisher, valkeyPublisher = p, p
+	}
+
+	// Test Valkey connectivity
+	pingCtx, pingCancel := context.WithTimeout(life.Context(), 5*time.Second)
+	defer pingCancel()
+	if err := publisher.Ping(pingCtx); err != nil {
+		return &classError{class: ErrBrokerUnavailable, err: fmt.Errorf("failed to connect to Valkey at %s: %w", cfg.ValkeyAddr, err)}
+	}
+	logger.Info("connected to Valkey", "addr", cfg.ValkeyAddr)
+
+	// Keep checking the connection so readiness fails while Valkey is lost
+	var ready func() error
+	if valkeyPublisher != nil && cfg.ValkeyPingInterval > 0 {
+		go valkeyPublisher.KeepAlive(life.Context(), cfg.ValkeyPingInterval)
+		ready = valkeyPublisher.Healthy
+	}
+
+	auditLogger := w.opts.AuditLogger
+	if opts, ok := cfg.AuditLogOptions(); ok && auditLogger == nil {
+		l, closer, err := logging.New(opts)
+		if err != nil {
+			return fmt.Errorf("failed to create audit logger: %w", err)
+		}
+		defer closer.Close()
+		auditLogger = l
+	}
+	if auditLogger != nil {
+		// Tells audit records apart when they share an output with the logs
+		auditLogger = auditLogger.With("log", "audit")
+	}
+
+	// Initialize web server
+	var authorizer web.Authorizer
+	if cfg.OPAURL != "" {
+		authorizer = web.NewOPAAuthorizer(cfg.OPAURL, cfg.OPATimeout)
+	}
+
+	// Count events in Valkey so the rate limit holds across web replicas
+	var sharedLimiter web.SharedRateLimiter
+	if cfg.EventRateLimitBackend == "valkey" && cfg.EventRateLimit > 0 {
+		if valkeyPublisher == nil {
+			return &classError{class: ErrInvalidConfig, err: fmt.Errorf("EVENT_RATE_LIMIT_BACKEND=valkey requires the built-in Valkey publisher")}
+		}
+		sharedLimiter = valkeyPublisher.RateLimiter(cfg.EventRateLimit, cfg.EventRateBurst)
+	}
+
+	server := web.NewServer(validator, publisher, cfg.AllowedImagePrefix, logger, web.Options{
+		AuthFailureLogWindow:   cfg.AuthFailureLogWindow,
+		AuditLogger:            auditLogger,
+		ProtectedTags:          cfg.ProtectedTags,
+		AdminToken:             cfg.AdminToken,
+		AdminTokens:            cfg.AdminTokens,
+		EventRateLimit:         cfg.EventRateLimit,
+		EventRateBurst:         cfg.EventRateBurst,
+		SharedRateLimiter:      sharedLimiter,
+		IdempotencyKeyTTL:      cfg.IdempotencyKeyTTL,
+		LoadShedMaxInFlight:    cfg.LoadShedMaxInFlight,
+		LoadShedMaxHeapBytes:   uint64(cfg.LoadShedMaxHeapMB) << 20,
+		ReadOnly:               cfg.ReadOnly,
+		Authorizer:             authorizer,
+		ChannelRoutes:          cfg.ChannelRoutes,
+		LogLevel:               w.opts.LogLevel,
+		RequireReceivers:       cfg.PublishRequireReceivers,
+		SchemaValidation:       cfg.EventSchemaValidation,
+		PayloadStrictness:      payload.Strictness(cfg.PayloadStrictness),
+		Ready:                  ready,
+		GitHubWebhookSecret:    cfg.GitHubWebhookSecret,
+		DeploymentEnvironments: cfg.DeploymentEnvironmentRoutes,
+	})
+	servers := map[string]*http.Server{"web": newHTTPServer(cfg.ListenAddr, server.Handler())}
+	if cfg.AdminListenAddr != "" {
+		// Keep health, metrics and admin routes off the listener behind the ingress
+		servers = map[string]*http.Server{
+			"web":   newHTTPServer(cfg.ListenAddr, server.EventHandler()),
+			"admin": newHTTPServer(cfg.AdminListenAddr, server.OperationalHandler()),
+		}
+	}
+
+	if cfg.HeartbeatInterval > 0 {
+		// Workers on routed channels need heartbeats as much as the default one
+		channels := append([]string{cfg.ValkeyChannel}, cfg.ChannelRoutes.Channels()...)
+		go runHeartbeat(life.Context(), cfg.HeartbeatInterval, publisher, channels, logger)
+	}
+
+	// Graceful shutdown
+	go func() {
+		<-life.Done()
+		logger.Info("shutting down web server", "reason", life.Reason())
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		for _, httpServer := range servers {
+			httpServer.Shutdown(shutdownCtx)
+		}
+	}()
+
+	errs := make(chan error, len(servers))
+	for name, httpServer := range servers {
+		go func() {
+			logger.Info("starting "+name+" server", "addr", httpServer.Addr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errs <- fmt.Errorf("HTTP server error on %s: %w", httpServer.Addr, err)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	var serveErr error
+	for range servers {
+		if err := <-errs; err != nil && serveErr == nil {
+			// One listener failing stops the other
+			serveErr = err
+			life.Stop()
+		}
+	}
+	return serveErr
+}
+
+// newHTTPServer creates an HTTP server for the web mode listeners.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
+
+// runHeartbeat publishes a heartbeat for each event channel every interval so
+// workers can detect that messages from the web no longer reach them.
+func runHeartbeat(ctx context.Context, interval time.Duration, publisher Publisher, channels []string, logger *slog.Logger) {
+	source, err := os.Hostname()
+	if err != nil {
+		source = "unknown"
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, channel := range channels {
+			if err := publisher.PublishHeartbeat(ctx, channel, source); err != nil && ctx.Err() == nil {
+				logger.Warn("failed to publish heartbeat", "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
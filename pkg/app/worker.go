@@ -0,0 +1,972 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/config"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/fault"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/github"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/httpclient"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/logging"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/notify"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/registry"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/routing"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/valkey"
+)
+
+// WorkerOptions configures optional Worker behavior.
+type WorkerOptions struct {
+	// Subscriber delivers the messages published by the web. Nil subscribes
+	// to the Valkey server configured in WorkerConfig. A Subscriber passed
+	// here is not closed by the Worker.
+	Subscriber Subscriber
+	// Restarter finds and restarts workloads. Nil uses the Kubernetes cluster
+	// configured in WorkerConfig. Fault injection does not apply to a
+	// Restarter passed here.
+	Restarter Restarter
+	// LogLevel is the level of the logger passed to NewWorker, changed by
+	// log_level messages from the admin API. Nil ignores those messages.
+	LogLevel *slog.LevelVar
+	// Version is the program version in the default Valkey client name and
+	// Kubernetes user agent, kuberollouttrigger-worker/<Version>. Empty uses
+	// dev.
+	Version string
+	// Middlewares wrap the handling of each message, inside the logging,
+	// metrics, deduplication and timeout of the worker, the first one
+	// outermost.
+	Middlewares []Middleware
+}
+
+// Worker subscribes to the messages published by the web and restarts the
+// workloads running the pushed images.
+type Worker struct {
+	cfg    *WorkerConfig
+	logger *slog.Logger
+	opts   WorkerOptions
+	stop   *stopper
+
+	// Set up by Start
+	restarter    Restarter
+	subscriber   Subscriber
+	registry     *registry.Client
+	verifier     signatureVerifier
+	notifier     *notify.Notifier
+	digestPolicy *digestPolicy
+	reporter     *github.Reporter
+	deferred     *k8s.DeferredQueue
+	pause        *pauseGate
+	// chain is the middleware chain messages are handled with, which those
+	// held while paused are replayed through when resumed
+	chain MessageHandler
+	// lifetime is the context of Start, which deferred restarts are
+	// retried with
+	lifetime context.Context
+
+	// restartErrors counts failed restarts by error class. Nil until Start.
+	restartErrors *metrics.CounterVec
+}
+
+// NewWorker creates a Worker. It does nothing until started.
+func NewWorker(cfg *WorkerConfig, logger *slog.Logger, opts WorkerOptions) *Worker {
+	return &Worker{
+		cfg:    cfg,
+		logger: logger,
+		opts:   opts,
+		stop:   newStopper(),
+	}
+}
+
+// Stop requests a graceful shutdown: the subscription and background loops
+// stop, and restarts still paced by RESTART_INTERVAL are skipped. It may be
+// called before Start, which then returns immediately.
+func (w *Worker) Stop() {
+	w.stop.stop()
+}
+
+// Start runs the worker mode until Stop is called or ctx is cancelled. It
+// returns an error if it could not start; subscription failures are retried.
+func (w *Worker) Start(ctx context.Context) error {
+	life := w.stop.lifecycle(ctx)
+	defer life.Close()
+	ctx = life.Context()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	cfg, logger := w.cfg, w.logger
+	cfg.LogSummary(logger)
+	logConfigWarnings(logger, cfg.Warnings())
+
+	// Metrics are registered afresh for each run, so the worker can be
+	// started again
+	runMetrics := metrics.NewRegistry()
+	defer metrics.Default.Include(runMetrics)()
+
+	faults := newFaultInjector(runMetrics, map[fault.Point]float64{
+		fault.KubeThrottle: cfg.FaultKubeThrottleRate,
+	}, logger)
+
+	// Initialize Kubernetes restarter
+	w.restarter = w.opts.Restarter
+	if w.restarter == nil {
+		restarter, err := k8s.NewRestarter(k8s.Options{
+			Kubeconfig:           cfg.Kubeconfig,
+			Context:              cfg.KubeContext,
+			APIServer:            cfg.KubeAPIServer,
+			BearerToken:          cfg.KubeBearerToken,
+			BearerTokenFile:      cfg.KubeBearerTokenFile,
+			CAFile:               cfg.KubeCAFile,
+			ExecTimeout:          cfg.KubeExecTimeout,
+			UserAgent:            kubeUserAgent(cfg.KubeUserAgent, w.opts.Version),
+			ImpersonateUser:      cfg.KubeAs,
+			ImpersonateGroups:    cfg.KubeAsGroups,
+			TenantImpersonation:  cfg.KubeTenantImpersonation,
+			TenantServiceAccount: cfg.KubeTenantServiceAccount,
+			Namespaces:           cfg.KubeNamespaces,
+			LabelSelector:        cfg.KubeLabelSelector,
+			ListPageSize:         int64(cfg.KubeListPageSize),
+			RecordEvents:         cfg.KubeEvents,
+			PatchStrategy:        cfg.KubePatchStrategy,
+			FieldManager:         cfg.KubeFieldManager,
+			ApplyForce:           cfg.KubeApplyForce,
+			CheckDisruption:      cfg.KubePDBCheck,
+			TimestampFormat:      cfg.RestartedAtFormat,
+			WorkloadKinds:        cfg.WorkloadKinds,
+			Matcher:              cfg.Matcher,
+			Faults:               faults,
+		}, logger)
+		if err != nil {
+			return &classError{class: ErrKubernetesClient, err: fmt.Errorf("failed to initialize Kubernetes client: %w", err)}
+		}
+		if err := checkKubernetesCredentials(restarter, logger); err != nil {
+			return err
+		}
+		w.restarter = restarter
+	}
+
+	// Registry and webhook calls share one transport honoring the proxy settings
+	transport, err := httpclient.NewTransport(cfg.HTTPClientOptions(0))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP transport: %w", err)
+	}
+
+	// Initialize cosign signature verification
+	w.registry = registry.NewClient(registry.Options{
+		Username:  cfg.RegistryUsername,
+		Password:  cfg.RegistryPassword,
+		Transport: transport,
+	}, logger)
+	if cfg.CosignPublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.CosignPublicKeyFile)
+		if err != nil {
+			return &classError{class: ErrInvalidConfig, err: fmt.Errorf("failed to read cosign public key file: %w", err)}
+		}
+		keys, err := registry.ParsePublicKeys(data)
+		if err != nil {
+			return &classError{class: ErrInvalidConfig, err: fmt.Errorf("failed to load cosign public keys from %s: %w", cfg.CosignPublicKeyFile, err)}
+		}
+		w.verifier = registry.NewSignatureVerifier(w.registry, keys, logger)
+		logger.Info("cosign signature verification enabled", "keys", len(keys))
+	}
+
+	// Initialize restart notifications
+	if cfg.NotifyWebhookURL != "" || cfg.NotifyNamespaceAnnotations {
+		notifier := notify.New(notify.Options{
+			DefaultURL:           cfg.NotifyWebhookURL,
+			NamespaceAnnotations: cfg.NotifyNamespaceAnnotations,
+			AllowedHosts:         cfg.NotifyAllowedHosts,
+			Timeout:              cfg.NotifyTimeout,
+			Transport:            transport,
+		}, w.restarter.NamespaceAnnotations, logger)
+		runMetrics.NewCounterFunc(
+			"kuberollouttrigger_notifications_sent_total",
+			"Restart notifications delivered to a webhook.",
+			func() float64 { return float64(notifier.Sent()) },
+		)
+		runMetrics.NewCounterFunc(
+			"kuberollouttrigger_notifications_failed_total",
+			"Restart notifications that could not be delivered.",
+			func() float64 { return float64(notifier.Failed()) },
+		)
+		w.notifier = notifier
+	}
+
+	// Initialize the namespace digest policy
+	if cfg.NamespaceDigestPolicy {
+		policy := newDigestPolicy(w.restarter.NamespaceAnnotations, logger)
+		runMetrics.NewCounterFunc(
+			"kuberollouttrigger_digest_policy_excluded_total",
+			"Deployments and workloads not restarted because their namespace requires an image digest.",
+			func() float64 { return float64(policy.Excluded()) },
+		)
+		w.digestPolicy = policy
+		logger.Info("namespace digest policy enabled", "annotation", k8s.RequireDigestAnnotation)
+	}
+
+	// Initialize rollout reports to GitHub
+	if cfg.GitHubReport != "" {
+		reporter, err := github.New(github.Options{
+			Mode:           cfg.GitHubReport,
+			APIURL:         cfg.GitHubAPIURL,
+			AppID:          cfg.GitHubAppID,
+			InstallationID: cfg.GitHubAppInstallationID,
+			PrivateKey:     cfg.GitHubAppPrivateKey,
+			Context:        cfg.GitHubStatusContext,
+			Environment:    cfg.GitHubDeploymentEnvironment,
+			Timeout:        cfg.GitHubTimeout,
+			Transport:      transport,
+		}, logger)
+		if err != nil {
+			return fmt.Errorf("failed to initialize GitHub reporting: %w", err)
+		}
+		runMetrics.NewCounterFunc(
+			"kuberollouttrigger_github_reports_sent_total",
+			"Rollout results reported to GitHub.",
+			func() float64 { return float64(reporter.Sent()) },
+		)
+		runMetrics.NewCounterFunc(
+			"kuberollouttrigger_github_reports_failed_total",
+			"Rollout results that could not be reported to GitHub.",
+			func() float64 { return float64(reporter.Failed()) },
+		)
+		w.reporter = reporter
+		logger.Info("GitHub rollout reporting enabled", "mode", cfg.GitHubReport)
+	}
+
+	// Initialize Valkey subscriber
+	w.subscriber = w.opts.Subscriber
+	if w.subscriber == nil {
+		subscriber := valkey.NewSubscriber(cfg.CommonConfig.NewRedisOptions(valkeyClientName("worker", w.opts.Version)), cfg.ValkeyChannel, logger, valkey.SubscriberOptions{
+			BufferSize:          cfg.SubscriberBufferSize,
+			HealthCheckInterval: cfg.SubscriberHealthCheckInterval,
+			DropOldest:          cfg.SubscriberOverflow == "drop_oldest",
+			Channels:            cfg.ValkeyChannels,
+			Pattern:             cfg.ValkeyChannelPattern,
+		})
+		defer subscriber.Close()
+		w.subscriber = subscriber
+	}
+	subscriber := w.subscriber
+	runMetrics.NewGaugeFunc(
+		"kuberollouttrigger_subscriber_buffered_messages",
+		"Messages received from Valkey and waiting to be processed.",
+		func() float64 { return float64(subscriber.Buffered()) },
+	)
+	runMetrics.NewCounterFunc(
+		"kuberollouttrigger_subscriber_dropped_messages_total",
+		"Messages discarded because the subscriber buffer was full.",
+		func() float64 { return float64(subscriber.Dropped()) },
+	)
+
+	// Test Valkey connectivity
+	pingCtx, pingCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer pingCancel()
+	if err := subscriber.Ping(pingCtx); err != nil {
+		return &classError{class: ErrBrokerUnavailable, err: fmt.Errorf("failed to connect to Valkey at %s: %w", cfg.ValkeyAddr, err)}
+	}
+	logger.Info("connected to Valkey", "addr", cfg.ValkeyAddr)
+
+	// Restarts deferred by the disruption check are retried in the background
+	w.lifetime = ctx
+	w.deferred = k8s.NewDeferredQueue(w.restarter, cfg.KubePDBRetryInterval, cfg.KubePDBDeferTimeout, logger)
+	w.restartErrors = runMetrics.NewCounterVec(
+		"kuberollouttrigger_restart_errors_total",
+		"Restarts that failed, by Kubernetes API error class (not_found, unauthorized, forbidden, conflict, throttled or other).",
+		"class",
+	)
+
+	// Events and restarts are held while an admin has paused the worker
+	pause := &pauseGate{}
+	w.pause = pause
+	if cfg.StartPaused {
+		pause.Pause()
+		w.deferred.Pause()
+		logger.Warn("worker started paused, holding events until resumed")
+	}
+	runMetrics.NewGaugeFunc(
+		"kuberollouttrigger_worker_paused",
+		"1 while processing is paused through the admin API or START_PAUSED, otherwise 0.",
+		func() float64 {
+			if pause.Paused() {
+				return 1
+			}
+			return 0
+		},
+	)
+	runMetrics.NewGaugeFunc(
+		"kuberollouttrigger_worker_held_messages",
+		"Messages held while processing is paused.",
+		func() float64 { return float64(pause.Held()) },
+	)
+
+	if cfg.StartupPrefixCheck || cfg.InventoryResyncInterval > 0 {
+		go runInventory(ctx, cfg, w.restarter, runMetrics, logger)
+	}
+	if cfg.StartupBackfill {
+		// Run alongside the subscription so events published meanwhile are not missed
+		var verify func(ctx context.Context, image, digest string) error
+		if w.verifier != nil {
+			verify = w.verifier.Verify
+		}
+		go runBackfill(ctx, cfg, w.restarter, w.registry, verify, w.digestPolicy, w.deferred, pause, logger)
+	}
+	if cfg.AnnotationGCMaxAge > 0 {
+		go runAnnotationGC(ctx, cfg, w.restarter, logger)
+	}
+	if cfg.HealthListenAddr != "" {
+		go serveWorkerHealth(ctx, cfg.HealthListenAddr, subscriber, logger)
+	}
+	if cfg.HeartbeatTimeout > 0 {
+		go monitorHeartbeat(ctx, cfg.HeartbeatTimeout, subscriber, runMetrics, logger)
+	}
+
+	logger.Info("starting worker, subscribing to Valkey channel",
+		"channel", cfg.ValkeyChannel,
+		"channels", strings.Join(cfg.ValkeyChannels, ","),
+		"pattern", cfg.ValkeyChannelPattern,
+	)
+
+	handler := w.handler(logger, runMetrics)
+	w.chain = handler
+
+	// Retry loop for subscriber
+	for {
+		err := subscriber.Subscribe(ctx, handler)
+		if ctx.Err() != nil {
+			// Context cancelled, exit gracefully
+			logger.Info("shutting down worker", "reason", life.Reason())
+			return nil
+		}
+		if err != nil {
+			logger.Error("Valkey subscription error, retrying in 5s", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("shutting down worker", "reason", life.Reason())
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// checkKubernetesCredentials fails with ErrKubernetesClient if the API server
+// rejects the credentials of restarter. Any other error, such as an API
+// server that cannot be reached yet, is logged and left to the restarts.
+func checkKubernetesCredentials(restarter *k8s.Restarter, logger *slog.Logger) error {
+	err := restarter.CheckCredentials()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, k8s.ErrUnauthorized), errors.Is(err, k8s.ErrForbidden):
+		return &classError{class: ErrKubernetesClient, err: err}
+	default:
+		logger.Warn("failed to check Kubernetes credentials", "error", err, "error_class", k8s.ErrorClass(err))
+		return nil
+	}
+}
+
+// handler returns w.handle wrapped with the message logging, metrics,
+// deduplication and timeout of the worker, then the WorkerOptions
+// middlewares. Its metrics are registered in registry.
+func (w *Worker) handler(logger *slog.Logger, registry *metrics.Registry) MessageHandler {
+	middlewares := []Middleware{
+		logMessages(logger),
+		countMessages(
+			registry.NewCounter("kuberollouttrigger_worker_messages_total", "Messages handled by the worker, including duplicates dropped."),
+			registry.NewCounter("kuberollouttrigger_worker_message_handling_seconds_total", "Total time spent handling messages."),
+		),
+	}
+	if w.cfg.MessageDedupeWindow > 0 {
+		middlewares = append(middlewares, dedupeMessages(w.cfg.MessageDedupeWindow,
+			registry.NewCounter("kuberollouttrigger_worker_messages_deduplicated_total", "Events dropped as duplicates of one received within MESSAGE_DEDUPE_WINDOW."),
+			logger,
+		))
+	}
+	if w.cfg.MessageTimeout > 0 {
+		middlewares = append(middlewares, timeoutMessages(w.cfg.MessageTimeout,
+			registry.NewCounter("kuberollouttrigger_worker_messages_timed_out_total", "Messages whose handling was cancelled after MESSAGE_TIMEOUT."),
+			logger,
+		))
+	}
+	return Chain(w.handle, append(middlewares, w.opts.Middlewares...)...)
+}
+
+// retryContext returns the context to retry deferred restarts with: the
+// worker's lifetime, so retries outlive the handling of the message that
+// deferred them, even when MESSAGE_TIMEOUT cancels it. Before Start it is
+// ctx.
+func (w *Worker) retryContext(ctx context.Context) context.Context {
+	if w.lifetime != nil {
+		return w.lifetime
+	}
+	return ctx
+}
+
+// setLogLevel changes the log level as asked by a log_level message.
+func (w *Worker) setLogLevel(name string, logger *slog.Logger) {
+	if w.opts.LogLevel == nil {
+		logger.Info("log level cannot be changed, ignoring log level message", "level", name)
+		return
+	}
+	level, err := logging.ParseLevel(name)
+	if err != nil {
+		logger.Error("invalid log level, skipping", "error", err.Error())
+		return
+	}
+	w.opts.LogLevel.Set(level)
+	// Logged at warn so the change is recorded whatever the new level
+	logger.Warn("log level changed", "level", level.String())
+}
+
+// handle processes one message from the subscription, published to
+// channel. An empty channel is VALKEY_CHANNEL.
+func (w *Worker) handle(ctx context.Context, channel, message string) {
+	if channel == "" {
+		channel = w.cfg.ValkeyChannel
+	}
+	msg, unknown, err := payload.ParseMessageWith([]byte(message), w.cfg.AllowedImagePrefix, payload.Strictness(w.cfg.PayloadStrictness))
+	if err != nil {
+		w.logger.Error("invalid message payload, skipping", "error", err.Error())
+		return
+	}
+	if unknown != "" {
+		w.logger.Warn("message payload has unknown field", "field", unknown)
+	}
+	evt := msg.Event
+
+	// Attribute every log line for this event to the triggering workflow run
+	trigger := msg.Trigger
+	if trigger == nil {
+		trigger = &payload.Trigger{}
+	}
+	logger := w.logger.With(
+		"repository", trigger.Repository,
+		"actor", trigger.Actor,
+		"run_id", trigger.RunID,
+	)
+
+	// The admin API only publishes to VALKEY_CHANNEL; the other channels
+	// carry events routed by the web and nothing else
+	if msg.Type != "" && msg.Type != payload.MessageTypeEvent && channel != w.cfg.ValkeyChannel {
+		logger.Warn("ignoring control message on an event channel", "type", msg.Type, "channel", channel)
+		return
+	}
+
+	switch msg.Type {
+	case payload.MessageTypePause:
+		if w.pause.Pause() {
+			w.deferred.Pause()
+			logger.Warn("worker paused, holding events until resumed")
+		}
+		return
+	case payload.MessageTypeResume:
+		held, ok := w.pause.Resume()
+		if !ok {
+			logger.Info("worker is not paused, ignoring resume")
+			return
+		}
+		w.deferred.Resume()
+		logger.Info("worker resumed", "held_messages", len(held))
+		// Each held message is handled as if it arrived now, with its own
+		// MESSAGE_TIMEOUT rather than what is left of the resume's
+		replay := w.chain
+		if replay == nil {
+			replay = w.handle
+		}
+		replayCtx := replayContext(w.retryContext(ctx), time.Now())
+		for _, m := range held {
+			replay(replayCtx, m.channel, m.message)
+		}
+		return
+	case payload.MessageTypeLogLevel:
+		// Handled while paused: debug logs matter most during an incident
+		w.setLogLevel(msg.LogLevel, logger)
+		return
+	case payload.MessageTypeMatchQuery:
+		// Queries restart nothing, so they are answered while paused
+		handleMatchQuery(ctx, w.restarter, w.subscriber, w.cfg, msg.Query, logger)
+		return
+	}
+
+	if held, dropped := w.pause.Hold(channel, message); held {
+		logger.Info("worker paused, holding message", "type", msg.Type, "held_messages", w.pause.Held())
+		if dropped {
+			logger.Warn("too many held messages, dropped oldest", "max_held_messages", maxHeldMessages)
+		}
+		return
+	}
+
+	if msg.Type == payload.MessageTypeRestart {
+		handleManualRestart(ctx, w.retryContext(ctx), w.restarter, w.deferred, msg.Restart, trigger, logger)
+		return
+	}
+
+	parts := evt.Parts()
+	if len(parts) > 1 {
+		logger.Info("processing multi-image event", "images", len(parts))
+	}
+	group := newRolloutGroup()
+	channelRule := w.cfg.ChannelRules.Route(channel)
+	for _, part := range parts {
+		if !w.matchImage(ctx, msg, part, channelRule, group, logger) {
+			return
+		}
+	}
+
+	if group.empty() {
+		logger.Info("no matching deployments found", "image_refs", strings.Join(evt.ImageRefs(), ","))
+		return
+	}
+
+	outcome := w.restartGroup(ctx, group, trigger, logger)
+	if len(parts) > 1 {
+		level := slog.LevelInfo
+		if outcome.result() != "succeeded" {
+			level = slog.LevelWarn
+		}
+		logger.Log(ctx, level, "multi-image rollout group finished",
+			"outcome", outcome.result(),
+			"images", len(parts),
+			"restarted", outcome.restarted,
+			"deferred", outcome.deferred,
+			"failed", outcome.failed,
+			"skipped", outcome.skipped,
+		)
+	}
+}
+
+// matchImage adds the Deployments and workloads running one image of an
+// event message, allowed by the rule of its channel, to group. It returns
+// false if the image failed signature verification, in which case nothing of
+// the event may be restarted.
+func (w *Worker) matchImage(ctx context.Context, msg *payload.Message, evt *payload.Event, channelRule *routing.Rule, group *rolloutGroup, logger *slog.Logger) bool {
+	if w.cfg.RegistryVerify {
+		evt.Tags = existingTags(ctx, w.registry, evt, w.cfg.RegistryWaitTimeout, logger)
+		if len(evt.Tags) == 0 {
+			logger.Warn("no event tags exist in the registry, skipping image", "image", evt.Image)
+			return true
+		}
+	}
+
+	imageRefs := evt.ImageRefs()
+	logger.Info("processing event", "image", evt.Image, "tags", strings.Join(evt.Tags, ","), "digest", evt.Digest, "priority", evt.Priority, "image_refs_count", len(imageRefs))
+
+	if w.verifier != nil {
+		if err := verifySignatures(ctx, w.registry, w.verifier, evt, w.cfg.RegistryPlatformDigests); err != nil {
+			logger.Error("image signature verification failed, skipping event", "image", evt.Image, "error", err)
+			return false
+		}
+		logger.Info("image signature verified", "image", evt.Image)
+	}
+
+	// Collect all matching deployments for any of the image references.
+	// The group deduplicates deployments that match multiple tags or images.
+	for i, imageRef := range imageRefs {
+		matches, err := w.restarter.FindMatchingDeployments(ctx, imageRef)
+		if err != nil {
+			logger.Error("failed to find matching deployments", "image_ref", imageRef, "error", err, "error_class", k8s.ErrorClass(err))
+			continue
+		}
+
+		// Restrict matches to the namespaces/labels this tag is routed to
+		route := w.cfg.TagRoutes.Route(evt.Tags[i])
+
+		if w.cfg.ExplainMatches {
+			explainMatches(ctx, w.restarter, imageRef, logger)
+		}
+
+		for _, m := range matches {
+			if !msg.AllowsNamespace(m.Namespace) {
+				logger.Info("deployment excluded by authorization policy", "namespace", m.Namespace, "deployment", m.Name)
+				continue
+			}
+			if reason := channelRule.Explain(m.Namespace, m.Labels); reason != "" {
+				logger.Info("deployment excluded by channel rule", "namespace", m.Namespace, "deployment", m.Name, "reason", reason)
+				continue
+			}
+			if reason := route.Explain(m.Namespace, m.Labels); reason != "" {
+				logger.Info("deployment excluded by tag route",
+					"namespace", m.Namespace,
+					"deployment", m.Name,
+					"tag", evt.Tags[i],
+					"reason", reason,
+				)
+				continue
+			}
+			if w.digestPolicy.Excludes(ctx, m.Namespace, evt.Digest) {
+				logger.Info("deployment excluded by namespace digest policy", "namespace", m.Namespace, "deployment", m.Name, "tag", evt.Tags[i], "reason", digestRequiredReason)
+				continue
+			}
+			group.add(k8s.DeploymentTarget(m), evt.Image)
+		}
+	}
+
+	for _, wl := range findWorkloads(ctx, w.restarter, w.cfg, msg, evt, imageRefs, channelRule, w.digestPolicy, logger) {
+		group.add(k8s.WorkloadTarget(wl), evt.Image)
+	}
+	return true
+}
+
+// restartGroup restarts every Deployment and workload of group once, with
+// a cause naming the images that matched it. Up to RESTART_CONCURRENCY
+// restarts are in flight at once; the failures are summarized in one log
+// entry once all are done.
+func (w *Worker) restartGroup(ctx context.Context, group *rolloutGroup, trigger *payload.Trigger, logger *slog.Logger) rolloutOutcome {
+	targets, self := selfLast(group.sortedTargets(), w.cfg.SelfNamespace, w.cfg.SelfDeployment)
+	if self {
+		logger.Warn("event matches the worker's own Deployment, restarting it last",
+			"namespace", w.cfg.SelfNamespace,
+			"deployment", w.cfg.SelfDeployment,
+			"targets", len(targets),
+		)
+	}
+
+	causeFor := func(key string) *k8s.RestartCause {
+		cause := &k8s.RestartCause{
+			Repository:      trigger.Repository,
+			RepositoryOwner: trigger.RepositoryOwner,
+			Actor:           trigger.Actor,
+			RunID:           trigger.RunID,
+		}
+		if images := group.images[key]; len(images) == 1 {
+			cause.Image = images[0]
+		} else {
+			cause.Images = images
+		}
+		cause.Containers = group.targets[key].Containers
+		return cause
+	}
+
+	results := w.restartTargets(ctx, targets, self, causeFor, logger)
+
+	// Notify and report whatever was restarted, even if shutdown cut the group short
+	var outcome rolloutOutcome
+	var restarted []notify.Restart
+	var failures []error
+	for i, result := range results {
+		t := targets[i]
+		switch result.status {
+		case targetRestarted:
+			outcome.restarted++
+			restarted = append(restarted, notify.Restart{Kind: t.KindName(), Namespace: t.Namespace, Name: t.Name})
+		case targetDeferred:
+			outcome.deferred++
+		case targetFailed:
+			outcome.failed++
+			failures = append(failures, fmt.Errorf("%s %s: %w", t.KindName(), t.Key(), result.err))
+		default:
+			outcome.skipped++
+		}
+	}
+	if len(failures) > 0 {
+		logger.Error("failed to restart targets of event",
+			"failed", len(failures),
+			"targets", len(targets),
+			"error", errors.Join(failures...),
+		)
+	}
+	if w.notifier != nil && len(restarted) > 0 {
+		w.notifier.Notify(context.WithoutCancel(ctx), restarted, group.cause(trigger).String())
+	}
+	if w.reporter != nil {
+		w.reporter.Report(context.WithoutCancel(ctx), githubReport(trigger, restarted, outcome))
+	}
+	return outcome
+}
+
+// Statuses of the restart of one target.
+const (
+	targetSkipped = iota
+	targetRestarted
+	targetDeferred
+	targetFailed
+)
+
+// targetResult is the outcome of the restart of one target.
+type targetResult struct {
+	status int
+	err    error
+}
+
+// restartTargets restarts targets in order, with up to RESTART_CONCURRENCY
+// restarts in flight and RESTART_INTERVAL between the start of consecutive
+// restarts. When self is set, the last target, the worker's own Deployment,
+// is only restarted once all others are done. It returns the result of each
+// target; the targets not started because the worker is shutting down are
+// skipped.
+func (w *Worker) restartTargets(ctx context.Context, targets []k8s.Target, self bool, causeFor func(key string) *k8s.RestartCause, logger *slog.Logger) []targetResult {
+	results := make([]targetResult, len(targets))
+	slots := make(chan struct{}, max(w.cfg.RestartConcurrency, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for i, t := range targets {
+		if self && i == len(targets)-1 {
+			wg.Wait()
+		}
+		// Space out restarts to avoid simultaneous image pulls
+		if i > 0 && w.cfg.RestartInterval > 0 {
+			logger.Debug("waiting before next restart", "restart_interval", w.cfg.RestartInterval.String())
+			select {
+			case <-ctx.Done():
+				logger.Warn("shutting down, skipping remaining restarts", "remaining", len(targets)-i)
+				return results
+			case <-time.After(w.cfg.RestartInterval):
+			}
+		}
+		slots <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			results[i] = w.restartTarget(ctx, t, causeFor(t.Key()), logger)
+		})
+	}
+	return results
+}
+
+// restartTarget restarts t, deferring Deployments that cannot be restarted
+// safely now or failed with a transient error.
+func (w *Worker) restartTarget(ctx context.Context, t k8s.Target, cause *k8s.RestartCause, logger *slog.Logger) targetResult {
+	logger.Info("found matching target",
+		"kind", t.KindName(),
+		"namespace", t.Namespace,
+		"name", t.Name,
+		"containers", strings.Join(t.ContainerNames, ","),
+		"image", cmp.Or(cause.Image, strings.Join(cause.Images, ",")),
+	)
+	err := w.restarter.Restart(ctx, t, cause)
+	var deferredErr *k8s.DeferredError
+	switch {
+	case err == nil:
+		return targetResult{status: targetRestarted}
+	case errors.As(err, &deferredErr) && t.IsDeployment():
+		logger.Warn("restart deferred",
+			"namespace", t.Namespace,
+			"deployment", t.Name,
+			"reason", deferredErr.Reason,
+			"retry_interval", w.cfg.KubePDBRetryInterval.String(),
+		)
+		w.deferred.Add(w.retryContext(ctx), t.Namespace, t.Name, cause)
+		return targetResult{status: targetDeferred}
+	}
+
+	w.countRestartError(err)
+	switch {
+	case k8s.IsTransient(err) && t.IsDeployment():
+		logger.Warn("restart failed with a transient error, retrying",
+			"namespace", t.Namespace,
+			"deployment", t.Name,
+			"error", err,
+			"error_class", k8s.ErrorClass(err),
+			"retry_interval", w.cfg.KubePDBRetryInterval.String(),
+		)
+		w.deferred.Add(w.retryContext(ctx), t.Namespace, t.Name, cause)
+		return targetResult{status: targetDeferred}
+	case errors.Is(err, k8s.ErrNotFound):
+		// Deleted since it was listed, so there is nothing to restart
+		logger.Warn("target no longer exists, skipping",
+			"kind", t.KindName(),
+			"namespace", t.Namespace,
+			"name", t.Name,
+		)
+		return targetResult{status: targetSkipped}
+	default:
+		logger.Error("failed to restart target",
+			"kind", t.KindName(),
+			"namespace", t.Namespace,
+			"name", t.Name,
+			"error", err,
+			"error_class", k8s.ErrorClass(err),
+		)
+		return targetResult{status: targetFailed, err: err}
+	}
+}
+
+// countRestartError counts a failed restart by the class of err.
+func (w *Worker) countRestartError(err error) {
+	if w.restartErrors != nil {
+		w.restartErrors.WithLabelValues(k8s.ErrorClass(err)).Inc()
+	}
+}
+
+// githubReport returns the GitHub report of a rollout group restarted for
+// trigger.
+func githubReport(trigger *payload.Trigger, restarted []notify.Restart, outcome rolloutOutcome) github.Report {
+	report := github.Report{
+		Repository: trigger.Repository,
+		SHA:        trigger.SHA,
+		RunID:      trigger.RunID,
+		Deferred:   outcome.deferred,
+		Failed:     outcome.failed,
+		Skipped:    outcome.skipped,
+	}
+	for _, r := range restarted {
+		report.Restarted = append(report.Restarted, r.Kind+" "+r.Namespace+"/"+r.Name)
+	}
+	return report
+}
+
+// handleManualRestart restarts the single Deployment named by an admin request.
+func handleManualRestart(ctx, retryCtx context.Context, restarter Restarter, deferred *k8s.DeferredQueue, req *payload.RestartRequest, trigger *payload.Trigger, logger *slog.Logger) {
+	logger = logger.With("namespace", req.Namespace, "deployment", req.Deployment)
+	logger.Info("processing manual restart", "reason", req.Reason)
+
+	cause := &k8s.RestartCause{
+		Actor:  trigger.Actor,
+		Reason: req.Reason,
+	}
+	err := restarter.RestartDeployment(ctx, req.Namespace, req.Deployment, cause)
+	var deferredErr *k8s.DeferredError
+	switch {
+	case errors.As(err, &deferredErr):
+		logger.Warn("restart deferred", "reason", deferredErr.Reason)
+		deferred.Add(retryCtx, req.Namespace, req.Deployment, cause)
+	case err != nil:
+		logger.Error("failed to restart deployment", "error", err)
+	}
+}
+
+// findWorkloads returns the custom workloads running any of imageRefs of the
+// single-image event evt that the tag routes and the message's namespace
+// restrictions and the digest policy allow, deduplicated and sorted by kind,
+// namespace and name.
+func findWorkloads(ctx context.Context, restarter Restarter, cfg *config.WorkerConfig, msg *payload.Message, evt *payload.Event, imageRefs []string, channelRule *routing.Rule, policy *digestPolicy, logger *slog.Logger) []k8s.MatchingWorkload {
+	if len(cfg.WorkloadKinds) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]int)
+	var workloads []k8s.MatchingWorkload
+	for i, imageRef := range imageRefs {
+		matches, err := restarter.FindMatchingWorkloads(ctx, imageRef)
+		if err != nil {
+			logger.Error("failed to find matching workloads", "image_ref", imageRef, "error", err, "error_class", k8s.ErrorClass(err))
+			continue
+		}
+		route := cfg.TagRoutes.Route(evt.Tags[i])
+		for _, w := range matches {
+			if !msg.AllowsNamespace(w.Namespace) {
+				logger.Info("workload excluded by authorization policy", "kind", w.Kind.String(), "namespace", w.Namespace, "name", w.Name)
+				continue
+			}
+			if reason := channelRule.Explain(w.Namespace, w.Labels); reason != "" {
+				logger.Info("workload excluded by channel rule", "kind", w.Kind.String(), "namespace", w.Namespace, "name", w.Name, "reason", reason)
+				continue
+			}
+			if reason := route.Explain(w.Namespace, w.Labels); reason != "" {
+				logger.Info("workload excluded by tag route",
+					"kind", w.Kind.String(),
+					"namespace", w.Namespace,
+					"name", w.Name,
+					"tag", evt.Tags[i],
+					"reason", reason,
+				)
+				continue
+			}
+			if policy.Excludes(ctx, w.Namespace, evt.Digest) {
+				logger.Info("workload excluded by namespace digest policy", "kind", w.Kind.String(), "namespace", w.Namespace, "name", w.Name, "tag", evt.Tags[i], "reason", digestRequiredReason)
+				continue
+			}
+			key := w.Kind.String() + "/" + w.Namespace + "/" + w.Name
+			if j, found := seen[key]; found {
+				// Keep every container and reference that matched
+				workloads[j].Containers = mergeContainerMatches(workloads[j].Containers, w.Containers)
+				continue
+			}
+			seen[key] = len(workloads)
+			workloads = append(workloads, w)
+		}
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		a, b := workloads[i], workloads[j]
+		if a.Kind.String() != b.Kind.String() {
+			return a.Kind.String() < b.Kind.String()
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return workloads
+}
+
+// handleMatchQuery answers an admin match query with the Deployments that an
+// image push for the queried tag would currently restart.
+func handleMatchQuery(ctx context.Context, restarter Restarter, subscriber Subscriber, cfg *config.WorkerConfig, q *payload.MatchQuery, logger *slog.Logger) {
+	// Only reply on channels derived from our own channel so a query cannot
+	// be used to publish into arbitrary channels
+	if !strings.HasPrefix(q.ReplyTo, cfg.ValkeyChannel+":reply:") {
+		logger.Warn("ignoring match query with foreign reply channel", "reply_to", q.ReplyTo)
+		return
+	}
+
+	imageRef := q.Image + ":" + q.Tag
+	reply := payload.MatchReply{Matches: []payload.MatchResult{}}
+	matches, err := restarter.FindMatchingDeployments(ctx, imageRef)
+	if err != nil {
+		logger.Error("failed to find matching deployments", "image_ref", imageRef, "error", err, "error_class", k8s.ErrorClass(err))
+		reply.Error = "failed to find matching deployments"
+	}
+	route := cfg.TagRoutes.Route(q.Tag)
+	for _, m := range matches {
+		reply.Matches = append(reply.Matches, payload.MatchResult{
+			Namespace:  m.Namespace,
+			Deployment: m.Name,
+			Containers: m.ContainerNames,
+			Excluded:   route.Explain(m.Namespace, m.Labels),
+		})
+	}
+	sort.Slice(reply.Matches, func(i, j int) bool {
+		if reply.Matches[i].Namespace != reply.Matches[j].Namespace {
+			return reply.Matches[i].Namespace < reply.Matches[j].Namespace
+		}
+		return reply.Matches[i].Deployment < reply.Matches[j].Deployment
+	})
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		logger.Error("failed to serialize match reply", "error", err)
+		return
+	}
+	if err := subscriber.Reply(ctx, q.ReplyTo, string(data)); err != nil {
+		logger.Error("failed to send match reply", "error", err)
+		return
+	}
+	logger.Info("answered match query", "image_ref", imageRef, "deployments_matched", len(reply.Matches))
+}
+
+// explainMatches logs why each Deployment running the image repository did or
+// did not match imageRef, to diagnose Deployments that were not restarted.
+func explainMatches(ctx context.Context, restarter Restarter, imageRef string, logger *slog.Logger) {
+	decisions, examined, err := restarter.ExplainMatches(ctx, imageRef)
+	if err != nil {
+		logger.Warn("failed to explain matches", "image_ref", imageRef, "error", err)
+		return
+	}
+	for _, d := range decisions {
+		logger.Info("match decision",
+			"image_ref", imageRef,
+			"namespace", d.Namespace,
+			"deployment", d.Name,
+			"matched", d.Matched,
+			"reason", d.Reason,
+		)
+	}
+	logger.Info("match explanation complete",
+		"image_ref", imageRef,
+		"deployments_examined", examined,
+		"deployments_explained", len(decisions),
+	)
+}
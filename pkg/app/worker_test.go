@@ -0,0 +1,850 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/config"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/k8s"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/metrics"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/notify"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/payload"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/registry"
+	"github.com/UnitVectorY-Labs/kuberollouttrigger/internal/routing"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeRestarter matches every Deployment in deployments by image reference
+// and records the restarts.
+type fakeRestarter struct {
+	deployments map[string][]MatchingDeployment
+	annotations map[string]map[string]string
+	stale       []StaleDeployment
+	// errs fails the restarts of the namespace/name keys
+	errs map[string]error
+	// delay slows each restart down, failing it if ctx ends first
+	delay time.Duration
+
+	mu        sync.Mutex
+	restarted []string
+	causes    []*RestartCause
+}
+
+func (f *fakeRestarter) FindMatchingDeployments(ctx context.Context, imageRef string) ([]MatchingDeployment, error) {
+	return f.deployments[imageRef], nil
+}
+
+func (f *fakeRestarter) FindMatchingWorkloads(ctx context.Context, imageRef string) ([]MatchingWorkload, error) {
+	return nil, nil
+}
+
+func (f *fakeRestarter) RestartDeployment(ctx context.Context, namespace, name string, cause *RestartCause) error {
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.errs[namespace+"/"+name]; err != nil {
+		return err
+	}
+	f.restarted = append(f.restarted, namespace+"/"+name)
+	f.causes = append(f.causes, cause)
+	return nil
+}
+
+func (f *fakeRestarter) Restart(ctx context.Context, t Target, cause *RestartCause) error {
+	if t.IsDeployment() {
+		return f.RestartDeployment(ctx, t.Namespace, t.Name, cause)
+	}
+	return nil
+}
+
+func (f *fakeRestarter) ExplainMatches(ctx context.Context, imageRef string) ([]MatchDecision, int, error) {
+	return nil, 0, nil
+}
+
+func (f *fakeRestarter) Inventory(ctx context.Context, imagePrefix string) (Inventory, error) {
+	return Inventory{}, nil
+}
+
+func (f *fakeRestarter) FindStaleDeployments(ctx context.Context, imagePrefix string, resolve ResolveFunc) ([]StaleDeployment, error) {
+	return f.stale, nil
+}
+
+func (f *fakeRestarter) CleanupTriggerAnnotations(ctx context.Context, maxAge time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeRestarter) NamespaceAnnotations(ctx context.Context, namespace string) (map[string]string, error) {
+	if namespace == "unreadable" {
+		return nil, errors.New("namespaces is forbidden")
+	}
+	return f.annotations[namespace], nil
+}
+
+func (f *fakeRestarter) Restarted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.restarted...)
+}
+
+// fakeSubscriber delivers messages to the handler and then blocks until the
+// subscription is cancelled.
+type fakeSubscriber struct {
+	messages  []string
+	delivered chan struct{}
+}
+
+func (f *fakeSubscriber) Subscribe(ctx context.Context, handler MessageHandler) error {
+	for _, m := range f.messages {
+		handler(ctx, "test", m)
+	}
+	close(f.delivered)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (f *fakeSubscriber) Reply(ctx context.Context, channel, message string) error { return nil }
+func (f *fakeSubscriber) Channel() string                                          { return "test" }
+func (f *fakeSubscriber) LastHeartbeat() time.Time                                 { return time.Time{} }
+func (f *fakeSubscriber) Healthy(ctx context.Context) error                        { return nil }
+func (f *fakeSubscriber) Buffered() int                                            { return 0 }
+func (f *fakeSubscriber) Dropped() int64                                           { return 0 }
+func (f *fakeSubscriber) Ping(ctx context.Context) error                           { return nil }
+
+func eventMessage(t *testing.T, msgType string, evt *payload.Event) string {
+	t.Helper()
+	msg := &payload.Message{
+		Type:    msgType,
+		Event:   evt,
+		Trigger: &payload.Trigger{Repository: "test-org/app", Actor: "octocat", RunID: "42"},
+	}
+	data, err := msg.ToJSON()
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	return string(data)
+}
+
+func testWorkerConfig() *WorkerConfig {
+	return &WorkerConfig{
+		CommonConfig:         config.CommonConfig{ValkeyChannel: "test"},
+		AllowedImagePrefix:   "ghcr.io/test/",
+		KubePDBRetryInterval: time.Second,
+		KubePDBDeferTimeout:  time.Minute,
+	}
+}
+
+func TestWorker_StartHandlesEventsUntilStopped(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:latest": {
+			{Namespace: "dev", Name: "api", ContainerNames: []string{"api"}},
+			{Namespace: "dev", Name: "web", ContainerNames: []string{"web"}},
+		},
+		"ghcr.io/test/app:v1": {
+			{Namespace: "dev", Name: "api", ContainerNames: []string{"api"}},
+		},
+	}}
+	subscriber := &fakeSubscriber{
+		messages: []string{
+			eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest", "v1"}}),
+			eventMessage(t, payload.MessageTypePause, nil),
+			eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"v1"}}),
+			`{"type":"log_level","log_level":"debug","trigger":{"actor":"admin"}}`,
+		},
+		delivered: make(chan struct{}),
+	}
+
+	level := new(slog.LevelVar)
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{Subscriber: subscriber, Restarter: restarter, LogLevel: level})
+	done := make(chan error, 1)
+	go func() { done <- w.Start(context.Background()) }()
+
+	select {
+	case <-subscriber.delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages were not delivered")
+	}
+	w.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+
+	// api matched two tags but is restarted once; the event sent while
+	// paused is held, but the log level change is applied
+	restarted := restarter.Restarted()
+	if len(restarted) != 2 || restarted[0] != "dev/api" || restarted[1] != "dev/web" {
+		t.Errorf("expected dev/api and dev/web to be restarted once, got %v", restarted)
+	}
+	if restarter.causes[0].RunID != "42" || restarter.causes[0].Image != "ghcr.io/test/app" {
+		t.Errorf("unexpected restart cause %+v", restarter.causes[0])
+	}
+	if w.pause.Held() != 1 {
+		t.Errorf("expected 1 held message, got %d", w.pause.Held())
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("expected log level debug, got %s", level.Level())
+	}
+}
+
+func TestWorker_StartAgain(t *testing.T) {
+	// Each run registers its metrics afresh, so a worker can be started again
+	// and a second one started alongside
+	run := func(w *Worker, subscriber *fakeSubscriber, ctx context.Context, stop func()) {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() { done <- w.Start(ctx) }()
+		select {
+		case <-subscriber.delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("worker did not subscribe")
+		}
+		var b strings.Builder
+		metrics.Default.Write(&b)
+		if !strings.Contains(b.String(), "kuberollouttrigger_worker_paused 0") {
+			t.Errorf("expected the worker metrics to be exported while started, got:\n%s", b.String())
+		}
+		stop()
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	subscriber := &fakeSubscriber{delivered: make(chan struct{})}
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{Subscriber: subscriber, Restarter: &fakeRestarter{}})
+	ctx, cancel := context.WithCancel(context.Background())
+	run(w, subscriber, ctx, cancel)
+	subscriber.delivered = make(chan struct{})
+	run(w, subscriber, context.Background(), w.Stop)
+
+	other := &fakeSubscriber{delivered: make(chan struct{})}
+	w = NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{Subscriber: other, Restarter: &fakeRestarter{}})
+	run(w, other, context.Background(), w.Stop)
+}
+
+func TestWorker_ChannelRules(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:latest": {
+			{Namespace: "dev", Name: "api"},
+			{Namespace: "prod-eu", Name: "api"},
+		},
+	}}
+	rules, err := routing.ParseSubscriptions(`[{"channel": "test.prod", "namespaces": ["prod-*"]}]`)
+	if err != nil {
+		t.Fatalf("failed to parse channel rules: %v", err)
+	}
+	cfg := testWorkerConfig()
+	cfg.ChannelRules = rules
+	w := NewWorker(cfg, testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	event := eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}})
+	w.handle(context.Background(), "test.prod", event)
+	if restarted := restarter.Restarted(); len(restarted) != 1 || restarted[0] != "prod-eu/api" {
+		t.Errorf("expected only prod-eu/api to be restarted for test.prod, got %v", restarted)
+	}
+
+	// Channels without a rule are unrestricted
+	w.handle(context.Background(), "test.dev", event)
+	if restarted := restarter.Restarted(); len(restarted) != 3 {
+		t.Errorf("expected both deployments to be restarted for test.dev, got %v", restarted)
+	}
+
+	// Control messages are only accepted on VALKEY_CHANNEL
+	w.handle(context.Background(), "test.dev", eventMessage(t, payload.MessageTypePause, nil))
+	if w.pause.Paused() {
+		t.Error("expected a pause message on another channel to be ignored")
+	}
+	w.handle(context.Background(), "", eventMessage(t, payload.MessageTypePause, nil))
+	if !w.pause.Paused() {
+		t.Error("expected a pause message on VALKEY_CHANNEL to pause the worker")
+	}
+}
+
+func TestWorker_ResumeReplaysHeldMessages(t *testing.T) {
+	tags := []string{"v1", "v2", "v3", "v4", "v5"}
+	restarter := &fakeRestarter{delay: 50 * time.Millisecond, deployments: map[string][]MatchingDeployment{}}
+	for _, tag := range tags {
+		restarter.deployments["ghcr.io/test/app:"+tag] = []MatchingDeployment{{Namespace: "dev", Name: tag}}
+	}
+	cfg := testWorkerConfig()
+	cfg.MessageTimeout = 200 * time.Millisecond
+	cfg.MessageDedupeWindow = time.Minute
+	w := NewWorker(cfg, testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+	w.lifetime = context.Background()
+	w.chain = w.handler(testLogger(), metrics.NewRegistry())
+
+	event := func(tag string) string {
+		return eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{tag}})
+	}
+	w.chain(context.Background(), "test", eventMessage(t, payload.MessageTypePause, nil))
+	for _, tag := range tags {
+		w.chain(context.Background(), "test", event(tag))
+	}
+	if held := w.pause.Held(); held != len(tags) {
+		t.Fatalf("expected %d held messages, got %d", len(tags), held)
+	}
+
+	// Together the held events take longer than MESSAGE_TIMEOUT, but each
+	// gets its own, and none is a duplicate of its own arrival
+	w.chain(context.Background(), "test", eventMessage(t, payload.MessageTypeResume, nil))
+	want := []string{"dev/v1", "dev/v2", "dev/v3", "dev/v4", "dev/v5"}
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, want) {
+		t.Errorf("expected every held event to be replayed, got %v", restarted)
+	}
+
+	// A replayed event is deduplicated like one received when resumed
+	w.chain(context.Background(), "test", event("v1"))
+	if restarted := restarter.Restarted(); len(restarted) != len(want) {
+		t.Errorf("expected a duplicate of a replayed event to be dropped, got %v", restarted)
+	}
+}
+
+func TestWorker_PauseHoldsMessagesUntilResumed(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:latest": {{Namespace: "dev", Name: "api"}},
+	}}
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	restart, err := (&payload.Message{
+		Type:    payload.MessageTypeRestart,
+		Restart: &payload.RestartRequest{Namespace: "dev", Deployment: "web"},
+		Trigger: &payload.Trigger{Actor: "admin"},
+	}).ToJSON()
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypePause, nil))
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}}))
+	w.handle(context.Background(), "test", string(restart))
+	if restarted := restarter.Restarted(); len(restarted) != 0 || w.pause.Held() != 2 {
+		t.Fatalf("expected the event and restart to be held, got %v restarted and %d held", restarted, w.pause.Held())
+	}
+
+	// A second pause changes nothing, and resuming replays in arrival order
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypePause, nil))
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeResume, nil))
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, []string{"dev/api", "dev/web"}) {
+		t.Errorf("expected the held messages to be handled in order, got %v", restarted)
+	}
+	if w.pause.Paused() || w.pause.Held() != 0 {
+		t.Error("expected the worker to be resumed with nothing held")
+	}
+}
+
+func TestWorker_ControlMessagesAreNotDeduplicated(t *testing.T) {
+	cfg := testWorkerConfig()
+	cfg.MessageDedupeWindow = time.Minute
+	w := NewWorker(cfg, testLogger(), WorkerOptions{})
+	w.restarter = &fakeRestarter{}
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(w.restarter, time.Second, time.Minute, testLogger())
+	w.lifetime = context.Background()
+	w.chain = w.handler(testLogger(), metrics.NewRegistry())
+
+	w.chain(context.Background(), "test", eventMessage(t, payload.MessageTypePause, nil))
+	w.chain(context.Background(), "test", eventMessage(t, payload.MessageTypeResume, nil))
+	w.chain(context.Background(), "test", eventMessage(t, payload.MessageTypePause, nil))
+	if !w.pause.Paused() {
+		t.Error("expected a repeated pause within the dedupe window to pause the worker")
+	}
+}
+
+func TestWorker_TagRoutes(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:dev": {
+			{Namespace: "dev", Name: "api"},
+			{Namespace: "prod", Name: "api", Labels: map[string]string{"tier": "web"}},
+		},
+		"ghcr.io/test/app:v1": {
+			{Namespace: "dev", Name: "api"},
+			{Namespace: "prod", Name: "api", Labels: map[string]string{"tier": "web"}},
+			{Namespace: "prod", Name: "batch", Labels: map[string]string{"tier": "batch"}},
+		},
+	}}
+	routes, err := routing.Parse(`[{"tags": ["dev"], "namespaces": ["dev"]}, {"tags": ["v*"], "namespaces": ["prod"], "selector": "tier=web"}]`)
+	if err != nil {
+		t.Fatalf("failed to parse tag routes: %v", err)
+	}
+	cfg := testWorkerConfig()
+	cfg.TagRoutes = routes
+	w := NewWorker(cfg, testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	// Each tag only restarts the namespaces and labels it is routed to
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"dev"}}))
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, []string{"dev/api"}) {
+		t.Errorf("expected :dev to restart only dev/api, got %v", restarted)
+	}
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"v1"}}))
+	if restarted := restarter.Restarted(); !slices.Equal(restarted[1:], []string{"prod/api"}) {
+		t.Errorf("expected :v1 to restart only prod/api, got %v", restarted[1:])
+	}
+}
+
+func TestWorker_AuthorizedNamespaces(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:latest": {
+			{Namespace: "team-a-dev", Name: "api"},
+			{Namespace: "team-a-prod", Name: "api"},
+			{Namespace: "team-b-dev", Name: "api"},
+		},
+	}}
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	// The namespaces the authorizer narrowed the event to are all it restarts
+	msg, err := (&payload.Message{
+		Type:       payload.MessageTypeEvent,
+		Event:      &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}},
+		Trigger:    &payload.Trigger{Repository: "test-org/app"},
+		Namespaces: []string{"team-a-*"},
+	}).ToJSON()
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	w.handle(context.Background(), "test", string(msg))
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, []string{"team-a-dev/api", "team-a-prod/api"}) {
+		t.Errorf("expected only team-a namespaces to be restarted, got %v", restarted)
+	}
+}
+
+func TestWorker_DeferredRestart(t *testing.T) {
+	restarter := &fakeRestarter{
+		deployments: map[string][]MatchingDeployment{
+			"ghcr.io/test/app:latest": {{Namespace: "dev", Name: "api"}, {Namespace: "dev", Name: "web"}},
+		},
+		errs: map[string]error{
+			"dev/api": &k8s.DeferredError{Namespace: "dev", Name: "api", Reason: "PodDisruptionBudget api allows no disruptions"},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, 10*time.Millisecond, time.Minute, testLogger())
+
+	w.handle(ctx, "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}}))
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, []string{"dev/web"}) || w.deferred.Len() != 1 {
+		t.Fatalf("expected dev/web restarted and dev/api deferred, got %v with %d deferred", restarted, w.deferred.Len())
+	}
+
+	// Once the disruption clears, the retry restarts it with the event's cause
+	restarter.mu.Lock()
+	delete(restarter.errs, "dev/api")
+	restarter.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for w.deferred.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	restarter.mu.Lock()
+	defer restarter.mu.Unlock()
+	if !slices.Equal(restarter.restarted, []string{"dev/web", "dev/api"}) {
+		t.Fatalf("expected the deferred restart to complete, got %v", restarter.restarted)
+	}
+	if cause := restarter.causes[1]; cause.RunID != "42" || cause.Image != "ghcr.io/test/app" {
+		t.Errorf("unexpected cause of the deferred restart %+v", cause)
+	}
+}
+
+// fakeVerifier accepts the signatures of every digest but those in unsigned.
+type fakeVerifier struct {
+	unsigned map[string]bool
+
+	mu       sync.Mutex
+	verified []string
+}
+
+func (f *fakeVerifier) Verify(ctx context.Context, image, digest string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.verified = append(f.verified, image+"@"+digest)
+	if f.unsigned[digest] {
+		return fmt.Errorf("%s@%s: %w: image is not signed", image, digest, registry.ErrNoValidSignature)
+	}
+	return nil
+}
+
+// registryTransport answers manifest requests of the registry API with the
+// digest named after the image and tag.
+type registryTransport struct{}
+
+func (registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	repo, reference, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/manifests/")
+	header := http.Header{}
+	header.Set("Docker-Content-Digest", "sha256:"+strings.ReplaceAll(repo, "/", "-")+"-"+reference)
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+func TestWorker_SignatureFailureAbortsEvent(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:v1":     {{Namespace: "dev", Name: "api"}},
+		"ghcr.io/test/migrate:v1": {{Namespace: "dev", Name: "migrate"}},
+	}}
+	verifier := &fakeVerifier{unsigned: map[string]bool{"sha256:test-migrate-v1": true}}
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+	w.registry = registry.NewClient(registry.Options{Transport: registryTransport{}}, testLogger())
+	w.verifier = verifier
+
+	// The signed image matched, but the unsigned one stops the whole event
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Images: []payload.EventImage{
+		{Image: "ghcr.io/test/app", Tags: []string{"v1"}},
+		{Image: "ghcr.io/test/migrate", Tags: []string{"v1"}},
+	}}))
+	if restarted := restarter.Restarted(); len(restarted) != 0 {
+		t.Errorf("expected nothing restarted for an event with an unsigned image, got %v", restarted)
+	}
+	if want := []string{"ghcr.io/test/app@sha256:test-app-v1", "ghcr.io/test/migrate@sha256:test-migrate-v1"}; !slices.Equal(verifier.verified, want) {
+		t.Errorf("expected both images to be verified, got %v", verifier.verified)
+	}
+
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"v1"}}))
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, []string{"dev/api"}) {
+		t.Errorf("expected the signed image alone to be restarted, got %v", restarted)
+	}
+}
+
+func TestWorker_SelfRestartLast(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:latest": {
+			{Namespace: "apps", Name: "worker"},
+			{Namespace: "dev", Name: "api"},
+			{Namespace: "dev", Name: "web"},
+		},
+	}}
+	cfg := testWorkerConfig()
+	cfg.SelfNamespace = "apps"
+	cfg.SelfDeployment = "worker"
+	w := NewWorker(cfg, testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	w.handle(context.Background(), "", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}}))
+	want := []string{"dev/api", "dev/web", "apps/worker"}
+	if restarted := restarter.Restarted(); !slices.Equal(restarted, want) {
+		t.Errorf("expected the worker's own Deployment to be restarted last, got %v", restarted)
+	}
+
+	// A Deployment of the same name in another namespace is not the worker
+	targets, self := selfLast([]k8s.Target{
+		k8s.DeploymentTarget(MatchingDeployment{Namespace: "dev", Name: "worker"}),
+		k8s.DeploymentTarget(MatchingDeployment{Namespace: "prod", Name: "api"}),
+	}, "apps", "worker")
+	if self || targets[0].Key() != "dev/worker" {
+		t.Errorf("expected targets to be unchanged, got %v %v", self, targets)
+	}
+}
+
+func TestWorker_ContainerMatchesInCause(t *testing.T) {
+	restarter := &fakeRestarter{deployments: map[string][]MatchingDeployment{
+		"ghcr.io/test/app:latest": {{
+			Namespace: "dev", Name: "api", ContainerNames: []string{"api"},
+			Containers: []k8s.ContainerMatch{{Name: "api", Image: "ghcr.io/test/app:latest", ImageRef: "ghcr.io/test/app:latest"}},
+		}},
+		"ghcr.io/test/app:v2": {{
+			Namespace: "dev", Name: "api", ContainerNames: []string{"migrate"},
+			Containers: []k8s.ContainerMatch{{Name: "migrate", Image: "ghcr.io/test/app:v2", ImageRef: "ghcr.io/test/app:v2"}},
+		}},
+	}}
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	w.handle(context.Background(), "", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest", "v2"}}))
+	if len(restarter.causes) != 1 {
+		t.Fatalf("expected the Deployment to be restarted once, got %d restarts", len(restarter.causes))
+	}
+	want := []k8s.ContainerMatch{
+		{Name: "api", Image: "ghcr.io/test/app:latest", ImageRef: "ghcr.io/test/app:latest"},
+		{Name: "migrate", Image: "ghcr.io/test/app:v2", ImageRef: "ghcr.io/test/app:v2"},
+	}
+	if got := restarter.causes[0].Containers; !slices.Equal(got, want) {
+		t.Errorf("expected the cause to record every matched container, got %+v", got)
+	}
+}
+
+// slowRestarter holds each restart of a fakeRestarter for a while and
+// records the most restarts in flight at once.
+type slowRestarter struct {
+	*fakeRestarter
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (s *slowRestarter) Restart(ctx context.Context, t Target, cause *RestartCause) error {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		if m := s.maxInFlight.Load(); n <= m || s.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return s.fakeRestarter.Restart(ctx, t, cause)
+}
+
+func TestWorker_RestartConcurrency(t *testing.T) {
+	var matches []MatchingDeployment
+	for _, name := range []string{"a", "b", "c", "d", "e", "worker"} {
+		matches = append(matches, MatchingDeployment{Namespace: "dev", Name: name})
+	}
+	restarter := &slowRestarter{fakeRestarter: &fakeRestarter{
+		deployments: map[string][]MatchingDeployment{"ghcr.io/test/app:latest": matches},
+		errs:        map[string]error{"dev/c": fmt.Errorf("admission webhook denied the request")},
+	}}
+	cfg := testWorkerConfig()
+	cfg.RestartConcurrency = 2
+	cfg.SelfNamespace = "dev"
+	cfg.SelfDeployment = "worker"
+	w := NewWorker(cfg, testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+
+	group := newRolloutGroup()
+	for _, m := range matches {
+		group.add(k8s.DeploymentTarget(m), "ghcr.io/test/app")
+	}
+	outcome := w.restartGroup(context.Background(), group, &payload.Trigger{}, testLogger())
+	if outcome.restarted != 5 || outcome.failed != 1 {
+		t.Errorf("expected 5 restarted and 1 failed, got %+v", outcome)
+	}
+	if got := restarter.maxInFlight.Load(); got != 2 {
+		t.Errorf("expected at most 2 restarts in flight, got %d", got)
+	}
+	if restarted := restarter.Restarted(); restarted[len(restarted)-1] != "dev/worker" {
+		t.Errorf("expected the worker's own Deployment to be restarted after the others, got %v", restarted)
+	}
+}
+
+func TestWorker_RestartErrorClasses(t *testing.T) {
+	restarter := &fakeRestarter{
+		deployments: map[string][]MatchingDeployment{
+			"ghcr.io/test/app:latest": {
+				{Namespace: "dev", Name: "api"},
+				{Namespace: "dev", Name: "busy"},
+				{Namespace: "dev", Name: "gone"},
+				{Namespace: "dev", Name: "locked"},
+			},
+		},
+		errs: map[string]error{
+			"dev/busy":   fmt.Errorf("failed to patch deployment dev/busy: %w", k8s.ErrThrottled),
+			"dev/gone":   fmt.Errorf("failed to patch deployment dev/gone: %w", k8s.ErrNotFound),
+			"dev/locked": fmt.Errorf("failed to patch deployment dev/locked: %w", k8s.ErrForbidden),
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Hour, time.Hour, testLogger())
+
+	group := newRolloutGroup()
+	for _, m := range restarter.deployments["ghcr.io/test/app:latest"] {
+		group.add(k8s.DeploymentTarget(m), "ghcr.io/test/app")
+	}
+	outcome := w.restartGroup(ctx, group, &payload.Trigger{}, testLogger())
+
+	// The throttled restart is retried, the deleted Deployment skipped and
+	// only the forbidden restart fails
+	want := rolloutOutcome{restarted: 1, deferred: 1, failed: 1, skipped: 1}
+	if outcome != want {
+		t.Errorf("expected outcome %+v, got %+v", want, outcome)
+	}
+	if w.deferred.Len() != 1 {
+		t.Errorf("expected the throttled restart to be queued, got %d", w.deferred.Len())
+	}
+}
+
+func TestWorker_NamespaceDigestPolicy(t *testing.T) {
+	restarter := &fakeRestarter{
+		deployments: map[string][]MatchingDeployment{
+			"ghcr.io/test/app:latest": {
+				{Namespace: "dev", Name: "api"},
+				{Namespace: "prod", Name: "api"},
+				{Namespace: "staging", Name: "api"},
+				{Namespace: "unreadable", Name: "api"},
+			},
+		},
+		annotations: map[string]map[string]string{
+			"prod":    {k8s.RequireDigestAnnotation: "true"},
+			"staging": {k8s.RequireDigestAnnotation: "yes"},
+		},
+	}
+	w := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	w.restarter = restarter
+	w.pause = &pauseGate{}
+	w.deferred = k8s.NewDeferredQueue(restarter, time.Second, time.Minute, testLogger())
+	w.digestPolicy = newDigestPolicy(restarter.NamespaceAnnotations, testLogger())
+
+	// Without a digest, annotated, misannotated and unreadable namespaces
+	// are all excluded
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}}))
+	if restarted := restarter.Restarted(); len(restarted) != 1 || restarted[0] != "dev/api" {
+		t.Errorf("expected only dev/api to be restarted without a digest, got %v", restarted)
+	}
+	if excluded := w.digestPolicy.Excluded(); excluded != 3 {
+		t.Errorf("expected 3 exclusions, got %d", excluded)
+	}
+
+	w.handle(context.Background(), "test", eventMessage(t, payload.MessageTypeEvent, &payload.Event{Image: "ghcr.io/test/app", Tags: []string{"latest"}, Digest: "sha256:" + strings.Repeat("a", 64)}))
+	restarted := restarter.Restarted()
+	if !slices.Contains(restarted[1:], "prod/api") {
+		t.Errorf("expected prod/api to be restarted for an event with a digest, got %v", restarted)
+	}
+	if excluded := w.digestPolicy.Excluded(); excluded != 3 {
+		t.Errorf("expected no further exclusions, got %d", excluded)
+	}
+
+	// Without the policy nothing is excluded
+	var policy *digestPolicy
+	if policy.Excludes(context.Background(), "prod", "") {
+		t.Error("expected a nil policy to exclude nothing")
+	}
+}
+
+func TestRunBackfill_VerifiesSignatures(t *testing.T) {
+	stale := func(name, digest string) StaleDeployment {
+		return StaleDeployment{
+			MatchingDeployment: MatchingDeployment{Namespace: "dev", Name: name, ContainerNames: []string{name}},
+			Image:              "ghcr.io/test/app",
+			Tag:                "latest",
+			Digest:             digest,
+		}
+	}
+	restarter := &fakeRestarter{stale: []StaleDeployment{
+		stale("signed", "sha256:signed"),
+		stale("unsigned", "sha256:unsigned"),
+		stale("unsigned-too", "sha256:unsigned"),
+	}}
+	var verified []string
+	verify := func(ctx context.Context, image, digest string) error {
+		verified = append(verified, digest)
+		if digest != "sha256:signed" {
+			return errors.New("no matching signatures")
+		}
+		return nil
+	}
+
+	runBackfill(context.Background(), testWorkerConfig(), restarter, nil, verify, nil, nil, &pauseGate{}, testLogger())
+
+	if want := []string{"dev/signed"}; !slices.Equal(restarter.Restarted(), want) {
+		t.Errorf("expected only the signed image to be backfilled, got %v", restarter.Restarted())
+	}
+	if want := []string{"sha256:signed", "sha256:unsigned"}; !slices.Equal(verified, want) {
+		t.Errorf("expected each digest to be verified once, got %v", verified)
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	// Neither connects to Valkey or Kubernetes once stopped
+	worker := NewWorker(testWorkerConfig(), testLogger(), WorkerOptions{})
+	worker.Stop()
+	worker.Stop()
+	if err := worker.Start(context.Background()); err != nil {
+		t.Errorf("expected a stopped worker to return without error, got %v", err)
+	}
+
+	web := NewWeb(&WebConfig{}, testLogger(), WebOptions{})
+	web.Stop()
+	if err := web.Start(context.Background()); err != nil {
+		t.Errorf("expected a stopped web to return without error, got %v", err)
+	}
+}
+
+func TestParseConfig_InvalidConfigClass(t *testing.T) {
+	t.Setenv("VALKEY_ADDR", "")
+	if _, err := ParseWebConfig(nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected a web configuration error to be ErrInvalidConfig, got %v", err)
+	}
+	_, err := ParseWorkerConfig([]string{"--restart-concurrency", "0"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected a worker configuration error to be ErrInvalidConfig, got %v", err)
+	}
+	if _, want := config.ParseWorkerConfig([]string{"--restart-concurrency", "0"}); err.Error() != want.Error() {
+		t.Errorf("expected the configuration error message to be unchanged, got %q", err)
+	}
+}
+
+func TestGitHubReport(t *testing.T) {
+	trigger := &payload.Trigger{Repository: "test-org/app", SHA: "abc123", RunID: "42"}
+	report := githubReport(trigger, []notify.Restart{
+		{Kind: "Deployment", Namespace: "dev", Name: "api"},
+		{Kind: "Rollout", Namespace: "dev", Name: "web"},
+	}, rolloutOutcome{restarted: 2, failed: 1})
+	if report.Repository != "test-org/app" || report.SHA != "abc123" || report.RunID != "42" || report.Failed != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Restarted) != 2 || report.Restarted[0] != "Deployment dev/api" || report.Restarted[1] != "Rollout dev/web" {
+		t.Errorf("unexpected restarted workloads %v", report.Restarted)
+	}
+}
+
+func TestCheckKubernetesCredentials(t *testing.T) {
+	clientset := fake.NewClientset()
+	restarter := k8s.NewRestarterWithClient(clientset, testLogger())
+	if err := checkKubernetesCredentials(restarter, testLogger()); err != nil {
+		t.Fatalf("expected accepted credentials to pass, got %v", err)
+	}
+
+	// An API server that cannot be reached yet does not stop the worker
+	clientset.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	if err := checkKubernetesCredentials(restarter, testLogger()); err != nil {
+		t.Errorf("expected an unreachable API server to be tolerated, got %v", err)
+	}
+
+	clientset.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewUnauthorized("token expired")
+	})
+	if err := checkKubernetesCredentials(restarter, testLogger()); !errors.Is(err, ErrKubernetesClient) || !errors.Is(err, k8s.ErrUnauthorized) {
+		t.Errorf("expected rejected credentials to fail with ErrKubernetesClient, got %v", err)
+	}
+}